@@ -0,0 +1,425 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	mathrand "math/rand"
+	"time"
+
+	"f1-fantasy-app/database"
+	"f1-fantasy-app/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Modos de subasta configurables por liga
+const (
+	auctionModeOpen         = "open"                // Pujas visibles, el ganador paga su puja
+	auctionModeSealedFirst  = "sealed_first_price"  // Pujas ocultas, el ganador paga su puja
+	auctionModeSealedSecond = "sealed_second_price" // Pujas ocultas, el ganador paga la segunda puja (Vickrey)
+)
+
+// isValidAuctionMode comprueba si un modo de subasta es válido
+func isValidAuctionMode(mode string) bool {
+	switch mode {
+	case auctionModeOpen, auctionModeSealedFirst, auctionModeSealedSecond:
+		return true
+	}
+	return false
+}
+
+// leagueAuctionMode devuelve el modo de subasta de una liga (open por defecto)
+func leagueAuctionMode(tx *gorm.DB, leagueID uint) string {
+	var league models.League
+	if err := tx.Select("id", "auction_mode").First(&league, leagueID).Error; err != nil || !isValidAuctionMode(league.AuctionMode) {
+		return auctionModeOpen
+	}
+	return league.AuctionMode
+}
+
+// visibleBids devuelve las pujas que puede ver un usuario. En los modos sellados
+// solo ve la suya hasta que la subasta se finaliza.
+func visibleBids(bids []Bid, mode string, viewerID uint) []Bid {
+	if mode == auctionModeOpen {
+		return bids
+	}
+	visible := []Bid{}
+	for _, bid := range bids {
+		if viewerID != 0 && bid.PlayerID == viewerID {
+			visible = append(visible, bid)
+		}
+	}
+	return visible
+}
+
+// hideSealedBids reemplaza las pujas de la subasta por las que puede ver el
+// usuario. Devuelve el modo de la liga y el número total de pujas.
+func hideSealedBids(auction *Auction, viewerID uint) (string, int) {
+	mode := leagueAuctionMode(database.DB, auction.LeagueID)
+	var bids []Bid
+	if len(auction.Bids) > 0 {
+		_ = json.Unmarshal(auction.Bids, &bids)
+	}
+	if mode != auctionModeOpen {
+		auction.Bids, _ = json.Marshal(visibleBids(bids, mode, viewerID))
+	}
+	return mode, len(bids)
+}
+
+// auctionClearingPrice calcula lo que paga el ganador según el modo de subasta.
+// En segundo precio paga la segunda puja más alta, con el valor de mercado del
+// elemento como precio de reserva y sin superar nunca su propia puja.
+func auctionClearingPrice(mode string, bids []Bid, winner Bid, reserve float64) float64 {
+	if mode != auctionModeSealedSecond {
+		return winner.Valor
+	}
+	price := reserve
+	winnerCounted := false
+	for _, bid := range bids {
+		if !winnerCounted && bid == winner {
+			winnerCounted = true
+			continue
+		}
+		if bid.Valor > price {
+			price = bid.Valor
+		}
+	}
+	if price > winner.Valor {
+		price = winner.Valor
+	}
+	return price
+}
+
+// auctionItem agrupa los datos comunes de un elemento subastable, sea piloto,
+// track engineer, chief engineer o team constructor.
+type auctionItem struct {
+	Table         string  // tabla *_by_league del elemento
+	ID            uint    // ID en la tabla *_by_league
+	GlobalID      uint    // ID en pilots, track_engineers, chief_engineers o teamconstructor
+	LeagueID      uint    // Liga a la que pertenece
+	OwnerID       uint    // Propietario actual (0 si está libre)
+	Value         float64 // Valor de mercado del elemento
+	ClausulaValue *float64
+}
+
+// auctionSettlement es el resultado de finalizar una subasta. Si ningún postor
+// pudo quedarse el elemento, WinnerID es 0 y Failure explica el motivo.
+type auctionSettlement struct {
+	AuctionID uint    `json:"auction_id"`
+	ItemType  string  `json:"item_type"`
+	ItemID    uint    `json:"item_id"`
+	GlobalID  uint    `json:"global_id"`
+	WinnerID  uint    `json:"winner"`
+	Price     float64 `json:"price"`
+	Failure   string  `json:"failure,omitempty"`
+}
+
+// loadAuctionItem carga el elemento *_by_league de una subasta para cualquier ItemType
+func loadAuctionItem(tx *gorm.DB, itemType string, itemID uint) (auctionItem, error) {
+	item := auctionItem{ID: itemID}
+	switch itemType {
+	case "pilot":
+		var pbl models.PilotByLeague
+		if err := tx.First(&pbl, itemID).Error; err != nil {
+			return item, fmt.Errorf("pilot_by_league %d no encontrado", itemID)
+		}
+		var pilot models.Pilot
+		tx.First(&pilot, pbl.PilotID)
+		item.Table = pbl.TableName()
+		item.GlobalID, item.LeagueID, item.OwnerID = pbl.PilotID, pbl.LeagueID, pbl.OwnerID
+		item.Value, item.ClausulaValue = pilot.Value, pbl.ClausulaValue
+	case "track_engineer":
+		var teb models.TrackEngineerByLeague
+		if err := tx.First(&teb, itemID).Error; err != nil {
+			return item, fmt.Errorf("track_engineer_by_league %d no encontrado", itemID)
+		}
+		var te models.TrackEngineer
+		tx.First(&te, teb.TrackEngineerID)
+		item.Table = teb.TableName()
+		item.GlobalID, item.LeagueID, item.OwnerID = teb.TrackEngineerID, teb.LeagueID, teb.OwnerID
+		item.Value, item.ClausulaValue = te.Value, teb.ClausulaValue
+	case "chief_engineer":
+		var ceb models.ChiefEngineerByLeague
+		if err := tx.First(&ceb, itemID).Error; err != nil {
+			return item, fmt.Errorf("chief_engineer_by_league %d no encontrado", itemID)
+		}
+		var ce models.ChiefEngineer
+		tx.First(&ce, ceb.ChiefEngineerID)
+		item.Table = ceb.TableName()
+		item.GlobalID, item.LeagueID, item.OwnerID = ceb.ChiefEngineerID, ceb.LeagueID, ceb.OwnerID
+		item.Value, item.ClausulaValue = ce.Value, ceb.ClausulaValue
+	case "team_constructor":
+		var tcb models.TeamConstructorByLeague
+		if err := tx.First(&tcb, itemID).Error; err != nil {
+			return item, fmt.Errorf("team_constructor_by_league %d no encontrado", itemID)
+		}
+		var tc models.TeamConstructor
+		tx.First(&tc, tcb.TeamConstructorID)
+		item.Table = tcb.TableName()
+		item.GlobalID, item.LeagueID, item.OwnerID = tcb.TeamConstructorID, tcb.LeagueID, tcb.OwnerID
+		item.Value, item.ClausulaValue = tc.Value, tcb.ClausulaValue
+	default:
+		return item, fmt.Errorf("item_type no válido: %s", itemType)
+	}
+	return item, nil
+}
+
+// ownedItemsField devuelve la columna JSON Owned* de PlayerByLeague para un ItemType
+func ownedItemsField(playerLeague *models.PlayerByLeague, itemType string) *string {
+	switch itemType {
+	case "pilot":
+		return &playerLeague.OwnedPilots
+	case "track_engineer":
+		return &playerLeague.OwnedTrackEngineers
+	case "chief_engineer":
+		return &playerLeague.OwnedChiefEngineers
+	case "team_constructor":
+		return &playerLeague.OwnedTeamConstructors
+	}
+	return nil
+}
+
+// addOwnedItem añade un ID al array JSON de elementos en propiedad si no está ya
+func addOwnedItem(ownedJSON string, id uint) string {
+	var owned []uint
+	if ownedJSON != "" && ownedJSON != "[]" {
+		_ = json.Unmarshal([]byte(ownedJSON), &owned)
+	}
+	if contains(owned, id) {
+		return ownedJSON
+	}
+	owned = append(owned, id)
+	result, _ := json.Marshal(owned)
+	return string(result)
+}
+
+// removeOwnedItem elimina un ID del array JSON de elementos en propiedad
+func removeOwnedItem(ownedJSON string, id uint) string {
+	var owned []uint
+	if ownedJSON != "" && ownedJSON != "[]" {
+		_ = json.Unmarshal([]byte(ownedJSON), &owned)
+	}
+	nuevaOwned := make([]uint, 0, len(owned))
+	for _, oid := range owned {
+		if oid != id {
+			nuevaOwned = append(nuevaOwned, oid)
+		}
+	}
+	result, _ := json.Marshal(nuevaOwned)
+	return string(result)
+}
+
+// winningBid devuelve la puja más alta; en caso de empate gana la primera en llegar
+func winningBid(bids []Bid) Bid {
+	maxBid := bids[0]
+	for _, bid := range bids {
+		if bid.Valor > maxBid.Valor {
+			maxBid = bid
+		}
+	}
+	return maxBid
+}
+
+// withoutBid devuelve las pujas sin la primera que coincida con bid
+func withoutBid(bids []Bid, bid Bid) []Bid {
+	rest := make([]Bid, 0, len(bids))
+	removed := false
+	for _, b := range bids {
+		if !removed && b == bid {
+			removed = true
+			continue
+		}
+		rest = append(rest, b)
+	}
+	return rest
+}
+
+// failAuction cierra una subasta sin adjudicarla: guarda el resultado con el
+// motivo y la elimina, de modo que el elemento vuelve a estar libre y el
+// dinero de los postores deja de estar comprometido.
+func failAuction(tx *gorm.DB, auction Auction, mode string, item auctionItem, reason string) (*auctionSettlement, error) {
+	log.Printf("[SETTLE] Subasta %d cerrada sin adjudicar: %s", auction.ID, reason)
+	if err := tx.Create(&models.AuctionResult{
+		AuctionID: auction.ID,
+		LeagueID:  auction.LeagueID,
+		ItemType:  auction.ItemType,
+		ItemID:    auction.ItemID,
+		Mode:      mode,
+		Bids:      auction.Bids,
+		Reserve:   item.Value,
+		SettledAt: time.Now(),
+		Failure:   reason,
+	}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Delete(&Auction{}, auction.ID).Error; err != nil {
+		return nil, err
+	}
+	return &auctionSettlement{
+		AuctionID: auction.ID,
+		ItemType:  auction.ItemType,
+		ItemID:    auction.ItemID,
+		GlobalID:  item.GlobalID,
+		Failure:   reason,
+	}, nil
+}
+
+// settleAuction finaliza una subasta de cualquier ItemType en una sola transacción:
+// elige al ganador a partir de las pujas de la propia subasta, le descuenta el
+// dinero, transfiere el elemento, actualiza su JSON Owned*, fija la cláusula,
+// guarda el histórico y elimina la subasta. Devuelve nil si no había pujas.
+// Si el mejor postor no puede pagar se adjudica al siguiente; si nadie puede, o
+// el elemento ya tiene propietario, la subasta se cierra sin ganador (Failure).
+func settleAuction(auction Auction) (*auctionSettlement, error) {
+	log.Printf("[SETTLE] Finalizando subasta ID=%d, Type=%s, ItemID=%d", auction.ID, auction.ItemType, auction.ItemID)
+
+	var result *auctionSettlement
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Releer la subasta bloqueándola para que no se finalice dos veces
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&auction, auction.ID).Error; err != nil {
+			return fmt.Errorf("subasta %d no encontrada", auction.ID)
+		}
+
+		var bids []Bid
+		if len(auction.Bids) > 0 {
+			if err := json.Unmarshal(auction.Bids, &bids); err != nil {
+				return fmt.Errorf("parseando bids de subasta %d: %v", auction.ID, err)
+			}
+		}
+		log.Printf("[SETTLE] Bids encontrados: %d - %+v", len(bids), bids)
+
+		if len(bids) == 0 {
+			log.Printf("[SETTLE] No hay pujas en subasta %d, se elimina sin asignar", auction.ID)
+			return tx.Delete(&Auction{}, auction.ID).Error
+		}
+
+		item, err := loadAuctionItem(tx, auction.ItemType, auction.ItemID)
+		if err != nil {
+			return err
+		}
+		mode := leagueAuctionMode(tx, auction.LeagueID)
+		if item.OwnerID != 0 {
+			result, err = failAuction(tx, auction, mode, item, fmt.Sprintf("%s %d ya tiene propietario (%d)", auction.ItemType, auction.ItemID, item.OwnerID))
+			return err
+		}
+
+		// Adjudicar al mejor postor que pueda pagar; el precio se recalcula
+		// según el modo de la liga con las pujas que quedan
+		var (
+			maxBid       Bid
+			price        float64
+			playerLeague models.PlayerByLeague
+			found        bool
+		)
+		for remaining := bids; len(remaining) > 0; remaining = withoutBid(remaining, maxBid) {
+			maxBid = winningBid(remaining)
+			price = auctionClearingPrice(mode, remaining, maxBid, item.Value)
+			log.Printf("[SETTLE] Modo %s: puja ganadora %.2f, precio %.2f", mode, maxBid.Valor, price)
+
+			playerLeague = models.PlayerByLeague{}
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("player_id = ? AND league_id = ?", maxBid.PlayerID, auction.LeagueID).First(&playerLeague).Error; err != nil {
+				log.Printf("[SETTLE] Jugador %d no encontrado en liga %d, se pasa a la siguiente puja", maxBid.PlayerID, auction.LeagueID)
+				continue
+			}
+			if playerLeague.Money < price {
+				log.Printf("[SETTLE] Jugador %d no tiene suficiente dinero (%.2f < %.2f), se pasa a la siguiente puja", maxBid.PlayerID, playerLeague.Money, price)
+				continue
+			}
+			found = true
+			break
+		}
+		if !found {
+			result, err = failAuction(tx, auction, mode, item, "ningún postor tiene saldo suficiente")
+			return err
+		}
+
+		// Descontar dinero, sumar valor de equipo y añadir a Owned*
+		if err := moveMoney(tx, playerLeague.LeagueID, &playerLeague, nil, price, auction.ItemType, auction.ItemID, ledgerReasonAuction); err != nil {
+			return err
+		}
+		playerLeague.TeamValue += item.Value
+		owned := ownedItemsField(&playerLeague, auction.ItemType)
+		*owned = addOwnedItem(*owned, item.GlobalID)
+		if err := tx.Save(&playerLeague).Error; err != nil {
+			return err
+		}
+
+		// Cláusula: al menos lo pagado, con expiración 14 días tras la subasta
+		clausulaValue := price
+		if item.ClausulaValue != nil && *item.ClausulaValue > clausulaValue {
+			clausulaValue = *item.ClausulaValue
+		}
+		settings := loadLeagueSettings(tx, auction.LeagueID)
+		clausulaExpira := clausulaExpiry(settings, auction.EndTime)
+
+		// Generar oferta de la FIA automáticamente después de la compra, con la
+		// semilla comprometida de ofertas FIA de la liga
+		var fiaBidsJSON []byte
+		if err := withFIADraw(tx, auction.LeagueID, func(rng *mathrand.Rand) ([]drawFIAOffer, error) {
+			offer := generateFIAOffer(rng, settings, price)
+			fiaBidsJSON, _ = json.Marshal([]Bid{{PlayerID: FIA_PLAYER_ID, Valor: offer}})
+			return []drawFIAOffer{{ItemType: auction.ItemType, ItemID: auction.ItemID, SaleValue: price, Offer: offer, MinMultiplier: settings.FIAMinMultiplier, MaxMultiplier: settings.FIAMaxMultiplier}}, nil
+		}); err != nil {
+			return err
+		}
+
+		if err := tx.Table(item.Table).Where("id = ?", item.ID).Updates(map[string]interface{}{
+			"owner_id":       maxBid.PlayerID,
+			"clausula_value": clausulaValue,
+			"clausulatime":   clausulaExpira,
+			"bids":           fiaBidsJSON,
+		}).Error; err != nil {
+			return err
+		}
+
+		// Guardar histórico de fichaje (subasta)
+		if auction.ItemType == "pilot" {
+			errHist := tx.Exec(`INSERT INTO pilot_value_history (pilot_id, pilot_by_league_id, league_id, player_id, valor_pagado, fecha, tipo, counterparty_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, item.GlobalID, item.ID, item.LeagueID, maxBid.PlayerID, price, time.Now(), "fichaje", 0).Error
+			if errHist != nil {
+				log.Printf("[HISTORICO] Error guardando en pilot_value_history: %v", errHist)
+			}
+		}
+
+		// Guardar las pujas y el precio antes de borrar la subasta
+		if err := tx.Create(&models.AuctionResult{
+			AuctionID:  auction.ID,
+			LeagueID:   auction.LeagueID,
+			ItemType:   auction.ItemType,
+			ItemID:     auction.ItemID,
+			Mode:       mode,
+			Bids:       auction.Bids,
+			Reserve:    item.Value,
+			WinnerID:   maxBid.PlayerID,
+			WinningBid: maxBid.Valor,
+			Price:      price,
+			SettledAt:  time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Delete(&Auction{}, auction.ID).Error; err != nil {
+			return err
+		}
+
+		result = &auctionSettlement{
+			AuctionID: auction.ID,
+			ItemType:  auction.ItemType,
+			ItemID:    auction.ItemID,
+			GlobalID:  item.GlobalID,
+			WinnerID:  maxBid.PlayerID,
+			Price:     price,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result == nil || result.Failure != "" {
+		return result, nil
+	}
+
+	log.Printf("[SETTLE] Subasta finalizada exitosamente: %s ID %d -> Player %d", auction.ItemType, auction.ItemID, result.WinnerID)
+	return result, nil
+}
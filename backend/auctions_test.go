@@ -0,0 +1,45 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWithoutBid(t *testing.T) {
+	bids := []Bid{{1, 100}, {2, 80}, {1, 100}}
+	got := withoutBid(bids, Bid{1, 100})
+	want := []Bid{{2, 80}, {1, 100}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("withoutBid = %+v, want %+v", got, want)
+	}
+	if len(bids) != 3 {
+		t.Fatalf("withoutBid modificó las pujas originales: %+v", bids)
+	}
+}
+
+// Si el mejor postor no puede pagar, el siguiente paga el precio que resulta
+// de las pujas restantes, no el que se calculó con la del primero
+func TestSettlementFallbackPrice(t *testing.T) {
+	bids := []Bid{{1, 100}, {2, 80}, {3, 60}}
+	const reserve = 50
+
+	first := winningBid(bids)
+	if first.PlayerID != 1 {
+		t.Fatalf("ganador = %d, want 1", first.PlayerID)
+	}
+	if price := auctionClearingPrice(auctionModeSealedSecond, bids, first, reserve); price != 80 {
+		t.Fatalf("precio del primero = %.0f, want 80", price)
+	}
+
+	remaining := withoutBid(bids, first)
+	next := winningBid(remaining)
+	if next.PlayerID != 2 {
+		t.Fatalf("siguiente ganador = %d, want 2", next.PlayerID)
+	}
+	if price := auctionClearingPrice(auctionModeSealedSecond, remaining, next, reserve); price != 60 {
+		t.Fatalf("precio del siguiente = %.0f, want 60", price)
+	}
+	if price := auctionClearingPrice(auctionModeOpen, remaining, next, reserve); price != 80 {
+		t.Fatalf("precio abierto del siguiente = %.0f, want 80", price)
+	}
+}
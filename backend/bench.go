@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"f1-fantasy-app/database"
+	"f1-fantasy-app/models"
+)
+
+// Suplentes que puede tener una alineación en cada sesión
+const benchSlotsPerSession = 2
+
+// benchSessions son las sesiones con banquillo, en el orden de la alineación
+var benchSessions = []string{"race", "qualy", "practice"}
+
+// benchSubstitution es un cambio automático: el suplente entra por un titular
+// que no tiene resultado en su sesión
+type benchSubstitution struct {
+	Session string `json:"session"`
+	OutID   uint   `json:"out_id"` // pilot_by_league_id del titular
+	InID    uint   `json:"in_id"`  // pilot_by_league_id del suplente
+	OutName string `json:"out_name"`
+	InName  string `json:"in_name"`
+}
+
+// lineupBench devuelve los suplentes ordenados de cada sesión
+func lineupBench(lineup models.Lineup) map[string][]uint {
+	bench := map[string][]uint{}
+	if len(lineup.BenchPilots) > 0 {
+		if err := json.Unmarshal(lineup.BenchPilots, &bench); err != nil {
+			log.Printf("[BENCH] Error parseando BenchPilots de la alineación %d: %v", lineup.ID, err)
+		}
+	}
+	return bench
+}
+
+// validateBench comprueba el banquillo: sesiones conocidas, como mucho
+// benchSlotsPerSession suplentes por sesión y ninguno repetido ni titular
+func validateBench(bench map[string][]uint, starters ...[]uint) error {
+	used := make(map[uint]bool)
+	for _, ids := range starters {
+		for _, id := range ids {
+			used[id] = true
+		}
+	}
+	for session, ids := range bench {
+		if !containsString(benchSessions, session) {
+			return fmt.Errorf("Sesión de banquillo inválida: %s", session)
+		}
+		if len(ids) > benchSlotsPerSession {
+			return fmt.Errorf("Como mucho %d suplentes en %s", benchSlotsPerSession, session)
+		}
+		for _, id := range ids {
+			if used[id] {
+				return fmt.Errorf("El piloto %d ya está en la alineación", id)
+			}
+			used[id] = true
+		}
+	}
+	return nil
+}
+
+// containsString indica si una lista contiene un valor
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// benchCard es un piloto por liga con su carta global
+type benchCard struct {
+	ID    uint
+	Pilot models.Pilot
+}
+
+// loadBenchCard carga un piloto por liga y su carta global
+func loadBenchCard(pilotByLeagueID uint) (benchCard, bool) {
+	var pbl models.PilotByLeague
+	var pilot models.Pilot
+	if database.DB.First(&pbl, pilotByLeagueID).Error != nil || database.DB.First(&pilot, pbl.PilotID).Error != nil {
+		return benchCard{}, false
+	}
+	return benchCard{ID: pilotByLeagueID, Pilot: pilot}, true
+}
+
+// hasSessionResult indica si la carta tiene fila de resultado en la sesión del GP
+func hasSessionResult(session string, pilotID uint, gpIndex uint64) bool {
+	var count int64
+	database.DB.Table(sessionTables[session]).Where("pilot_id = ? AND gp_index = ?", pilotID, gpIndex).Count(&count)
+	return count > 0
+}
+
+// applyBenchSubstitutions devuelve la alineación con la que se puntúa: cada
+// titular sin resultado en su sesión se cambia por el primer suplente de esa
+// sesión con carta del mismo modo y con resultado. Mientras la sesión no tenga
+// resultados no se hace ningún cambio.
+func applyBenchSubstitutions(lineup models.Lineup) (models.Lineup, []benchSubstitution) {
+	bench := lineupBench(lineup)
+	if len(bench) == 0 {
+		return lineup, nil
+	}
+
+	slots := map[string]*[]byte{"race": &lineup.RacePilots, "qualy": &lineup.QualifyingPilots, "practice": &lineup.PracticePilots}
+	var subs []benchSubstitution
+	for _, session := range benchSessions {
+		if len(bench[session]) == 0 {
+			continue
+		}
+		var sessionResults int64
+		database.DB.Table(sessionTables[session]).Where("gp_index = ?", lineup.GPIndex).Count(&sessionResults)
+		if sessionResults == 0 {
+			continue
+		}
+
+		var starters []uint
+		if raw := *slots[session]; len(raw) > 0 {
+			json.Unmarshal(raw, &starters)
+		}
+		available := append([]uint{}, bench[session]...)
+		changed := false
+		for i, starterID := range starters {
+			starter, ok := loadBenchCard(starterID)
+			if ok && hasSessionResult(session, starter.Pilot.ID, lineup.GPIndex) {
+				continue
+			}
+			for j, benchID := range available {
+				card, ok := loadBenchCard(benchID)
+				if !ok || pilotSessionName(card.Pilot.Mode) != session || !hasSessionResult(session, card.Pilot.ID, lineup.GPIndex) {
+					continue
+				}
+				subs = append(subs, benchSubstitution{
+					Session: session,
+					OutID:   starterID,
+					InID:    benchID,
+					OutName: starter.Pilot.DriverName,
+					InName:  card.Pilot.DriverName,
+				})
+				starters[i] = benchID
+				available = append(available[:j], available[j+1:]...)
+				changed = true
+				break
+			}
+		}
+		if changed {
+			*slots[session], _ = json.Marshal(starters)
+		}
+	}
+	return lineup, subs
+}
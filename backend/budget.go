@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+
+	"f1-fantasy-app/models"
+
+	"gorm.io/gorm"
+)
+
+// Origen de un compromiso de dinero
+const (
+	commitmentAuction = "auction" // Puja en una subasta activa
+	commitmentOffer   = "offer"   // Oferta directa (make-offer) a otro manager
+)
+
+// fundsCommitment es una puja u oferta abierta que reserva dinero de un manager
+type fundsCommitment struct {
+	Source   string  `json:"source"`
+	ItemType string  `json:"item_type"`
+	ItemID   uint    `json:"item_id"`
+	Amount   float64 `json:"amount"`
+}
+
+// budgetSummary resume el dinero de un manager en una liga
+type budgetSummary struct {
+	Money       float64           `json:"money"`
+	Committed   float64           `json:"committed"`
+	Available   float64           `json:"available"`
+	Commitments []fundsCommitment `json:"commitments"`
+}
+
+// playerCommitments devuelve todas las pujas en subastas aún sin finalizar y
+// las ofertas directas abiertas de un manager en una liga. Las subastas
+// vencidas siguen reservando dinero hasta que el planificador las resuelve.
+func playerCommitments(tx *gorm.DB, leagueID, playerID uint) []fundsCommitment {
+	commitments := []fundsCommitment{}
+
+	var auctions []Auction
+	tx.Where("league_id = ?", leagueID).Find(&auctions)
+	for _, auction := range auctions {
+		if amount, ok := bidOf(auction.Bids, playerID); ok {
+			commitments = append(commitments, fundsCommitment{commitmentAuction, auction.ItemType, auction.ItemID, amount})
+		}
+	}
+
+	tables := map[string]string{
+		"pilot":            models.PilotByLeague{}.TableName(),
+		"track_engineer":   models.TrackEngineerByLeague{}.TableName(),
+		"chief_engineer":   models.ChiefEngineerByLeague{}.TableName(),
+		"team_constructor": models.TeamConstructorByLeague{}.TableName(),
+	}
+	for _, itemType := range []string{"pilot", "track_engineer", "chief_engineer", "team_constructor"} {
+		var rows []struct {
+			ID   uint
+			Bids []byte
+		}
+		tx.Table(tables[itemType]).Select("id", "bids").
+			Where("league_id = ? AND owner_id > 0 AND owner_id != ? AND bids IS NOT NULL AND bids != '[]' AND bids != 'null'", leagueID, playerID).
+			Find(&rows)
+		for _, row := range rows {
+			if amount, ok := bidOf(row.Bids, playerID); ok {
+				commitments = append(commitments, fundsCommitment{commitmentOffer, itemType, row.ID, amount})
+			}
+		}
+	}
+	return commitments
+}
+
+// bidOf devuelve la puja de un manager dentro de un array JSON de pujas
+func bidOf(bidsJSON []byte, playerID uint) (float64, bool) {
+	if len(bidsJSON) == 0 {
+		return 0, false
+	}
+	var bids []Bid
+	if err := json.Unmarshal(bidsJSON, &bids); err != nil {
+		return 0, false
+	}
+	for _, bid := range bids {
+		if bid.PlayerID == playerID {
+			return bid.Valor, true
+		}
+	}
+	return 0, false
+}
+
+// playerBudget calcula el dinero comprometido y disponible de un manager. El
+// compromiso indicado por source/itemType/itemID se excluye, porque una nueva
+// puja sobre el mismo elemento sustituye a la anterior. Dentro de una
+// transacción que gasta dinero se pasa tx con la fila del manager bloqueada.
+func playerBudget(tx *gorm.DB, pl models.PlayerByLeague, source, itemType string, itemID uint) budgetSummary {
+	summary := budgetSummary{Money: pl.Money, Commitments: []fundsCommitment{}}
+	for _, cm := range playerCommitments(tx, uint(pl.LeagueID), uint(pl.PlayerID)) {
+		if cm.Source == source && cm.ItemType == itemType && cm.ItemID == itemID {
+			continue
+		}
+		summary.Committed += cm.Amount
+		summary.Commitments = append(summary.Commitments, cm)
+	}
+	summary.Available = summary.Money - summary.Committed
+	return summary
+}
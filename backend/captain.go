@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"f1-fantasy-app/database"
+	"f1-fantasy-app/models"
+
+	"gorm.io/gorm"
+)
+
+// Papeles del piloto cuyo multiplicador se aplica en una alineación
+const (
+	captainRoleCaptain     = "captain"
+	captainRoleViceCaptain = "vice_captain"
+)
+
+// pilotTookPart indica si un piloto por liga tiene resultado en la sesión de su
+// modo del GP, con el mismo criterio que los suplentes: basta con que exista la
+// fila, aunque abandonara sin posición final.
+func pilotTookPart(pilotByLeagueID uint, gpIndex uint64) bool {
+	var pbl models.PilotByLeague
+	var pilot models.Pilot
+	if database.DB.First(&pbl, pilotByLeagueID).Error != nil || database.DB.First(&pilot, pbl.PilotID).Error != nil {
+		return false
+	}
+	session := pilotSessionName(pilot.Mode)
+	if _, ok := sessionTables[session]; !ok {
+		return false
+	}
+	return hasSessionResult(session, pilot.ID, gpIndex)
+}
+
+// lineupCaptain devuelve el piloto que lleva el multiplicador: el capitán si
+// participó en su sesión o, si no, el vicecapitán
+func lineupCaptain(lineup models.Lineup) (uint, string) {
+	if lineup.CaptainID != nil && pilotTookPart(*lineup.CaptainID, lineup.GPIndex) {
+		return *lineup.CaptainID, captainRoleCaptain
+	}
+	if lineup.ViceCaptainID != nil && pilotTookPart(*lineup.ViceCaptainID, lineup.GPIndex) {
+		return *lineup.ViceCaptainID, captainRoleViceCaptain
+	}
+	return 0, ""
+}
+
+// captainBonus calcula los puntos extra del capitán: sus puntos multiplicados
+// por el factor de la liga (o el del chip triple_captain) menos los que ya
+// cuentan como piloto alineado
+func captainBonus(tx *gorm.DB, lineup models.Lineup) (int, uint, string, float64) {
+	pilotByLeagueID, role := lineupCaptain(lineup)
+	if pilotByLeagueID == 0 {
+		return 0, 0, "", 1
+	}
+	multiplier := loadLeagueSettings(tx, uint(lineup.LeagueID)).CaptainMultiplier
+	if lineupChip(lineup) == chipTripleCaptain {
+		multiplier = chipTripleCaptainMultiplier
+	}
+	points := getPilotPoints(tx, pilotByLeagueID, lineup.GPIndex)
+	bonus := int(math.Round(float64(points) * (multiplier - 1)))
+	return bonus, pilotByLeagueID, role, multiplier
+}
+
+// validateCaptains comprueba que capitán y vicecapitán sean pilotos distintos
+// alineados en carrera o clasificación
+func validateCaptains(captainID, viceCaptainID *uint, racePilots, qualifyingPilots []uint) error {
+	eligible := make(map[uint]bool)
+	for _, id := range append(append([]uint{}, racePilots...), qualifyingPilots...) {
+		eligible[id] = true
+	}
+	if captainID == nil {
+		if viceCaptainID != nil {
+			return fmt.Errorf("No se puede elegir vicecapitán sin capitán")
+		}
+		return nil
+	}
+	if !eligible[*captainID] {
+		return fmt.Errorf("El capitán debe ser un piloto de carrera o de clasificación de la alineación")
+	}
+	if viceCaptainID != nil {
+		if *viceCaptainID == *captainID {
+			return fmt.Errorf("El capitán y el vicecapitán deben ser pilotos distintos")
+		}
+		if !eligible[*viceCaptainID] {
+			return fmt.Errorf("El vicecapitán debe ser un piloto de carrera o de clasificación de la alineación")
+		}
+	}
+	return nil
+}
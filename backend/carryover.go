@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"f1-fantasy-app/database"
+	"f1-fantasy-app/models"
+)
+
+// Tiempo tras la última sesión de un GP durante el que aún se copian
+// alineaciones; evita rellenar GPs antiguos tras una parada del servidor
+const carryOverWindow = 24 * time.Hour
+
+// lockedGP devuelve el último GP cuya alineación ya se ha bloqueado (ha
+// empezado su primera sesión) y la hora de bloqueo del siguiente, si lo hay
+func lockedGP(now time.Time) (*gpSchedule, *time.Time) {
+	var gps []models.GrandPrix
+	database.DB.Order("start_date ASC").Find(&gps)
+
+	var locked *gpSchedule
+	for _, gp := range gps {
+		schedule := loadGPSchedule(gp)
+		first := schedule.firstStart()
+		if first.After(now) {
+			return locked, &first
+		}
+		locked = &schedule
+	}
+	return locked, nil
+}
+
+// ownedCardIDs devuelve los IDs por liga de las cartas de una tabla que son
+// del manager
+func ownedCardIDs(table string, leagueID, ownerID uint) map[uint]bool {
+	var ids []uint
+	database.DB.Table(table).Where("league_id = ? AND owner_id = ?", leagueID, ownerID).Pluck("id", &ids)
+	owned := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		owned[id] = true
+	}
+	return owned
+}
+
+// keepOwned filtra un array JSON de IDs dejando solo las cartas del manager
+func keepOwned(raw []byte, owned map[uint]bool) []uint {
+	var ids []uint
+	if len(raw) > 0 {
+		json.Unmarshal(raw, &ids)
+	}
+	kept := []uint{}
+	for _, id := range ids {
+		if owned[id] {
+			kept = append(kept, id)
+		}
+	}
+	return kept
+}
+
+// carryOverLineup copia la alineación anterior de un manager a un GP,
+// quitando las cartas que ya no son suyas. La nueva alineación queda marcada
+// como generada automáticamente y sin chip.
+func carryOverLineup(previous models.Lineup, gp models.GrandPrix) models.Lineup {
+	leagueID, ownerID := uint(previous.LeagueID), uint(previous.PlayerID)
+	pilots := ownedCardIDs(models.PilotByLeague{}.TableName(), leagueID, ownerID)
+	trackEngineers := ownedCardIDs(models.TrackEngineerByLeague{}.TableName(), leagueID, ownerID)
+	chiefEngineers := ownedCardIDs(models.ChiefEngineerByLeague{}.TableName(), leagueID, ownerID)
+	constructors := ownedCardIDs(models.TeamConstructorByLeague{}.TableName(), leagueID, ownerID)
+
+	racePilots := keepOwned(previous.RacePilots, pilots)
+	qualifyingPilots := keepOwned(previous.QualifyingPilots, pilots)
+	practicePilots := keepOwned(previous.PracticePilots, pilots)
+	sprintPilots := []uint{}
+	if gp.HasSprint {
+		sprintPilots = keepOwned(previous.SprintPilots, pilots)
+	}
+
+	bench := map[string][]uint{}
+	for session, ids := range lineupBench(previous) {
+		raw, _ := json.Marshal(ids)
+		if kept := keepOwned(raw, pilots); len(kept) > 0 {
+			bench[session] = kept
+		}
+	}
+
+	ownedPointer := func(id *uint, owned map[uint]bool) *uint {
+		if id == nil || !owned[*id] {
+			return nil
+		}
+		return id
+	}
+	// El capitán y el vicecapitán solo siguen si siguen alineados
+	starters := make(map[uint]bool)
+	for _, id := range append(append([]uint{}, racePilots...), qualifyingPilots...) {
+		starters[id] = true
+	}
+
+	lineup := models.Lineup{
+		PlayerID:          previous.PlayerID,
+		LeagueID:          previous.LeagueID,
+		GPIndex:           gp.GPIndex,
+		TeamConstructorID: ownedPointer(previous.TeamConstructorID, constructors),
+		ChiefEngineerID:   ownedPointer(previous.ChiefEngineerID, chiefEngineers),
+		CaptainID:         ownedPointer(previous.CaptainID, starters),
+		ViceCaptainID:     ownedPointer(previous.ViceCaptainID, starters),
+		AutoGenerated:     true,
+	}
+	lineup.RacePilots, _ = json.Marshal(racePilots)
+	lineup.QualifyingPilots, _ = json.Marshal(qualifyingPilots)
+	lineup.PracticePilots, _ = json.Marshal(practicePilots)
+	lineup.SprintPilots, _ = json.Marshal(sprintPilots)
+	lineup.BenchPilots, _ = json.Marshal(bench)
+	lineup.TrackEngineers, _ = json.Marshal(keepOwned(previous.TrackEngineers, trackEngineers))
+	return lineup
+}
+
+// carryOverLineups crea la alineación del GP a los managers de la liga que no
+// la guardaron, copiando la del GP anterior. Devuelve cuántas ha creado.
+func carryOverLineups(leagueID uint, gp models.GrandPrix) (int, error) {
+	var managers []models.PlayerByLeague
+	if err := database.DB.Where("league_id = ?", leagueID).Find(&managers).Error; err != nil {
+		return 0, err
+	}
+
+	created := 0
+	var lastErr error
+	for _, manager := range managers {
+		var count int64
+		database.DB.Model(&models.Lineup{}).Where("player_id = ? AND league_id = ? AND gp_index = ?", manager.PlayerID, leagueID, gp.GPIndex).Count(&count)
+		if count > 0 {
+			continue
+		}
+		var previous models.Lineup
+		if err := database.DB.Where("player_id = ? AND league_id = ? AND gp_index < ?", manager.PlayerID, leagueID, gp.GPIndex).
+			Order("gp_index DESC").First(&previous).Error; err != nil {
+			continue // Nunca ha guardado una alineación
+		}
+
+		lineup := carryOverLineup(previous, gp)
+		if err := database.DB.Create(&lineup).Error; err != nil {
+			log.Printf("[CARRY-OVER] Error copiando la alineación del jugador %d en liga %d: %v", manager.PlayerID, leagueID, err)
+			lastErr = err
+			continue
+		}
+		log.Printf("[CARRY-OVER] Liga %d: alineación del GP %d copiada del GP %d para el jugador %d", leagueID, gp.GPIndex, previous.GPIndex, manager.PlayerID)
+		created++
+	}
+	return created, lastErr
+}
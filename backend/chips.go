@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"f1-fantasy-app/database"
+	"f1-fantasy-app/models"
+
+	"gorm.io/gorm"
+)
+
+// Chips de temporada: cada manager puede usar cada chip una vez por temporada
+const (
+	chipTripleCaptain       = "triple_captain"        // El capitán multiplica ×3 en ese GP
+	chipNoNegatives         = "no_negatives"          // Ningún elemento resta puntos en ese GP
+	chipDoubleChiefEngineer = "double_chief_engineer" // El chief engineer puntúa doble en ese GP
+	chipFreeClausula        = "free_clausula"         // Una cláusula pagada por la liga
+)
+
+// Multiplicador del capitán con el chip triple_captain
+const chipTripleCaptainMultiplier = 3
+
+// chipInfo describe un chip del catálogo. Los de alineación se activan al
+// guardar la alineación de un GP; el resto se gastan en otra acción.
+type chipInfo struct {
+	Chip        string `json:"chip"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Lineup      bool   `json:"lineup"`
+}
+
+var chipCatalog = []chipInfo{
+	{chipTripleCaptain, "Triple capitán", "El capitán multiplica sus puntos ×3 en el GP", true},
+	{chipNoNegatives, "Sin negativos", "Ningún elemento de la alineación resta puntos en el GP", true},
+	{chipDoubleChiefEngineer, "Chief engineer doble", "El chief engineer puntúa doble en el GP", true},
+	{chipFreeClausula, "Cláusula gratis", "Paga la liga una cláusula en lugar del manager", false},
+}
+
+// findChip busca un chip en el catálogo
+func findChip(chip string) (chipInfo, bool) {
+	for _, info := range chipCatalog {
+		if info.Chip == chip {
+			return info, true
+		}
+	}
+	return chipInfo{}, false
+}
+
+// parseEnabledChips separa la lista de chips de la configuración de una liga
+func parseEnabledChips(enabled string) []string {
+	var chips []string
+	for _, chip := range strings.Split(enabled, ",") {
+		if chip = strings.TrimSpace(chip); chip != "" {
+			chips = append(chips, chip)
+		}
+	}
+	return chips
+}
+
+// validateEnabledChips comprueba que la lista de chips de una liga solo tenga
+// chips del catálogo y sin repetir
+func validateEnabledChips(enabled string) error {
+	seen := make(map[string]bool)
+	for _, chip := range parseEnabledChips(enabled) {
+		if _, ok := findChip(chip); !ok {
+			return fmt.Errorf("chip desconocido: %s", chip)
+		}
+		if seen[chip] {
+			return fmt.Errorf("chip repetido: %s", chip)
+		}
+		seen[chip] = true
+	}
+	return nil
+}
+
+// leagueChipEnabled indica si la liga tiene activado un chip
+func leagueChipEnabled(leagueID uint, chip string) bool {
+	for _, enabled := range parseEnabledChips(loadLeagueSettings(database.DB, leagueID).EnabledChips) {
+		if enabled == chip {
+			return true
+		}
+	}
+	return false
+}
+
+// playerChipUsages devuelve los chips ya usados por un manager, por chip
+func playerChipUsages(playerByLeagueID uint64) map[string]models.ChipUsage {
+	var usages []models.ChipUsage
+	database.DB.Where("player_by_league_id = ?", playerByLeagueID).Find(&usages)
+	byChip := make(map[string]models.ChipUsage, len(usages))
+	for _, usage := range usages {
+		byChip[usage.Chip] = usage
+	}
+	return byChip
+}
+
+// lineupChip devuelve el chip activado con la alineación o "" si no hay ninguno
+func lineupChip(lineup models.Lineup) string {
+	var usage models.ChipUsage
+	if err := database.DB.Where("league_id = ? AND player_id = ? AND gp_index = ?", lineup.LeagueID, lineup.PlayerID, lineup.GPIndex).
+		First(&usage).Error; err != nil {
+		return ""
+	}
+	return usage.Chip
+}
+
+// validateLineupChip comprueba que el manager pueda activar el chip con la
+// alineación del GP; "" (quitar el chip) siempre es válido
+func validateLineupChip(pl models.PlayerByLeague, gpIndex uint64, chip string) error {
+	if chip == "" {
+		return nil
+	}
+	info, ok := findChip(chip)
+	if !ok || !info.Lineup {
+		return fmt.Errorf("El chip %s no se puede activar con la alineación", chip)
+	}
+	if !leagueChipEnabled(uint(pl.LeagueID), chip) {
+		return fmt.Errorf("El chip %s no está disponible en esta liga", chip)
+	}
+	if used, ok := playerChipUsages(pl.ID)[chip]; ok && (used.GPIndex == nil || *used.GPIndex != gpIndex) {
+		return fmt.Errorf("Ya has usado el chip %s esta temporada", chip)
+	}
+	return nil
+}
+
+// setLineupChip activa un chip de alineación ya validado para el GP o lo quita
+// si chip es "". Solo puede haber un chip por GP; cambiarlo libera el anterior.
+// Se ejecuta dentro de la transacción que guarda la alineación.
+func setLineupChip(tx *gorm.DB, pl models.PlayerByLeague, gpIndex uint64, chip string) error {
+	var current models.ChipUsage
+	if err := tx.Where("player_by_league_id = ? AND gp_index = ?", pl.ID, gpIndex).First(&current).Error; err == nil {
+		if current.Chip == chip {
+			return nil
+		}
+		if err := tx.Delete(&current).Error; err != nil {
+			return err
+		}
+	}
+	if chip == "" {
+		return nil
+	}
+	return tx.Create(&models.ChipUsage{
+		LeagueID:         pl.LeagueID,
+		PlayerID:         pl.PlayerID,
+		PlayerByLeagueID: pl.ID,
+		Chip:             chip,
+		GPIndex:          &gpIndex,
+	}).Error
+}
+
+// reserveClausulaChip gasta el chip de cláusula gratis de un manager. El
+// índice único por manager y chip impide gastarlo dos veces.
+func reserveClausulaChip(pl models.PlayerByLeague, itemType string, itemID uint) (models.ChipUsage, error) {
+	usage := models.ChipUsage{
+		LeagueID:         pl.LeagueID,
+		PlayerID:         pl.PlayerID,
+		PlayerByLeagueID: pl.ID,
+		Chip:             chipFreeClausula,
+		ItemType:         itemType,
+		ItemID:           itemID,
+	}
+	if !leagueChipEnabled(uint(pl.LeagueID), chipFreeClausula) {
+		return usage, fmt.Errorf("El chip %s no está disponible en esta liga", chipFreeClausula)
+	}
+	if _, used := playerChipUsages(pl.ID)[chipFreeClausula]; used {
+		return usage, fmt.Errorf("Ya has usado el chip %s esta temporada", chipFreeClausula)
+	}
+	if err := database.DB.Create(&usage).Error; err != nil {
+		return usage, fmt.Errorf("Ya has usado el chip %s esta temporada", chipFreeClausula)
+	}
+	return usage, nil
+}
+
+// chipBonus calcula los puntos extra del chip activado con la alineación.
+// captainPoints es el extra del capitán, que sin negativos tampoco resta.
+func chipBonus(tx *gorm.DB, lineup models.Lineup, captainPoints int) (int, string, string) {
+	chip := lineupChip(lineup)
+	switch chip {
+	case chipDoubleChiefEngineer:
+		if lineup.ChiefEngineerID == nil {
+			return 0, chip, ""
+		}
+		points := getChiefEngineerPoints(tx, *lineup.ChiefEngineerID, lineup.GPIndex)
+		return points, chip, fmt.Sprintf("%d pts del chief engineer × 2", points)
+
+	case chipNoNegatives:
+		var pilotIDs, trackEngineerIDs []uint
+		for _, raw := range [][]byte{lineup.RacePilots, lineup.QualifyingPilots, lineup.PracticePilots} {
+			var ids []uint
+			if len(raw) > 0 {
+				json.Unmarshal(raw, &ids)
+			}
+			pilotIDs = append(pilotIDs, ids...)
+		}
+		if len(lineup.TrackEngineers) > 0 {
+			json.Unmarshal(lineup.TrackEngineers, &trackEngineerIDs)
+		}
+
+		var sprintPilotIDs []uint
+		if len(lineup.SprintPilots) > 0 {
+			json.Unmarshal(lineup.SprintPilots, &sprintPilotIDs)
+		}
+
+		points := []int{captainPoints}
+		for _, id := range pilotIDs {
+			points = append(points, getPilotPoints(tx, id, lineup.GPIndex))
+		}
+		for _, id := range sprintPilotIDs {
+			points = append(points, getPilotSprintPoints(tx, id, lineup.GPIndex))
+		}
+		if lineup.TeamConstructorID != nil {
+			points = append(points, getTeamConstructorPoints(tx, *lineup.TeamConstructorID, lineup.GPIndex))
+		}
+		if lineup.ChiefEngineerID != nil {
+			points = append(points, getChiefEngineerPoints(tx, *lineup.ChiefEngineerID, lineup.GPIndex))
+		}
+		for _, id := range trackEngineerIDs {
+			points = append(points, getTrackEngineerPointsWithLineup(tx, id, lineup.GPIndex, lineup))
+		}
+
+		bonus, negatives := 0, 0
+		for _, p := range points {
+			if p < 0 {
+				bonus -= p
+				negatives++
+			}
+		}
+		return bonus, chip, fmt.Sprintf("%d elementos con puntos negativos quedan a 0", negatives)
+	}
+	return 0, chip, ""
+}
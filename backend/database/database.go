@@ -108,6 +108,21 @@ func Migrate() {
 		&models.PilotRace{},
 		&models.PilotQualy{},
 		&models.PilotPractice{},
+		&models.PilotSprint{},
+		&models.PilotSprintQualy{},
+		&models.SchedulerJobState{},
+		&models.LedgerEntry{},
+		&models.LeagueMarketSettings{},
+		&models.MarketDraw{},
+		&models.AuctionResult{},
+		&models.LeagueSettings{},
+		&models.ValuationConfig{},
+		&models.ItemValuation{},
+		&models.PointsLineItem{},
+		&models.ChipUsage{},
+		&models.GrandPrixSession{},
+		&models.ScraperImport{},
+		&models.ScraperJob{},
 	}
 
 	for _, table := range tables {
@@ -135,6 +150,39 @@ func Migrate() {
 	// Migración específica para finish_cars en team_races
 	MigrateTeamRacesFinishCars()
 
+	// Migración específica para auction_mode en leagues
+	MigrateLeaguesAuctionMode()
+
+	// Migrar versión de reglas de puntuación
+	MigrateScoringVersion()
+
+	// Migrar capitán y vicecapitán de las alineaciones
+	MigrateLineupCaptains()
+
+	// Migrar chips de temporada de las ligas
+	MigrateLeagueChips()
+
+	// Migrar hueco de sprint de las alineaciones
+	MigrateSprintWeekends()
+
+	// Migrar banquillo de las alineaciones
+	MigrateLineupBench()
+
+	// Migrar marca de alineación generada automáticamente
+	MigrateLineupCarryOver()
+
+	// Migrar parada más rápida de los equipos
+	MigrateTeamRacesFastestPitstop()
+
+	// Validez de las ofertas FIA y refresco del mercado configurables por liga
+	MigrateLeagueSettingsIntervals()
+
+	// Migrar motivo de las subastas cerradas sin adjudicar
+	MigrateAuctionResultsFailure()
+
+	// Migrar tipo de sorteo (mercado u ofertas FIA)
+	MigrateMarketDrawKind()
+
 	log.Println("Migraciones completadas")
 }
 
@@ -279,3 +327,121 @@ func MigrateTeamRacesFinishCars() {
 		log.Println("Columna finish_cars ya existe en tabla team_races")
 	}
 }
+
+// MigrateLeaguesAuctionMode añade la columna auction_mode a la tabla leagues si no existe
+func MigrateLeaguesAuctionMode() {
+	log.Println("Verificando columna auction_mode en tabla leagues...")
+
+	var columnExists bool
+	err := DB.Raw("SELECT COUNT(*) > 0 FROM information_schema.columns WHERE table_schema = ? AND table_name = ? AND column_name = ?",
+		os.Getenv("DB_NAME"), "leagues", "auction_mode").Scan(&columnExists).Error
+
+	if err != nil {
+		log.Printf("Error verificando columna auction_mode: %v", err)
+		return
+	}
+
+	if !columnExists {
+		log.Println("Agregando columna auction_mode a tabla leagues...")
+
+		err := DB.Exec(`
+			ALTER TABLE leagues 
+			ADD COLUMN auction_mode VARCHAR(30) DEFAULT 'open' COMMENT 'Modo de subasta: open, sealed_first_price o sealed_second_price'
+		`).Error
+
+		if err != nil {
+			log.Printf("Error agregando columna auction_mode: %v", err)
+		} else {
+			log.Println("Columna auction_mode agregada exitosamente a tabla leagues")
+		}
+	} else {
+		log.Println("Columna auction_mode ya existe en tabla leagues")
+	}
+}
+
+// addColumnIfMissing añade una columna a una tabla existente si todavía no la tiene
+func addColumnIfMissing(table, column, definition string) {
+	var columnExists bool
+	err := DB.Raw("SELECT COUNT(*) > 0 FROM information_schema.columns WHERE table_schema = ? AND table_name = ? AND column_name = ?",
+		os.Getenv("DB_NAME"), table, column).Scan(&columnExists).Error
+
+	if err != nil {
+		log.Printf("Error verificando columna %s en %s: %v", column, table, err)
+		return
+	}
+	if columnExists {
+		return
+	}
+
+	log.Printf("Agregando columna %s a tabla %s...", column, table)
+	if err := DB.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)).Error; err != nil {
+		log.Printf("Error agregando columna %s a %s: %v", column, table, err)
+	} else {
+		log.Printf("Columna %s agregada exitosamente a tabla %s", column, table)
+	}
+}
+
+// MigrateScoringVersion añade la versión de reglas con la que se puntuó cada
+// resultado y la versión fijada por cada liga. Los datos existentes quedan en la versión 1.
+func MigrateScoringVersion() {
+	for _, table := range []string{"pilot_races", "pilot_qualies", "pilot_practices", "team_races"} {
+		addColumnIfMissing(table, "scoring_version", "INT NOT NULL DEFAULT 1 COMMENT 'Versión de reglas con la que se calcularon los puntos'")
+	}
+	addColumnIfMissing("leagues", "scoring_version", "INT NOT NULL DEFAULT 1 COMMENT 'Versión de reglas de puntuación fijada por la liga'")
+}
+
+// MigrateLineupCaptains añade el capitán y vicecapitán a las alineaciones y el
+// multiplicador del capitán a la configuración de las ligas
+func MigrateLineupCaptains() {
+	addColumnIfMissing("lineups", "captain_id", "BIGINT UNSIGNED NULL COMMENT 'pilot_by_league_id del capitán'")
+	addColumnIfMissing("lineups", "vice_captain_id", "BIGINT UNSIGNED NULL COMMENT 'pilot_by_league_id del vicecapitán'")
+	addColumnIfMissing("league_settings", "captain_multiplier", "DOUBLE NOT NULL DEFAULT 2 COMMENT 'Multiplicador de puntos del capitán'")
+}
+
+// MigrateLeagueChips añade a la configuración de las ligas los chips de
+// temporada disponibles. Las ligas existentes tienen todos los chips.
+func MigrateLeagueChips() {
+	addColumnIfMissing("league_settings", "enabled_chips", "VARCHAR(255) NOT NULL DEFAULT 'triple_captain,no_negatives,double_chief_engineer,free_clausula' COMMENT 'Chips de temporada disponibles separados por comas'")
+}
+
+// MigrateSprintWeekends añade el hueco de sprint a las alineaciones. El flag
+// has_sprint de los GPs lo crea el AutoMigrate de GrandPrix.
+func MigrateSprintWeekends() {
+	addColumnIfMissing("lineups", "sprint_pilots", "JSON NULL COMMENT 'Array de pilot_by_league_id del hueco de sprint'")
+}
+
+// MigrateLineupBench añade los suplentes ordenados por sesión a las alineaciones
+func MigrateLineupBench() {
+	addColumnIfMissing("lineups", "bench_pilots", "JSON NULL COMMENT 'Suplentes ordenados por sesión (pilot_by_league_id)'")
+}
+
+// MigrateTeamRacesFastestPitstop añade a team_races la marca de parada más
+// rápida del GP y el tiempo en pit lane que lee el scraper
+func MigrateTeamRacesFastestPitstop() {
+	addColumnIfMissing("team_races", "fastest_pitstop", "BOOLEAN NOT NULL DEFAULT FALSE COMMENT 'Parada más rápida del GP'")
+	addColumnIfMissing("team_races", "pit_lane_time", "DOUBLE NULL COMMENT 'Segundos en pit lane de la parada más rápida del equipo (formula1.com)'")
+}
+
+// MigrateLineupCarryOver añade la marca de las alineaciones copiadas del GP anterior
+func MigrateLineupCarryOver() {
+	addColumnIfMissing("lineups", "auto_generated", "BOOLEAN NOT NULL DEFAULT FALSE COMMENT 'Copiada de la alineación anterior al bloquearse el GP'")
+}
+
+// MigrateLeagueSettingsIntervals añade a la configuración de las ligas la
+// validez de las ofertas de la FIA y el intervalo de refresco del mercado
+func MigrateLeagueSettingsIntervals() {
+	addColumnIfMissing("league_settings", "fia_offer_hours", "INT NOT NULL DEFAULT 24 COMMENT 'Horas de validez de las ofertas de la FIA'")
+	addColumnIfMissing("league_settings", "market_refresh_hours", "INT NOT NULL DEFAULT 24 COMMENT 'Horas entre refrescos del mercado'")
+}
+
+// MigrateAuctionResultsFailure añade a auction_results el motivo de las
+// subastas que se cerraron sin ganador
+func MigrateAuctionResultsFailure() {
+	addColumnIfMissing("auction_results", "failure_reason", "VARCHAR(255) NOT NULL DEFAULT '' COMMENT 'Motivo por el que no se adjudicó la subasta'")
+}
+
+// MigrateMarketDrawKind añade a market_draws el tipo de sorteo. Los sorteos
+// existentes son todos refrescos del mercado.
+func MigrateMarketDrawKind() {
+	addColumnIfMissing("market_draws", "kind", "VARCHAR(16) NOT NULL DEFAULT 'market' COMMENT 'market: refresco del mercado; fia: ofertas de la FIA fuera del refresco'")
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	mathrand "math/rand"
+	"time"
+
+	"f1-fantasy-app/database"
+	"f1-fantasy-app/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Tipos de sorteo. Cada liga tiene una semilla comprometida por tipo: la del
+// refresco del mercado y la de las ofertas de la FIA que se generan fuera de
+// él (tras una subasta o a petición de un admin).
+const (
+	drawKindMarket = "market"
+	drawKindFIA    = "fia"
+)
+
+// drawCandidate es un elemento libre que entra en el sorteo del mercado
+type drawCandidate struct {
+	MarketItemID uint    `json:"market_item_id"`
+	ItemType     string  `json:"item_type"`
+	ItemID       uint    `json:"item_id"`
+	Weight       float64 `json:"weight"`
+}
+
+// drawFIAOffer es una oferta de la FIA generada con la semilla del sorteo
+type drawFIAOffer struct {
+	ItemType      string  `json:"item_type"`
+	ItemID        uint    `json:"item_id"`
+	SaleValue     float64 `json:"sale_value"`
+	Offer         float64 `json:"offer"`
+	MinMultiplier float64 `json:"min_multiplier"`
+	MaxMultiplier float64 `json:"max_multiplier"`
+}
+
+// drawVerification es el resultado de repetir un sorteo a partir de su semilla
+type drawVerification struct {
+	DrawID           uint   `json:"draw_id"`
+	Seed             string `json:"seed"`
+	SeedHash         string `json:"seed_hash"`
+	HashMatches      bool   `json:"hash_matches"`
+	SelectionMatches bool   `json:"selection_matches"`
+	FIAOffersMatch   bool   `json:"fia_offers_match"`
+	Selected         []uint `json:"selected"`
+	Recomputed       []uint `json:"recomputed"`
+	Valid            bool   `json:"valid"`
+}
+
+// hashSeed devuelve el compromiso (SHA-256 en hex) de una semilla
+func hashSeed(seed string) string {
+	sum := sha256.Sum256([]byte(seed))
+	return hex.EncodeToString(sum[:])
+}
+
+// drawRand crea el generador determinista del sorteo a partir de la semilla
+func drawRand(seed string) *mathrand.Rand {
+	sum := sha256.Sum256([]byte(seed))
+	return mathrand.New(mathrand.NewSource(int64(binary.BigEndian.Uint64(sum[:8]))))
+}
+
+// commitDraw genera la semilla del próximo sorteo de un tipo en una liga y publica su hash
+func commitDraw(tx *gorm.DB, leagueID uint, kind string) (models.MarketDraw, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return models.MarketDraw{}, err
+	}
+	seed := hex.EncodeToString(b)
+	draw := models.MarketDraw{
+		LeagueID:    leagueID,
+		Kind:        kind,
+		Seed:        seed,
+		SeedHash:    hashSeed(seed),
+		CommittedAt: time.Now(),
+	}
+	return draw, tx.Create(&draw).Error
+}
+
+// pendingDraw devuelve el sorteo comprometido y aún no revelado de un tipo en
+// una liga, creándolo si no existe. Dentro de una transacción la fila queda
+// bloqueada para que dos peticiones no consuman la misma semilla.
+func pendingDraw(tx *gorm.DB, leagueID uint, kind string) (models.MarketDraw, error) {
+	var draw models.MarketDraw
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("league_id = ? AND kind = ? AND revealed_at IS NULL", leagueID, kind).Order("id asc").First(&draw).Error; err == nil {
+		return draw, nil
+	}
+	return commitDraw(tx, leagueID, kind)
+}
+
+// pendingMarketDraw devuelve el sorteo comprometido del próximo refresco del mercado
+func pendingMarketDraw(leagueID uint) (models.MarketDraw, error) {
+	return pendingDraw(database.DB, leagueID, drawKindMarket)
+}
+
+// runMarketDraw ejecuta la selección del mercado sobre los candidatos en su orden
+func runMarketDraw(rng *mathrand.Rand, candidates []drawCandidate, settings models.LeagueMarketSettings) []models.MarketItem {
+	items := make([]models.MarketItem, len(candidates))
+	weights := make(map[uint]float64, len(candidates))
+	for i, cand := range candidates {
+		items[i] = models.MarketItem{ID: cand.MarketItemID, LeagueID: settings.LeagueID, ItemType: cand.ItemType, ItemID: cand.ItemID, IsActive: true}
+		weights[cand.MarketItemID] = cand.Weight
+	}
+	return selectMarketItems(items, settings, func(item models.MarketItem) float64 {
+		return weights[item.ID]
+	}, rng)
+}
+
+// storeMarketDraw guarda los candidatos con sus pesos, la configuración y el
+// resultado del sorteo dentro de la transacción que lo aplica
+func storeMarketDraw(tx *gorm.DB, draw *models.MarketDraw, candidates []drawCandidate, settings models.LeagueMarketSettings, selected []models.MarketItem) error {
+	selectedIDs := make([]uint, len(selected))
+	for i, item := range selected {
+		selectedIDs[i] = item.ID
+	}
+	draw.Candidates, _ = json.Marshal(candidates)
+	draw.Settings, _ = json.Marshal(settings)
+	draw.Selected, _ = json.Marshal(selectedIDs)
+	return tx.Model(draw).Updates(map[string]interface{}{
+		"candidates": draw.Candidates,
+		"settings":   draw.Settings,
+		"selected":   draw.Selected,
+	}).Error
+}
+
+// revealDraw guarda las ofertas FIA del sorteo, revela la semilla y
+// compromete la del siguiente del mismo tipo
+func revealDraw(tx *gorm.DB, draw models.MarketDraw, fiaOffers []drawFIAOffer) error {
+	now := time.Now()
+	draw.FIAOffers, _ = json.Marshal(fiaOffers)
+	draw.RevealedAt = &now
+	if err := tx.Save(&draw).Error; err != nil {
+		return err
+	}
+	_, err := commitDraw(tx, draw.LeagueID, draw.Kind)
+	return err
+}
+
+// revealMarketDraw revela el sorteo de un refresco del mercado
+func revealMarketDraw(draw models.MarketDraw, fiaOffers []drawFIAOffer) error {
+	return revealDraw(database.DB, draw, fiaOffers)
+}
+
+// withFIADraw genera ofertas de la FIA fuera del refresco del mercado con la
+// semilla comprometida de la liga. Si generate produce alguna oferta se
+// guardan en el sorteo y se revela la semilla; si no, la semilla sigue
+// pendiente para la próxima vez.
+func withFIADraw(tx *gorm.DB, leagueID uint, generate func(rng *mathrand.Rand) ([]drawFIAOffer, error)) error {
+	draw, err := pendingDraw(tx, leagueID, drawKindFIA)
+	if err != nil {
+		return fmt.Errorf("error obteniendo la semilla de ofertas FIA: %v", err)
+	}
+	offers, err := generate(drawRand(draw.Seed))
+	if err != nil || len(offers) == 0 {
+		return err
+	}
+	return revealDraw(tx, draw, offers)
+}
+
+// runFIADraw ejecuta withFIADraw en su propia transacción
+func runFIADraw(leagueID uint, generate func(rng *mathrand.Rand) ([]drawFIAOffer, error)) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		return withFIADraw(tx, leagueID, generate)
+	})
+}
+
+// marketDrawView devuelve un sorteo para la API. La semilla solo se incluye si ya se reveló.
+func marketDrawView(draw models.MarketDraw) map[string]interface{} {
+	view := map[string]interface{}{
+		"id":           draw.ID,
+		"league_id":    draw.LeagueID,
+		"kind":         draw.Kind,
+		"seed_hash":    draw.SeedHash,
+		"committed_at": draw.CommittedAt,
+		"revealed_at":  draw.RevealedAt,
+	}
+	if draw.RevealedAt != nil {
+		view["seed"] = draw.Seed
+		view["candidates"] = json.RawMessage(draw.Candidates)
+		view["settings"] = json.RawMessage(draw.Settings)
+		view["selected"] = json.RawMessage(draw.Selected)
+		view["fia_offers"] = json.RawMessage(draw.FIAOffers)
+	}
+	return view
+}
+
+// verifyMarketDraw repite un sorteo revelado con su semilla y comprueba que
+// coinciden el hash, la selección y las ofertas de la FIA. Los sorteos de
+// ofertas FIA no tienen selección y solo se repiten las ofertas.
+func verifyMarketDraw(draw models.MarketDraw) (drawVerification, error) {
+	result := drawVerification{DrawID: draw.ID, Seed: draw.Seed, SeedHash: draw.SeedHash}
+	if draw.RevealedAt == nil {
+		return result, fmt.Errorf("el sorteo %d aún no se ha revelado", draw.ID)
+	}
+
+	var fiaOffers []drawFIAOffer
+	_ = json.Unmarshal(draw.FIAOffers, &fiaOffers)
+
+	result.HashMatches = hashSeed(draw.Seed) == draw.SeedHash
+
+	// Mismo orden de consumo del generador que en refreshMarketForLeague
+	rng := drawRand(draw.Seed)
+	result.Selected = []uint{}
+	result.Recomputed = []uint{}
+	if draw.Kind != drawKindFIA {
+		var candidates []drawCandidate
+		var settings models.LeagueMarketSettings
+		if err := json.Unmarshal(draw.Candidates, &candidates); err != nil {
+			return result, fmt.Errorf("candidatos inválidos: %v", err)
+		}
+		if err := json.Unmarshal(draw.Settings, &settings); err != nil {
+			return result, fmt.Errorf("configuración inválida: %v", err)
+		}
+		_ = json.Unmarshal(draw.Selected, &result.Selected)
+		for _, item := range runMarketDraw(rng, candidates, settings) {
+			result.Recomputed = append(result.Recomputed, item.ID)
+		}
+	}
+	result.SelectionMatches = len(result.Selected) == len(result.Recomputed)
+	for i := 0; result.SelectionMatches && i < len(result.Selected); i++ {
+		result.SelectionMatches = result.Selected[i] == result.Recomputed[i]
+	}
+
+	result.FIAOffersMatch = true
+	for _, offer := range fiaOffers {
+		fiaSettings := models.LeagueSettings{FIAMinMultiplier: offer.MinMultiplier, FIAMaxMultiplier: offer.MaxMultiplier}
+		if math.Abs(generateFIAOffer(rng, fiaSettings, offer.SaleValue)-offer.Offer) > 0.005 {
+			result.FIAOffersMatch = false
+		}
+	}
+
+	result.Valid = result.HashMatches && result.SelectionMatches && result.FIAOffersMatch
+	return result, nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"f1-fantasy-app/models"
+)
+
+const testSeed = "4f1c0a3e9b7d2c6e8a5f1b3d7c9e2a4b6d8f0a1c3e5b7d9f2a4c6e8b0d1f3a5c"
+
+// testDrawCandidates son elementos libres de los cuatro tipos
+func testDrawCandidates() []drawCandidate {
+	candidates := []drawCandidate{}
+	id := uint(1)
+	for _, itemType := range marketItemTypes {
+		for i := 0; i < 5; i++ {
+			candidates = append(candidates, drawCandidate{MarketItemID: id, ItemType: itemType, ItemID: id + 100, Weight: float64(i + 1)})
+			id++
+		}
+	}
+	return candidates
+}
+
+// revealedTestDraw hace el sorteo como refreshMarketForLeague: compromete el
+// hash, elige el mercado y genera las ofertas FIA con el mismo generador, y
+// devuelve el sorteo revelado tal y como se guarda
+func revealedTestDraw(t *testing.T) models.MarketDraw {
+	t.Helper()
+	settings := defaultMarketSettings(7)
+	candidates := testDrawCandidates()
+	draw := models.MarketDraw{ID: 1, LeagueID: 7, Kind: drawKindMarket, Seed: testSeed, SeedHash: hashSeed(testSeed), CommittedAt: time.Now()}
+
+	rng := drawRand(draw.Seed)
+	selected := runMarketDraw(rng, candidates, settings)
+	if len(selected) != settings.TotalSlots {
+		t.Fatalf("seleccionados %d, want %d", len(selected), settings.TotalSlots)
+	}
+	fiaSettings := defaultLeagueSettings(7)
+	offers := []drawFIAOffer{}
+	for i, sale := range []float64{12000000, 8500000} {
+		offers = append(offers, drawFIAOffer{ItemType: "pilot", ItemID: uint(i + 1), SaleValue: sale, Offer: generateFIAOffer(rng, fiaSettings, sale), MinMultiplier: fiaSettings.FIAMinMultiplier, MaxMultiplier: fiaSettings.FIAMaxMultiplier})
+	}
+
+	selectedIDs := []uint{}
+	for _, item := range selected {
+		selectedIDs = append(selectedIDs, item.ID)
+	}
+	now := time.Now()
+	draw.Candidates, _ = json.Marshal(candidates)
+	draw.Settings, _ = json.Marshal(settings)
+	draw.Selected, _ = json.Marshal(selectedIDs)
+	draw.FIAOffers, _ = json.Marshal(offers)
+	draw.RevealedAt = &now
+	return draw
+}
+
+func TestVerifyMarketDrawRoundTrip(t *testing.T) {
+	draw := revealedTestDraw(t)
+	v, err := verifyMarketDraw(draw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.Valid || !v.HashMatches || !v.SelectionMatches || !v.FIAOffersMatch {
+		t.Fatalf("sorteo legítimo no verifica: %+v", v)
+	}
+
+	// El mismo sorteo con la misma semilla elige lo mismo
+	again := revealedTestDraw(t)
+	if string(again.Selected) != string(draw.Selected) {
+		t.Fatalf("el sorteo no es determinista: %s != %s", again.Selected, draw.Selected)
+	}
+}
+
+func TestVerifyMarketDrawTampered(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(d *models.MarketDraw)
+		check  func(v drawVerification) bool
+	}{
+		{"semilla distinta de la comprometida", func(d *models.MarketDraw) {
+			d.Seed = "00" + d.Seed[2:]
+		}, func(v drawVerification) bool { return !v.HashMatches }},
+		{"selección cambiada", func(d *models.MarketDraw) {
+			var ids []uint
+			_ = json.Unmarshal(d.Selected, &ids)
+			ids[0], ids[1] = ids[1], ids[0]
+			d.Selected, _ = json.Marshal(ids)
+		}, func(v drawVerification) bool { return v.HashMatches && !v.SelectionMatches }},
+		{"elemento sustituido", func(d *models.MarketDraw) {
+			var ids []uint
+			_ = json.Unmarshal(d.Selected, &ids)
+			ids[len(ids)-1] = 999
+			d.Selected, _ = json.Marshal(ids)
+		}, func(v drawVerification) bool { return !v.SelectionMatches }},
+		{"oferta FIA cambiada", func(d *models.MarketDraw) {
+			var offers []drawFIAOffer
+			_ = json.Unmarshal(d.FIAOffers, &offers)
+			offers[1].Offer += 1000
+			d.FIAOffers, _ = json.Marshal(offers)
+		}, func(v drawVerification) bool { return v.SelectionMatches && !v.FIAOffersMatch }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			draw := revealedTestDraw(t)
+			tt.tamper(&draw)
+			v, err := verifyMarketDraw(draw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v.Valid || !tt.check(v) {
+				t.Fatalf("sorteo manipulado verifica: %+v", v)
+			}
+		})
+	}
+}
+
+func TestVerifyMarketDrawNotRevealed(t *testing.T) {
+	draw := revealedTestDraw(t)
+	draw.RevealedAt = nil
+	if _, err := verifyMarketDraw(draw); err == nil {
+		t.Fatal("un sorteo sin revelar no debería poder verificarse")
+	}
+}
+
+// Las ofertas FIA fuera del refresco solo tienen ofertas, sin candidatos
+func TestVerifyFIADraw(t *testing.T) {
+	settings := defaultLeagueSettings(7)
+	rng := drawRand(testSeed)
+	offers := []drawFIAOffer{}
+	for i, sale := range []float64{5000000, 9000000, 15000000} {
+		offers = append(offers, drawFIAOffer{ItemType: "chief_engineer", ItemID: uint(i + 1), SaleValue: sale, Offer: generateFIAOffer(rng, settings, sale), MinMultiplier: settings.FIAMinMultiplier, MaxMultiplier: settings.FIAMaxMultiplier})
+	}
+	now := time.Now()
+	draw := models.MarketDraw{ID: 2, LeagueID: 7, Kind: drawKindFIA, Seed: testSeed, SeedHash: hashSeed(testSeed), RevealedAt: &now}
+	draw.FIAOffers, _ = json.Marshal(offers)
+
+	v, err := verifyMarketDraw(draw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.Valid {
+		t.Fatalf("sorteo FIA legítimo no verifica: %+v", v)
+	}
+
+	offers[0], offers[1] = offers[1], offers[0]
+	draw.FIAOffers, _ = json.Marshal(offers)
+	if v, _ := verifyMarketDraw(draw); v.Valid {
+		t.Fatalf("ofertas FIA reordenadas verifican: %+v", v)
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math"
+
+	"f1-fantasy-app/database"
+	"f1-fantasy-app/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Cuenta contable de la propia liga (banca, FIA, subastas sin vendedor)
+const ledgerLeagueAccount = 0
+
+// Motivos de los asientos del libro mayor
+const (
+	ledgerReasonOpeningBalance  = "opening_balance"
+	ledgerReasonInitialBalance  = "initial_balance"
+	ledgerReasonAuction         = "auction"
+	ledgerReasonLeagueOffer     = "league_offer"
+	ledgerReasonClausula        = "clausula"
+	ledgerReasonClausulaUpgrade = "clausula_upgrade"
+	ledgerReasonClausulaChip    = "clausula_chip"
+	ledgerReasonPlayerOffer     = "player_offer"
+)
+
+// newTransferID genera un identificador aleatorio que agrupa los dos asientos de un movimiento
+func newTransferID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// openLedgerAccount registra el saldo actual de un manager como asiento de
+// apertura si aún no tiene asientos: un cargo a la cuenta de la liga y un
+// abono al manager. Así las cuentas anteriores al libro mayor también se
+// pueden reconstruir.
+func openLedgerAccount(tx *gorm.DB, pl *models.PlayerByLeague, reason string) error {
+	var count int64
+	if err := tx.Model(&models.LedgerEntry{}).Where("league_id = ? AND player_id = ?", pl.LeagueID, pl.PlayerID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	leagueBalance, err := leagueAccountBalance(tx, pl.LeagueID)
+	if err != nil {
+		return err
+	}
+	transferID := newTransferID()
+	return tx.Create(&[]models.LedgerEntry{
+		{
+			TransferID:     transferID,
+			LeagueID:       pl.LeagueID,
+			PlayerID:       ledgerLeagueAccount,
+			CounterpartyID: pl.PlayerID,
+			Direction:      "debit",
+			Amount:         pl.Money,
+			Reason:         reason,
+			BalanceAfter:   leagueBalance - pl.Money,
+		},
+		{
+			TransferID:     transferID,
+			LeagueID:       pl.LeagueID,
+			PlayerID:       pl.PlayerID,
+			CounterpartyID: ledgerLeagueAccount,
+			Direction:      "credit",
+			Amount:         pl.Money,
+			Reason:         reason,
+			BalanceAfter:   pl.Money,
+		},
+	}).Error
+}
+
+// openLedgerAccountTx ejecuta openLedgerAccount en su propia transacción
+func openLedgerAccountTx(pl *models.PlayerByLeague, reason string) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		return openLedgerAccount(tx, pl, reason)
+	})
+}
+
+// leagueAccountBalance devuelve el saldo de la cuenta de la liga según su
+// último asiento. Bloquea la fila de la liga hasta el final de la transacción
+// para que dos movimientos simultáneos no partan del mismo saldo, y lee el
+// último asiento con lectura bloqueante para ver el más reciente confirmado.
+func leagueAccountBalance(tx *gorm.DB, leagueID uint64) (float64, error) {
+	var league models.League
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&league, leagueID).Error; err != nil {
+		return 0, fmt.Errorf("liga %d no encontrada: %v", leagueID, err)
+	}
+	var last models.LedgerEntry
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("league_id = ? AND player_id = ?", leagueID, ledgerLeagueAccount).
+		Order("id desc").Limit(1).Find(&last).Error
+	return last.BalanceAfter, err
+}
+
+// moveMoney mueve dinero de un manager a otro dentro de una liga y registra los
+// dos asientos. from o to a nil representan la cuenta de la liga. Actualiza
+// Money en los structs recibidos y guarda solo esa columna, por lo que el
+// llamador puede seguir modificando y guardando el resto de campos.
+func moveMoney(tx *gorm.DB, leagueID uint64, from, to *models.PlayerByLeague, amount float64, itemType string, itemID uint, reason string) error {
+	if amount < 0 {
+		return fmt.Errorf("importe negativo: %.2f", amount)
+	}
+	transferID := newTransferID()
+
+	fromID, toID := uint64(ledgerLeagueAccount), uint64(ledgerLeagueAccount)
+	if from != nil {
+		fromID = from.PlayerID
+	}
+	if to != nil {
+		toID = to.PlayerID
+	}
+
+	legs := []struct {
+		pl           *models.PlayerByLeague
+		playerID     uint64
+		counterparty uint64
+		direction    string
+		delta        float64
+	}{
+		{from, fromID, toID, "debit", -amount},
+		{to, toID, fromID, "credit", amount},
+	}
+
+	for _, leg := range legs {
+		var balance float64
+		if leg.pl != nil {
+			if err := openLedgerAccount(tx, leg.pl, ledgerReasonOpeningBalance); err != nil {
+				return err
+			}
+			leg.pl.Money += leg.delta
+			if err := tx.Model(&models.PlayerByLeague{}).Where("id = ?", leg.pl.ID).Update("money", leg.pl.Money).Error; err != nil {
+				return err
+			}
+			balance = leg.pl.Money
+		} else {
+			leagueBalance, err := leagueAccountBalance(tx, leagueID)
+			if err != nil {
+				return err
+			}
+			balance = leagueBalance + leg.delta
+		}
+
+		entry := models.LedgerEntry{
+			TransferID:     transferID,
+			LeagueID:       leagueID,
+			PlayerID:       leg.playerID,
+			CounterpartyID: leg.counterparty,
+			Direction:      leg.direction,
+			Amount:         amount,
+			ItemType:       itemType,
+			ItemID:         itemID,
+			Reason:         reason,
+			BalanceAfter:   balance,
+		}
+		if err := tx.Create(&entry).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// moveMoneyTx ejecuta moveMoney en su propia transacción
+func moveMoneyTx(leagueID uint64, from, to *models.PlayerByLeague, amount float64, itemType string, itemID uint, reason string) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		return moveMoney(tx, leagueID, from, to, amount, itemType, itemID, reason)
+	})
+}
+
+// ledgerReconciliation es el resultado de reconstruir el saldo de un manager
+type ledgerReconciliation struct {
+	LeagueID      uint64  `json:"league_id"`
+	PlayerID      uint64  `json:"player_id"`
+	Entries       int     `json:"entries"`
+	Credits       float64 `json:"credits"`
+	Debits        float64 `json:"debits"`
+	LedgerBalance float64 `json:"ledger_balance"`
+	StoredMoney   float64 `json:"stored_money"`
+	Drift         float64 `json:"drift"`
+	Consistent    bool    `json:"consistent"`
+}
+
+// reconcileLedger reconstruye el saldo de un manager a partir de sus asientos y
+// lo compara con PlayerByLeague.Money
+func reconcileLedger(pl models.PlayerByLeague) (ledgerReconciliation, error) {
+	result := ledgerReconciliation{LeagueID: pl.LeagueID, PlayerID: pl.PlayerID, StoredMoney: pl.Money}
+
+	var entries []models.LedgerEntry
+	if err := database.DB.Where("league_id = ? AND player_id = ?", pl.LeagueID, pl.PlayerID).Order("id asc").Find(&entries).Error; err != nil {
+		return result, err
+	}
+	for _, e := range entries {
+		if e.Direction == "credit" {
+			result.Credits += e.Amount
+		} else {
+			result.Debits += e.Amount
+		}
+	}
+	result.Entries = len(entries)
+	result.LedgerBalance = result.Credits - result.Debits
+	result.Drift = math.Round((pl.Money-result.LedgerBalance)*100) / 100
+	result.Consistent = result.Drift == 0
+	return result, nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+
+	"f1-fantasy-app/database"
+	"f1-fantasy-app/models"
+)
+
+// Límites de la alineación (fantasy_f_1_rules.md, sección 2)
+var lineupSlotLimits = map[string]int{
+	"race_pilots":       2,
+	"qualifying_pilots": 2,
+	"practice_pilots":   1,
+	"track_engineers":   1,
+}
+
+// Modo de carta que admite cada hueco de pilotos
+var lineupSlotModes = map[string]string{
+	"race_pilots":       "R",
+	"qualifying_pilots": "Q",
+	"practice_pilots":   "P",
+}
+
+// lineupSlotError es un error de un hueco concreto de la alineación
+type lineupSlotError struct {
+	Slot  string `json:"slot"`
+	Index int    `json:"index"`        // Posición dentro del hueco
+	ID    uint   `json:"id,omitempty"` // ID por liga de la carta
+	Error string `json:"error"`
+}
+
+// lineupSelection son las cartas que un manager quiere alinear en un GP
+type lineupSelection struct {
+	RacePilots        []uint
+	QualifyingPilots  []uint
+	PracticePilots    []uint
+	SprintPilots      []uint
+	BenchPilots       map[string][]uint
+	TeamConstructorID *uint
+	ChiefEngineerID   *uint
+	TrackEngineers    []uint
+}
+
+// lineupValidator acumula los errores de una alineación
+type lineupValidator struct {
+	userID   uint
+	leagueID uint
+	errors   []lineupSlotError
+	used     map[uint]bool
+}
+
+func (v *lineupValidator) add(slot string, index int, id uint, format string, args ...interface{}) {
+	v.errors = append(v.errors, lineupSlotError{Slot: slot, Index: index, ID: id, Error: fmt.Sprintf(format, args...)})
+}
+
+// ownedPilot carga un piloto por liga del manager y su carta global
+func (v *lineupValidator) ownedPilot(slot string, index int, id uint) (models.Pilot, bool) {
+	var pbl models.PilotByLeague
+	var pilot models.Pilot
+	if database.DB.Where("id = ? AND league_id = ?", id, v.leagueID).First(&pbl).Error != nil {
+		v.add(slot, index, id, "El piloto %d no existe en esta liga", id)
+		return pilot, false
+	}
+	if pbl.OwnerID != v.userID {
+		v.add(slot, index, id, "El piloto %d no es tuyo", id)
+		return pilot, false
+	}
+	if database.DB.First(&pilot, pbl.PilotID).Error != nil {
+		v.add(slot, index, id, "Carta de piloto %d no encontrada", pbl.PilotID)
+		return pilot, false
+	}
+	return pilot, true
+}
+
+// checkPilots valida un hueco de pilotos: propiedad, modo de la carta, sin
+// repetir y como mucho un piloto por escudería
+func (v *lineupValidator) checkPilots(slot string, ids []uint, mode string) {
+	if limit, ok := lineupSlotLimits[slot]; ok && len(ids) > limit {
+		v.add(slot, limit, 0, "Como mucho %d cartas en %s", limit, slot)
+	}
+	teams := make(map[string]bool)
+	for i, id := range ids {
+		if v.used[id] {
+			v.add(slot, i, id, "El piloto %d ya está en la alineación", id)
+			continue
+		}
+		v.used[id] = true
+		pilot, ok := v.ownedPilot(slot, i, id)
+		if !ok {
+			continue
+		}
+		if pilot.Mode != mode {
+			v.add(slot, i, id, "%s es carta de modo %s y el hueco es de modo %s", pilot.DriverName, pilot.Mode, mode)
+			continue
+		}
+		if teams[pilot.Team] {
+			v.add(slot, i, id, "Solo se puede alinear un piloto de %s en %s", pilot.Team, slot)
+		}
+		teams[pilot.Team] = true
+	}
+}
+
+// checkSprintPilots valida el hueco de sprint: cartas propias de carrera o de
+// clasificación
+func (v *lineupValidator) checkSprintPilots(ids []uint) {
+	for i, id := range ids {
+		pilot, ok := v.ownedPilot("sprint_pilots", i, id)
+		if ok && sprintSessionName(pilot.Mode) == "" {
+			v.add("sprint_pilots", i, id, "%s no puede puntuar en la sprint", pilot.DriverName)
+		}
+	}
+}
+
+// checkBench valida que los suplentes sean propios y del modo de su sesión
+func (v *lineupValidator) checkBench(bench map[string][]uint) {
+	for _, session := range benchSessions {
+		slot := "bench_pilots." + session
+		for i, id := range bench[session] {
+			pilot, ok := v.ownedPilot(slot, i, id)
+			if ok && pilotSessionName(pilot.Mode) != session {
+				v.add(slot, i, id, "%s no es carta de %s", pilot.DriverName, session)
+			}
+		}
+	}
+}
+
+// checkTrackEngineers valida que cada track engineer sea propio y que el
+// manager tenga en la liga un piloto de ese track engineer
+func (v *lineupValidator) checkTrackEngineers(ids []uint) {
+	const slot = "track_engineers"
+	if limit := lineupSlotLimits[slot]; len(ids) > limit {
+		v.add(slot, limit, 0, "Como mucho %d cartas en %s", limit, slot)
+	}
+	for i, id := range ids {
+		var teb models.TrackEngineerByLeague
+		if database.DB.Where("id = ? AND league_id = ?", id, v.leagueID).First(&teb).Error != nil {
+			v.add(slot, i, id, "El track engineer %d no existe en esta liga", id)
+			continue
+		}
+		if teb.OwnerID != v.userID {
+			v.add(slot, i, id, "El track engineer %d no es tuyo", id)
+			continue
+		}
+		var owned int64
+		database.DB.Table("pilot_by_leagues").
+			Joins("JOIN pilots ON pilots.id = pilot_by_leagues.pilot_id").
+			Where("pilot_by_leagues.league_id = ? AND pilot_by_leagues.owner_id = ? AND pilots.track_engineer_id = ?", v.leagueID, v.userID, teb.TrackEngineerID).
+			Count(&owned)
+		if owned == 0 {
+			v.add(slot, i, id, "No tienes ningún piloto del track engineer %d", id)
+		}
+	}
+}
+
+// validateLineup comprueba una alineación contra las reglas de la plantilla y
+// devuelve los errores de cada hueco (vacío si es válida)
+func validateLineup(userID, leagueID uint, sel lineupSelection) []lineupSlotError {
+	v := &lineupValidator{userID: userID, leagueID: leagueID, used: make(map[uint]bool)}
+
+	v.checkPilots("race_pilots", sel.RacePilots, lineupSlotModes["race_pilots"])
+	v.checkPilots("qualifying_pilots", sel.QualifyingPilots, lineupSlotModes["qualifying_pilots"])
+	v.checkPilots("practice_pilots", sel.PracticePilots, lineupSlotModes["practice_pilots"])
+	v.checkSprintPilots(sel.SprintPilots)
+	v.checkBench(sel.BenchPilots)
+
+	if sel.TeamConstructorID != nil {
+		var tcb models.TeamConstructorByLeague
+		if database.DB.Where("id = ? AND league_id = ?", *sel.TeamConstructorID, leagueID).First(&tcb).Error != nil {
+			v.add("team_constructor_id", 0, *sel.TeamConstructorID, "El constructor %d no existe en esta liga", *sel.TeamConstructorID)
+		} else if tcb.OwnerID != userID {
+			v.add("team_constructor_id", 0, *sel.TeamConstructorID, "El constructor %d no es tuyo", *sel.TeamConstructorID)
+		}
+	}
+	if sel.ChiefEngineerID != nil {
+		var ceb models.ChiefEngineerByLeague
+		if database.DB.Where("id = ? AND league_id = ?", *sel.ChiefEngineerID, leagueID).First(&ceb).Error != nil {
+			v.add("chief_engineer_id", 0, *sel.ChiefEngineerID, "El chief engineer %d no existe en esta liga", *sel.ChiefEngineerID)
+		} else if ceb.OwnerID != userID {
+			v.add("chief_engineer_id", 0, *sel.ChiefEngineerID, "El chief engineer %d no es tuyo", *sel.ChiefEngineerID)
+		}
+	}
+	v.checkTrackEngineers(sel.TrackEngineers)
+
+	return v.errors
+}
+
+// withoutSlots quita los errores de los grupos indicados
+func withoutSlots(errs []lineupSlotError, slots map[string]bool) []lineupSlotError {
+	kept := []lineupSlotError{}
+	for _, e := range errs {
+		if !slots[e.Slot] {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
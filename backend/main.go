@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math"
@@ -21,6 +22,7 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/joho/godotenv"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 var jwtSecret = []byte("mysecretkey")
@@ -105,6 +107,42 @@ func authMiddleware() gin.HandlerFunc {
 	}
 }
 
+// requireAdmin comprueba que el usuario autenticado sea administrador y, si no
+// lo es, responde con el error correspondiente
+func requireAdmin(c *gin.Context) bool {
+	var player models.Player
+	if err := database.DB.First(&player, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(404, gin.H{"error": "Usuario no encontrado"})
+		return false
+	}
+	if !player.IsAdmin {
+		c.JSON(403, gin.H{"error": "No tienes permisos de administrador"})
+		return false
+	}
+	return true
+}
+
+// optionalUserID devuelve el usuario del token si viene uno válido, o 0 si no.
+// Sirve para endpoints públicos que muestran más datos al usuario autenticado.
+func optionalUserID(c *gin.Context) uint {
+	tokenString := strings.TrimSpace(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+	if tokenString == "" {
+		return 0
+	}
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return jwtSecret, nil
+	})
+	if err != nil || !token.Valid {
+		return 0
+	}
+	userIDFloat, ok := claims["user_id"].(float64)
+	if !ok {
+		return 0
+	}
+	return uint(userIDFloat)
+}
+
 // Modificar el modelo Auction para añadir bids como array json
 type Bid struct {
 	PlayerID uint    `json:"player_id"`
@@ -122,12 +160,6 @@ type Auction struct {
 	UpdatedAt time.Time
 }
 
-var marketNextRefresh = time.Now().Add(24 * time.Hour)
-
-func updateMarketNextRefresh() {
-	marketNextRefresh = time.Now().Add(24 * time.Hour)
-}
-
 // Función para actualizar la propiedad de elementos en PlayerByLeague
 
 func refreshMarketForLeague(leagueID uint) error {
@@ -198,8 +230,9 @@ func refreshMarketForLeague(leagueID uint) error {
 	}
 	log.Printf("[refreshMarketForLeague] Desglose - Pilotos: %d, Track Engineers: %d, Chief Engineers: %d, Team Constructors: %d", pilotCount, trackEngCount, chiefEngCount, teamConsCount)
 
-	// 3. Verificar si hay suficientes elementos libres (mínimo 8)
-	selectedCount := 8
+	// 3. Verificar si hay suficientes elementos libres para los huecos de la liga
+	settings := loadMarketSettings(leagueID)
+	selectedCount := settings.TotalSlots
 	if len(freeItems) < selectedCount {
 		log.Printf("[refreshMarketForLeague] ADVERTENCIA: Solo hay %d elementos libres, verificando si se pueden crear más...", len(freeItems))
 
@@ -248,13 +281,20 @@ func refreshMarketForLeague(leagueID uint) error {
 		}
 	}
 
-	// Mezclar aleatoriamente usando Fisher-Yates shuffle
-	for i := len(freeItems) - 1; i > 0; i-- {
-		j := rand.Intn(i + 1)
-		freeItems[i], freeItems[j] = freeItems[j], freeItems[i]
+	// Seleccionar respetando mínimos/máximos por tipo y la ponderación de la liga.
+	// El azar sale de la semilla comprometida para este sorteo.
+	settings.TotalSlots = selectedCount
+	draw, err := pendingMarketDraw(leagueID)
+	if err != nil {
+		return fmt.Errorf("error obteniendo la semilla del sorteo: %v", err)
 	}
-
-	selectedItems := freeItems[:selectedCount]
+	log.Printf("[refreshMarketForLeague] Sorteo %d con semilla comprometida %s", draw.ID, draw.SeedHash)
+	candidates := make([]drawCandidate, len(freeItems))
+	for i, item := range freeItems {
+		candidates[i] = drawCandidate{MarketItemID: item.ID, ItemType: item.ItemType, ItemID: item.ItemID, Weight: marketItemWeight(item, settings.Weighting)}
+	}
+	rng := drawRand(draw.Seed)
+	selectedItems := runMarketDraw(rng, candidates, settings)
 	log.Printf("[refreshMarketForLeague] Elementos seleccionados para el mercado: %d de %d disponibles", len(selectedItems), len(freeItems))
 
 	// Mostrar qué se seleccionó
@@ -263,107 +303,140 @@ func refreshMarketForLeague(leagueID uint) error {
 	}
 
 	// 4. Marcar elementos seleccionados como en el mercado y crear subastas
-	// Primero, desmarcar todos los elementos del mercado anterior
-	result := database.DB.Model(&models.MarketItem{}).Where("league_id = ?", leagueID).Update("is_in_market", false)
-	log.Printf("[refreshMarketForLeague] Desmarcados %d elementos del mercado anterior", result.RowsAffected)
+	leagueSettings := loadLeagueSettings(database.DB, leagueID)
+	// Los candidatos, sus pesos y el resultado se guardan en la misma
+	// transacción que aplica el sorteo, para que siempre se pueda auditar
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := storeMarketDraw(tx, &draw, candidates, settings, selectedItems); err != nil {
+			return err
+		}
+		// Primero, desmarcar todos los elementos del mercado anterior
+		result := tx.Model(&models.MarketItem{}).Where("league_id = ?", leagueID).Update("is_in_market", false)
+		if result.Error != nil {
+			return result.Error
+		}
+		log.Printf("[refreshMarketForLeague] Desmarcados %d elementos del mercado anterior", result.RowsAffected)
 
-	for i, item := range selectedItems {
-		// Marcar este elemento como en el mercado
-		updateResult := database.DB.Model(&models.MarketItem{}).Where("id = ?", item.ID).Update("is_in_market", true)
-		log.Printf("[refreshMarketForLeague] Elemento %d marcado: ID=%d, Tipo=%s, RowsAffected=%d", i+1, item.ID, item.ItemType, updateResult.RowsAffected)
+		for i, item := range selectedItems {
+			// Marcar este elemento como en el mercado
+			updateResult := tx.Model(&models.MarketItem{}).Where("id = ?", item.ID).Update("is_in_market", true)
+			if updateResult.Error != nil {
+				return updateResult.Error
+			}
+			log.Printf("[refreshMarketForLeague] Elemento %d marcado: ID=%d, Tipo=%s, RowsAffected=%d", i+1, item.ID, item.ItemType, updateResult.RowsAffected)
 
-		switch item.ItemType {
-		case "pilot":
-			// Para pilotos, crear subasta
-			var pbl models.PilotByLeague
-			if err := database.DB.First(&pbl, item.ItemID).Error; err == nil {
-				// Verificar si ya existe subasta activa
-				var existingAuction Auction
-				if err := database.DB.Where("item_type = ? AND item_id = ? AND league_id = ? AND end_time > ?", "pilot", pbl.ID, leagueID, time.Now()).First(&existingAuction).Error; err != nil {
-					// No existe, crear nueva
-					auction := Auction{
-						ItemType: "pilot",
-						ItemID:   pbl.ID,
-						LeagueID: leagueID,
-						EndTime:  time.Now().Add(24 * time.Hour),
-						Bids:     []byte("[]"),
+			switch item.ItemType {
+			case "pilot":
+				// Para pilotos, crear subasta
+				var pbl models.PilotByLeague
+				if err := tx.First(&pbl, item.ItemID).Error; err == nil {
+					// Verificar si ya existe subasta activa
+					var existingAuction Auction
+					if err := tx.Where("item_type = ? AND item_id = ? AND league_id = ? AND end_time > ?", "pilot", pbl.ID, leagueID, time.Now()).First(&existingAuction).Error; err != nil {
+						// No existe, crear nueva
+						auction := Auction{
+							ItemType: "pilot",
+							ItemID:   pbl.ID,
+							LeagueID: leagueID,
+							EndTime:  auctionEndTime(leagueSettings),
+							Bids:     []byte("[]"),
+						}
+						if err := tx.Create(&auction).Error; err != nil {
+							return err
+						}
+						log.Printf("[refreshMarketForLeague] Subasta creada para pilot ID %d", pbl.ID)
+					} else {
+						log.Printf("[refreshMarketForLeague] Subasta ya existe para pilot ID %d", pbl.ID)
 					}
-					database.DB.Create(&auction)
-					log.Printf("[refreshMarketForLeague] Subasta creada para pilot ID %d", pbl.ID)
-				} else {
-					log.Printf("[refreshMarketForLeague] Subasta ya existe para pilot ID %d", pbl.ID)
 				}
-			}
-		case "track_engineer":
-			// Crear subasta para track engineer
-			var teb models.TrackEngineerByLeague
-			if err := database.DB.First(&teb, item.ItemID).Error; err == nil {
-				// Verificar si ya existe subasta activa
-				var existingAuction Auction
-				if err := database.DB.Where("item_type = ? AND item_id = ? AND league_id = ? AND end_time > ?", "track_engineer", teb.ID, leagueID, time.Now()).First(&existingAuction).Error; err != nil {
-					// No existe, crear nueva
-					auction := Auction{
-						ItemType: "track_engineer",
-						ItemID:   teb.ID,
-						LeagueID: leagueID,
-						EndTime:  time.Now().Add(24 * time.Hour),
-						Bids:     []byte("[]"),
+			case "track_engineer":
+				// Crear subasta para track engineer
+				var teb models.TrackEngineerByLeague
+				if err := tx.First(&teb, item.ItemID).Error; err == nil {
+					// Verificar si ya existe subasta activa
+					var existingAuction Auction
+					if err := tx.Where("item_type = ? AND item_id = ? AND league_id = ? AND end_time > ?", "track_engineer", teb.ID, leagueID, time.Now()).First(&existingAuction).Error; err != nil {
+						// No existe, crear nueva
+						auction := Auction{
+							ItemType: "track_engineer",
+							ItemID:   teb.ID,
+							LeagueID: leagueID,
+							EndTime:  auctionEndTime(leagueSettings),
+							Bids:     []byte("[]"),
+						}
+						if err := tx.Create(&auction).Error; err != nil {
+							return err
+						}
+						log.Printf("[refreshMarketForLeague] Subasta creada para track engineer ID %d", teb.ID)
 					}
-					database.DB.Create(&auction)
-					log.Printf("[refreshMarketForLeague] Subasta creada para track engineer ID %d", teb.ID)
 				}
-			}
-		case "chief_engineer":
-			// Crear subasta para chief engineer
-			var ceb models.ChiefEngineerByLeague
-			if err := database.DB.First(&ceb, item.ItemID).Error; err == nil {
-				// Verificar si ya existe subasta activa
-				var existingAuction Auction
-				if err := database.DB.Where("item_type = ? AND item_id = ? AND league_id = ? AND end_time > ?", "chief_engineer", ceb.ID, leagueID, time.Now()).First(&existingAuction).Error; err != nil {
-					// No existe, crear nueva
-					auction := Auction{
-						ItemType: "chief_engineer",
-						ItemID:   ceb.ID,
-						LeagueID: leagueID,
-						EndTime:  time.Now().Add(24 * time.Hour),
-						Bids:     []byte("[]"),
+			case "chief_engineer":
+				// Crear subasta para chief engineer
+				var ceb models.ChiefEngineerByLeague
+				if err := tx.First(&ceb, item.ItemID).Error; err == nil {
+					// Verificar si ya existe subasta activa
+					var existingAuction Auction
+					if err := tx.Where("item_type = ? AND item_id = ? AND league_id = ? AND end_time > ?", "chief_engineer", ceb.ID, leagueID, time.Now()).First(&existingAuction).Error; err != nil {
+						// No existe, crear nueva
+						auction := Auction{
+							ItemType: "chief_engineer",
+							ItemID:   ceb.ID,
+							LeagueID: leagueID,
+							EndTime:  auctionEndTime(leagueSettings),
+							Bids:     []byte("[]"),
+						}
+						if err := tx.Create(&auction).Error; err != nil {
+							return err
+						}
+						log.Printf("[refreshMarketForLeague] Subasta creada para chief engineer ID %d", ceb.ID)
 					}
-					database.DB.Create(&auction)
-					log.Printf("[refreshMarketForLeague] Subasta creada para chief engineer ID %d", ceb.ID)
 				}
-			}
-		case "team_constructor":
-			// Crear subasta para team constructor
-			var tcb models.TeamConstructorByLeague
-			if err := database.DB.First(&tcb, item.ItemID).Error; err == nil {
-				// Verificar si ya existe subasta activa
-				var existingAuction Auction
-				if err := database.DB.Where("item_type = ? AND item_id = ? AND league_id = ? AND end_time > ?", "team_constructor", tcb.ID, tcb.LeagueID, time.Now()).First(&existingAuction).Error; err != nil {
-					// No existe, crear nueva
-					auction := Auction{
-						ItemType: "team_constructor",
-						ItemID:   tcb.ID,
-						LeagueID: leagueID,
-						EndTime:  time.Now().Add(24 * time.Hour),
-						Bids:     []byte("[]"),
+			case "team_constructor":
+				// Crear subasta para team constructor
+				var tcb models.TeamConstructorByLeague
+				if err := tx.First(&tcb, item.ItemID).Error; err == nil {
+					// Verificar si ya existe subasta activa
+					var existingAuction Auction
+					if err := tx.Where("item_type = ? AND item_id = ? AND league_id = ? AND end_time > ?", "team_constructor", tcb.ID, tcb.LeagueID, time.Now()).First(&existingAuction).Error; err != nil {
+						// No existe, crear nueva
+						auction := Auction{
+							ItemType: "team_constructor",
+							ItemID:   tcb.ID,
+							LeagueID: leagueID,
+							EndTime:  auctionEndTime(leagueSettings),
+							Bids:     []byte("[]"),
+						}
+						if err := tx.Create(&auction).Error; err != nil {
+							return err
+						}
+						log.Printf("[refreshMarketForLeague] Subasta creada para team constructor ID %d", tcb.ID)
 					}
-					database.DB.Create(&auction)
-					log.Printf("[refreshMarketForLeague] Subasta creada para team constructor ID %d", tcb.ID)
 				}
 			}
 		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error aplicando el sorteo %d: %v", draw.ID, err)
 	}
 
 	log.Printf("[refreshMarketForLeague] Mercado actualizado con %d elementos seleccionados", len(selectedItems))
 
 	// 5. Generar ofertas de la FIA para elementos en venta
 	log.Printf("[refreshMarketForLeague] Generando ofertas de la FIA para elementos en venta")
-	if err := generateFIAOffersForLeague(leagueID); err != nil {
+	fiaOffers, err := generateFIAOffersForLeague(leagueID, rng)
+	if err != nil {
 		log.Printf("[refreshMarketForLeague] Error generando ofertas FIA: %v", err)
 	} else {
 		log.Printf("[refreshMarketForLeague] Ofertas de la FIA generadas correctamente")
 	}
 
+	// 6. Revelar la semilla para que se pueda verificar
+	if err := revealMarketDraw(draw, fiaOffers); err != nil {
+		log.Printf("[refreshMarketForLeague] Error guardando el sorteo %d: %v", draw.ID, err)
+	}
+
 	return nil
 }
 
@@ -400,6 +473,10 @@ func main() {
 	// Crear datos de teamconstructor si no existen
 	initializeTeamConstructors()
 
+	// Planificador de subastas, mercado y ofertas en segundo plano
+	startScheduler()
+	startScraperWorker()
+
 	router := gin.Default()
 
 	router.Use(func(c *gin.Context) {
@@ -447,6 +524,7 @@ func main() {
 			Name:         req.Name,
 			Email:        req.Email,
 			PasswordHash: string(hash),
+			Money:        defaultStartingMoney,
 		}
 		if err := database.DB.Create(&player).Error; err != nil {
 			c.JSON(500, gin.H{"error": "Error creating user"})
@@ -639,9 +717,10 @@ func main() {
 		}
 		log.Printf("[CREAR LIGA] user_id obtenido del contexto: %v (tipo: %T)", userID, userID)
 		league := models.League{
-			Name:     req.Name,
-			Code:     req.Code,
-			PlayerID: userID.(uint),
+			Name:           req.Name,
+			Code:           req.Code,
+			PlayerID:       userID.(uint),
+			ScoringVersion: activeScoringVersion(), // Las ligas nuevas usan las reglas vigentes
 		}
 		log.Printf("[CREAR LIGA] Liga a crear: Name=%s, Code=%s, PlayerID=%d", league.Name, league.Code, league.PlayerID)
 		if err := database.DB.Create(&league).Error; err != nil {
@@ -676,7 +755,7 @@ func main() {
 			playerByLeague := models.PlayerByLeague{
 				PlayerID:              userIDUint64,
 				LeagueID:              uint64(league.ID),
-				Money:                 100000000, // 100M
+				Money:                 loadLeagueSettings(database.DB, league.ID).StartingMoney,
 				TeamValue:             0,
 				OwnedPilots:           "[]",
 				OwnedTrackEngineers:   "[]",
@@ -692,6 +771,9 @@ func main() {
 				return
 			} else {
 				log.Printf("[CREAR LIGA] ✅ Registro player_by_league creado para player_id=%d, league_id=%d", playerByLeague.PlayerID, playerByLeague.LeagueID)
+				if err := openLedgerAccountTx(&playerByLeague, ledgerReasonInitialBalance); err != nil {
+					log.Printf("[CREAR LIGA] Error registrando saldo inicial en ledger: %v", err)
+				}
 			}
 		}
 		// Poblar ingenieros de pista para el primer GP
@@ -1047,7 +1129,7 @@ func main() {
 		c.JSON(200, gin.H{"message": "Liga eliminada completamente por el administrador"})
 	})
 
-	// Endpoint para editar el nombre de una liga
+	// Endpoint para editar el nombre, el modo de subasta y la versión de reglas de una liga
 	router.PUT("/api/leagues/:id", authMiddleware(), func(c *gin.Context) {
 		id := c.Param("id")
 		var league models.League
@@ -1056,13 +1138,48 @@ func main() {
 			return
 		}
 		var req struct {
-			Name string `json:"name"`
+			Name           string `json:"name"`
+			AuctionMode    string `json:"auction_mode"`
+			ScoringVersion int    `json:"scoring_version"`
 		}
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(400, gin.H{"error": "Datos inválidos"})
 			return
 		}
-		league.Name = req.Name
+		if req.Name != "" {
+			league.Name = req.Name
+		}
+		if req.AuctionMode != "" && req.AuctionMode != league.AuctionMode {
+			// Solo el creador de la liga puede cambiar el modo de subasta
+			if c.GetUint("user_id") != league.PlayerID {
+				c.JSON(403, gin.H{"error": "Solo el creador de la liga puede cambiar el modo de subasta"})
+				return
+			}
+			if !isValidAuctionMode(req.AuctionMode) {
+				c.JSON(400, gin.H{"error": "Modo de subasta inválido", "valid_modes": []string{auctionModeOpen, auctionModeSealedFirst, auctionModeSealedSecond}})
+				return
+			}
+			// No cambiar las reglas con subastas en curso
+			var activeAuctions int64
+			database.DB.Model(&Auction{}).Where("league_id = ? AND end_time > ?", league.ID, time.Now()).Count(&activeAuctions)
+			if activeAuctions > 0 {
+				c.JSON(400, gin.H{"error": "No se puede cambiar el modo de subasta con subastas activas"})
+				return
+			}
+			league.AuctionMode = req.AuctionMode
+		}
+		if req.ScoringVersion != 0 && req.ScoringVersion != league.ScoringVersion {
+			// Solo el creador de la liga puede cambiar las reglas de puntuación
+			if c.GetUint("user_id") != league.PlayerID {
+				c.JSON(403, gin.H{"error": "Solo el creador de la liga puede cambiar las reglas de puntuación"})
+				return
+			}
+			if _, ok := loadScoringRulesets()[req.ScoringVersion]; !ok {
+				c.JSON(400, gin.H{"error": "Versión de reglas inexistente", "valid_versions": scoringVersions()})
+				return
+			}
+			league.ScoringVersion = req.ScoringVersion
+		}
 		if err := database.DB.Save(&league).Error; err != nil {
 			c.JSON(500, gin.H{"error": "Error actualizando liga"})
 			return
@@ -1070,6 +1187,134 @@ func main() {
 		c.JSON(200, gin.H{"league": league})
 	})
 
+	// Endpoint para listar las versiones de reglas de puntuación disponibles
+	router.GET("/api/scoring/rulesets", func(c *gin.Context) {
+		rulesets := []ScoringRuleset{}
+		for _, v := range scoringVersions() {
+			rulesets = append(rulesets, scoringRuleset(v))
+		}
+		c.JSON(200, gin.H{"active_version": activeScoringVersion(), "rulesets": rulesets})
+	})
+
+	// Endpoint para consultar una versión concreta de las reglas de puntuación
+	router.GET("/api/scoring/rulesets/:version", func(c *gin.Context) {
+		version, err := strconv.Atoi(c.Param("version"))
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Versión inválida"})
+			return
+		}
+		ruleset, ok := loadScoringRulesets()[version]
+		if !ok {
+			c.JSON(404, gin.H{"error": "Versión de reglas no encontrada"})
+			return
+		}
+		c.JSON(200, gin.H{"ruleset": ruleset})
+	})
+
+	// Endpoint para consultar la configuración económica de una liga (solo el creador)
+	router.GET("/api/leagues/:id/settings", authMiddleware(), func(c *gin.Context) {
+		var league models.League
+		if err := database.DB.First(&league, c.Param("id")).Error; err != nil {
+			c.JSON(404, gin.H{"error": "Liga no encontrada"})
+			return
+		}
+		if c.GetUint("user_id") != league.PlayerID {
+			c.JSON(403, gin.H{"error": "Solo el creador de la liga puede ver la configuración"})
+			return
+		}
+		c.JSON(200, gin.H{"settings": loadLeagueSettings(database.DB, league.ID), "market": loadMarketSettings(league.ID)})
+	})
+
+	// Endpoint para cambiar la configuración económica de una liga (solo el creador)
+	router.PUT("/api/leagues/:id/settings", authMiddleware(), func(c *gin.Context) {
+		var league models.League
+		if err := database.DB.First(&league, c.Param("id")).Error; err != nil {
+			c.JSON(404, gin.H{"error": "Liga no encontrada"})
+			return
+		}
+		if c.GetUint("user_id") != league.PlayerID {
+			c.JSON(403, gin.H{"error": "Solo el creador de la liga puede cambiar la configuración"})
+			return
+		}
+		// Los campos que no se envían conservan su valor actual
+		settings := loadLeagueSettings(database.DB, league.ID)
+		settingsID := settings.ID
+		var req struct {
+			models.LeagueSettings
+			MarketSlots *int `json:"market_slots"`
+		}
+		req.LeagueSettings = settings
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": "Datos inválidos"})
+			return
+		}
+		settings = req.LeagueSettings
+		settings.ID, settings.LeagueID = settingsID, league.ID
+		if err := validateLeagueSettings(settings); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		market := loadMarketSettings(league.ID)
+		if req.MarketSlots != nil {
+			market.TotalSlots = *req.MarketSlots
+			if err := validateMarketSettings(market); err != nil {
+				c.JSON(400, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		var marketUpdate *models.LeagueMarketSettings
+		if req.MarketSlots != nil {
+			marketUpdate = &market
+		}
+		if err := saveLeagueSettings(&settings, marketUpdate); err != nil {
+			c.JSON(500, gin.H{"error": "Error guardando la configuración de la liga"})
+			return
+		}
+		log.Printf("[SETTINGS] Configuración actualizada para liga %d: %+v", league.ID, settings)
+		c.JSON(200, gin.H{"settings": settings, "market": market})
+	})
+
+	// Endpoint para consultar la configuración del mercado de una liga
+	router.GET("/api/leagues/:id/market-settings", authMiddleware(), func(c *gin.Context) {
+		var league models.League
+		if err := database.DB.First(&league, c.Param("id")).Error; err != nil {
+			c.JSON(404, gin.H{"error": "Liga no encontrada"})
+			return
+		}
+		c.JSON(200, gin.H{"settings": loadMarketSettings(league.ID)})
+	})
+
+	// Endpoint para cambiar la configuración del mercado (solo el creador de la liga)
+	router.PUT("/api/leagues/:id/market-settings", authMiddleware(), func(c *gin.Context) {
+		var league models.League
+		if err := database.DB.First(&league, c.Param("id")).Error; err != nil {
+			c.JSON(404, gin.H{"error": "Liga no encontrada"})
+			return
+		}
+		if c.GetUint("user_id") != league.PlayerID {
+			c.JSON(403, gin.H{"error": "Solo el creador de la liga puede cambiar el mercado"})
+			return
+		}
+		// Los campos que no se envían conservan su valor actual
+		settings := loadMarketSettings(league.ID)
+		settingsID := settings.ID
+		if err := c.ShouldBindJSON(&settings); err != nil {
+			c.JSON(400, gin.H{"error": "Datos inválidos"})
+			return
+		}
+		settings.ID, settings.LeagueID = settingsID, league.ID
+		if err := validateMarketSettings(settings); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err := database.DB.Save(&settings).Error; err != nil {
+			c.JSON(500, gin.H{"error": "Error guardando la configuración del mercado"})
+			return
+		}
+		log.Printf("[MARKET] Configuración del mercado actualizada para liga %d: %+v", league.ID, settings)
+		c.JSON(200, gin.H{"settings": settings})
+	})
+
 	// Endpoint para obtener todos los pilotos de una liga desde PilotByLeague
 	router.GET("/api/pilotsbyleague", func(c *gin.Context) {
 		leagueID := c.Query("league_id")
@@ -1254,7 +1499,7 @@ func main() {
 		}
 		// Crear subastas para esos pilotos
 		var auctions []Auction
-		endTime := time.Now().Add(24 * time.Hour)
+		endTime := auctionEndTime(loadLeagueSettings(database.DB, req.LeagueID))
 		for _, pbl := range libres {
 			auction := Auction{
 				ItemType: "pilot",
@@ -1268,7 +1513,7 @@ func main() {
 		c.JSON(201, gin.H{"auctions": auctions})
 	})
 
-	// Endpoint para finalizar una subasta y asignar el piloto al ganador
+	// Endpoint para finalizar una subasta y asignar el elemento al ganador
 	router.POST("/api/auctions/finish", authMiddleware(), func(c *gin.Context) {
 		var req struct {
 			AuctionID uint `json:"auction_id"`
@@ -1287,82 +1532,27 @@ func main() {
 			c.JSON(400, gin.H{"error": "La subasta aún no ha terminado"})
 			return
 		}
-		// Buscar el piloto en la liga
-		var pbl models.PilotByLeague
-		if err := database.DB.First(&pbl, auction.ItemID).Error; err != nil {
-			c.JSON(404, gin.H{"error": "Piloto en subasta no encontrado"})
+		result, err := settleAuction(auction)
+		if err != nil {
+			log.Printf("[AUCTION-FINISH] Error finalizando subasta %d: %v", auction.ID, err)
+			c.JSON(400, gin.H{"error": "No se pudo finalizar la subasta", "details": err.Error()})
 			return
 		}
-		// Obtener las pujas
-		var bids []Bid
-		if len(pbl.Bids) > 0 {
-			_ = json.Unmarshal(([]byte)(pbl.Bids), &bids)
-		}
-		if len(bids) == 0 {
+		if result == nil {
 			c.JSON(400, gin.H{"error": "No hay pujas para esta subasta"})
 			return
 		}
-		// Buscar la puja más alta
-		maxBid := bids[0]
-		for _, bid := range bids {
-			if bid.Valor > maxBid.Valor {
-				maxBid = bid
-			}
-		}
-		// Asignar el piloto al ganador
-		pbl.OwnerID = maxBid.PlayerID
-		pbl.Bids = []byte("[]") // Limpiar pujas
-		database.DB.Save(&pbl)
-		// Actualizar PlayerByLeague del ganador
-		var playerLeague models.PlayerByLeague
-		if err := database.DB.Where("player_id = ? AND league_id = ?", maxBid.PlayerID, pbl.LeagueID).First(&playerLeague).Error; err != nil {
-			c.JSON(404, gin.H{"error": "No se encontró el jugador ganador en la liga"})
-			return
-		}
-		// Descontar el dinero solo al ganador
-		if playerLeague.Money < float64(maxBid.Valor) {
-			c.JSON(400, gin.H{"error": "El ganador no tiene suficiente saldo (error de integridad)"})
+		if result.Failure != "" {
+			c.JSON(409, gin.H{"error": "La subasta se ha cerrado sin adjudicar", "details": result.Failure})
 			return
 		}
-		playerLeague.Money -= float64(maxBid.Valor)
-		// Actualizar owned_pilots y team_value
-		var owned []uint
-		if playerLeague.OwnedPilots != "" && playerLeague.OwnedPilots != "[]" {
-			_ = json.Unmarshal([]byte(playerLeague.OwnedPilots), &owned)
-		}
-		// Añadir solo si no está ya presente
-		alreadyOwned := false
-		for _, pid := range owned {
-			if pid == pbl.PilotID {
-				alreadyOwned = true
-				break
-			}
-		}
-		if !alreadyOwned {
-			owned = append(owned, pbl.PilotID)
-		}
-		ownedJSON, _ := json.Marshal(owned)
-		playerLeague.OwnedPilots = string(ownedJSON)
-		// Sumar el valor del piloto al team_value solo si es nuevo
-		if !alreadyOwned {
-			var pilot models.Pilot
-			database.DB.First(&pilot, pbl.PilotID)
-			playerLeague.TeamValue += pilot.Value
-		}
-		database.DB.Save(&playerLeague)
-		// Guardar histórico de fichaje (subasta)
-		errHist := database.DB.Exec(`INSERT INTO pilot_value_history (pilot_id, pilot_by_league_id, league_id, player_id, valor_pagado, fecha, tipo, counterparty_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, pbl.PilotID, pbl.ID, pbl.LeagueID, maxBid.PlayerID, maxBid.Valor, time.Now(), "fichaje", 0).Error
-		if errHist != nil {
-			log.Printf("[HISTORICO] Error guardando en pilot_value_history: %v", errHist)
-		}
-		c.JSON(200, gin.H{"message": "Subasta finalizada y piloto asignado", "winner": maxBid.PlayerID, "pilot_id": pbl.PilotID})
-		// En /api/auctions/finish, después de asignar el piloto al ganador:
-		if pbl.ClausulaValue == nil || maxBid.Valor > *pbl.ClausulaValue {
-			pbl.ClausulaValue = &maxBid.Valor
-		}
-		clausulaExpira := auction.EndTime.Add(14 * 24 * time.Hour)
-		pbl.Clausulatime = &clausulaExpira
-		database.DB.Save(&pbl)
+		c.JSON(200, gin.H{
+			"message":   "Subasta finalizada y elemento asignado",
+			"winner":    result.WinnerID,
+			"item_type": result.ItemType,
+			"item_id":   result.ItemID,
+			"price":     result.Price,
+		})
 	})
 
 	// Obtener información del jugador
@@ -1628,30 +1818,50 @@ func main() {
 	})
 
 	// Función unificada de pujas para pilotos, ingenieros y equipos
-	router.POST("/api/auctions/bid", func(c *gin.Context) {
+	router.POST("/api/auctions/bid", authMiddleware(), func(c *gin.Context) {
 		var req struct {
 			ItemType string  `json:"item_type"` // "pilot", "track_engineer", "chief_engineer", "team_constructor"
 			ItemID   uint    `json:"item_id"`   // ID del elemento específico
 			LeagueID uint    `json:"league_id"`
-			PlayerID uint    `json:"player_id"`
 			Valor    float64 `json:"valor"`
 		}
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(400, gin.H{"error": "Datos inválidos"})
 			return
 		}
+		// El que puja es siempre el usuario autenticado
+		playerID := c.GetUint("user_id")
 		log.Printf("[BID] ===== NUEVA PUJA =====")
-		log.Printf("[BID] item_type=%s, item_id=%d, league_id=%d, player_id=%d, valor=%.2f", req.ItemType, req.ItemID, req.LeagueID, req.PlayerID, req.Valor)
+		log.Printf("[BID] item_type=%s, item_id=%d, league_id=%d, player_id=%d, valor=%.2f", req.ItemType, req.ItemID, req.LeagueID, playerID, req.Valor)
+
+		// Comprobar que la puja cabe en el dinero no comprometido del manager
+		var bidder models.PlayerByLeague
+		if err := database.DB.Where("player_id = ? AND league_id = ?", playerID, req.LeagueID).First(&bidder).Error; err != nil {
+			c.JSON(404, gin.H{"error": "Jugador no encontrado en la liga"})
+			return
+		}
+		budget := playerBudget(database.DB, bidder, commitmentAuction, req.ItemType, req.ItemID)
+		if req.Valor > budget.Available {
+			log.Printf("[BID] Puja rechazada: %.2f > disponible %.2f (comprometido %.2f)", req.Valor, budget.Available, budget.Committed)
+			c.JSON(400, gin.H{"error": "No tienes suficiente dinero disponible", "money": budget.Money, "committed": budget.Committed, "available": budget.Available})
+			return
+		}
 
+		// Buscar cualquier subasta del elemento: una vencida que el planificador
+		// aún no ha finalizado no admite pujas ni se duplica con una nueva
 		var auction Auction
-		if err := database.DB.Where("item_type = ? AND item_id = ? AND league_id = ? AND end_time > ?", req.ItemType, req.ItemID, req.LeagueID, time.Now()).First(&auction).Error; err != nil {
+		if err := database.DB.Where("item_type = ? AND item_id = ? AND league_id = ?", req.ItemType, req.ItemID, req.LeagueID).Order("id").First(&auction).Error; err == nil && !auction.EndTime.After(time.Now()) {
+			log.Printf("[BID] Subasta %d vencida pendiente de finalizar, puja rechazada", auction.ID)
+			c.JSON(409, gin.H{"error": "La subasta de este elemento ha terminado y se está finalizando"})
+			return
+		} else if err != nil {
 			log.Printf("[BID] No existe subasta activa, creando nueva para %s ID %d", req.ItemType, req.ItemID)
 			// No existe subasta, crearla
 			auction = Auction{
 				ItemType: req.ItemType,
 				ItemID:   req.ItemID,
 				LeagueID: req.LeagueID,
-				EndTime:  time.Now().Add(24 * time.Hour),
+				EndTime:  auctionEndTime(loadLeagueSettings(database.DB, req.LeagueID)),
 				Bids:     []byte("[]"),
 			}
 			if err := database.DB.Create(&auction).Error; err != nil {
@@ -1677,7 +1887,7 @@ func main() {
 		// Buscar si el jugador ya tiene una puja
 		found := false
 		for i, b := range bids {
-			if b.PlayerID == req.PlayerID {
+			if b.PlayerID == playerID {
 				log.Printf("[BID] Actualizando puja existente de player_id=%d de %.2f a %.2f", b.PlayerID, bids[i].Valor, req.Valor)
 				bids[i].Valor = req.Valor // Actualiza el valor de la puja existente
 				found = true
@@ -1685,8 +1895,8 @@ func main() {
 			}
 		}
 		if !found {
-			log.Printf("[BID] Añadiendo nueva puja para player_id=%d valor=%.2f", req.PlayerID, req.Valor)
-			bids = append(bids, Bid{PlayerID: req.PlayerID, Valor: req.Valor})
+			log.Printf("[BID] Añadiendo nueva puja para player_id=%d valor=%.2f", playerID, req.Valor)
+			bids = append(bids, Bid{PlayerID: playerID, Valor: req.Valor})
 		}
 		log.Printf("[BID] Bids después de actualizar: %+v", bids)
 
@@ -1715,37 +1925,7 @@ func main() {
 			return
 		}
 
-		// Verificar si necesita refrescar el mercado
-		var marketItemCount int64
-		err := database.DB.Model(&models.MarketItem{}).Where("league_id = ? AND is_in_market = ?", leagueID, true).Count(&marketItemCount).Error
-		if err != nil {
-			log.Printf("[MARKET] Error contando elementos en mercado (probablemente falta columna is_in_market): %v", err)
-			// Fallback: usar el método anterior temporalmente
-			shouldRefresh := league.MarketPilots == nil || len(league.MarketPilots) == 0
-			if league.MarketNextRefresh == nil || league.MarketNextRefresh.Before(time.Now()) {
-				shouldRefresh = true
-			}
-			if shouldRefresh {
-				refreshMarketForLeague(league.ID)
-				next := time.Now().Add(24 * time.Hour)
-				league.MarketNextRefresh = &next
-				database.DB.Save(&league)
-			}
-		} else {
-			log.Printf("[MARKET] Elementos actualmente en mercado: %d", marketItemCount)
-			shouldRefresh := marketItemCount == 0
-			if league.MarketNextRefresh == nil || league.MarketNextRefresh.Before(time.Now()) {
-				shouldRefresh = true
-			}
-			if shouldRefresh {
-				log.Printf("[MARKET] Refrescando mercado para liga %s", leagueID)
-				refreshMarketForLeague(league.ID)
-				next := time.Now().Add(24 * time.Hour)
-				league.MarketNextRefresh = &next
-				database.DB.Save(&league)
-			}
-		}
-
+		// El refresco cada 24h lo hace el planificador (scheduler.go)
 		var result []map[string]interface{}
 
 		// Obtener elementos del mercado que están marcados como is_in_market = true
@@ -1975,7 +2155,7 @@ func main() {
 		// Eliminar subastas antiguas/finalizadas
 		database.DB.Where("league_id = ?", id).Delete(&Auction{})
 		refreshMarketForLeague(uint(id))
-		updateMarketNextRefresh() // Reinicia el contador de 24h
+		updateMarketNextRefresh(uint(id), nil) // Reinicia el contador de 24h
 		c.JSON(200, gin.H{"message": "Mercado reiniciado"})
 	})
 
@@ -2095,285 +2275,73 @@ func main() {
 			log.Printf("[REFRESH-AND-FINISH] Procesando subasta %d/%d: ID=%d, Type=%s, ItemID=%d",
 				i+1, len(auctions), auction.ID, auction.ItemType, auction.ItemID)
 
-			// Buscar bids
-			var bids []Bid
-			if len(auction.Bids) > 0 {
-				if err := json.Unmarshal(auction.Bids, &bids); err != nil {
-					log.Printf("[REFRESH-AND-FINISH] ERROR parseando bids de subasta %d: %v", auction.ID, err)
-					continue
-				}
-			}
-			log.Printf("[REFRESH-AND-FINISH] Bids encontrados: %d - %+v", len(bids), bids)
-
-			if len(bids) == 0 {
-				log.Printf("[REFRESH-AND-FINISH] No hay pujas en subasta %d, saltando", auction.ID)
-				continue // No hay pujas, no se asigna
-			}
-			// Buscar la puja más alta
-			maxBid := bids[0]
-			for _, bid := range bids {
-				if bid.Valor > maxBid.Valor {
-					maxBid = bid
-				}
-			}
-
-			// Verificar que el ganador tenga suficiente dinero
-			var playerLeague models.PlayerByLeague
-			if err := database.DB.Where("player_id = ? AND league_id = ?", maxBid.PlayerID, auction.LeagueID).First(&playerLeague).Error; err != nil {
-				log.Printf("[REFRESH-AND-FINISH] Error: jugador %d no encontrado en liga %d", maxBid.PlayerID, auction.LeagueID)
+			result, err := settleAuction(auction)
+			if err != nil {
+				log.Printf("[REFRESH-AND-FINISH] Error finalizando subasta %d: %v", auction.ID, err)
 				continue
 			}
-			if playerLeague.Money < float64(maxBid.Valor) {
-				log.Printf("[REFRESH-AND-FINISH] Error: jugador %d no tiene suficiente dinero (%.2f < %.2f)", maxBid.PlayerID, playerLeague.Money, maxBid.Valor)
-				continue
+			if result != nil && result.Failure == "" {
+				finalizados++
 			}
+		}
+		// Eliminar subastas antiguas/finalizadas
+		id, _ := strconv.ParseUint(leagueID, 10, 64)
+		database.DB.Where("league_id = ?", id).Delete(&Auction{})
 
-			// Descontar dinero
-			playerLeague.Money -= float64(maxBid.Valor)
-
-			// Asignar según el tipo
-			switch auction.ItemType {
-			case "pilot":
-				var pbl models.PilotByLeague
-				if err := database.DB.First(&pbl, auction.ItemID).Error; err != nil {
-					log.Printf("[REFRESH-AND-FINISH] Error: pilot_by_league %d no encontrado", auction.ItemID)
-					continue
-				}
-				pbl.OwnerID = maxBid.PlayerID
-				database.DB.Save(&pbl)
-
-				// El owner_id ya se actualizó arriba, no necesitamos actualizar columnas JSON
+		// Asegurar que existan market_items para esta liga
+		log.Printf("[REFRESH-AND-FINISH] Verificando market_items para liga %d", id)
+		if err := ensureMarketItemsForLeague(uint(id)); err != nil {
+			log.Printf("[REFRESH-AND-FINISH] Error asegurando market_items: %v", err)
+		} else {
+			log.Printf("[REFRESH-AND-FINISH] ✅ Market_items verificados/creados para liga %d", id)
+		}
 
-				// Actualizar team_value
-				var pilot models.Pilot
-				if err := database.DB.First(&pilot, pbl.PilotID).Error; err == nil {
-					playerLeague.TeamValue += pilot.Value
-				}
+		refreshMarketForLeague(uint(id))
+		updateMarketNextRefresh(uint(id), nil)
 
-				// Guardar histórico
-				errHist := database.DB.Exec(`INSERT INTO pilot_value_history (pilot_id, pilot_by_league_id, league_id, player_id, valor_pagado, fecha, tipo, counterparty_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, pbl.PilotID, pbl.ID, pbl.LeagueID, maxBid.PlayerID, maxBid.Valor, time.Now(), "fichaje", 0).Error
-				if errHist != nil {
-					log.Printf("[REFRESH-AND-FINISH] Error guardando histórico pilot: %v", errHist)
-				}
+		// Generar ofertas de la FIA para elementos en venta después de finalizar subastas
+		log.Printf("[REFRESH-AND-FINISH] Generando ofertas de la FIA para elementos en venta")
+		if err := runFIADraw(uint(id), func(rng *rand.Rand) ([]drawFIAOffer, error) {
+			return generateFIAOffersForLeague(uint(id), rng)
+		}); err != nil {
+			log.Printf("[REFRESH-AND-FINISH] Error generando ofertas FIA: %v", err)
+		} else {
+			log.Printf("[REFRESH-AND-FINISH] Ofertas de la FIA generadas correctamente")
+		}
 
-				// Actualizar cláusula
-				if pbl.ClausulaValue == nil || maxBid.Valor > *pbl.ClausulaValue {
-					pbl.ClausulaValue = &maxBid.Valor
-				}
-				clausulaExpira := auction.EndTime.Add(14 * 24 * time.Hour)
-				pbl.Clausulatime = &clausulaExpira
-				database.DB.Save(&pbl)
+		c.JSON(200, gin.H{"message": "Mercado reiniciado y subastas finalizadas", "finalizadas": finalizados})
+	})
 
-				// Generar oferta de la FIA automáticamente después de la compra
-				if err := database.DB.First(&pilot, pbl.PilotID).Error; err == nil {
-					// Generar oferta entre 90% y 110% del valor de la puja ganadora
-					fiaOfferValue := generateFIAOffer(maxBid.Valor)
+	// Endpoint para generar ofertas de la FIA manualmente (cada 24 horas)
+	router.POST("/api/generate-fia-offers", authMiddleware(), func(c *gin.Context) {
+		// Verificar que el usuario es admin
+		userIDRaw, ok := c.Get("user_id")
+		if !ok {
+			c.JSON(401, gin.H{"error": "No autenticado"})
+			return
+		}
+		userID, ok := userIDRaw.(uint)
+		if !ok {
+			c.JSON(401, gin.H{"error": "No autenticado (tipo user_id incorrecto)"})
+			return
+		}
 
-					// Crear la oferta de la FIA con ID especial
-					fiaBid := Bid{
-						PlayerID: FIA_PLAYER_ID, // ID especial de la FIA
-						Valor:    fiaOfferValue,
-					}
+		// Verificar si el usuario es admin
+		var player models.Player
+		if err := database.DB.First(&player, userID).Error; err != nil {
+			c.JSON(404, gin.H{"error": "Usuario no encontrado"})
+			return
+		}
+		if !player.IsAdmin {
+			c.JSON(403, gin.H{"error": "No tienes permisos de administrador"})
+			return
+		}
 
-					// Guardar en el campo bids
-					bidsJSON, _ := json.Marshal([]Bid{fiaBid})
-					pbl.Bids = bidsJSON
-					database.DB.Save(&pbl)
-
-				}
-
-			case "track_engineer":
-				var teb models.TrackEngineerByLeague
-				if err := database.DB.First(&teb, auction.ItemID).Error; err != nil {
-					log.Printf("[REFRESH-AND-FINISH] Error: track_engineer_by_league %d no encontrado", auction.ItemID)
-					continue
-				}
-				teb.OwnerID = maxBid.PlayerID
-				database.DB.Save(&teb)
-
-				// El owner_id ya se actualizó arriba, no necesitamos actualizar columnas JSON
-
-				// Actualizar team_value
-				var te models.TrackEngineer
-				if err := database.DB.First(&te, teb.TrackEngineerID).Error; err == nil {
-					playerLeague.TeamValue += te.Value
-				}
-
-				// Actualizar cláusula
-				if teb.ClausulaValue == nil || maxBid.Valor > *teb.ClausulaValue {
-					teb.ClausulaValue = &maxBid.Valor
-				}
-				clausulaExpira := auction.EndTime.Add(14 * 24 * time.Hour)
-				teb.Clausulatime = &clausulaExpira
-				database.DB.Save(&teb)
-
-				// Generar oferta de la FIA automáticamente después de la compra
-				if err := database.DB.First(&te, teb.TrackEngineerID).Error; err == nil {
-					// Generar oferta entre 90% y 110% del valor de la puja ganadora
-					fiaOfferValue := generateFIAOffer(maxBid.Valor)
-
-					// Crear la oferta de la FIA con ID especial
-					fiaBid := Bid{
-						PlayerID: FIA_PLAYER_ID, // ID especial de la FIA
-						Valor:    fiaOfferValue,
-					}
-
-					// Guardar en el campo bids
-					bidsJSON, _ := json.Marshal([]Bid{fiaBid})
-					teb.Bids = bidsJSON
-					database.DB.Save(&teb)
-
-				}
-
-			case "chief_engineer":
-				var ceb models.ChiefEngineerByLeague
-				if err := database.DB.First(&ceb, auction.ItemID).Error; err != nil {
-					log.Printf("[REFRESH-AND-FINISH] Error: chief_engineer_by_league %d no encontrado", auction.ItemID)
-					continue
-				}
-				ceb.OwnerID = maxBid.PlayerID
-				database.DB.Save(&ceb)
-
-				// El owner_id ya se actualizó arriba, no necesitamos actualizar columnas JSON
-
-				// Actualizar team_value
-				var ce models.ChiefEngineer
-				if err := database.DB.First(&ce, ceb.ChiefEngineerID).Error; err == nil {
-					playerLeague.TeamValue += ce.Value
-				}
-
-				// Actualizar cláusula
-				if ceb.ClausulaValue == nil || maxBid.Valor > *ceb.ClausulaValue {
-					ceb.ClausulaValue = &maxBid.Valor
-				}
-				clausulaExpira := auction.EndTime.Add(14 * 24 * time.Hour)
-				ceb.Clausulatime = &clausulaExpira
-				database.DB.Save(&ceb)
-
-				// Generar oferta de la FIA automáticamente después de la compra
-				if err := database.DB.First(&ce, ceb.ChiefEngineerID).Error; err == nil {
-					// Generar oferta entre 90% y 110% del valor de la puja ganadora
-					fiaOfferValue := generateFIAOffer(maxBid.Valor)
-
-					// Crear la oferta de la FIA con ID especial
-					fiaBid := Bid{
-						PlayerID: FIA_PLAYER_ID, // ID especial de la FIA
-						Valor:    fiaOfferValue,
-					}
-
-					// Guardar en el campo bids
-					bidsJSON, _ := json.Marshal([]Bid{fiaBid})
-					ceb.Bids = bidsJSON
-					database.DB.Save(&ceb)
-
-				}
-
-			case "team_constructor":
-				var tcb models.TeamConstructorByLeague
-				if err := database.DB.First(&tcb, auction.ItemID).Error; err != nil {
-					log.Printf("[REFRESH-AND-FINISH] Error: team_constructor_by_league %d no encontrado", auction.ItemID)
-					continue
-				}
-				tcb.OwnerID = maxBid.PlayerID
-				database.DB.Save(&tcb)
-
-				// El owner_id ya se actualizó arriba, no necesitamos actualizar columnas JSON
-
-				// Actualizar team_value
-				var tc models.TeamConstructor
-				if err := database.DB.First(&tc, tcb.TeamConstructorID).Error; err == nil {
-					playerLeague.TeamValue += tc.Value
-				}
-
-				// Actualizar cláusula
-				if tcb.ClausulaValue == nil || maxBid.Valor > *tcb.ClausulaValue {
-					tcb.ClausulaValue = &maxBid.Valor
-				}
-				clausulaExpira := auction.EndTime.Add(14 * 24 * time.Hour)
-				tcb.Clausulatime = &clausulaExpira
-				database.DB.Save(&tcb)
-
-				// Generar oferta de la FIA automáticamente después de la compra
-				if err := database.DB.First(&tc, tcb.TeamConstructorID).Error; err == nil {
-					// Generar oferta entre 90% y 110% del valor de la puja ganadora
-					fiaOfferValue := generateFIAOffer(maxBid.Valor)
-
-					// Crear la oferta de la FIA con ID especial
-					fiaBid := Bid{
-						PlayerID: FIA_PLAYER_ID, // ID especial de la FIA
-						Valor:    fiaOfferValue,
-					}
-
-					// Guardar en el campo bids
-					bidsJSON, _ := json.Marshal([]Bid{fiaBid})
-					tcb.Bids = bidsJSON
-					database.DB.Save(&tcb)
-
-				}
-			}
-
-			// Guardar el player_by_league actualizado
-			database.DB.Save(&playerLeague)
-			finalizados++
-
-			log.Printf("[REFRESH-AND-FINISH] Subasta finalizada exitosamente: %s ID %d -> Player %d", auction.ItemType, auction.ItemID, maxBid.PlayerID)
-		}
-		// Eliminar subastas antiguas/finalizadas
-		id, _ := strconv.ParseUint(leagueID, 10, 64)
-		database.DB.Where("league_id = ?", id).Delete(&Auction{})
-
-		// Asegurar que existan market_items para esta liga
-		log.Printf("[REFRESH-AND-FINISH] Verificando market_items para liga %d", id)
-		if err := ensureMarketItemsForLeague(uint(id)); err != nil {
-			log.Printf("[REFRESH-AND-FINISH] Error asegurando market_items: %v", err)
-		} else {
-			log.Printf("[REFRESH-AND-FINISH] ✅ Market_items verificados/creados para liga %d", id)
-		}
-
-		refreshMarketForLeague(uint(id))
-		updateMarketNextRefresh()
-
-		// Generar ofertas de la FIA para elementos en venta después de finalizar subastas
-		log.Printf("[REFRESH-AND-FINISH] Generando ofertas de la FIA para elementos en venta")
-		if err := generateFIAOffersForLeague(uint(id)); err != nil {
-			log.Printf("[REFRESH-AND-FINISH] Error generando ofertas FIA: %v", err)
-		} else {
-			log.Printf("[REFRESH-AND-FINISH] Ofertas de la FIA generadas correctamente")
-		}
-
-		c.JSON(200, gin.H{"message": "Mercado reiniciado y subastas finalizadas", "finalizadas": finalizados})
-	})
-
-	// Endpoint para generar ofertas de la FIA manualmente (cada 24 horas)
-	router.POST("/api/generate-fia-offers", authMiddleware(), func(c *gin.Context) {
-		// Verificar que el usuario es admin
-		userIDRaw, ok := c.Get("user_id")
-		if !ok {
-			c.JSON(401, gin.H{"error": "No autenticado"})
-			return
-		}
-		userID, ok := userIDRaw.(uint)
-		if !ok {
-			c.JSON(401, gin.H{"error": "No autenticado (tipo user_id incorrecto)"})
-			return
-		}
-
-		// Verificar si el usuario es admin
-		var player models.Player
-		if err := database.DB.First(&player, userID).Error; err != nil {
-			c.JSON(404, gin.H{"error": "Usuario no encontrado"})
-			return
-		}
-		if !player.IsAdmin {
-			c.JSON(403, gin.H{"error": "No tienes permisos de administrador"})
-			return
-		}
-
-		leagueID := c.Query("league_id")
-		if leagueID == "" {
-			c.JSON(400, gin.H{"error": "Falta league_id"})
-			return
-		}
+		leagueID := c.Query("league_id")
+		if leagueID == "" {
+			c.JSON(400, gin.H{"error": "Falta league_id"})
+			return
+		}
 
 		id, err := strconv.ParseUint(leagueID, 10, 32)
 		if err != nil {
@@ -2383,7 +2351,9 @@ func main() {
 
 		log.Printf("[FIA-OFFERS] Generando ofertas de la FIA para liga %d", id)
 
-		if err := generateFIAOffersForLeague(uint(id)); err != nil {
+		if err := runFIADraw(uint(id), func(rng *rand.Rand) ([]drawFIAOffer, error) {
+			return generateFIAOffersForLeague(uint(id), rng)
+		}); err != nil {
 			log.Printf("[FIA-OFFERS] Error generando ofertas FIA: %v", err)
 			c.JSON(500, gin.H{"error": "Error generando ofertas de la FIA"})
 			return
@@ -2432,7 +2402,9 @@ func main() {
 
 		log.Printf("[FIA-OWNED-OFFERS] Generando ofertas de la FIA para elementos con propietario en liga %d", id)
 
-		if err := generateFIAOffersForOwnedItems(uint(id)); err != nil {
+		if err := runFIADraw(uint(id), func(rng *rand.Rand) ([]drawFIAOffer, error) {
+			return generateFIAOffersForOwnedItems(uint(id), rng)
+		}); err != nil {
 			log.Printf("[FIA-OWNED-OFFERS] Error generando ofertas FIA: %v", err)
 			c.JSON(500, gin.H{"error": "Error generando ofertas de la FIA"})
 			return
@@ -2447,8 +2419,68 @@ func main() {
 	// 1. Manualmente con el botón "Generar Ofertas FIA" (admin)
 	// 2. Automáticamente después de finalizar subastas
 
+	// Endpoint para consultar los sorteos del mercado de una liga: el hash de la
+	// semilla del próximo sorteo (y de las próximas ofertas FIA fuera del
+	// refresco) y las semillas reveladas de los anteriores
+	router.GET("/api/market/draws", func(c *gin.Context) {
+		leagueID, err := strconv.ParseUint(c.Query("league_id"), 10, 64)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Falta league_id"})
+			return
+		}
+		next, err := pendingMarketDraw(uint(leagueID))
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Error obteniendo el próximo sorteo"})
+			return
+		}
+		nextFIA, err := pendingDraw(database.DB, uint(leagueID), drawKindFIA)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Error obteniendo el próximo sorteo"})
+			return
+		}
+		var draws []models.MarketDraw
+		database.DB.Where("league_id = ? AND revealed_at IS NOT NULL", leagueID).Order("id desc").Limit(20).Find(&draws)
+		result := []map[string]interface{}{}
+		for _, draw := range draws {
+			result = append(result, marketDrawView(draw))
+		}
+		c.JSON(200, gin.H{"next": marketDrawView(next), "next_fia": marketDrawView(nextFIA), "draws": result})
+	})
+
+	// Endpoint para verificar un sorteo repitiéndolo con su semilla revelada
+	router.GET("/api/market/draws/:id/verify", func(c *gin.Context) {
+		var draw models.MarketDraw
+		if err := database.DB.First(&draw, c.Param("id")).Error; err != nil {
+			c.JSON(404, gin.H{"error": "Sorteo no encontrado"})
+			return
+		}
+		verification, err := verifyMarketDraw(draw)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"verification": verification})
+	})
+
 	router.GET("/api/market/next-refresh", func(c *gin.Context) {
-		c.JSON(200, gin.H{"next_refresh": marketNextRefresh.Unix()})
+		leagueID := c.Query("league_id")
+		if leagueID == "" {
+			c.JSON(400, gin.H{"error": "Falta league_id"})
+			return
+		}
+		var league models.League
+		if err := database.DB.First(&league, leagueID).Error; err != nil {
+			c.JSON(404, gin.H{"error": "Liga no encontrada"})
+			return
+		}
+		// Si la liga aún no tiene fecha de refresco, el planificador la refrescará en su próxima pasada
+		next := time.Now()
+		if league.MarketNextRefresh != nil {
+			next = *league.MarketNextRefresh
+		}
+		var jobs []models.SchedulerJobState
+		database.DB.Where("league_id = ?", league.ID).Find(&jobs)
+		c.JSON(200, gin.H{"next_refresh": next.Unix(), "league_id": league.ID, "jobs": jobs})
 	})
 
 	// Endpoint para obtener información de cláusulas de un jugador en una liga
@@ -2826,7 +2858,7 @@ func main() {
 		playerByLeague := models.PlayerByLeague{
 			PlayerID:              uint64(userID.(uint)),
 			LeagueID:              uint64(league.ID),
-			Money:                 100000000, // 100M
+			Money:                 loadLeagueSettings(database.DB, league.ID).StartingMoney,
 			TeamValue:             0,
 			OwnedPilots:           "[]",
 			OwnedTrackEngineers:   "[]",
@@ -2839,10 +2871,46 @@ func main() {
 			c.JSON(500, gin.H{"error": "Error al unirse a la liga"})
 			return
 		}
+		if err := openLedgerAccountTx(&playerByLeague, ledgerReasonInitialBalance); err != nil {
+			log.Printf("Error registrando saldo inicial en ledger: %v", err)
+		}
 		log.Printf("Usuario %d unido a la liga %d", userID, league.ID)
 		c.JSON(200, gin.H{"message": "Unido a la liga correctamente"})
 	})
 
+	// Endpoint para consultar las subastas finalizadas de una liga con todas sus
+	// pujas, el modo y el precio cobrado
+	router.GET("/api/auctions/results", func(c *gin.Context) {
+		leagueID, err := strconv.ParseUint(c.Query("league_id"), 10, 64)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Falta league_id"})
+			return
+		}
+		var results []models.AuctionResult
+		if err := database.DB.Where("league_id = ?", leagueID).Order("settled_at desc").Limit(50).Find(&results).Error; err != nil {
+			c.JSON(500, gin.H{"error": "Error obteniendo resultados de subastas"})
+			return
+		}
+		views := make([]gin.H, 0, len(results))
+		for _, r := range results {
+			views = append(views, gin.H{
+				"id":          r.ID,
+				"auction_id":  r.AuctionID,
+				"item_type":   r.ItemType,
+				"item_id":     r.ItemID,
+				"mode":        r.Mode,
+				"bids":        json.RawMessage(r.Bids),
+				"reserve":     r.Reserve,
+				"winner_id":   r.WinnerID,
+				"winning_bid": r.WinningBid,
+				"price":       r.Price,
+				"settled_at":  r.SettledAt,
+				"failure":     r.Failure,
+			})
+		}
+		c.JSON(200, gin.H{"results": views})
+	})
+
 	// Endpoint para obtener una subasta concreta por id
 	router.GET("/api/auctions/:id", func(c *gin.Context) {
 		id := c.Param("id")
@@ -2852,17 +2920,19 @@ func main() {
 			c.JSON(404, gin.H{"error": "Subasta no encontrada"})
 			return
 		}
+		// En ligas con subasta sellada solo se muestran las pujas propias
+		mode, numBids := hideSealedBids(&auction, optionalUserID(c))
 		// Si se pasa league_id, incluir datos del piloto y la liga
 		if leagueID != "" {
 			var pbl models.PilotByLeague
 			if err := database.DB.First(&pbl, auction.ItemID).Error; err == nil {
 				var pilot models.Pilot
 				database.DB.First(&pilot, pbl.PilotID)
-				c.JSON(200, gin.H{"auction": auction, "pilot_by_league": pbl, "pilot": pilot})
+				c.JSON(200, gin.H{"auction": auction, "auction_mode": mode, "num_bids": numBids, "pilot_by_league": pbl, "pilot": pilot})
 				return
 			}
 		}
-		c.JSON(200, gin.H{"auction": auction})
+		c.JSON(200, gin.H{"auction": auction, "auction_mode": mode, "num_bids": numBids})
 	})
 
 	// Endpoint para obtener la subasta activa de cualquier elemento en una liga
@@ -2879,7 +2949,8 @@ func main() {
 			c.JSON(404, gin.H{"error": "No hay subasta activa para este elemento"})
 			return
 		}
-		c.JSON(200, gin.H{"auction": auction})
+		mode, numBids := hideSealedBids(&auction, optionalUserID(c))
+		c.JSON(200, gin.H{"auction": auction, "auction_mode": mode, "num_bids": numBids})
 	})
 
 	// Endpoint para obtener datos de pilot_by_league y piloto general por id de pilot_by_league
@@ -2961,6 +3032,57 @@ func main() {
 		c.JSON(200, gin.H{"leagues": result})
 	})
 
+	// Endpoint para reconstruir el saldo de un manager desde el libro mayor y detectar descuadres
+	router.GET("/api/leagues/:id/ledger/reconcile", authMiddleware(), func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		leagueID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "league_id inválido"})
+			return
+		}
+		var league models.League
+		if err := database.DB.First(&league, leagueID).Error; err != nil {
+			c.JSON(404, gin.H{"error": "Liga no encontrada"})
+			return
+		}
+
+		playerID := uint64(userID)
+		if playerIDStr := c.Query("player_id"); playerIDStr != "" {
+			playerID, err = strconv.ParseUint(playerIDStr, 10, 64)
+			if err != nil {
+				c.JSON(400, gin.H{"error": "player_id inválido"})
+				return
+			}
+		}
+
+		// Solo el propio manager, el creador de la liga o un admin pueden consultarlo
+		if playerID != uint64(userID) && league.PlayerID != userID {
+			var player models.Player
+			if err := database.DB.First(&player, userID).Error; err != nil || !player.IsAdmin {
+				c.JSON(403, gin.H{"error": "No tienes permisos para ver este saldo"})
+				return
+			}
+		}
+
+		var playerLeague models.PlayerByLeague
+		if err := database.DB.Where("player_id = ? AND league_id = ?", playerID, leagueID).First(&playerLeague).Error; err != nil {
+			c.JSON(404, gin.H{"error": "Jugador no encontrado en la liga"})
+			return
+		}
+
+		reconciliation, err := reconcileLedger(playerLeague)
+		if err != nil {
+			log.Printf("[LEDGER] Error reconstruyendo saldo de player_id=%d, league_id=%d: %v", playerID, leagueID, err)
+			c.JSON(500, gin.H{"error": "Error reconstruyendo el saldo"})
+			return
+		}
+
+		var entries []models.LedgerEntry
+		database.DB.Where("league_id = ? AND player_id = ?", leagueID, playerID).Order("id asc").Find(&entries)
+
+		c.JSON(200, gin.H{"reconciliation": reconciliation, "entries": entries})
+	})
+
 	// Endpoint para clasificación de una liga (usando totalpoints)
 	router.GET("/api/leagues/:id/classification", authMiddleware(), func(c *gin.Context) {
 		leagueID := c.Param("id")
@@ -3058,7 +3180,7 @@ func main() {
 				log.Printf("[CLASSIFICATION] Jugador %d tiene %d alineaciones", playerID, len(playerLineups))
 				for _, lineup := range playerLineups {
 					log.Printf("[CLASSIFICATION] Calculando puntos para GP %d", lineup.GPIndex)
-					points := calculatePlayerTotalPoints(uint64(playerID), leagueIDUint, lineup.GPIndex)
+					points := calculatePlayerTotalPoints(database.DB, uint64(playerID), leagueIDUint, lineup.GPIndex)
 					totalPoints += points
 					pointsByGP[lineup.GPIndex] = points
 					log.Printf("[CLASSIFICATION] GP %d: %d puntos", lineup.GPIndex, points)
@@ -3509,39 +3631,15 @@ func main() {
 			c.JSON(400, gin.H{"error": "No hay oferta activa de la liga"})
 			return
 		}
-		// Sumar el dinero al usuario (PlayerByLeague)
-		var playerLeague models.PlayerByLeague
-		if err := database.DB.Where("player_id = ? AND league_id = ?", userID, pbl.LeagueID).First(&playerLeague).Error; err != nil {
-			c.JSON(404, gin.H{"error": "PlayerByLeague no encontrado"})
-			return
-		}
-		playerLeague.Money += *pbl.LeagueOfferValue
-		// Eliminar el piloto vendido del array owned_pilots
-		var owned []uint
-		if playerLeague.OwnedPilots != "" && playerLeague.OwnedPilots != "[]" {
-			_ = json.Unmarshal([]byte(playerLeague.OwnedPilots), &owned)
-		}
-		nuevaOwned := make([]uint, 0, len(owned))
-		for _, pid := range owned {
-			if pid != pbl.PilotID {
-				nuevaOwned = append(nuevaOwned, pid)
+		if _, err := acceptLeagueOffer("pilot", pbl.ID, userID); err != nil {
+			log.Printf("[LEDGER] Error vendiendo pilot %d a la liga: %v", pbl.ID, err)
+			if errors.Is(err, errOwnerChanged) || errors.Is(err, errNoLeagueOffer) {
+				c.JSON(409, gin.H{"error": err.Error()})
+				return
 			}
+			c.JSON(500, gin.H{"error": "Error registrando la venta a la liga"})
+			return
 		}
-		ownedJSON, _ := json.Marshal(nuevaOwned)
-		playerLeague.OwnedPilots = string(ownedJSON)
-		database.DB.Save(&playerLeague)
-		// Guardar histórico de venta directa ANTES de limpiar LeagueOfferValue
-		errHist := database.DB.Exec(`INSERT INTO pilot_value_history (pilot_id, pilot_by_league_id, league_id, player_id, valor_pagado, fecha, tipo, counterparty_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, pbl.PilotID, pbl.ID, pbl.LeagueID, userID, *pbl.LeagueOfferValue, time.Now(), "venta", 0).Error
-		if errHist != nil {
-			log.Printf("[HISTORICO] Error guardando en pilot_value_history (venta): %v", errHist)
-		}
-		// Poner owner_id a 0, borrar venta y oferta
-		pbl.OwnerID = 0
-		pbl.Venta = nil
-		pbl.VentaExpiresAt = nil
-		pbl.LeagueOfferValue = nil
-		pbl.LeagueOfferExpiresAt = nil
-		database.DB.Save(&pbl)
 		c.JSON(200, gin.H{"success": true})
 	})
 
@@ -3655,31 +3753,15 @@ func main() {
 			return
 		}
 
-		// Procesar la venta a la FIA
-		var playerLeague models.PlayerByLeague
-		if err := database.DB.Where("player_id = ? AND league_id = ?", userID, teb.LeagueID).First(&playerLeague).Error; err != nil {
-			c.JSON(404, gin.H{"error": "Jugador no encontrado en la liga"})
+		if _, err := acceptLeagueOffer("track_engineer", teb.ID, userID); err != nil {
+			log.Printf("[LEDGER] Error vendiendo track_engineer %d a la liga: %v", teb.ID, err)
+			if errors.Is(err, errOwnerChanged) || errors.Is(err, errNoLeagueOffer) {
+				c.JSON(409, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(500, gin.H{"error": "Error registrando la venta a la liga"})
 			return
 		}
-
-		var te models.TrackEngineer
-		database.DB.First(&te, teb.TrackEngineerID)
-
-		// Añadir dinero al jugador
-		playerLeague.Money += *teb.LeagueOfferValue
-		playerLeague.TeamValue -= te.Value
-
-		// Limpiar venta y oferta
-		teb.Venta = nil
-		teb.VentaExpiresAt = nil
-		teb.LeagueOfferValue = nil
-		teb.LeagueOfferExpiresAt = nil
-		teb.OwnerID = 0 // Volver a estar libre
-
-		// Guardar cambios
-		database.DB.Save(&playerLeague)
-		database.DB.Save(&teb)
-
 		c.JSON(200, gin.H{"message": "Oferta de la FIA aceptada"})
 	})
 
@@ -3792,34 +3874,15 @@ func main() {
 			c.JSON(400, gin.H{"error": "No hay oferta activa de la FIA"})
 			return
 		}
-		// Sumar el dinero al usuario (PlayerByLeague)
-		var playerLeague models.PlayerByLeague
-		if err := database.DB.Where("player_id = ? AND league_id = ?", userID, ceb.LeagueID).First(&playerLeague).Error; err != nil {
-			c.JSON(404, gin.H{"error": "PlayerByLeague no encontrado"})
-			return
-		}
-		playerLeague.Money += *ceb.LeagueOfferValue
-		// Eliminar el ingeniero vendido del array owned_chief_engineers
-		var owned []uint
-		if playerLeague.OwnedChiefEngineers != "" && playerLeague.OwnedChiefEngineers != "[]" {
-			_ = json.Unmarshal([]byte(playerLeague.OwnedChiefEngineers), &owned)
-		}
-		nuevaOwned := make([]uint, 0, len(owned))
-		for _, cid := range owned {
-			if cid != ceb.ChiefEngineerID {
-				nuevaOwned = append(nuevaOwned, cid)
+		if _, err := acceptLeagueOffer("chief_engineer", ceb.ID, userID); err != nil {
+			log.Printf("[LEDGER] Error vendiendo chief_engineer %d a la liga: %v", ceb.ID, err)
+			if errors.Is(err, errOwnerChanged) || errors.Is(err, errNoLeagueOffer) {
+				c.JSON(409, gin.H{"error": err.Error()})
+				return
 			}
+			c.JSON(500, gin.H{"error": "Error registrando la venta a la liga"})
+			return
 		}
-		ownedJSON, _ := json.Marshal(nuevaOwned)
-		playerLeague.OwnedChiefEngineers = string(ownedJSON)
-		database.DB.Save(&playerLeague)
-		// Poner owner_id a 0, borrar venta y oferta
-		ceb.OwnerID = 0
-		ceb.Venta = nil
-		ceb.VentaExpiresAt = nil
-		ceb.LeagueOfferValue = nil
-		ceb.LeagueOfferExpiresAt = nil
-		database.DB.Save(&ceb)
 		c.JSON(200, gin.H{"success": true})
 	})
 
@@ -3938,34 +4001,15 @@ func main() {
 			c.JSON(400, gin.H{"error": "No hay oferta activa de la FIA"})
 			return
 		}
-		// Sumar el dinero al usuario (PlayerByLeague)
-		var playerLeague models.PlayerByLeague
-		if err := database.DB.Where("player_id = ? AND league_id = ?", userID, tcb.LeagueID).First(&playerLeague).Error; err != nil {
-			c.JSON(404, gin.H{"error": "PlayerByLeague no encontrado"})
-			return
-		}
-		playerLeague.Money += *tcb.LeagueOfferValue
-		// Eliminar el equipo vendido del array owned_team_constructors
-		var owned []uint
-		if playerLeague.OwnedTeamConstructors != "" && playerLeague.OwnedTeamConstructors != "[]" {
-			_ = json.Unmarshal([]byte(playerLeague.OwnedTeamConstructors), &owned)
-		}
-		nuevaOwned := make([]uint, 0, len(owned))
-		for _, tcid := range owned {
-			if tcid != tcb.TeamConstructorID {
-				nuevaOwned = append(nuevaOwned, tcid)
+		if _, err := acceptLeagueOffer("team_constructor", tcb.ID, userID); err != nil {
+			log.Printf("[LEDGER] Error vendiendo team_constructor %d a la liga: %v", tcb.ID, err)
+			if errors.Is(err, errOwnerChanged) || errors.Is(err, errNoLeagueOffer) {
+				c.JSON(409, gin.H{"error": err.Error()})
+				return
 			}
+			c.JSON(500, gin.H{"error": "Error registrando la venta a la liga"})
+			return
 		}
-		ownedJSON, _ := json.Marshal(nuevaOwned)
-		playerLeague.OwnedTeamConstructors = string(ownedJSON)
-		database.DB.Save(&playerLeague)
-		// Poner owner_id a 0, borrar venta y oferta
-		tcb.OwnerID = 0
-		tcb.Venta = nil
-		tcb.VentaExpiresAt = nil
-		tcb.LeagueOfferValue = nil
-		tcb.LeagueOfferExpiresAt = nil
-		database.DB.Save(&tcb)
 		c.JSON(200, gin.H{"success": true})
 	})
 
@@ -4814,8 +4858,15 @@ func main() {
 			}
 		}
 
-		log.Printf("[MY-BIDS] Devolviendo %d elementos con pujas del usuario %d", len(result), userID)
-		c.JSON(200, gin.H{"bids": result})
+		// Dinero comprometido en pujas y ofertas abiertas frente al disponible
+		budget := budgetSummary{Commitments: []fundsCommitment{}}
+		var playerLeague models.PlayerByLeague
+		if err := database.DB.Where("player_id = ? AND league_id = ?", userID, leagueID).First(&playerLeague).Error; err == nil {
+			budget = playerBudget(database.DB, playerLeague, "", "", 0)
+		}
+
+		log.Printf("[MY-BIDS] Devolviendo %d elementos con pujas del usuario %d (comprometido %.2f, disponible %.2f)", len(result), userID, budget.Committed, budget.Available)
+		c.JSON(200, gin.H{"bids": result, "money": budget.Money, "committed": budget.Committed, "available": budget.Available, "commitments": budget.Commitments})
 	})
 
 	// Alias para mantener compatibilidad con el frontend
@@ -5176,8 +5227,15 @@ func main() {
 			}
 		}
 
-		log.Printf("[MY-BIDS-ALIAS] Devolviendo %d elementos con pujas del usuario %d", len(result), userID)
-		c.JSON(200, gin.H{"bids": result})
+		// Dinero comprometido en pujas y ofertas abiertas frente al disponible
+		budget := budgetSummary{Commitments: []fundsCommitment{}}
+		var playerLeague models.PlayerByLeague
+		if err := database.DB.Where("player_id = ? AND league_id = ?", userID, leagueID).First(&playerLeague).Error; err == nil {
+			budget = playerBudget(database.DB, playerLeague, "", "", 0)
+		}
+
+		log.Printf("[MY-BIDS-ALIAS] Devolviendo %d elementos con pujas del usuario %d (comprometido %.2f, disponible %.2f)", len(result), userID, budget.Committed, budget.Available)
+		c.JSON(200, gin.H{"bids": result, "money": budget.Money, "committed": budget.Committed, "available": budget.Available, "commitments": budget.Commitments})
 	})
 
 	// Endpoint para eliminar la puja de un usuario sobre cualquier elemento en una liga
@@ -5340,78 +5398,92 @@ func main() {
 			c.JSON(403, gin.H{"error": "No tienes permisos de administrador"})
 			return
 		}
-		log.Println("[UPDATE-VALUES] Iniciando actualización de valores y ventas7fichajes usando pilot_value_history y driver_value_update_log...")
-		// Obtener la última fecha de actualización
-		var lastUpdate time.Time
-		database.DB.Raw("SELECT last_update FROM driver_value_update_log ORDER BY id DESC LIMIT 1").Scan(&lastUpdate)
-		log.Printf("[UPDATE-VALUES] Última actualización: %v", lastUpdate)
-		var pilots []models.Pilot
-		database.DB.Find(&pilots)
-		for _, pilot := range pilots {
-			log.Printf("[UPDATE-VALUES] Piloto: %s (ID: %d)", pilot.DriverName, pilot.ID)
-			var history []struct {
-				ValorPagado float64
-				Tipo        string
-			}
-			database.DB.Raw(`SELECT valor_pagado, tipo FROM pilot_value_history WHERE pilot_id = ? AND fecha > ?`, pilot.ID, lastUpdate).Scan(&history)
-			numFichajes := 0
-			numVentas := 0
-			totalFichajes := 0.0
-			totalVentas := 0.0
-			valorActual := pilot.Value
-			penalizacionExtra := 0.0
-			for _, h := range history {
-				if h.Tipo == "fichaje" {
-					numFichajes++
-					totalFichajes += h.ValorPagado
-				}
-				if h.Tipo == "venta" {
-					numVentas++
-					totalVentas += h.ValorPagado
-					if h.ValorPagado < valorActual {
-						penalizacion := (valorActual - h.ValorPagado) / valorActual
-						penalizacionExtra += penalizacion * 0.1 * valorActual
-					}
-				}
-			}
-			ventas7fichajes := numFichajes - numVentas
-			impactoFichajes := 0.0
-			impactoVentas := 0.0
-			if valorActual > 0 {
-				impactoFichajes = (totalFichajes / valorActual) * 0.05 * valorActual
-				impactoVentas = (totalVentas / valorActual) * 0.05 * valorActual
-			}
-			nuevoValor := valorActual + impactoFichajes - impactoVentas - penalizacionExtra
-			if nuevoValor < 0 {
-				nuevoValor = 0
-			}
-			log.Printf("[UPDATE-VALUES] totalFichajes: %.2f, totalVentas: %.2f, penalizacionExtra: %.2f, nuevoValor: %.2f", totalFichajes, totalVentas, penalizacionExtra, nuevoValor)
-			dbRes1 := database.DB.Model(&models.Pilot{}).Where("id = ?", pilot.ID).Update("ventas7fichajes", ventas7fichajes)
-			if dbRes1.Error != nil {
-				log.Printf("[UPDATE-VALUES] Error actualizando ventas7fichajes para piloto %d: %v", pilot.ID, dbRes1.Error)
-			}
-			dbRes2 := database.DB.Model(&models.Pilot{}).Where("id = ?", pilot.ID).Update("value", nuevoValor)
-			if dbRes2.Error != nil {
-				log.Printf("[UPDATE-VALUES] Error actualizando value para piloto %d: %v", pilot.ID, dbRes2.Error)
-			}
-			var updatedPilot models.Pilot
-			database.DB.First(&updatedPilot, pilot.ID)
-			log.Printf("[UPDATE-VALUES] Valor actualizado ventas7fichajes: %d, value: %.2f", updatedPilot.Ventas7Fichajes, updatedPilot.Value)
-			// En /api/drivers/update-values, después de actualizar el valor de cada piloto:
-			// Buscar todos los pilot_by_leagues de este piloto
-			var pbls []models.PilotByLeague
-			database.DB.Where("pilot_id = ?", pilot.ID).Find(&pbls)
-			for _, pbl := range pbls {
-				if pbl.ClausulaValue == nil || nuevoValor > *pbl.ClausulaValue {
-					pbl.ClausulaValue = &nuevoValor
-					database.DB.Save(&pbl)
-				}
-			}
-		}
-		// Guardar la nueva fecha de actualización
-		database.DB.Exec("INSERT INTO driver_value_update_log (last_update) VALUES (?)", time.Now())
+		// Revalorizar pilotos, ingenieros y constructores con el motor de valoración
+		log.Println("[UPDATE-VALUES] Ejecutando el motor de valoración...")
+		updated, err := runValuation(time.Now())
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Error ejecutando la valoración", "details": err.Error()})
+			return
+		}
 		log.Println("[UPDATE-VALUES] Proceso finalizado.")
-		c.JSON(200, gin.H{"message": "Valores y ventas7fichajes actualizados usando pilot_value_history y driver_value_update_log"})
+		c.JSON(200, gin.H{"message": "Valores actualizados con el motor de valoración", "updated": updated})
+	})
+
+	// Endpoint para consultar la configuración del motor de valoración
+	router.GET("/api/admin/valuation-config", authMiddleware(), func(c *gin.Context) {
+		if !requireAdmin(c) {
+			return
+		}
+		c.JSON(200, gin.H{"config": loadValuationConfig()})
+	})
+
+	// Endpoint para cambiar la configuración del motor de valoración
+	router.PUT("/api/admin/valuation-config", authMiddleware(), func(c *gin.Context) {
+		if !requireAdmin(c) {
+			return
+		}
+		cfg := loadValuationConfig()
+		cfgID := cfg.ID
+		if err := c.ShouldBindJSON(&cfg); err != nil {
+			c.JSON(400, gin.H{"error": "Datos inválidos"})
+			return
+		}
+		cfg.ID = cfgID
+		if err := validateValuationConfig(cfg); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err := database.DB.Save(&cfg).Error; err != nil {
+			c.JSON(500, gin.H{"error": "Error guardando la configuración"})
+			return
+		}
+		c.JSON(200, gin.H{"config": cfg})
+	})
+
+	// Endpoint para consultar las valoraciones de un día (por defecto hoy)
+	router.GET("/api/admin/valuations", authMiddleware(), func(c *gin.Context) {
+		if !requireAdmin(c) {
+			return
+		}
+		day := c.DefaultQuery("day", time.Now().Format("2006-01-02"))
+		query := database.DB.Where("day = ?", day)
+		if itemType := c.Query("item_type"); itemType != "" {
+			query = query.Where("item_type = ?", itemType)
+		}
+		var valuations []models.ItemValuation
+		query.Order("item_type, item_id").Find(&valuations)
+		c.JSON(200, gin.H{"day": day, "valuations": valuations})
+	})
+
+	// Endpoint para obtener la evolución diaria del valor de un elemento
+	router.GET("/api/items/:type/:id/value-history", func(c *gin.Context) {
+		itemType := c.Param("type")
+		t, ok := valuationTables[itemType]
+		if !ok {
+			c.JSON(400, gin.H{"error": "Tipo de elemento no válido"})
+			return
+		}
+		itemID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "ID inválido"})
+			return
+		}
+		from, to, err := parseValueHistoryRange(c.Query("from"), c.Query("to"))
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		var item struct{ Value float64 }
+		if res := database.DB.Table(t.Global).Where("id = ?", itemID).Select("value").Take(&item); res.Error != nil {
+			c.JSON(404, gin.H{"error": "Elemento no encontrado"})
+			return
+		}
+		points, err := itemValueHistory(itemType, uint(itemID), from, to)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Error obteniendo el historial de valores"})
+			return
+		}
+		c.JSON(200, gin.H{"item_type": itemType, "item_id": itemID, "current_value": item.Value, "from": from, "to": to, "points": points})
 	})
 
 	// Endpoint para obtener el historial de actividad de mercado
@@ -5462,13 +5534,15 @@ func main() {
 			return
 		}
 
-		// Calcular puntos por posición final
-		positionPoints := getPositionPoints(pilot.Mode, req.FinishPosition)
-		originalPoints := req.Points
-		req.Points += positionPoints
+		// Calcular los puntos con el ruleset activo
+		rs := activeScoringRuleset()
+		items := rs.BreakdownPilotRace(req)
+		summary := lineItemsSummary(items)
+		req.Points = summary["total_points"]
+		req.ScoringVersion = rs.Version
 
-		log.Printf("[RACE-POINTS] Piloto %s (Pos: %d): Delta=%d + Position=%d = Total=%d",
-			pilot.DriverName, req.FinishPosition, originalPoints, positionPoints, req.Points)
+		log.Printf("[RACE-POINTS] Piloto %s (Pos: %d): Delta=%d + Position=%d + Bonus=%d = Total=%d",
+			pilot.DriverName, req.FinishPosition, summary["delta_points"], summary["position_points"], summary["bonus_points"], req.Points)
 
 		// Buscar si ya existe para ese piloto y GP
 		var existing models.PilotRace
@@ -5483,16 +5557,19 @@ func main() {
 		}
 
 		// Actualizar puntos de todos los jugadores que tengan este piloto alineado
+		storePilotLineItems(database.DB, "race", req.PilotID, req.GPIndex)
 		go updatePlayerPointsForPilot(req.PilotID, req.GPIndex, req.Points, "race")
 
 		c.JSON(200, gin.H{
 			"message": "Puntuación guardada y puntos de jugadores actualizados",
 			"points_breakdown": gin.H{
-				"delta_points":    originalPoints,
-				"position_points": positionPoints,
+				"delta_points":    summary["delta_points"],
+				"position_points": summary["position_points"],
+				"bonus_points":    summary["bonus_points"],
 				"total_points":    req.Points,
 				"position":        req.FinishPosition,
 				"mode":            pilot.Mode,
+				"line_items":      items,
 			},
 		})
 	})
@@ -5512,13 +5589,15 @@ func main() {
 			return
 		}
 
-		// Calcular puntos por posición final
-		positionPoints := getPositionPoints(pilot.Mode, req.FinishPosition)
-		originalPoints := req.Points
-		req.Points += positionPoints
+		// Calcular los puntos con el ruleset activo
+		rs := activeScoringRuleset()
+		items := rs.BreakdownPilotQualy(req)
+		summary := lineItemsSummary(items)
+		req.Points = summary["total_points"]
+		req.ScoringVersion = rs.Version
 
-		log.Printf("[QUALY-POINTS] Piloto %s (Pos: %d): Delta=%d + Position=%d = Total=%d",
-			pilot.DriverName, req.FinishPosition, originalPoints, positionPoints, req.Points)
+		log.Printf("[QUALY-POINTS] Piloto %s (Pos: %d): Delta=%d + Position=%d + Bonus=%d = Total=%d",
+			pilot.DriverName, req.FinishPosition, summary["delta_points"], summary["position_points"], summary["bonus_points"], req.Points)
 
 		var existing models.PilotQualy
 		if err := database.DB.Where("pilot_id = ? AND gp_index = ?", req.PilotID, req.GPIndex).First(&existing).Error; err == nil {
@@ -5532,16 +5611,19 @@ func main() {
 		}
 
 		// Actualizar puntos de todos los jugadores que tengan este piloto alineado
+		storePilotLineItems(database.DB, "qualy", req.PilotID, req.GPIndex)
 		go updatePlayerPointsForPilot(req.PilotID, req.GPIndex, req.Points, "qualy")
 
 		c.JSON(200, gin.H{
 			"message": "Puntuación guardada y puntos de jugadores actualizados",
 			"points_breakdown": gin.H{
-				"delta_points":    originalPoints,
-				"position_points": positionPoints,
+				"delta_points":    summary["delta_points"],
+				"position_points": summary["position_points"],
+				"bonus_points":    summary["bonus_points"],
 				"total_points":    req.Points,
 				"position":        req.FinishPosition,
 				"mode":            pilot.Mode,
+				"line_items":      items,
 			},
 		})
 	})
@@ -5561,13 +5643,15 @@ func main() {
 			return
 		}
 
-		// Calcular puntos por posición final
-		positionPoints := getPositionPoints(pilot.Mode, req.FinishPosition)
-		originalPoints := req.Points
-		req.Points += positionPoints
+		// Calcular los puntos con el ruleset activo
+		rs := activeScoringRuleset()
+		items := rs.BreakdownPilotPractice(req)
+		summary := lineItemsSummary(items)
+		req.Points = summary["total_points"]
+		req.ScoringVersion = rs.Version
 
-		log.Printf("[PRACTICE-POINTS] Piloto %s (Pos: %d): Delta=%d + Position=%d = Total=%d",
-			pilot.DriverName, req.FinishPosition, originalPoints, positionPoints, req.Points)
+		log.Printf("[PRACTICE-POINTS] Piloto %s (Pos: %d): Delta=%d + Position=%d + Bonus=%d = Total=%d",
+			pilot.DriverName, req.FinishPosition, summary["delta_points"], summary["position_points"], summary["bonus_points"], req.Points)
 
 		var existing models.PilotPractice
 		if err := database.DB.Where("pilot_id = ? AND gp_index = ?", req.PilotID, req.GPIndex).First(&existing).Error; err == nil {
@@ -5581,20 +5665,119 @@ func main() {
 		}
 
 		// Actualizar puntos de todos los jugadores que tengan este piloto alineado
+		storePilotLineItems(database.DB, "practice", req.PilotID, req.GPIndex)
 		go updatePlayerPointsForPilot(req.PilotID, req.GPIndex, req.Points, "practice")
 
 		c.JSON(200, gin.H{
 			"message": "Puntuación guardada y puntos de jugadores actualizados",
 			"points_breakdown": gin.H{
-				"delta_points":    originalPoints,
-				"position_points": positionPoints,
+				"delta_points":    summary["delta_points"],
+				"position_points": summary["position_points"],
+				"bonus_points":    summary["bonus_points"],
 				"total_points":    req.Points,
 				"position":        req.FinishPosition,
 				"mode":            pilot.Mode,
+				"line_items":      items,
 			},
 		})
 	})
 
+	// Endpoint para crear o actualizar el resultado de un piloto en la sprint o
+	// en la sprint qualifying. Los puntos se calculan con el ruleset activo.
+	router.POST("/api/admin/sprint-result", authMiddleware(), func(c *gin.Context) {
+		if !requireAdmin(c) {
+			return
+		}
+		var req struct {
+			sprintResultInput
+			GPIndex uint64 `json:"gp_index"`
+			PilotID uint   `json:"pilot_id"`
+			Session string `json:"session"` // "sprint" o "sprint_qualy"
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": "Datos inválidos"})
+			return
+		}
+		if !gpHasSprint(req.GPIndex) {
+			c.JSON(400, gin.H{"error": "El GP no tiene sprint"})
+			return
+		}
+		var pilot models.Pilot
+		if err := database.DB.First(&pilot, req.PilotID).Error; err != nil {
+			c.JSON(404, gin.H{"error": "Piloto no encontrado"})
+			return
+		}
+		if sprintSessionName(pilot.Mode) != req.Session {
+			c.JSON(400, gin.H{"error": "La sprint la puntúan las cartas de carrera y la sprint qualifying las de clasificación"})
+			return
+		}
+
+		points, err := saveSprintResult(req.Session, pilot.ID, req.GPIndex, req.sprintResultInput)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("[SPRINT-POINTS] Piloto %s (%s, GP %d): %d puntos", pilot.DriverName, req.Session, req.GPIndex, points)
+
+		// Actualizar puntos de todos los jugadores que tengan este piloto en el hueco de sprint
+		go updatePlayerPointsForPilot(pilot.ID, req.GPIndex, points, req.Session)
+
+		c.JSON(200, gin.H{"message": "Resultado de sprint guardado", "points": points})
+	})
+
+	// Endpoint para guardar el horario de sesiones de un GP. Sustituye las
+	// sesiones guardadas; cada grupo de la alineación se bloquea con la suya.
+	router.PUT("/api/admin/gp/:gp_index/sessions", authMiddleware(), func(c *gin.Context) {
+		if !requireAdmin(c) {
+			return
+		}
+		gpIndex, err := strconv.ParseUint(c.Param("gp_index"), 10, 64)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "gp_index inválido"})
+			return
+		}
+		var gp models.GrandPrix
+		if err := database.DB.Where("gp_index = ?", gpIndex).First(&gp).Error; err != nil {
+			c.JSON(404, gin.H{"error": "GP no encontrado"})
+			return
+		}
+		var req struct {
+			Sessions []struct {
+				Session   string    `json:"session"`
+				StartTime time.Time `json:"start_time"`
+			} `json:"sessions"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": "Datos inválidos"})
+			return
+		}
+
+		rows := make([]models.GrandPrixSession, 0, len(req.Sessions))
+		seen := make(map[string]bool)
+		for _, in := range req.Sessions {
+			if !containsString(gpSessionNames, in.Session) || seen[in.Session] {
+				c.JSON(400, gin.H{"error": fmt.Sprintf("Sesión inválida o repetida: %s", in.Session)})
+				return
+			}
+			if !gp.HasSprint && (in.Session == sessionSprint || in.Session == sessionSprintQualifying) {
+				c.JSON(400, gin.H{"error": fmt.Sprintf("El GP %s no tiene sprint", gp.Name)})
+				return
+			}
+			seen[in.Session] = true
+			rows = append(rows, models.GrandPrixSession{GPIndex: gpIndex, Session: in.Session, StartTime: in.StartTime})
+		}
+
+		if err := saveGPSessions(gpIndex, rows); err != nil {
+			c.JSON(500, gin.H{"error": "Error guardando las sesiones"})
+			return
+		}
+		log.Printf("[GP-SESSIONS] Horario del GP %d actualizado: %d sesiones", gpIndex, len(rows))
+
+		now := time.Now()
+		schedule := loadGPSchedule(gp)
+		c.JSON(200, gin.H{"sessions": schedule.sessionStatuses(now), "locked_slots": schedule.lockedSlots(now)})
+	})
+
 	// Endpoint para obtener la lista de GPs para el formulario
 	router.GET("/api/grand-prix", func(c *gin.Context) {
 		var gps []models.GrandPrix
@@ -5624,69 +5807,21 @@ func main() {
 
 		log.Printf("[PILOT-POINTS] Piloto encontrado: %s (ID: %d, Mode: %s)", pilot.DriverName, pilot.ID, pilot.Mode)
 
-		var points int = 0
-		var finishPosition int = 0
-		var table string
-
-		// Determinar la tabla según el modo del piloto
 		switch pilot.Mode {
-		case "race", "R":
-			table = "pilot_races"
-		case "qualy", "Q":
-			table = "pilot_qualies"
-		case "practice", "P":
-			table = "pilot_practices"
+		case "race", "R", "qualy", "Q", "practice", "P":
 		default:
 			log.Printf("[PILOT-POINTS] Error: Modo de piloto inválido: %s", pilot.Mode)
 			c.JSON(400, gin.H{"error": "Modo de piloto inválido"})
 			return
 		}
 
-		log.Printf("[PILOT-POINTS] Buscando en tabla: %s", table)
-
-		// Obtener puntos de la tabla correspondiente
-		var result map[string]interface{}
-		if err := database.DB.Table(table).Where("pilot_id = ? AND gp_index = ?", pilotID, gpIndex).Take(&result).Error; err != nil {
-			log.Printf("[PILOT-POINTS] No se encontraron puntos en %s para pilot_id=%s, gp_index=%s: %v", table, pilotID, gpIndex, err)
-		} else {
-			log.Printf("[PILOT-POINTS] Resultado encontrado: %+v", result)
-
-			// Manejar diferentes tipos de datos para el campo points (puntos base)
-			pointsRaw := result["points"]
-			if pointsRaw == nil {
-				log.Printf("[PILOT-POINTS] Campo points es NULL")
-				points = 0
-			} else if pointsVal, ok := pointsRaw.(float64); ok {
-				points = int(pointsVal)
-				log.Printf("[PILOT-POINTS] Puntos base extraídos (float64): %d", points)
-			} else if pointsVal, ok := pointsRaw.(int); ok {
-				points = pointsVal
-				log.Printf("[PILOT-POINTS] Puntos base extraídos (int): %d", points)
-			} else if pointsVal, ok := pointsRaw.(int64); ok {
-				points = int(pointsVal)
-				log.Printf("[PILOT-POINTS] Puntos base extraídos (int64): %d", points)
-			} else {
-				log.Printf("[PILOT-POINTS] Tipo de datos no manejado para points: %T, valor: %v", pointsRaw, pointsRaw)
-				points = 0
-			}
-
-			// Obtener posición final para calcular puntos por posición
-			finishPosRaw := result["finish_position"]
-			if finishPosRaw != nil {
-				if finishPosVal, ok := finishPosRaw.(float64); ok {
-					finishPosition = int(finishPosVal)
-				} else if finishPosVal, ok := finishPosRaw.(int); ok {
-					finishPosition = finishPosVal
-				} else if finishPosVal, ok := finishPosRaw.(int64); ok {
-					finishPosition = int(finishPosVal)
-				}
-			}
-
-			// Agregar puntos por posición final
-			positionPoints := getPositionPoints(pilot.Mode, finishPosition)
-			points += positionPoints
-
-			log.Printf("[PILOT-POINTS] Pos: %d, Puntos por posición: %d", finishPosition, positionPoints)
+		// Puntos de la sesión con las reglas de la liga (league_id opcional; sin
+		// liga se usa el ruleset activo)
+		gpIdx, _ := strconv.ParseUint(gpIndex, 10, 64)
+		leagueID, _ := strconv.ParseUint(c.Query("league_id"), 10, 64)
+		points, ok := pilotSessionPointsForLeague(database.DB, uint(leagueID), pilot.Mode, pilot.ID, gpIdx)
+		if !ok {
+			log.Printf("[PILOT-POINTS] No se encontraron puntos para pilot_id=%s, gp_index=%s", pilotID, gpIndex)
 		}
 
 		log.Printf("[PILOT-POINTS] Devolviendo puntos totales: %d", points)
@@ -5715,6 +5850,9 @@ func main() {
 
 		log.Printf("[PILOT-PRACTICE-DATA] Piloto encontrado: %s (ID: %d, Mode: %s)", pilot.DriverName, pilot.ID, pilot.Mode)
 
+		// Reglas de la liga indicada (opcional; sin liga se usa el ruleset activo)
+		leagueID, _ := strconv.ParseUint(c.Query("league_id"), 10, 64)
+
 		// Construir la consulta
 		query := database.DB.Table("pilot_practices").Where("pilot_id = ?", pilotID)
 		if gpIndex != "" {
@@ -5743,7 +5881,7 @@ func main() {
 
 			// Calcular puntos esperados por posición para comparar
 			if finishPos, ok := result["finish_position"].(float64); ok && finishPos > 0 {
-				expectedPoints := getPositionPoints(pilot.Mode, int(finishPos))
+				expectedPoints := getPositionPoints(uint(leagueID), pilot.Mode, int(finishPos))
 				processed["expected_position_points"] = expectedPoints
 
 				// Verificar si los puntos guardados coinciden con los esperados
@@ -5767,259 +5905,6 @@ func main() {
 		})
 	})
 
-	// Endpoint para corregir puntos de un piloto específico
-	router.POST("/api/fix-pilot-points", func(c *gin.Context) {
-		var req struct {
-			PilotID uint   `json:"pilot_id"`
-			GPIndex uint64 `json:"gp_index"`
-			Mode    string `json:"mode"`
-		}
-
-		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(400, gin.H{"error": "Datos inválidos"})
-			return
-		}
-
-		log.Printf("[FIX-POINTS] Corrigiendo puntos para pilot_id=%d, gp_index=%d, mode=%s", req.PilotID, req.GPIndex, req.Mode)
-
-		// Obtener el piloto
-		var pilot models.Pilot
-		if err := database.DB.First(&pilot, req.PilotID).Error; err != nil {
-			c.JSON(404, gin.H{"error": "Piloto no encontrado"})
-			return
-		}
-
-		// Determinar tabla
-		var table string
-		switch req.Mode {
-		case "race":
-			table = "pilot_races"
-		case "qualy":
-			table = "pilot_qualies"
-		case "practice":
-			table = "pilot_practices"
-		default:
-			c.JSON(400, gin.H{"error": "Modo inválido"})
-			return
-		}
-
-		// Obtener datos actuales
-		var result map[string]interface{}
-		if err := database.DB.Table(table).Where("pilot_id = ? AND gp_index = ?", req.PilotID, req.GPIndex).Take(&result).Error; err != nil {
-			c.JSON(404, gin.H{"error": "Datos no encontrados"})
-			return
-		}
-
-		// Extraer datos
-		finishPosition := 0
-		deltaPosition := 0
-
-		if finishPosRaw := result["finish_position"]; finishPosRaw != nil {
-			if finishPosVal, ok := finishPosRaw.(float64); ok {
-				finishPosition = int(finishPosVal)
-			}
-		}
-
-		if deltaPosRaw := result["delta_position"]; deltaPosRaw != nil {
-			if deltaPosVal, ok := deltaPosRaw.(float64); ok {
-				deltaPosition = int(deltaPosVal)
-			}
-		}
-
-		// Calcular puntos correctos
-		positionPoints := getPositionPoints(pilot.Mode, finishPosition)
-		correctTotalPoints := deltaPosition + positionPoints
-
-		log.Printf("[FIX-POINTS] Posición: %d, Delta: %d, Puntos por posición: %d, Total correcto: %d",
-			finishPosition, deltaPosition, positionPoints, correctTotalPoints)
-
-		// Actualizar puntos en la base de datos
-		if err := database.DB.Table(table).Where("pilot_id = ? AND gp_index = ?", req.PilotID, req.GPIndex).
-			Update("points", correctTotalPoints).Error; err != nil {
-			c.JSON(500, gin.H{"error": "Error actualizando puntos"})
-			return
-		}
-
-		// Actualizar puntos de jugadores
-		go updatePlayerPointsForPilot(req.PilotID, req.GPIndex, correctTotalPoints, req.Mode)
-
-		c.JSON(200, gin.H{
-			"message": "Puntos corregidos",
-			"details": gin.H{
-				"pilot_id":             req.PilotID,
-				"gp_index":             req.GPIndex,
-				"mode":                 req.Mode,
-				"finish_position":      finishPosition,
-				"delta_position":       deltaPosition,
-				"position_points":      positionPoints,
-				"correct_total_points": correctTotalPoints,
-			},
-		})
-	})
-
-	// Endpoint para corregir automáticamente todos los puntos incorrectos
-	router.POST("/api/fix-all-pilot-points", func(c *gin.Context) {
-		log.Printf("[FIX-ALL-POINTS] Iniciando corrección automática de todos los puntos")
-
-		// Corregir pilot_practices
-		var practiceResults []map[string]interface{}
-		if err := database.DB.Table("pilot_practices").Find(&practiceResults).Error; err != nil {
-			c.JSON(500, gin.H{"error": "Error consultando pilot_practices"})
-			return
-		}
-
-		corrections := []map[string]interface{}{}
-
-		for _, result := range practiceResults {
-			pilotID := uint(result["pilot_id"].(float64))
-			gpIndex := uint(result["gp_index"].(float64))
-			finishPosition := int(result["finish_position"].(float64))
-			deltaPosition := int(result["delta_position"].(float64))
-			currentPoints := int(result["points"].(float64))
-
-			// Obtener el piloto
-			var pilot models.Pilot
-			if err := database.DB.First(&pilot, pilotID).Error; err != nil {
-				continue
-			}
-
-			// Calcular puntos correctos
-			positionPoints := getPositionPoints(pilot.Mode, finishPosition)
-			correctTotalPoints := deltaPosition + positionPoints
-
-			// Si los puntos son incorrectos, corregir
-			if currentPoints != correctTotalPoints {
-				log.Printf("[FIX-ALL-POINTS] Corrigiendo pilot_id=%d, gp_index=%d: %d → %d",
-					pilotID, gpIndex, currentPoints, correctTotalPoints)
-
-				// Actualizar en la base de datos
-				if err := database.DB.Table("pilot_practices").
-					Where("pilot_id = ? AND gp_index = ?", pilotID, gpIndex).
-					Update("points", correctTotalPoints).Error; err != nil {
-					log.Printf("[FIX-ALL-POINTS] Error actualizando pilot_id=%d: %v", pilotID, err)
-					continue
-				}
-
-				// Actualizar puntos de jugadores
-				go updatePlayerPointsForPilot(pilotID, uint64(gpIndex), correctTotalPoints, "practice")
-
-				corrections = append(corrections, map[string]interface{}{
-					"pilot_id":        pilotID,
-					"pilot_name":      pilot.DriverName,
-					"gp_index":        gpIndex,
-					"mode":            "practice",
-					"finish_position": finishPosition,
-					"delta_position":  deltaPosition,
-					"old_points":      currentPoints,
-					"new_points":      correctTotalPoints,
-					"position_points": positionPoints,
-				})
-			}
-		}
-
-		// Corregir pilot_qualies
-		var qualyResults []map[string]interface{}
-		if err := database.DB.Table("pilot_qualies").Find(&qualyResults).Error; err != nil {
-			c.JSON(500, gin.H{"error": "Error consultando pilot_qualies"})
-			return
-		}
-
-		for _, result := range qualyResults {
-			pilotID := uint(result["pilot_id"].(float64))
-			gpIndex := uint(result["gp_index"].(float64))
-			finishPosition := int(result["finish_position"].(float64))
-			deltaPosition := int(result["delta_position"].(float64))
-			currentPoints := int(result["points"].(float64))
-
-			var pilot models.Pilot
-			if err := database.DB.First(&pilot, pilotID).Error; err != nil {
-				continue
-			}
-
-			positionPoints := getPositionPoints(pilot.Mode, finishPosition)
-			correctTotalPoints := deltaPosition + positionPoints
-
-			if currentPoints != correctTotalPoints {
-				log.Printf("[FIX-ALL-POINTS] Corrigiendo pilot_id=%d, gp_index=%d: %d → %d",
-					pilotID, gpIndex, currentPoints, correctTotalPoints)
-
-				if err := database.DB.Table("pilot_qualies").
-					Where("pilot_id = ? AND gp_index = ?", pilotID, gpIndex).
-					Update("points", correctTotalPoints).Error; err != nil {
-					continue
-				}
-
-				go updatePlayerPointsForPilot(pilotID, uint64(gpIndex), correctTotalPoints, "qualy")
-
-				corrections = append(corrections, map[string]interface{}{
-					"pilot_id":        pilotID,
-					"pilot_name":      pilot.DriverName,
-					"gp_index":        gpIndex,
-					"mode":            "qualy",
-					"finish_position": finishPosition,
-					"delta_position":  deltaPosition,
-					"old_points":      currentPoints,
-					"new_points":      correctTotalPoints,
-					"position_points": positionPoints,
-				})
-			}
-		}
-
-		// Corregir pilot_races
-		var raceResults []map[string]interface{}
-		if err := database.DB.Table("pilot_races").Find(&raceResults).Error; err != nil {
-			c.JSON(500, gin.H{"error": "Error consultando pilot_races"})
-			return
-		}
-
-		for _, result := range raceResults {
-			pilotID := uint(result["pilot_id"].(float64))
-			gpIndex := uint(result["gp_index"].(float64))
-			finishPosition := int(result["finish_position"].(float64))
-			deltaPosition := int(result["delta_position"].(float64))
-			currentPoints := int(result["points"].(float64))
-
-			var pilot models.Pilot
-			if err := database.DB.First(&pilot, pilotID).Error; err != nil {
-				continue
-			}
-
-			positionPoints := getPositionPoints(pilot.Mode, finishPosition)
-			correctTotalPoints := deltaPosition + positionPoints
-
-			if currentPoints != correctTotalPoints {
-				log.Printf("[FIX-ALL-POINTS] Corrigiendo pilot_id=%d, gp_index=%d: %d → %d",
-					pilotID, gpIndex, currentPoints, correctTotalPoints)
-
-				if err := database.DB.Table("pilot_races").
-					Where("pilot_id = ? AND gp_index = ?", pilotID, gpIndex).
-					Update("points", correctTotalPoints).Error; err != nil {
-					continue
-				}
-
-				go updatePlayerPointsForPilot(pilotID, uint64(gpIndex), correctTotalPoints, "race")
-
-				corrections = append(corrections, map[string]interface{}{
-					"pilot_id":        pilotID,
-					"pilot_name":      pilot.DriverName,
-					"gp_index":        gpIndex,
-					"mode":            "race",
-					"finish_position": finishPosition,
-					"delta_position":  deltaPosition,
-					"old_points":      currentPoints,
-					"new_points":      correctTotalPoints,
-					"position_points": positionPoints,
-				})
-			}
-		}
-
-		c.JSON(200, gin.H{
-			"message":           "Corrección automática completada",
-			"total_corrections": len(corrections),
-			"corrections":       corrections,
-		})
-	})
-
 	// Endpoint para obtener puntos actuales de un team constructor en un GP específico
 	router.GET("/api/team-constructor-points", func(c *gin.Context) {
 		teamConstructorID := c.Query("team_constructor_id")
@@ -6815,6 +6700,7 @@ func main() {
 
 		log.Printf("[TEAM-FINISH-POSITIONS] Request recibido: gp_index=%d, positions=%+v", req.GPIndex, req.Positions)
 
+		rs := activeScoringRuleset()
 		updatedCount := 0
 		createdCount := 0
 		for _, pos := range req.Positions {
@@ -6834,15 +6720,17 @@ func main() {
 					TeamConstructorID: teamConstructor.ID,
 					GPIndex:           req.GPIndex,
 					FinishPosition:    &finishPos,
-					ExpectedPosition:  nil,                              // No hay expected_position
-					DeltaPosition:     nil,                              // No se puede calcular sin expected
-					Points:            getTeamPositionPoints(finishPos), // Solo puntos por posición
+					ExpectedPosition:  nil, // No hay expected_position
+					DeltaPosition:     nil, // No se puede calcular sin expected
+					ScoringVersion:    rs.Version,
 				}
+				teamRace.Points = rs.ScoreTeamRace(teamRace) // Solo puntos por posición
 				if err := database.DB.Create(&teamRace).Error; err != nil {
 					log.Printf("[TEAM-FINISH-POSITIONS] Error creando registro para %s: %v", pos.Team, err)
 					continue
 				}
 				createdCount++
+				storeTeamLineItems(database.DB, teamConstructor.ID, req.GPIndex)
 				log.Printf("[TEAM-FINISH-POSITIONS] Creado registro para %s (sin expected_position)", pos.Team)
 			} else {
 				// Existe, actualizar
@@ -6855,24 +6743,20 @@ func main() {
 					log.Printf("[TEAM-FINISH-POSITIONS] ADVERTENCIA: No hay expected_position para %s", pos.Team)
 				}
 
-				// Calcular puntos de posición (1º=10, 2º=9, ..., 10º=1)
-				positionPoints := getTeamPositionPoints(finishPos)
-
-				// Calcular puntos totales (delta + position points)
-				totalPoints := deltaPosition + positionPoints
-
-				// Actualizar registro
+				// Actualizar registro y calcular los puntos con el ruleset activo
 				teamRace.FinishPosition = &finishPos
 				teamRace.DeltaPosition = &deltaPosition
-				teamRace.Points = totalPoints
+				teamRace.Points = rs.ScoreTeamRace(teamRace)
+				teamRace.ScoringVersion = rs.Version
 
 				if err := database.DB.Save(&teamRace).Error; err != nil {
 					log.Printf("[TEAM-FINISH-POSITIONS] Error guardando registro para %s: %v", pos.Team, err)
 					continue
 				}
 
-				log.Printf("[TEAM-FINISH-POSITIONS] %s: Finish=%d, Expected=%.1f, Delta=%d, PositionPoints=%d, Total=%d",
-					pos.Team, finishPos, *teamRace.ExpectedPosition, deltaPosition, positionPoints, totalPoints)
+				log.Printf("[TEAM-FINISH-POSITIONS] %s: Finish=%d, Delta=%d, Total=%d",
+					pos.Team, finishPos, deltaPosition, teamRace.Points)
+				storeTeamLineItems(database.DB, teamConstructor.ID, req.GPIndex)
 				updatedCount++
 			}
 		}
@@ -7149,115 +7033,21 @@ func main() {
 		realDelta := expectedPosition - finishPosition
 		log.Printf("[SESSION-RESULT] Delta real sin multiplicadores: %d (esperada: %d - final: %d)", realDelta, expectedPosition, finishPosition)
 
-		// Calcular puntos por posición final
-		positionPoints := getPositionPoints(pilot.Mode, finishPosition)
-
-		// Calcular bonificaciones y penalizaciones
-		bonusPoints := 0
-
-		// Debug: mostrar todos los valores recibidos
-		log.Printf("[SESSION-RESULT] Valores recibidos en body: %+v", body)
-
-		// Posiciones ganadas/perdidas en salida - multiplicar por cantidad (permite negativos)
-		positionsGainedAtStartVal := body["positions_gained_at_start"]
-		log.Printf("[SESSION-RESULT] Procesando positions_gained_at_start: %v (tipo: %T)", positionsGainedAtStartVal, positionsGainedAtStartVal)
+		// Los puntos los calcula el motor de puntuación a partir de la fila guardada
+		body["delta_position"] = realDelta
 
-		if positionsGainedAtStart, ok := positionsGainedAtStartVal.(float64); ok && positionsGainedAtStart != 0 {
-			bonusPoints += int(positionsGainedAtStart) * 3
-			log.Printf("[SESSION-RESULT] Bonificación/penalización por posiciones en salida: %+d (valor: %v)", int(positionsGainedAtStart)*3, positionsGainedAtStart)
-		} else if positionsGainedAtStart, ok := positionsGainedAtStartVal.(int); ok && positionsGainedAtStart != 0 {
-			bonusPoints += positionsGainedAtStart * 3
-			log.Printf("[SESSION-RESULT] Bonificación/penalización por posiciones en salida: %+d (valor: %v)", positionsGainedAtStart*3, positionsGainedAtStart)
-		} else if positionsGainedAtStart, ok := positionsGainedAtStartVal.(string); ok && positionsGainedAtStart != "" && positionsGainedAtStart != "null" {
-			if positionsGainedAtStartInt, err := strconv.Atoi(positionsGainedAtStart); err == nil && positionsGainedAtStartInt != 0 {
-				bonusPoints += positionsGainedAtStartInt * 3
-				log.Printf("[SESSION-RESULT] Bonificación/penalización por posiciones en salida: %+d (valor: %v)", positionsGainedAtStartInt*3, positionsGainedAtStartInt)
-			}
-		} else {
-			log.Printf("[SESSION-RESULT] No se aplicó bonificación/penalización por posiciones en salida (valor: %v, tipo: %T)", positionsGainedAtStartVal, positionsGainedAtStartVal)
-		}
-
-		// Adelantamientos limpios (+2 cada uno)
-		if cleanOvertakes, ok := body["clean_overtakes"].(float64); ok && cleanOvertakes > 0 {
-			bonusPoints += int(cleanOvertakes) * 2
-			log.Printf("[SESSION-RESULT] Bonificación por adelantamientos limpios: +%d (valor: %v)", int(cleanOvertakes)*2, cleanOvertakes)
-		} else if cleanOvertakes, ok := body["clean_overtakes"].(int); ok && cleanOvertakes > 0 {
-			bonusPoints += cleanOvertakes * 2
-			log.Printf("[SESSION-RESULT] Bonificación por adelantamientos limpios: +%d (valor: %v)", cleanOvertakes*2, cleanOvertakes)
-		}
-
-		// Posiciones perdidas (-1 cada una)
-		if netPositionsLost, ok := body["net_positions_lost"].(float64); ok && netPositionsLost > 0 {
-			bonusPoints -= int(netPositionsLost)
-			log.Printf("[SESSION-RESULT] Penalización por posiciones perdidas: -%d (valor: %v)", int(netPositionsLost), netPositionsLost)
-		} else if netPositionsLost, ok := body["net_positions_lost"].(int); ok && netPositionsLost > 0 {
-			bonusPoints -= netPositionsLost
-			log.Printf("[SESSION-RESULT] Penalización por posiciones perdidas: -%d (valor: %v)", netPositionsLost, netPositionsLost)
-		}
-
-		// Vuelta rápida (+5 si termina P1-10)
-		if fastestLap, ok := body["fastest_lap"].(bool); ok && fastestLap && finishPosition <= 10 {
-			bonusPoints += 5
-			log.Printf("[SESSION-RESULT] Bonificación por vuelta rápida: +5")
-		}
-
-		// Causar VSC (-5)
-		if causedVsc, ok := body["caused_vsc"].(bool); ok && causedVsc {
-			bonusPoints -= 5
-			log.Printf("[SESSION-RESULT] Penalización por causar VSC: -5")
-		}
-
-		// Causar SC (-8)
-		if causedSc, ok := body["caused_sc"].(bool); ok && causedSc {
-			bonusPoints -= 8
-			log.Printf("[SESSION-RESULT] Penalización por causar SC: -8")
-		}
-
-		// Causar bandera roja (-12)
-		if causedRedFlag, ok := body["caused_red_flag"].(bool); ok && causedRedFlag {
-			bonusPoints -= 12
-			log.Printf("[SESSION-RESULT] Penalización por causar bandera roja: -12")
-		}
-
-		// DNF por error del piloto (-10)
-		if dnfDriverError, ok := body["dnf_driver_error"].(bool); ok && dnfDriverError {
-			bonusPoints -= 10
-			log.Printf("[SESSION-RESULT] Penalización por DNF error piloto: -10")
-		}
-
-		// DNF sin culpa (-3)
-		if dnfNoFault, ok := body["dnf_no_fault"].(bool); ok && dnfNoFault {
-			bonusPoints -= 3
-			log.Printf("[SESSION-RESULT] Penalización por DNF sin culpa: -3")
-		}
-
-		// Total: delta + puntos por posición + bonificaciones
-		totalPoints := realDelta + positionPoints + bonusPoints
-
-		log.Printf("[SESSION-RESULT] Piloto %s (Mode: %s, Pos: %d): Delta=%d + Position=%d + Bonus=%d = Total=%d",
-			pilot.DriverName, pilot.Mode, finishPosition, realDelta, positionPoints, bonusPoints, totalPoints)
-		log.Printf("[SESSION-RESULT] Valores extraídos - finishPosition: %v, expectedPosition: %v, realDelta: %v, positionPoints: %v, bonusPoints: %v",
-			finishPosition, expectedPosition, realDelta, positionPoints, bonusPoints)
-		log.Printf("[SESSION-RESULT] CÁLCULO DETALLADO: %d + %d + %d = %d", realDelta, positionPoints, bonusPoints, totalPoints)
-
-		// Actualizar el campo points con el total calculado
-		body["points"] = totalPoints
-
-		// También actualizar delta_position para consistencia
-		body["delta_position"] = realDelta
-
-		var table string
-		switch mode {
-		case "race":
-			table = "pilot_races"
-		case "qualy":
-			table = "pilot_qualies"
-		case "practice":
-			table = "pilot_practices"
-		default:
-			log.Printf("[SESSION-RESULT] Modo inválido: %v", mode)
-			c.JSON(400, gin.H{"error": "Modo inválido"})
-			return
+		var table string
+		switch mode {
+		case "race":
+			table = "pilot_races"
+		case "qualy":
+			table = "pilot_qualies"
+		case "practice":
+			table = "pilot_practices"
+		default:
+			log.Printf("[SESSION-RESULT] Modo inválido: %v", mode)
+			c.JSON(400, gin.H{"error": "Modo inválido"})
+			return
 		}
 
 		// Quitar gp_index, mode, pilot_id
@@ -7273,7 +7063,7 @@ func main() {
 			// PilotRace tiene todas las columnas
 			allowedFields := map[string]bool{
 				"start_position": true, "finish_position": true, "expected_position": true,
-				"delta_position": true, "points": true, "positions_gained_at_start": true,
+				"delta_position": true, "positions_gained_at_start": true,
 				"clean_overtakes": true, "net_positions_lost": true, "fastest_lap": true,
 				"caused_vsc": true, "caused_sc": true, "caused_red_flag": true,
 				"dnf_driver_error": true, "dnf_no_fault": true,
@@ -7296,7 +7086,7 @@ func main() {
 			// PilotQualy tiene columnas limitadas
 			allowedFields := map[string]bool{
 				"start_position": true, "finish_position": true, "expected_position": true,
-				"delta_position": true, "points": true, "caused_red_flag": true,
+				"delta_position": true, "caused_red_flag": true,
 			}
 			for k, v := range body {
 				if allowedFields[k] {
@@ -7316,7 +7106,7 @@ func main() {
 			// PilotPractice tiene columnas limitadas
 			allowedFields := map[string]bool{
 				"start_position": true, "finish_position": true, "expected_position": true,
-				"delta_position": true, "points": true, "caused_red_flag": true,
+				"delta_position": true, "caused_red_flag": true,
 			}
 			for k, v := range body {
 				if allowedFields[k] {
@@ -7351,25 +7141,38 @@ func main() {
 			database.DB.Table(table).Create(body)
 		}
 
+		// Puntuar el resultado con el ruleset activo y guardar su desglose
+		items, err := scorePilotSession(mode, uint(pilotID), uint64(gpIndex))
+		if err != nil {
+			log.Printf("[SESSION-RESULT] Error puntuando resultado: %v", err)
+			c.JSON(500, gin.H{"error": "Error puntuando el resultado"})
+			return
+		}
+		summary := lineItemsSummary(items)
+		totalPoints := summary["total_points"]
+		log.Printf("[SESSION-RESULT] Piloto %s (Mode: %s, Pos: %d): Delta=%d + Position=%d + Bonus=%d = Total=%d",
+			pilot.DriverName, pilot.Mode, finishPosition, summary["delta_points"], summary["position_points"], summary["bonus_points"], totalPoints)
+
 		// Actualizar puntos de todos los jugadores que tengan este piloto alineado
 		go updatePlayerPointsForPilot(uint(pilotID), uint64(gpIndex), totalPoints, mode)
 
 		// Calcular automáticamente puntos de track engineers para este piloto
 		go func() {
 			log.Printf("[AUTO-TRACK-ENG] Calculando puntos automáticamente para piloto %d, GP %d, mode %s", uint(pilotID), uint64(gpIndex), mode)
-			calculateTrackEngineerPointsForPilot(uint(pilotID), uint64(gpIndex), mode)
+			calculateTrackEngineerPointsForPilot(database.DB, uint(pilotID), uint64(gpIndex), mode)
 		}()
 
 		c.JSON(200, gin.H{
 			"message": "Resultado guardado y puntos de jugadores actualizados",
 			"points_breakdown": gin.H{
-				"delta_points":    realDelta,
-				"position_points": positionPoints,
-				"bonus_points":    bonusPoints,
+				"delta_points":    summary["delta_points"],
+				"position_points": summary["position_points"],
+				"bonus_points":    summary["bonus_points"],
 				"total_points":    totalPoints,
 				"position":        finishPosition,
 				"mode":            pilot.Mode,
 				"pilot_name":      pilot.DriverName,
+				"line_items":      items,
 			},
 		})
 	})
@@ -7839,7 +7642,7 @@ func main() {
 		}
 
 		// Calcular puntos dinámicamente usando la nueva lógica
-		totalPoints := calculatePlayerTotalPoints(playerIDUint, leagueIDUint, targetGPIndex)
+		totalPoints := calculatePlayerTotalPoints(database.DB, playerIDUint, leagueIDUint, targetGPIndex)
 
 		c.JSON(200, gin.H{
 			"lineup_points": totalPoints,
@@ -7855,15 +7658,28 @@ func main() {
 	// Endpoint para obtener todos los GPs que ya han empezado
 	router.GET("/api/gp/started", authMiddleware(), func(c *gin.Context) {
 		now := time.Now()
-		var gps []models.GrandPrix
+		var all []models.GrandPrix
 
-		if err := database.DB.Where("start_date <= ?", now).Order("start_date DESC").Find(&gps).Error; err != nil {
+		if err := database.DB.Order("start_date DESC").Find(&all).Error; err != nil {
 			c.JSON(500, gin.H{"error": "Error al obtener GPs"})
 			return
 		}
 
+		// Un GP ha comenzado cuando empieza su primera sesión
+		gps := []models.GrandPrix{}
+		sessions := make(map[uint64][]gpSessionStatus)
+		for _, gp := range all {
+			schedule := loadGPSchedule(gp)
+			if schedule.firstStart().After(now) {
+				continue
+			}
+			gps = append(gps, gp)
+			sessions[gp.GPIndex] = schedule.sessionStatuses(now)
+		}
+
 		c.JSON(200, gin.H{
-			"gps": gps,
+			"gps":      gps,
+			"sessions": sessions,
 		})
 	})
 
@@ -7887,13 +7703,17 @@ func main() {
 		now := time.Now()
 		var currentGP models.GrandPrix
 
-		// Buscar el próximo GP que NO haya comenzado aún (para alineaciones activas)
-		if err := database.DB.Where("start_date > ?", now).Order("start_date ASC").First(&currentGP).Error; err != nil {
+		// Buscar el GP que todavía tiene sesiones sin empezar (para alineaciones activas)
+		schedule, ok := lineupTargetGP(now)
+		if ok {
+			currentGP = schedule.GP
+		} else {
 			// Si no hay próximos GPs, buscar el último GP que haya comenzado
 			if err := database.DB.Where("start_date <= ?", now).Order("start_date DESC").First(&currentGP).Error; err != nil {
 				c.JSON(404, gin.H{"error": "No Grand Prix found"})
 				return
 			}
+			schedule = loadGPSchedule(currentGP)
 		}
 
 		// Buscar alineación existente
@@ -7905,18 +7725,23 @@ func main() {
 					"race_pilots":         []uint{},
 					"qualifying_pilots":   []uint{},
 					"practice_pilots":     []uint{},
+					"sprint_pilots":       []uint{},
+					"bench_pilots":        map[string][]uint{},
 					"team_constructor_id": nil,
 					"chief_engineer_id":   nil,
 					"track_engineers":     []uint{},
 				},
-				"gp_index": currentGP.GPIndex,
-				"gp_name":  currentGP.Name,
+				"gp_index":     currentGP.GPIndex,
+				"gp_name":      currentGP.Name,
+				"has_sprint":   currentGP.HasSprint,
+				"sessions":     schedule.sessionStatuses(now),
+				"locked_slots": schedule.lockedSlots(now),
 			})
 			return
 		}
 
 		// Parsear los arrays de IDs
-		var racePilots, qualifyingPilots, practicePilots, trackEngineers []uint
+		var racePilots, qualifyingPilots, practicePilots, sprintPilots, trackEngineers []uint
 
 		if len(lineup.RacePilots) > 0 {
 			json.Unmarshal(lineup.RacePilots, &racePilots)
@@ -7927,6 +7752,9 @@ func main() {
 		if len(lineup.PracticePilots) > 0 {
 			json.Unmarshal(lineup.PracticePilots, &practicePilots)
 		}
+		if len(lineup.SprintPilots) > 0 {
+			json.Unmarshal(lineup.SprintPilots, &sprintPilots)
+		}
 		if len(lineup.TrackEngineers) > 0 {
 			json.Unmarshal(lineup.TrackEngineers, &trackEngineers)
 		}
@@ -7936,14 +7764,20 @@ func main() {
 				"race_pilots":         racePilots,
 				"qualifying_pilots":   qualifyingPilots,
 				"practice_pilots":     practicePilots,
+				"sprint_pilots":       sprintPilots,
 				"team_constructor_id": lineup.TeamConstructorID,
 				"chief_engineer_id":   lineup.ChiefEngineerID,
 				"track_engineers":     trackEngineers,
+				"bench_pilots":        lineupBench(lineup),
+				"auto_generated":      lineup.AutoGenerated,
 			},
 			"gp_index":      currentGP.GPIndex,
 			"gp_name":       currentGP.Name,
 			"gp_start_date": currentGP.StartDate,
-			"is_gp_started": currentGP.StartDate.Before(time.Now()) || currentGP.StartDate.Equal(time.Now()),
+			"has_sprint":    currentGP.HasSprint,
+			"is_gp_started": !schedule.firstStart().After(now),
+			"sessions":      schedule.sessionStatuses(now),
+			"locked_slots":  schedule.lockedSlots(now, lineup),
 		})
 	})
 
@@ -7951,24 +7785,44 @@ func main() {
 	router.GET("/api/gp/status", authMiddleware(), func(c *gin.Context) {
 		now := time.Now()
 
-		// Buscar el GP actual (el que ha comenzado más recientemente)
-		var currentGP models.GrandPrix
-		if err := database.DB.Where("start_date <= ?", now).Order("start_date DESC").First(&currentGP).Error; err != nil {
+		var gps []models.GrandPrix
+		database.DB.Order("start_date ASC").Find(&gps)
+
+		// El GP actual es el último cuya primera sesión ya empezó y el próximo,
+		// el primero que aún no ha empezado
+		var current, next *gpSchedule
+		for _, gp := range gps {
+			schedule := loadGPSchedule(gp)
+			if schedule.firstStart().After(now) {
+				next = &schedule
+				break
+			}
+			current = &schedule
+		}
+		if current == nil {
 			c.JSON(404, gin.H{"error": "No Grand Prix found"})
 			return
 		}
 
-		// Buscar el próximo GP
-		var nextGP models.GrandPrix
-		if err := database.DB.Where("start_date > ?", now).Order("start_date ASC").First(&nextGP).Error; err != nil {
-			// No hay próximos GPs
+		gpJSON := func(schedule *gpSchedule) gin.H {
+			return gin.H{
+				"gp_index":   schedule.GP.GPIndex,
+				"name":       schedule.GP.Name,
+				"start_date": schedule.GP.StartDate,
+				"is_started": !schedule.firstStart().After(now),
+				"sessions":   schedule.sessionStatuses(now),
+			}
+		}
+
+		// Alineación editable: el GP actual mientras le queden sesiones por
+		// empezar y, si no, el próximo
+		target := next
+		if current.lastStart().After(now) {
+			target = current
+		}
+		if target == nil {
 			c.JSON(200, gin.H{
-				"current_gp": gin.H{
-					"gp_index":   currentGP.GPIndex,
-					"name":       currentGP.Name,
-					"start_date": currentGP.StartDate,
-					"is_started": true,
-				},
+				"current_gp":      gpJSON(current),
 				"next_gp":         nil,
 				"can_save_lineup": false,
 				"message":         "No hay próximos GPs disponibles para alineaciones",
@@ -7976,24 +7830,20 @@ func main() {
 			return
 		}
 
+		var nextJSON gin.H
+		if next != nil {
+			nextJSON = gpJSON(next)
+		}
 		c.JSON(200, gin.H{
-			"current_gp": gin.H{
-				"gp_index":   currentGP.GPIndex,
-				"name":       currentGP.Name,
-				"start_date": currentGP.StartDate,
-				"is_started": true,
-			},
-			"next_gp": gin.H{
-				"gp_index":   nextGP.GPIndex,
-				"name":       nextGP.Name,
-				"start_date": nextGP.StartDate,
-				"is_started": false,
-			},
+			"current_gp":      gpJSON(current),
+			"next_gp":         nextJSON,
 			"can_save_lineup": true,
 			"target_gp": gin.H{
-				"gp_index":   nextGP.GPIndex,
-				"name":       nextGP.Name,
-				"start_date": nextGP.StartDate,
+				"gp_index":     target.GP.GPIndex,
+				"name":         target.GP.Name,
+				"start_date":   target.GP.StartDate,
+				"sessions":     target.sessionStatuses(now),
+				"locked_slots": target.lockedSlots(now),
 			},
 		})
 	})
@@ -8047,8 +7897,11 @@ func main() {
 				continue
 			}
 
+			// Cambios automáticos del banquillo para los titulares sin resultado
+			_, substitutions := applyBenchSubstitutions(lineup)
+
 			// Parsear los arrays de IDs
-			var racePilots, qualifyingPilots, practicePilots, trackEngineers []uint
+			var racePilots, qualifyingPilots, practicePilots, sprintPilots, trackEngineers []uint
 			if len(lineup.RacePilots) > 0 {
 				json.Unmarshal(lineup.RacePilots, &racePilots)
 			}
@@ -8058,6 +7911,9 @@ func main() {
 			if len(lineup.PracticePilots) > 0 {
 				json.Unmarshal(lineup.PracticePilots, &practicePilots)
 			}
+			if len(lineup.SprintPilots) > 0 {
+				json.Unmarshal(lineup.SprintPilots, &sprintPilots)
+			}
 			if len(lineup.TrackEngineers) > 0 {
 				json.Unmarshal(lineup.TrackEngineers, &trackEngineers)
 			}
@@ -8069,13 +7925,18 @@ func main() {
 				"gp_date":             gp.Date,
 				"gp_country":          gp.Country,
 				"gp_flag":             gp.Flag,
+				"has_sprint":          gp.HasSprint,
 				"lineup_points":       lineup.LineupPoints,
 				"race_pilots":         racePilots,
 				"qualifying_pilots":   qualifyingPilots,
 				"practice_pilots":     practicePilots,
+				"sprint_pilots":       sprintPilots,
 				"team_constructor_id": lineup.TeamConstructorID,
 				"chief_engineer_id":   lineup.ChiefEngineerID,
 				"track_engineers":     trackEngineers,
+				"bench_pilots":        lineupBench(lineup),
+				"substitutions":       substitutions,
+				"auto_generated":      lineup.AutoGenerated,
 			})
 		}
 
@@ -8143,7 +8004,7 @@ func main() {
 			}
 
 			// Usar la nueva función que verifica si tiene el piloto asociado
-			totalPoints := getTrackEngineerPointsWithLineup(uint(elementID), gpIndex, lineup)
+			totalPoints := getTrackEngineerPointsWithLineup(database.DB, uint(elementID), gpIndex, lineup)
 
 			// También obtener puntos desglosados por sesión
 			var trackEngineerByLeague models.TrackEngineerByLeague
@@ -8330,11 +8191,11 @@ func main() {
 		var points int
 		switch elementType {
 		case "pilot":
-			points = getPilotPoints(uint(elementID), gpIndex)
+			points = getPilotPoints(database.DB, uint(elementID), gpIndex)
 		case "team_constructor":
-			points = getTeamConstructorPoints(uint(elementID), gpIndex)
+			points = getTeamConstructorPoints(database.DB, uint(elementID), gpIndex)
 		case "chief_engineer":
-			points = getChiefEngineerPoints(uint(elementID), gpIndex)
+			points = getChiefEngineerPoints(database.DB, uint(elementID), gpIndex)
 		default:
 			c.JSON(400, gin.H{"error": "Invalid element_type"})
 			return
@@ -8348,18 +8209,154 @@ func main() {
 		})
 	})
 
+	// Endpoint para explicar los puntos de una alineación: cada elemento con las
+	// reglas que le han dado puntos. La de otro jugador solo se ve cuando empieza el GP.
+	router.GET("/api/lineup/explanation", authMiddleware(), func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		leagueID, err := strconv.ParseUint(c.Query("league_id"), 10, 64)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Falta league_id"})
+			return
+		}
+		gpIndex, err := strconv.ParseUint(c.Query("gp_index"), 10, 64)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Falta gp_index"})
+			return
+		}
+		playerID := uint64(userID)
+		if p := c.Query("player_id"); p != "" {
+			if playerID, err = strconv.ParseUint(p, 10, 64); err != nil {
+				c.JSON(400, gin.H{"error": "player_id inválido"})
+				return
+			}
+		}
+
+		var membership models.PlayerByLeague
+		if err := database.DB.Where("player_id = ? AND league_id = ?", userID, leagueID).First(&membership).Error; err != nil {
+			c.JSON(403, gin.H{"error": "No perteneces a esta liga"})
+			return
+		}
+		var gp models.GrandPrix
+		if err := database.DB.Where("gp_index = ?", gpIndex).First(&gp).Error; err != nil {
+			c.JSON(404, gin.H{"error": "GP no encontrado"})
+			return
+		}
+		if playerID != uint64(userID) && time.Now().Before(gp.StartDate) {
+			c.JSON(403, gin.H{"error": "La alineación de otro jugador no es visible hasta que empiece el GP"})
+			return
+		}
+
+		var lineup models.Lineup
+		if err := database.DB.Where("player_id = ? AND league_id = ? AND gp_index = ?", playerID, leagueID, gpIndex).First(&lineup).Error; err != nil {
+			c.JSON(404, gin.H{"error": "No hay alineación para este GP"})
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"player_id":       playerID,
+			"league_id":       leagueID,
+			"gp_index":        gpIndex,
+			"gp_name":         gp.Name,
+			"scoring_version": leagueScoringRuleset(uint(leagueID)).Version,
+			"lineup_points":   lineup.LineupPoints,
+			"explanation":     explainLineup(lineup),
+		})
+	})
+
+	// Endpoint para ver los chips de temporada del jugador en una liga: los
+	// disponibles y en qué GP o fichaje se gastó cada uno
+	router.GET("/api/chips", authMiddleware(), func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		leagueID, err := strconv.ParseUint(c.Query("league_id"), 10, 64)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Falta league_id"})
+			return
+		}
+		var playerLeague models.PlayerByLeague
+		if err := database.DB.Where("player_id = ? AND league_id = ?", userID, leagueID).First(&playerLeague).Error; err != nil {
+			c.JSON(403, gin.H{"error": "No perteneces a esta liga"})
+			return
+		}
+
+		usages := playerChipUsages(playerLeague.ID)
+		chips := []gin.H{}
+		for _, chip := range parseEnabledChips(loadLeagueSettings(database.DB, uint(leagueID)).EnabledChips) {
+			info, ok := findChip(chip)
+			if !ok {
+				continue
+			}
+			entry := gin.H{"chip": info.Chip, "name": info.Name, "description": info.Description, "lineup": info.Lineup, "used": false}
+			if usage, used := usages[chip]; used {
+				entry["used"] = true
+				entry["usage"] = usage
+			}
+			chips = append(chips, entry)
+		}
+		c.JSON(200, gin.H{"chips": chips})
+	})
+
+	// Endpoint para ver los chips activados por los jugadores de una liga en un
+	// GP. Son privados hasta que empieza el GP y se cierran las alineaciones.
+	router.GET("/api/leagues/:id/chips", authMiddleware(), func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		leagueID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "league_id inválido"})
+			return
+		}
+		gpIndex, err := strconv.ParseUint(c.Query("gp_index"), 10, 64)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Falta gp_index"})
+			return
+		}
+		var membership models.PlayerByLeague
+		if err := database.DB.Where("player_id = ? AND league_id = ?", userID, leagueID).First(&membership).Error; err != nil {
+			c.JSON(403, gin.H{"error": "No perteneces a esta liga"})
+			return
+		}
+		var gp models.GrandPrix
+		if err := database.DB.Where("gp_index = ?", gpIndex).First(&gp).Error; err != nil {
+			c.JSON(404, gin.H{"error": "GP no encontrado"})
+			return
+		}
+		// Mismo corte que el bloqueo del chip: la primera sesión del GP
+		if time.Now().Before(loadGPSchedule(gp).firstStart()) {
+			c.JSON(403, gin.H{"error": "Los chips de la liga no son visibles hasta que empiece el GP"})
+			return
+		}
+
+		var usages []models.ChipUsage
+		if err := database.DB.Where("league_id = ? AND gp_index = ?", leagueID, gpIndex).Order("player_id asc").Find(&usages).Error; err != nil {
+			c.JSON(500, gin.H{"error": "Error obteniendo los chips"})
+			return
+		}
+		chips := make([]gin.H, 0, len(usages))
+		for _, usage := range usages {
+			var player models.Player
+			database.DB.Select("id", "name").First(&player, usage.PlayerID)
+			chips = append(chips, gin.H{"player_id": usage.PlayerID, "player_name": player.Name, "chip": usage.Chip})
+		}
+		c.JSON(200, gin.H{"gp_index": gpIndex, "gp_name": gp.Name, "chips": chips})
+	})
+
 	router.POST("/api/lineup/save", authMiddleware(), func(c *gin.Context) {
 		userID := c.GetUint("user_id")
 
 		var req struct {
-			LeagueID          uint   `json:"league_id"`
-			RacePilots        []uint `json:"race_pilots"`
-			QualifyingPilots  []uint `json:"qualifying_pilots"`
-			PracticePilots    []uint `json:"practice_pilots"`
-			TeamConstructorID *uint  `json:"team_constructor_id"`
-			ChiefEngineerID   *uint  `json:"chief_engineer_id"`
-			TrackEngineers    []uint `json:"track_engineers"`
-			GPIndex           *uint  `json:"gp_index"` // Opcional para admins
+			LeagueID          uint              `json:"league_id"`
+			RacePilots        []uint            `json:"race_pilots"`
+			QualifyingPilots  []uint            `json:"qualifying_pilots"`
+			PracticePilots    []uint            `json:"practice_pilots"`
+			SprintPilots      []uint            `json:"sprint_pilots"` // Solo en GPs con sprint
+			BenchPilots       map[string][]uint `json:"bench_pilots"`  // Suplentes ordenados por sesión
+			TeamConstructorID *uint             `json:"team_constructor_id"`
+			ChiefEngineerID   *uint             `json:"chief_engineer_id"`
+			TrackEngineers    []uint            `json:"track_engineers"`
+			CaptainID         *uint             `json:"captain_id"`      // pilot_by_league_id de carrera o clasificación
+			ViceCaptainID     *uint             `json:"vice_captain_id"` // Sustituye al capitán si no participa
+			Chip              *string           `json:"chip"`            // Chip de temporada para el GP ("" lo quita)
+			GPIndex           *uint             `json:"gp_index"`        // Opcional para admins
+			Force             bool              `json:"force"`           // Solo admins: ignora los bloqueos por sesión
 		}
 
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -8367,11 +8364,21 @@ func main() {
 			return
 		}
 
+		if err := validateCaptains(req.CaptainID, req.ViceCaptainID, req.RacePilots, req.QualifyingPilots); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		// Elegir el GP o saltarse los bloqueos queda reservado a los admins
+		if (req.GPIndex != nil || req.Force) && !requireAdmin(c) {
+			return
+		}
+
 		// LÓGICA MEJORADA: Determinar el GP correcto para guardar alineación
 		var targetGP models.GrandPrix
+		var schedule gpSchedule
 		now := time.Now()
 
-		// Si se proporciona un GP index específico (para admins), usarlo
+		// Si se proporciona un GP index específico (solo admins), usarlo
 		if req.GPIndex != nil {
 			log.Printf("🔍 Admin: Guardando alineación para GP index específico: %d", *req.GPIndex)
 			if err := database.DB.Where("gp_index = ?", *req.GPIndex).First(&targetGP).Error; err != nil {
@@ -8380,24 +8387,26 @@ func main() {
 			}
 			log.Printf("🔍 Admin: GP encontrado: %s (index: %d)", targetGP.Name, targetGP.GPIndex)
 			// Si se proporcionó un GP index específico, no continuar con la lógica automática
+			schedule = loadGPSchedule(targetGP)
 		} else {
-			// Buscar el próximo GP que NO haya comenzado aún
-			if err := database.DB.Where("start_date > ?", now).Order("start_date ASC").First(&targetGP).Error; err != nil {
-				// Si no hay próximos GPs, buscar el último GP que haya comenzado
-				if err := database.DB.Where("start_date <= ?", now).Order("start_date DESC").First(&targetGP).Error; err != nil {
-					c.JSON(404, gin.H{"error": "No Grand Prix found"})
-					return
-				}
+			// El GP objetivo es el primero con alguna sesión sin empezar; cada
+			// grupo de la alineación se bloquea al empezar su sesión
+			var ok bool
+			schedule, ok = lineupTargetGP(now)
+			if !ok {
+				c.JSON(400, gin.H{"error": "No se pueden guardar alineaciones. El GP ya ha comenzado y no hay próximos GPs disponibles."})
+				return
 			}
+			targetGP = schedule.GP
+		}
 
-			// Verificar si el GP objetivo ya ha comenzado
-			if targetGP.StartDate.Before(now) || targetGP.StartDate.Equal(now) {
-				// El GP ya comenzó, buscar el próximo GP disponible
-				if err := database.DB.Where("start_date > ?", now).Order("start_date ASC").First(&targetGP).Error; err != nil {
-					c.JSON(400, gin.H{"error": "No se pueden guardar alineaciones. El GP ya ha comenzado y no hay próximos GPs disponibles."})
-					return
-				}
-			}
+		if err := validateSprintPilots(targetGP, req.SprintPilots); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err := validateBench(req.BenchPilots, req.RacePilots, req.QualifyingPilots, req.PracticePilots); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
 		}
 
 		// Buscar alineación existente para el GP objetivo
@@ -8408,18 +8417,92 @@ func main() {
 		racePilotsJSON, _ := json.Marshal(req.RacePilots)
 		qualifyingPilotsJSON, _ := json.Marshal(req.QualifyingPilots)
 		practicePilotsJSON, _ := json.Marshal(req.PracticePilots)
+		sprintPilotsJSON, _ := json.Marshal(req.SprintPilots)
+		benchPilotsJSON, _ := json.Marshal(req.BenchPilots)
 		trackEngineersJSON, _ := json.Marshal(req.TrackEngineers)
 
+		// Los grupos cuya sesión ya empezó no se pueden cambiar; solo un admin
+		// puede saltarse los bloqueos con force
+		var frozen map[string]bool
+		if !req.Force {
+			next := models.Lineup{
+				RacePilots:        racePilotsJSON,
+				QualifyingPilots:  qualifyingPilotsJSON,
+				PracticePilots:    practicePilotsJSON,
+				SprintPilots:      sprintPilotsJSON,
+				BenchPilots:       benchPilotsJSON,
+				TeamConstructorID: req.TeamConstructorID,
+				ChiefEngineerID:   req.ChiefEngineerID,
+				TrackEngineers:    trackEngineersJSON,
+				CaptainID:         req.CaptainID,
+				ViceCaptainID:     req.ViceCaptainID,
+			}
+			if lockErrors := lockedSlotChanges(schedule, now, lineup, next, req.Chip); len(lockErrors) > 0 {
+				c.JSON(400, gin.H{"error": "Hay grupos de la alineación bloqueados", "slot_errors": lockErrors})
+				return
+			}
+			frozen = frozenSlots(schedule, now, lineup, next)
+		}
+
+		// Propiedad de las cartas, modo de cada hueco y reglas de la plantilla
+		slotErrors := validateLineup(userID, req.LeagueID, lineupSelection{
+			RacePilots:        req.RacePilots,
+			QualifyingPilots:  req.QualifyingPilots,
+			PracticePilots:    req.PracticePilots,
+			SprintPilots:      req.SprintPilots,
+			BenchPilots:       req.BenchPilots,
+			TeamConstructorID: req.TeamConstructorID,
+			ChiefEngineerID:   req.ChiefEngineerID,
+			TrackEngineers:    req.TrackEngineers,
+		})
+		// Los grupos bloqueados que se reenvían sin cambios no se revalidan: una
+		// carta vendida después del bloqueo no impide guardar los grupos abiertos
+		slotErrors = withoutSlots(slotErrors, frozen)
+		if len(slotErrors) > 0 {
+			c.JSON(400, gin.H{"error": "Alineación inválida", "slot_errors": slotErrors})
+			return
+		}
+
+		// Chip de temporada del GP: se valida ahora y se guarda junto con la
+		// alineación, para no gastarlo si la alineación no llega a guardarse
+		var playerLeague models.PlayerByLeague
+		if req.Chip != nil {
+			if err := database.DB.Where("player_id = ? AND league_id = ?", userID, req.LeagueID).First(&playerLeague).Error; err != nil {
+				c.JSON(404, gin.H{"error": "Jugador no encontrado"})
+				return
+			}
+			if err := validateLineupChip(playerLeague, targetGP.GPIndex, *req.Chip); err != nil {
+				c.JSON(400, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		saveChip := func(tx *gorm.DB) error {
+			if req.Chip == nil {
+				return nil
+			}
+			return setLineupChip(tx, playerLeague, targetGP.GPIndex, *req.Chip)
+		}
+
 		if exists {
 			// Actualizar alineación existente
 			lineup.RacePilots = racePilotsJSON
 			lineup.QualifyingPilots = qualifyingPilotsJSON
 			lineup.PracticePilots = practicePilotsJSON
+			lineup.SprintPilots = sprintPilotsJSON
+			lineup.BenchPilots = benchPilotsJSON
 			lineup.TeamConstructorID = req.TeamConstructorID
 			lineup.ChiefEngineerID = req.ChiefEngineerID
 			lineup.TrackEngineers = trackEngineersJSON
+			lineup.CaptainID = req.CaptainID
+			lineup.ViceCaptainID = req.ViceCaptainID
+			lineup.AutoGenerated = false
 
-			if err := database.DB.Save(&lineup).Error; err != nil {
+			if err := database.DB.Transaction(func(tx *gorm.DB) error {
+				if err := saveChip(tx); err != nil {
+					return err
+				}
+				return tx.Save(&lineup).Error
+			}); err != nil {
 				c.JSON(500, gin.H{"error": "Error updating lineup"})
 				return
 			}
@@ -8432,12 +8515,21 @@ func main() {
 				RacePilots:        racePilotsJSON,
 				QualifyingPilots:  qualifyingPilotsJSON,
 				PracticePilots:    practicePilotsJSON,
+				SprintPilots:      sprintPilotsJSON,
+				BenchPilots:       benchPilotsJSON,
 				TeamConstructorID: req.TeamConstructorID,
 				ChiefEngineerID:   req.ChiefEngineerID,
 				TrackEngineers:    trackEngineersJSON,
+				CaptainID:         req.CaptainID,
+				ViceCaptainID:     req.ViceCaptainID,
 			}
 
-			if err := database.DB.Create(&lineup).Error; err != nil {
+			if err := database.DB.Transaction(func(tx *gorm.DB) error {
+				if err := saveChip(tx); err != nil {
+					return err
+				}
+				return tx.Create(&lineup).Error
+			}); err != nil {
 				c.JSON(500, gin.H{"error": "Error creating lineup"})
 				return
 			}
@@ -8449,6 +8541,8 @@ func main() {
 			"gp_name":       targetGP.Name,
 			"gp_start_date": targetGP.StartDate,
 			"is_next_gp":    targetGP.StartDate.After(now),
+			"chip":          lineupChip(lineup),
+			"locked_slots":  schedule.lockedSlots(now, lineup),
 		})
 	})
 
@@ -8548,311 +8642,61 @@ func main() {
 		c.JSON(200, response)
 	})
 
-	// Endpoint para recalcular puntos de jugadores en player_points_by_gp para un GP
-	router.POST("/api/admin/recalculate-player-points", authMiddleware(), func(c *gin.Context) {
-		var req struct {
-			GPIndex  uint64 `json:"gp_index"`
-			LeagueID *uint  `json:"league_id,omitempty"` // Opcional, si no se especifica se hace para todas las ligas
-		}
-		if err := c.ShouldBindJSON(&req); err != nil {
-			log.Printf("[RECALC-PLAYER-POINTS] Error ShouldBindJSON: %v", err)
-			c.JSON(400, gin.H{"error": "Datos inválidos"})
-			return
-		}
-
-		log.Printf("[RECALC-PLAYER-POINTS] Recalculando puntos para GP %d", req.GPIndex)
-
-		// Obtener todas las alineaciones para este GP (filtrar por liga si se especifica)
-		var lineups []models.Lineup
-		query := database.DB.Where("gp_index = ?", req.GPIndex)
-		if req.LeagueID != nil {
-			query = query.Where("league_id = ?", *req.LeagueID)
-		}
-		query.Find(&lineups)
-
-		updatedCount := 0
-		for _, lineup := range lineups {
-			// Calcular puntos usando la nueva lógica
-			totalPoints := calculatePlayerTotalPoints(lineup.PlayerID, uint64(lineup.LeagueID), req.GPIndex)
-
-			// Actualizar player_points_by_gp
-			var existingRecord struct {
-				ID uint `gorm:"primaryKey"`
-			}
-			err := database.DB.Table("player_points_by_gp").Where("player_id = ? AND league_id = ? AND gp_index = ?", lineup.PlayerID, lineup.LeagueID, req.GPIndex).First(&existingRecord).Error
-
-			if err != nil {
-				// No existe, crear nuevo registro
-				err = database.DB.Exec("INSERT INTO player_points_by_gp (player_id, league_id, gp_index, points) VALUES (?, ?, ?, ?)",
-					lineup.PlayerID, lineup.LeagueID, req.GPIndex, totalPoints).Error
-				if err != nil {
-					log.Printf("[RECALC-PLAYER-POINTS] Error creando registro para player_id=%d, league_id=%d: %v", lineup.PlayerID, lineup.LeagueID, err)
-					continue
-				}
-			} else {
-				// Existe, actualizar
-				err = database.DB.Exec("UPDATE player_points_by_gp SET points = ? WHERE player_id = ? AND league_id = ? AND gp_index = ?",
-					totalPoints, lineup.PlayerID, lineup.LeagueID, req.GPIndex).Error
-				if err != nil {
-					log.Printf("[RECALC-PLAYER-POINTS] Error actualizando registro para player_id=%d, league_id=%d: %v", lineup.PlayerID, lineup.LeagueID, err)
-					continue
-				}
-			}
-
-			// También actualizar lineup_points en la tabla lineups
-			lineup.LineupPoints = totalPoints
-			database.DB.Save(&lineup)
-
-			log.Printf("[RECALC-PLAYER-POINTS] Player %d (Liga %d): %d puntos", lineup.PlayerID, lineup.LeagueID, totalPoints)
-			updatedCount++
-		}
-
-		// Recalcular puntos totales de todos los jugadores afectados
-		var affectedPlayers []struct {
-			PlayerID uint
-			LeagueID uint
-		}
-
-		query = database.DB.Table("lineups").Select("DISTINCT player_id, league_id").Where("gp_index = ?", req.GPIndex)
-		if req.LeagueID != nil {
-			query = query.Where("league_id = ?", *req.LeagueID)
-		}
-		query.Find(&affectedPlayers)
-
-		for _, player := range affectedPlayers {
-			// Recalcular puntos totales sumando todos los GPs
-			var totalPoints int
-			err := database.DB.Raw("SELECT COALESCE(SUM(points), 0) FROM player_points_by_gp WHERE player_id = ? AND league_id = ?", player.PlayerID, player.LeagueID).Scan(&totalPoints).Error
-			if err == nil {
-				// Actualizar TotalPoints en PlayerByLeague
-				database.DB.Model(&models.PlayerByLeague{}).Where("player_id = ? AND league_id = ?", player.PlayerID, player.LeagueID).Update("total_points", totalPoints)
-			}
-		}
-
-		message := fmt.Sprintf("Recalculados puntos para %d jugadores en GP %d", updatedCount, req.GPIndex)
-		if req.LeagueID != nil {
-			message += fmt.Sprintf(" (Liga %d)", *req.LeagueID)
-		}
-
-		c.JSON(200, gin.H{
-			"message":       message,
-			"updated_count": updatedCount,
-		})
-	})
-
-	// Endpoint para actualizar puntos de alineaciones (solo administradores)
-	router.POST("/api/admin/update-lineup-points", authMiddleware(), func(c *gin.Context) {
-		// Verificar que el usuario sea administrador
-		userIDRaw, ok := c.Get("user_id")
-		if !ok {
-			c.JSON(401, gin.H{"error": "No autenticado"})
-			return
-		}
-		userID, ok := userIDRaw.(uint)
-		if !ok {
-			c.JSON(401, gin.H{"error": "No autenticado (tipo user_id incorrecto)"})
-			return
-		}
-
-		// Verificar si es administrador
-		var player models.Player
-		if err := database.DB.First(&player, userID).Error; err != nil {
-			c.JSON(404, gin.H{"error": "Usuario no encontrado"})
-			return
-		}
-		if !player.IsAdmin {
-			c.JSON(403, gin.H{"error": "Acceso denegado. Solo administradores."})
+	// Endpoint para repuntuar un GP completo desde los resultados en bruto: sesiones,
+	// alineaciones y totales de jugadores. Se puede repetir sin duplicar puntos y
+	// devuelve el diff de lo que ha cambiado.
+	router.POST("/api/admin/rescore-gp", authMiddleware(), func(c *gin.Context) {
+		if !requireAdmin(c) {
 			return
 		}
-
 		var req struct {
-			LeagueID uint `json:"league_id"`
-			GPIndex  uint `json:"gp_index"`
+			GPIndex *uint64 `json:"gp_index"`
 		}
-		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(400, gin.H{"error": "Datos inválidos"})
+		if err := c.ShouldBindJSON(&req); err != nil || req.GPIndex == nil {
+			c.JSON(400, gin.H{"error": "Falta gp_index"})
 			return
 		}
-
-		log.Printf("[UPDATE-LINEUP-POINTS] Iniciando actualización para league_id=%d, gp_index=%d", req.LeagueID, req.GPIndex)
-
-		// Obtener todas las alineaciones de esta liga y GP
-		var lineups []models.Lineup
-		if err := database.DB.Where("league_id = ? AND gp_index = ?", req.LeagueID, req.GPIndex).Find(&lineups).Error; err != nil {
-			c.JSON(500, gin.H{"error": "Error obteniendo alineaciones"})
+		var gp models.GrandPrix
+		if err := database.DB.Where("gp_index = ?", *req.GPIndex).First(&gp).Error; err != nil {
+			c.JSON(404, gin.H{"error": "GP no encontrado"})
 			return
 		}
-
-		log.Printf("[UPDATE-LINEUP-POINTS] Encontradas %d alineaciones", len(lineups))
-
-		// Verificar si ya se han calculado puntos para alguna alineación
-		alreadyCalculatedCount := 0
-		lineupsToUpdate := []models.Lineup{}
-
-		for _, lineup := range lineups {
-			if lineup.LineupPoints > 0 {
-				alreadyCalculatedCount++
-			} else {
-				lineupsToUpdate = append(lineupsToUpdate, lineup)
-			}
-		}
-
-		if alreadyCalculatedCount > 0 {
-			log.Printf("[UPDATE-LINEUP-POINTS] ADVERTENCIA: %d alineaciones ya tienen puntos calculados, actualizando solo %d alineaciones", alreadyCalculatedCount, len(lineupsToUpdate))
-		}
-
-		if len(lineupsToUpdate) == 0 {
-			c.JSON(400, gin.H{
-				"error":                    fmt.Sprintf("Todas las alineaciones (%d) ya tienen puntos calculados. Si necesitas recalcular, primero resetea los puntos a 0.", len(lineups)),
-				"already_calculated_count": alreadyCalculatedCount,
-				"total_lineups":            len(lineups),
-				"league_id":                req.LeagueID,
-				"gp_index":                 req.GPIndex,
-			})
+		result, err := rescoreGP(*req.GPIndex)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error(), "diff": result})
 			return
 		}
-
-		updatedCount := 0
-		for _, lineup := range lineupsToUpdate {
-			totalPoints := 0
-
-			// Calcular puntos de pilotos de carrera
-			var racePilots []uint
-			if len(lineup.RacePilots) > 0 {
-				json.Unmarshal(lineup.RacePilots, &racePilots)
-				for _, pilotByLeagueID := range racePilots {
-					points := getPilotPoints(pilotByLeagueID, uint64(req.GPIndex))
-					totalPoints += points
-					log.Printf("[UPDATE-LINEUP-POINTS] Piloto carrera ID %d: %d pts", pilotByLeagueID, points)
-				}
-			}
-
-			// Calcular puntos de pilotos de clasificación
-			var qualifyingPilots []uint
-			if len(lineup.QualifyingPilots) > 0 {
-				json.Unmarshal(lineup.QualifyingPilots, &qualifyingPilots)
-				for _, pilotByLeagueID := range qualifyingPilots {
-					points := getPilotPoints(pilotByLeagueID, uint64(req.GPIndex))
-					totalPoints += points
-					log.Printf("[UPDATE-LINEUP-POINTS] Piloto qualy ID %d: %d pts", pilotByLeagueID, points)
-				}
-			}
-
-			// Calcular puntos de pilotos de práctica
-			var practicePilots []uint
-			if len(lineup.PracticePilots) > 0 {
-				json.Unmarshal(lineup.PracticePilots, &practicePilots)
-				for _, pilotByLeagueID := range practicePilots {
-					points := getPilotPoints(pilotByLeagueID, uint64(req.GPIndex))
-					totalPoints += points
-					log.Printf("[UPDATE-LINEUP-POINTS] Piloto practice ID %d: %d pts", pilotByLeagueID, points)
-				}
-			}
-
-			// Calcular puntos del constructor
-			if lineup.TeamConstructorID != nil {
-				points := getTeamConstructorPoints(*lineup.TeamConstructorID, uint64(req.GPIndex))
-				totalPoints += points
-				log.Printf("[UPDATE-LINEUP-POINTS] Constructor ID %d: %d pts", *lineup.TeamConstructorID, points)
-			}
-
-			// Calcular puntos del chief engineer
-			if lineup.ChiefEngineerID != nil {
-				points := getChiefEngineerPoints(*lineup.ChiefEngineerID, uint64(req.GPIndex))
-				totalPoints += points
-				log.Printf("[UPDATE-LINEUP-POINTS] Chief Engineer ID %d: %d pts", *lineup.ChiefEngineerID, points)
-			}
-
-			// Calcular puntos de track engineers
-			var trackEngineers []uint
-			if len(lineup.TrackEngineers) > 0 {
-				json.Unmarshal(lineup.TrackEngineers, &trackEngineers)
-				for _, trackEngineerByLeagueID := range trackEngineers {
-					points := getTrackEngineerPointsWithLineup(trackEngineerByLeagueID, uint64(req.GPIndex), lineup)
-					totalPoints += points
-					log.Printf("[UPDATE-LINEUP-POINTS] Track Engineer ID %d: %d pts", trackEngineerByLeagueID, points)
-				}
-			}
-
-			// Actualizar los puntos en la alineación
-			lineup.LineupPoints = totalPoints
-			if err := database.DB.Save(&lineup).Error; err != nil {
-				log.Printf("[UPDATE-LINEUP-POINTS] Error guardando alineación %d: %v", lineup.ID, err)
-				continue
-			}
-
-			log.Printf("[UPDATE-LINEUP-POINTS] Alineación %d (jugador %d): %d pts totales", lineup.ID, lineup.PlayerID, totalPoints)
-			updatedCount++
-		}
-
-		message := fmt.Sprintf("Actualizadas %d alineaciones con sus puntos totales", updatedCount)
-		if alreadyCalculatedCount > 0 {
-			message = fmt.Sprintf("Actualizadas %d alineaciones con sus puntos totales (%d alineaciones ya tenían puntos calculados)", updatedCount, alreadyCalculatedCount)
-		}
-
-		c.JSON(200, gin.H{
-			"message":                  message,
-			"updated_count":            updatedCount,
-			"already_calculated_count": alreadyCalculatedCount,
-			"total_lineups":            len(lineups),
-			"league_id":                req.LeagueID,
-			"gp_index":                 req.GPIndex,
-		})
+		c.JSON(200, gin.H{"changed": result.Changed(), "diff": result})
 	})
 
-	// Endpoint para resetear puntos de alineaciones (solo administradores)
-	router.POST("/api/admin/reset-lineup-points", authMiddleware(), func(c *gin.Context) {
-		// Verificar que el usuario sea administrador
-		userIDRaw, ok := c.Get("user_id")
-		if !ok {
-			c.JSON(401, gin.H{"error": "No autenticado"})
-			return
-		}
-		userID, ok := userIDRaw.(uint)
-		if !ok {
-			c.JSON(401, gin.H{"error": "No autenticado (tipo user_id incorrecto)"})
-			return
-		}
-
-		// Verificar si es administrador
-		var player models.Player
-		if err := database.DB.First(&player, userID).Error; err != nil {
-			c.JSON(404, gin.H{"error": "Usuario no encontrado"})
-			return
-		}
-		if !player.IsAdmin {
-			c.JSON(403, gin.H{"error": "Acceso denegado. Solo administradores."})
+	// Endpoint para actualizar puntos de alineaciones (solo administradores). Repuntúa
+	// el GP completo con /api/admin/rescore-gp, así que se puede repetir sin
+	// duplicar puntos.
+	router.POST("/api/admin/update-lineup-points", authMiddleware(), func(c *gin.Context) {
+		if !requireAdmin(c) {
 			return
 		}
-
 		var req struct {
-			LeagueID uint `json:"league_id"`
-			GPIndex  uint `json:"gp_index"`
+			GPIndex uint64 `json:"gp_index"`
 		}
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(400, gin.H{"error": "Datos inválidos"})
 			return
 		}
 
-		log.Printf("[RESET-LINEUP-POINTS] Reseteando puntos para league_id=%d, gp_index=%d", req.LeagueID, req.GPIndex)
-
-		// Resetear todos los puntos de alineaciones de esta liga y GP
-		result := database.DB.Model(&models.Lineup{}).
-			Where("league_id = ? AND gp_index = ?", req.LeagueID, req.GPIndex).
-			Update("lineup_points", 0)
-
-		if result.Error != nil {
-			c.JSON(500, gin.H{"error": "Error reseteando puntos"})
+		log.Printf("[UPDATE-LINEUP-POINTS] Repuntuando GP %d", req.GPIndex)
+		result, err := rescoreGP(req.GPIndex)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error(), "diff": result})
 			return
 		}
 
-		log.Printf("[RESET-LINEUP-POINTS] Reseteados %d alineaciones", result.RowsAffected)
-
 		c.JSON(200, gin.H{
-			"message":     fmt.Sprintf("Reseteados puntos de %d alineaciones", result.RowsAffected),
-			"reset_count": result.RowsAffected,
-			"league_id":   req.LeagueID,
-			"gp_index":    req.GPIndex,
+			"message":       fmt.Sprintf("Revisadas %d alineaciones del GP %d: %d con puntos nuevos", result.LineupsChecked, req.GPIndex, len(result.Lineups)),
+			"updated_count": len(result.Lineups),
+			"total_lineups": result.LineupsChecked,
+			"gp_index":      req.GPIndex,
+			"diff":          result,
 		})
 	})
 
@@ -8877,8 +8721,10 @@ func main() {
 			return
 		}
 
-		if playerLeague.Money < req.OfferValue {
-			c.JSON(400, gin.H{"error": "No tienes suficiente dinero"})
+		// Las pujas y ofertas abiertas reservan dinero
+		budget := playerBudget(database.DB, playerLeague, commitmentOffer, itemType, req.ItemID)
+		if req.OfferValue > budget.Available {
+			c.JSON(400, gin.H{"error": "No tienes suficiente dinero disponible", "money": budget.Money, "committed": budget.Committed, "available": budget.Available})
 			return
 		}
 
@@ -9048,8 +8894,10 @@ func main() {
 			return
 		}
 
-		if playerLeague.Money < req.OfferValue {
-			c.JSON(400, gin.H{"error": "No tienes suficiente dinero"})
+		// Las pujas y ofertas abiertas reservan dinero
+		budget := playerBudget(database.DB, playerLeague, commitmentOffer, itemType, req.ItemID)
+		if req.OfferValue > budget.Available {
+			c.JSON(400, gin.H{"error": "No tienes suficiente dinero disponible", "money": budget.Money, "committed": budget.Committed, "available": budget.Available})
 			return
 		}
 
@@ -9371,6 +9219,7 @@ func main() {
 			ItemID        uint    `json:"item_id"`
 			LeagueID      uint    `json:"league_id"`
 			ClausulaValue float64 `json:"clausula_value"`
+			UseChip       bool    `json:"use_chip"` // Gastar el chip free_clausula: paga la liga
 		}
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(400, gin.H{"error": "Datos inválidos"})
@@ -9385,9 +9234,50 @@ func main() {
 			return
 		}
 
-		if playerLeague.Money < req.ClausulaValue {
-			c.JSON(400, gin.H{"error": "No tienes suficiente dinero"})
-			return
+		// Las pujas y ofertas abiertas reservan dinero; una oferta propia por el
+		// mismo elemento queda sustituida por la cláusula
+		if !req.UseChip {
+			budget := playerBudget(database.DB, playerLeague, commitmentOffer, itemType, req.ItemID)
+			if req.ClausulaValue > budget.Available {
+				c.JSON(400, gin.H{"error": "No tienes suficiente dinero disponible", "money": budget.Money, "committed": budget.Committed, "available": budget.Available})
+				return
+			}
+		}
+
+		// Con el chip de cláusula gratis se reserva el chip antes de fichar y se
+		// libera si la cláusula no llega a activarse
+		reason := ledgerReasonClausula
+		activated := false
+		if req.UseChip {
+			usage, err := reserveClausulaChip(playerLeague, itemType, req.ItemID)
+			if err != nil {
+				c.JSON(400, gin.H{"error": err.Error()})
+				return
+			}
+			defer func() {
+				if !activated {
+					database.DB.Delete(&usage)
+				}
+			}()
+			reason = ledgerReasonClausulaChip
+		}
+
+		// Transferir el elemento y pagar la cláusula al propietario anterior (o a
+		// la liga si ya no está en ella) en una única transacción
+		transferClausula := func(table string, oldOwnerID uint) error {
+			err := payClausula(table, itemType, req.ItemID, req.LeagueID, oldOwnerID, userID, req.ClausulaValue, req.UseChip, reason)
+			if err != nil {
+				log.Printf("[LEDGER] Error activando cláusula %s %d: %v", itemType, req.ItemID, err)
+				switch {
+				case errors.Is(err, errOwnerChanged):
+					c.JSON(409, gin.H{"error": err.Error()})
+				case errors.Is(err, errNotEnoughMoney):
+					c.JSON(400, gin.H{"error": err.Error()})
+				default:
+					c.JSON(500, gin.H{"error": "Error registrando el pago de la cláusula"})
+				}
+			}
+			return err
 		}
 
 		// Activar cláusula según el tipo de elemento
@@ -9407,18 +9297,9 @@ func main() {
 				c.JSON(400, gin.H{"error": "La cláusula aún está activa y protege al elemento"})
 				return
 			}
-			// Transferir propiedad
-			oldOwnerID := pbl.OwnerID
-			pbl.OwnerID = userID
-			database.DB.Save(&pbl)
-			// Actualizar dinero
-			playerLeague.Money -= req.ClausulaValue
-			database.DB.Save(&playerLeague)
-			// Dar dinero al propietario anterior
-			var oldOwnerLeague models.PlayerByLeague
-			if err := database.DB.Where("player_id = ? AND league_id = ?", oldOwnerID, req.LeagueID).First(&oldOwnerLeague).Error; err == nil {
-				oldOwnerLeague.Money += req.ClausulaValue
-				database.DB.Save(&oldOwnerLeague)
+			// Transferir propiedad y pagar la cláusula
+			if err := transferClausula(pbl.TableName(), pbl.OwnerID); err != nil {
+				return
 			}
 
 		case "track_engineer":
@@ -9436,15 +9317,9 @@ func main() {
 				c.JSON(400, gin.H{"error": "La cláusula aún está activa y protege al elemento"})
 				return
 			}
-			oldOwnerID := teb.OwnerID
-			teb.OwnerID = userID
-			database.DB.Save(&teb)
-			playerLeague.Money -= req.ClausulaValue
-			database.DB.Save(&playerLeague)
-			var oldOwnerLeague models.PlayerByLeague
-			if err := database.DB.Where("player_id = ? AND league_id = ?", oldOwnerID, req.LeagueID).First(&oldOwnerLeague).Error; err == nil {
-				oldOwnerLeague.Money += req.ClausulaValue
-				database.DB.Save(&oldOwnerLeague)
+			// Transferir propiedad y pagar la cláusula
+			if err := transferClausula(teb.TableName(), teb.OwnerID); err != nil {
+				return
 			}
 
 		case "chief_engineer":
@@ -9462,15 +9337,9 @@ func main() {
 				c.JSON(400, gin.H{"error": "La cláusula aún está activa y protege al elemento"})
 				return
 			}
-			oldOwnerID := ceb.OwnerID
-			ceb.OwnerID = userID
-			database.DB.Save(&ceb)
-			playerLeague.Money -= req.ClausulaValue
-			database.DB.Save(&playerLeague)
-			var oldOwnerLeague models.PlayerByLeague
-			if err := database.DB.Where("player_id = ? AND league_id = ?", oldOwnerID, req.LeagueID).First(&oldOwnerLeague).Error; err == nil {
-				oldOwnerLeague.Money += req.ClausulaValue
-				database.DB.Save(&oldOwnerLeague)
+			// Transferir propiedad y pagar la cláusula
+			if err := transferClausula(ceb.TableName(), ceb.OwnerID); err != nil {
+				return
 			}
 
 		case "team_constructor":
@@ -9488,15 +9357,9 @@ func main() {
 				c.JSON(400, gin.H{"error": "La cláusula aún está activa y protege al elemento"})
 				return
 			}
-			oldOwnerID := tcb.OwnerID
-			tcb.OwnerID = userID
-			database.DB.Save(&tcb)
-			playerLeague.Money -= req.ClausulaValue
-			database.DB.Save(&playerLeague)
-			var oldOwnerLeague models.PlayerByLeague
-			if err := database.DB.Where("player_id = ? AND league_id = ?", oldOwnerID, req.LeagueID).First(&oldOwnerLeague).Error; err == nil {
-				oldOwnerLeague.Money += req.ClausulaValue
-				database.DB.Save(&oldOwnerLeague)
+			// Transferir propiedad y pagar la cláusula
+			if err := transferClausula(tcb.TableName(), tcb.OwnerID); err != nil {
+				return
 			}
 
 		default:
@@ -9504,7 +9367,8 @@ func main() {
 			return
 		}
 
-		c.JSON(200, gin.H{"message": "Cláusula activada correctamente"})
+		activated = true
+		c.JSON(200, gin.H{"message": "Cláusula activada correctamente", "chip_used": req.UseChip})
 	})
 
 	// Endpoint para subir cláusula (solo para elementos propios)
@@ -9616,8 +9480,11 @@ func main() {
 		}
 
 		// Descontar dinero del jugador
-		playerLeague.Money -= req.UpgradeAmount
-		database.DB.Save(&playerLeague)
+		if err := moveMoneyTx(uint64(req.LeagueID), &playerLeague, nil, req.UpgradeAmount, itemType, req.ItemID, ledgerReasonClausulaUpgrade); err != nil {
+			log.Printf("[LEDGER] Error registrando subida de cláusula %s %d: %v", itemType, req.ItemID, err)
+			c.JSON(500, gin.H{"error": "Error registrando el movimiento de dinero"})
+			return
+		}
 
 		c.JSON(200, gin.H{
 			"message":            "Cláusula subida correctamente",
@@ -9858,73 +9725,27 @@ func main() {
 				return
 			}
 
-			if bidderLeague.Money < req.OfferValue {
+			// La oferta aceptada deja de reservar dinero, pero el resto de pujas y
+			// ofertas del comprador sí
+			if req.OfferValue > playerBudget(database.DB, bidderLeague, commitmentOffer, req.ItemType, req.ItemID).Available {
 				c.JSON(400, gin.H{"error": "El comprador no tiene suficiente dinero"})
 				return
 			}
 
-			// Transferir propiedad y dinero
-			switch req.ItemType {
-			case "pilot":
-				var pbl models.PilotByLeague
-				database.DB.First(&pbl, req.ItemID)
-				pbl.OwnerID = req.BidderID
-				// Limpiar ofertas, cláusulas y ofertas de la FIA
-				pbl.Bids = []byte("[]")
-				pbl.Venta = nil
-				pbl.VentaExpiresAt = nil
-				pbl.LeagueOfferValue = nil
-				pbl.LeagueOfferExpiresAt = nil
-				pbl.ClausulaValue = nil
-				pbl.Clausulatime = nil
-				database.DB.Save(&pbl)
-			case "track_engineer":
-				var teb models.TrackEngineerByLeague
-				database.DB.First(&teb, req.ItemID)
-				teb.OwnerID = req.BidderID
-				teb.Bids = []byte("[]")
-				teb.Venta = nil
-				teb.VentaExpiresAt = nil
-				teb.LeagueOfferValue = nil
-				teb.LeagueOfferExpiresAt = nil
-				teb.ClausulaValue = nil
-				teb.Clausulatime = nil
-				database.DB.Save(&teb)
-			case "chief_engineer":
-				var ceb models.ChiefEngineerByLeague
-				database.DB.First(&ceb, req.ItemID)
-				ceb.OwnerID = req.BidderID
-				ceb.Bids = []byte("[]")
-				ceb.Venta = nil
-				ceb.VentaExpiresAt = nil
-				ceb.LeagueOfferValue = nil
-				ceb.LeagueOfferExpiresAt = nil
-				ceb.ClausulaValue = nil
-				ceb.Clausulatime = nil
-				database.DB.Save(&ceb)
-			case "team_constructor":
-				var tcb models.TeamConstructorByLeague
-				database.DB.First(&tcb, req.ItemID)
-				tcb.OwnerID = req.BidderID
-				tcb.Bids = []byte("[]")
-				tcb.Venta = nil
-				tcb.VentaExpiresAt = nil
-				tcb.LeagueOfferValue = nil
-				tcb.LeagueOfferExpiresAt = nil
-				tcb.ClausulaValue = nil
-				tcb.Clausulatime = nil
-				database.DB.Save(&tcb)
+			// Transferir propiedad y dinero en una única transacción
+			if err := acceptPlayerOffer(req.ItemType, req.ItemID, req.LeagueID, userID, req.BidderID, req.OfferValue); err != nil {
+				log.Printf("[LEDGER] Error registrando oferta aceptada %s %d: %v", req.ItemType, req.ItemID, err)
+				switch {
+				case errors.Is(err, errOwnerChanged):
+					c.JSON(409, gin.H{"error": err.Error()})
+				case errors.Is(err, errNotEnoughMoney):
+					c.JSON(400, gin.H{"error": "El comprador no tiene suficiente dinero"})
+				default:
+					c.JSON(500, gin.H{"error": "Error registrando el movimiento de dinero"})
+				}
+				return
 			}
 
-			// Actualizar dinero
-			bidderLeague.Money -= req.OfferValue
-			database.DB.Save(&bidderLeague)
-
-			var ownerLeague models.PlayerByLeague
-			database.DB.Where("player_id = ? AND league_id = ?", userID, req.LeagueID).First(&ownerLeague)
-			ownerLeague.Money += req.OfferValue
-			database.DB.Save(&ownerLeague)
-
 			c.JSON(200, gin.H{"message": "Oferta aceptada correctamente"})
 		} else if req.Action == "reject" {
 			// Solo limpiar la oferta específica del array de bids
@@ -10016,125 +9837,172 @@ func main() {
 	})
 
 	// Endpoint para ejecutar el scraper (solo para administradores)
-	router.POST("/api/admin/run-scraper", func(c *gin.Context) {
-		// userID := c.GetUint("user_id")
-
-		// Verificar que el usuario es administrador
-		// var player models.Player
-		// if err := database.DB.Where("id = ?", userID).First(&player).Error; err != nil {
-		// 	c.JSON(404, gin.H{"error": "Usuario no encontrado"})
-		// 	return
-		// }
-
-		// if !player.IsAdmin {
-		// 	c.JSON(403, gin.H{"error": "Solo los administradores pueden ejecutar el scraper"})
-		// 	return
-		// }
+	router.POST("/api/admin/run-scraper", authMiddleware(), func(c *gin.Context) {
+		if !requireAdmin(c) {
+			return
+		}
 
 		var req struct {
-			GPKey string `json:"gp_key" binding:"required"`
+			GPKey  string `json:"gp_key" binding:"required"`
+			Season int    `json:"season"`  // Temporada de formula1.com; 0 = año del GP
+			DryRun *bool  `json:"dry_run"` // Por defecto true: importación pendiente; false aplica los resultados
 		}
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(400, gin.H{"error": "GP Key es requerido"})
 			return
 		}
 
-		log.Printf("[ENDPOINT] GP Key recibido: '%s'", req.GPKey)
-
-		// Validar que el GP key sea válido
-		validGPKeys := map[string]bool{
-			"australian":                true, // Australian Grand Prix
-			"australian_grand_prix":     true, // Alias para compatibilidad
-			"chinese":                   true, // Chinese Grand Prix
-			"chinese_grand_prix":        true, // Alias para compatibilidad
-			"japanese":                  true, // Japanese Grand Prix
-			"japanese_grand_prix":       true, // Alias para compatibilidad
-			"bahrain":                   true, // Bahrain Grand Prix
-			"bahrain_grand_prix":        true, // Alias para compatibilidad
-			"saudi_arabian":             true, // Saudi Arabian Grand Prix
-			"saudi_arabian_grand_prix":  true, // Alias para compatibilidad
-			"saudi":                     true, // Alias
-			"miami":                     true, // Miami Grand Prix
-			"miami_grand_prix":          true, // Alias para compatibilidad
-			"emilia_romagna":            true, // Emilia Romagna Grand Prix
-			"emilia_romagna_grand_prix": true, // Alias para compatibilidad
-			"emilia":                    true, // Alias
-			"monaco":                    true, // Monaco Grand Prix
-			"monaco_grand_prix":         true, // Alias para compatibilidad
-			"spanish":                   true, // Spanish Grand Prix
-			"spanish_grand_prix":        true, // Alias para compatibilidad
-			"canadian":                  true, // Canadian Grand Prix
-			"canadian_grand_prix":       true, // Alias para compatibilidad
-			"austrian":                  true, // Austrian Grand Prix
-			"austrian_grand_prix":       true, // Alias para compatibilidad
-			"british":                   true, // British Grand Prix
-			"british_grand_prix":        true, // Alias para compatibilidad
-			"britain":                   true, // Alias
-			"belgian":                   true, // Belgian Grand Prix
-			"belgian_grand_prix":        true, // Alias para compatibilidad
-			"hungarian":                 true, // Hungarian Grand Prix
-			"hungarian_grand_prix":      true, // Alias para compatibilidad
-			"dutch":                     true, // Dutch Grand Prix
-			"dutch_grand_prix":          true, // Alias para compatibilidad
-			"italian":                   true, // Italian Grand Prix
-			"italian_grand_prix":        true, // Alias para compatibilidad
-			"azerbaijan":                true, // Azerbaijan Grand Prix
-			"azerbaijan_grand_prix":     true, // Alias para compatibilidad
-			"singapore":                 true, // Singapore Grand Prix
-			"singapore_grand_prix":      true, // Alias para compatibilidad
-			"united_states":             true, // United States Grand Prix
-			"united_states_grand_prix":  true, // Alias para compatibilidad
-			"usa":                       true, // Alias
-			"mexican":                   true, // Mexican Grand Prix
-			"mexican_grand_prix":        true, // Alias para compatibilidad
-			"mexico":                    true, // Alias
-			"brazilian":                 true, // Brazilian Grand Prix
-			"brazilian_grand_prix":      true, // Alias para compatibilidad
-			"brazil":                    true, // Alias
-			"las_vegas":                 true, // Las Vegas Grand Prix
-			"las_vegas_grand_prix":      true, // Alias para compatibilidad
-			"qatar":                     true, // Qatar Grand Prix
-			"qatar_grand_prix":          true, // Alias para compatibilidad
-			"abu_dhabi":                 true, // Abu Dhabi Grand Prix
-			"abu_dhabi_grand_prix":      true, // Alias para compatibilidad
-		}
-
-		if !validGPKeys[req.GPKey] {
-			log.Printf("[ENDPOINT] GP Key '%s' NO válido en validGPKeys", req.GPKey)
+		log.Printf("[ENDPOINT] GP Key recibido: '%s' (temporada %d)", req.GPKey, req.Season)
+
+		// Validar que el GP key corresponda a un GP del calendario
+		if _, err := getGPIndexFromKey(req.GPKey); err != nil {
+			log.Printf("[ENDPOINT] GP Key '%s' NO válido: %v", req.GPKey, err)
 			c.JSON(400, gin.H{"error": "GP key no válido", "received": req.GPKey})
 			return
 		}
 
-		log.Printf("[ENDPOINT] GP Key '%s' válido, procediendo con scraper", req.GPKey)
+		log.Printf("[ENDPOINT] GP Key '%s' válido, poniendo el scraper en cola", req.GPKey)
+
+		// El scraper corre en segundo plano; el progreso se consulta con el id del trabajo
+		// Sin dry_run:false explícito el scraper solo deja una importación pendiente
+		dryRun := req.DryRun == nil || *req.DryRun
+		job, err := submitScraperJob(req.GPKey, req.Season, dryRun, c.GetUint("user_id"))
+		if err != nil {
+			log.Printf("[SCRAPER] Error poniendo el scraper en cola: %v", err)
+			status := 500
+			if errors.Is(err, errScraperBusy) {
+				status = 503
+			}
+			c.JSON(status, gin.H{"error": "Error ejecutando scraper", "details": err.Error()})
+			return
+		}
+		c.JSON(202, gin.H{"message": "Scraper en cola", "job_id": job.ID, "job": newScraperJobView(*job), "gp_key": req.GPKey})
+	})
+
+	// Trabajos del scraper: progreso de uno e historial por GP
+	router.GET("/api/admin/scraper-jobs", authMiddleware(), func(c *gin.Context) {
+		if !requireAdmin(c) {
+			return
+		}
+		query := database.DB.Order("created_at DESC")
+		if gpIndex := c.Query("gp_index"); gpIndex != "" {
+			query = query.Where("gp_index = ?", gpIndex)
+		}
+		if status := c.Query("status"); status != "" {
+			query = query.Where("status = ?", status)
+		}
+		var jobs []models.ScraperJob
+		if err := query.Limit(100).Find(&jobs).Error; err != nil {
+			c.JSON(500, gin.H{"error": "Error obteniendo trabajos del scraper"})
+			return
+		}
+		views := make([]scraperJobView, 0, len(jobs))
+		for _, job := range jobs {
+			views = append(views, newScraperJobView(job))
+		}
+		c.JSON(200, gin.H{"jobs": views})
+	})
 
-		log.Printf("[SCRAPER] Iniciando scraper para GP: %s", req.GPKey)
+	router.GET("/api/admin/scraper-jobs/:id", authMiddleware(), func(c *gin.Context) {
+		if !requireAdmin(c) {
+			return
+		}
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "id inválido"})
+			return
+		}
+		var job models.ScraperJob
+		if err := database.DB.First(&job, id).Error; err != nil {
+			c.JSON(404, gin.H{"error": "Trabajo no encontrado"})
+			return
+		}
+		c.JSON(200, gin.H{"job": newScraperJobView(job)})
+	})
 
-		// Ejecutar el scraper directamente como función
-		log.Printf("[ENDPOINT] Llamando a RunScraper...")
+	// Importaciones del scraper pendientes de aprobación (dry-run)
+	router.GET("/api/admin/scraper-imports", authMiddleware(), func(c *gin.Context) {
+		if !requireAdmin(c) {
+			return
+		}
+		query := database.DB.Order("created_at DESC")
+		if status := c.DefaultQuery("status", scraperImportPending); status != "all" {
+			query = query.Where("status = ?", status)
+		}
+		if gpIndex := c.Query("gp_index"); gpIndex != "" {
+			query = query.Where("gp_index = ?", gpIndex)
+		}
+		var imports []models.ScraperImport
+		if err := query.Limit(100).Find(&imports).Error; err != nil {
+			c.JSON(500, gin.H{"error": "Error obteniendo importaciones"})
+			return
+		}
+		c.JSON(200, gin.H{"imports": imports})
+	})
 
-		// Agregar defer con recover para capturar panics
-		defer func() {
-			if r := recover(); r != nil {
-				log.Printf("[ENDPOINT] PANIC RECUPERADO en RunScraper: %v", r)
-				c.JSON(500, gin.H{
-					"error":   "Error interno del servidor (panic)",
-					"details": fmt.Sprintf("Panic: %v", r),
-				})
-			}
-		}()
+	router.GET("/api/admin/scraper-imports/:id", authMiddleware(), func(c *gin.Context) {
+		if !requireAdmin(c) {
+			return
+		}
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "id inválido"})
+			return
+		}
+		imp, diff, err := scraperImportDiff(uint(id))
+		if err != nil {
+			c.JSON(404, gin.H{"error": "Importación no encontrada"})
+			return
+		}
+		c.JSON(200, gin.H{"import": imp, "diff": diff})
+	})
 
-		err := RunScraper(req.GPKey)
+	router.POST("/api/admin/scraper-imports/:id/approve", authMiddleware(), func(c *gin.Context) {
+		if !requireAdmin(c) {
+			return
+		}
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
 		if err != nil {
-			log.Printf("[SCRAPER] Error ejecutando scraper: %v", err)
-			c.JSON(500, gin.H{
-				"error":   "Error ejecutando scraper",
-				"details": err.Error(),
-			})
+			c.JSON(400, gin.H{"error": "id inválido"})
+			return
+		}
+		saved, err := approveScraperImport(uint(id), c.GetUint("user_id"))
+		if err != nil {
+			switch {
+			case errors.Is(err, errImportNotPending):
+				c.JSON(409, gin.H{"error": err.Error()})
+			case errors.Is(err, errImportNotFound):
+				c.JSON(404, gin.H{"error": err.Error()})
+			default:
+				log.Printf("[SCRAPER] Error aprobando importación %d: %v", id, err)
+				c.JSON(500, gin.H{"error": "Error aplicando la importación", "details": err.Error()})
+			}
 			return
 		}
+		c.JSON(200, gin.H{"message": "Importación aplicada", "saved_rows": saved})
+	})
 
-		log.Printf("[SCRAPER] Scraper ejecutado exitosamente para GP: %s", req.GPKey)
-		c.JSON(200, gin.H{"message": "Scraper ejecutado exitosamente", "gp_key": req.GPKey})
+	router.POST("/api/admin/scraper-imports/:id/reject", authMiddleware(), func(c *gin.Context) {
+		if !requireAdmin(c) {
+			return
+		}
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "id inválido"})
+			return
+		}
+		if err := rejectScraperImport(uint(id), c.GetUint("user_id")); err != nil {
+			switch {
+			case errors.Is(err, errImportNotPending):
+				c.JSON(409, gin.H{"error": err.Error()})
+			case errors.Is(err, errImportNotFound):
+				c.JSON(404, gin.H{"error": err.Error()})
+			default:
+				c.JSON(500, gin.H{"error": "Error descartando la importación"})
+			}
+			return
+		}
+		c.JSON(200, gin.H{"message": "Importación descartada"})
 	})
 
 	port := os.Getenv("PORT")
@@ -10149,24 +10017,16 @@ func main() {
 
 const FIA_PLAYER_ID = 999999 // ID especial para la FIA
 
-// Función para generar oferta de la FIA (entre 90% y 110% del valor de venta)
-func generateFIAOffer(saleValue float64) float64 {
-	// Generar un valor aleatorio entre 0.9 y 1.1 (90% a 110%)
-	multiplier := 0.9 + rand.Float64()*0.2
+// Función para generar oferta de la FIA (por defecto entre 90% y 110% del valor de venta)
+// generateFIAOffer usa el rng de un sorteo verificable (refresco del mercado u
+// ofertas FIA de la liga); sin rng usa el generador global
+func generateFIAOffer(rng *rand.Rand, settings models.LeagueSettings, saleValue float64) float64 {
+	multiplier := fiaMultiplier(rng, settings)
 	result := saleValue * multiplier
 	// NO redondear para mantener valores aleatorios más naturales
 	return result
 }
 
-// Función para calcular puntos de posición de equipos (1º=10, 2º=9, ..., 10º=1)
-func getTeamPositionPoints(position int) int {
-	if position < 1 || position > 10 {
-		return 0
-	}
-	// 1º = 10 pts, 2º = 9 pts, ..., 10º = 1 pt
-	return 11 - position
-}
-
 // Función para actualizar puntos de jugadores que tengan un piloto alineado
 func updatePlayerPointsForPilot(pilotID uint, gpIndex uint64, points int, sessionType string) {
 	// Buscar todas las alineaciones que incluyan este piloto en este GP
@@ -10190,6 +10050,10 @@ func updatePlayerPointsForPilot(pilotID uint, gpIndex uint64, points int, sessio
 			if len(lineup.PracticePilots) > 0 {
 				json.Unmarshal(lineup.PracticePilots, &pilots)
 			}
+		case "sprint", "sprint_qualy":
+			if len(lineup.SprintPilots) > 0 {
+				json.Unmarshal(lineup.SprintPilots, &pilots)
+			}
 		}
 
 		// Verificar si el piloto está en esta alineación
@@ -10198,7 +10062,7 @@ func updatePlayerPointsForPilot(pilotID uint, gpIndex uint64, points int, sessio
 			if err := database.DB.First(&pilotByLeague, pilotByLeagueID).Error; err == nil {
 				if pilotByLeague.PilotID == pilotID {
 					// Este jugador tiene el piloto alineado, actualizar sus puntos
-					updatePlayerTotalPoints(lineup.PlayerID, lineup.LeagueID, gpIndex, points)
+					updatePlayerTotalPoints(lineup.PlayerID, lineup.LeagueID, gpIndex)
 					break
 				}
 			}
@@ -10207,16 +10071,22 @@ func updatePlayerPointsForPilot(pilotID uint, gpIndex uint64, points int, sessio
 }
 
 // Función para calcular puntos totales de un jugador en un GP específico
-func calculatePlayerTotalPoints(playerID uint64, leagueID uint64, gpIndex uint64) int {
+func calculatePlayerTotalPoints(tx *gorm.DB, playerID uint64, leagueID uint64, gpIndex uint64) int {
 	// Buscar la alineación del jugador para el GP actual
 	var lineup models.Lineup
-	if err := database.DB.Where("player_id = ? AND league_id = ? AND gp_index = ?", playerID, leagueID, gpIndex).First(&lineup).Error; err != nil {
+	if err := tx.Where("player_id = ? AND league_id = ? AND gp_index = ?", playerID, leagueID, gpIndex).First(&lineup).Error; err != nil {
 		log.Printf("[CALC-POINTS] No se encontró alineación para player_id=%d, league_id=%d, gp_index=%d", playerID, leagueID, gpIndex)
 		return 0
 	}
 
 	log.Printf("[CALC-POINTS] Alineación encontrada: ID=%d", lineup.ID)
 
+	// Los suplentes entran por los titulares que no tienen resultado
+	lineup, substitutions := applyBenchSubstitutions(lineup)
+	for _, sub := range substitutions {
+		log.Printf("[CALC-POINTS] Cambio en %s: entra %s (ID: %d) por %s (ID: %d)", sub.Session, sub.InName, sub.InID, sub.OutName, sub.OutID)
+	}
+
 	// Parsear los IDs de pilot_by_league
 	var racePilotIDs []uint
 	var qualyPilotIDs []uint
@@ -10252,7 +10122,7 @@ func calculatePlayerTotalPoints(playerID uint64, leagueID uint64, gpIndex uint64
 	if len(lineup.RacePilots) > 0 {
 		json.Unmarshal(lineup.RacePilots, &racePilots)
 		for i, pilotByLeagueID := range racePilots {
-			points := getPilotPoints(pilotByLeagueID, gpIndex)
+			points := getPilotPoints(tx, pilotByLeagueID, gpIndex)
 			racePilotPoints += points
 			log.Printf("[DEBUG-POINTS] Piloto Carrera %d (ID: %d): %d puntos", i+1, pilotByLeagueID, points)
 		}
@@ -10266,7 +10136,7 @@ func calculatePlayerTotalPoints(playerID uint64, leagueID uint64, gpIndex uint64
 	if len(lineup.QualifyingPilots) > 0 {
 		json.Unmarshal(lineup.QualifyingPilots, &qualifyingPilots)
 		for i, pilotByLeagueID := range qualifyingPilots {
-			points := getPilotPoints(pilotByLeagueID, gpIndex)
+			points := getPilotPoints(tx, pilotByLeagueID, gpIndex)
 			qualifyingPilotPoints += points
 			log.Printf("[DEBUG-POINTS] Piloto Qualy %d (ID: %d): %d puntos", i+1, pilotByLeagueID, points)
 		}
@@ -10280,7 +10150,7 @@ func calculatePlayerTotalPoints(playerID uint64, leagueID uint64, gpIndex uint64
 	if len(lineup.PracticePilots) > 0 {
 		json.Unmarshal(lineup.PracticePilots, &practicePilots)
 		for i, pilotByLeagueID := range practicePilots {
-			points := getPilotPoints(pilotByLeagueID, gpIndex)
+			points := getPilotPoints(tx, pilotByLeagueID, gpIndex)
 			practicePilotPoints += points
 			log.Printf("[DEBUG-POINTS] Piloto Practice %d (ID: %d): %d puntos", i+1, pilotByLeagueID, points)
 		}
@@ -10288,10 +10158,24 @@ func calculatePlayerTotalPoints(playerID uint64, leagueID uint64, gpIndex uint64
 	totalPoints += practicePilotPoints
 	log.Printf("[DEBUG-POINTS] Total Pilotos Practice: %d", practicePilotPoints)
 
+	// Calcular puntos del hueco de sprint (sprint o sprint qualifying según la carta)
+	var sprintPilots []uint
+	sprintPilotPoints := 0
+	if len(lineup.SprintPilots) > 0 {
+		json.Unmarshal(lineup.SprintPilots, &sprintPilots)
+		for i, pilotByLeagueID := range sprintPilots {
+			points := getPilotSprintPoints(tx, pilotByLeagueID, gpIndex)
+			sprintPilotPoints += points
+			log.Printf("[DEBUG-POINTS] Piloto Sprint %d (ID: %d): %d puntos", i+1, pilotByLeagueID, points)
+		}
+	}
+	totalPoints += sprintPilotPoints
+	log.Printf("[DEBUG-POINTS] Total Pilotos Sprint: %d", sprintPilotPoints)
+
 	// Calcular puntos del constructor
 	constructorPoints := 0
 	if lineup.TeamConstructorID != nil {
-		constructorPoints = getTeamConstructorPoints(*lineup.TeamConstructorID, gpIndex)
+		constructorPoints = getTeamConstructorPoints(tx, *lineup.TeamConstructorID, gpIndex)
 		totalPoints += constructorPoints
 		log.Printf("[DEBUG-POINTS] Constructor (ID: %d): %d puntos", *lineup.TeamConstructorID, constructorPoints)
 	}
@@ -10299,7 +10183,7 @@ func calculatePlayerTotalPoints(playerID uint64, leagueID uint64, gpIndex uint64
 	// Calcular puntos del chief engineer
 	chiefEngineerPoints := 0
 	if lineup.ChiefEngineerID != nil {
-		chiefEngineerPoints = getChiefEngineerPoints(*lineup.ChiefEngineerID, gpIndex)
+		chiefEngineerPoints = getChiefEngineerPoints(tx, *lineup.ChiefEngineerID, gpIndex)
 		totalPoints += chiefEngineerPoints
 		log.Printf("[DEBUG-POINTS] Chief Engineer (ID: %d): %d puntos", *lineup.ChiefEngineerID, chiefEngineerPoints)
 	}
@@ -10310,7 +10194,7 @@ func calculatePlayerTotalPoints(playerID uint64, leagueID uint64, gpIndex uint64
 	if len(lineup.TrackEngineers) > 0 {
 		json.Unmarshal(lineup.TrackEngineers, &trackEngineers)
 		for i, trackEngineerByLeagueID := range trackEngineers {
-			points := getTrackEngineerPointsWithLineup(trackEngineerByLeagueID, gpIndex, lineup)
+			points := getTrackEngineerPointsWithLineup(tx, trackEngineerByLeagueID, gpIndex, lineup)
 			trackEngineerPoints += points
 			log.Printf("[DEBUG-POINTS] Track Engineer %d (ID: %d): %d puntos", i+1, trackEngineerByLeagueID, points)
 		}
@@ -10318,186 +10202,107 @@ func calculatePlayerTotalPoints(playerID uint64, leagueID uint64, gpIndex uint64
 	totalPoints += trackEngineerPoints
 	log.Printf("[DEBUG-POINTS] Total Track Engineers: %d", trackEngineerPoints)
 
+	// Multiplicador del capitán (o del vicecapitán si el capitán no participó)
+	captainPoints, captainID, captainRole, captainMultiplier := captainBonus(tx, lineup)
+	totalPoints += captainPoints
+	if captainID != 0 {
+		log.Printf("[DEBUG-POINTS] Capitán (%s, ID: %d, ×%.2f): %+d puntos", captainRole, captainID, captainMultiplier, captainPoints)
+	}
+
+	// Chip de temporada activado con la alineación
+	chipPoints, chip, _ := chipBonus(tx, lineup, captainPoints)
+	totalPoints += chipPoints
+	if chip != "" {
+		log.Printf("[DEBUG-POINTS] Chip %s: %+d puntos", chip, chipPoints)
+	}
+
 	log.Printf("[DEBUG-POINTS] TOTAL FINAL: %d", totalPoints)
-	log.Printf("[DEBUG-POINTS] DESGLOSE: Race(%d) + Qualy(%d) + Practice(%d) + Constructor(%d) + ChiefEng(%d) + TrackEng(%d) = %d",
-		racePilotPoints, qualifyingPilotPoints, practicePilotPoints, constructorPoints, chiefEngineerPoints, trackEngineerPoints, totalPoints)
+	log.Printf("[DEBUG-POINTS] DESGLOSE: Race(%d) + Qualy(%d) + Practice(%d) + Sprint(%d) + Constructor(%d) + ChiefEng(%d) + TrackEng(%d) + Capitán(%d) + Chip(%d) = %d",
+		racePilotPoints, qualifyingPilotPoints, practicePilotPoints, sprintPilotPoints, constructorPoints, chiefEngineerPoints, trackEngineerPoints, captainPoints, chipPoints, totalPoints)
 	return totalPoints
 }
 
 // Función auxiliar para obtener puntos de un piloto
-func getPilotPoints(pilotByLeagueID uint, gpIndex uint64) int {
+func getPilotPoints(tx *gorm.DB, pilotByLeagueID uint, gpIndex uint64) int {
 	log.Printf("[GET-PILOT-POINTS] Buscando puntos para pilotByLeagueID=%d, gpIndex=%d", pilotByLeagueID, gpIndex)
 
 	var pilotByLeague models.PilotByLeague
-	if err := database.DB.First(&pilotByLeague, pilotByLeagueID).Error; err != nil {
+	if err := tx.First(&pilotByLeague, pilotByLeagueID).Error; err != nil {
 		log.Printf("[GET-PILOT-POINTS] Error buscando PilotByLeague ID=%d: %v", pilotByLeagueID, err)
 		return 0
 	}
 	log.Printf("[GET-PILOT-POINTS] PilotByLeague encontrado: ID=%d, PilotID=%d", pilotByLeague.ID, pilotByLeague.PilotID)
 
 	var pilot models.Pilot
-	if err := database.DB.First(&pilot, pilotByLeague.PilotID).Error; err != nil {
+	if err := tx.First(&pilot, pilotByLeague.PilotID).Error; err != nil {
 		log.Printf("[GET-PILOT-POINTS] Error buscando Pilot ID=%d: %v", pilotByLeague.PilotID, err)
 		return 0
 	}
 	log.Printf("[GET-PILOT-POINTS] Pilot encontrado: ID=%d, Name=%s, Mode=%s", pilot.ID, pilot.DriverName, pilot.Mode)
 
-	// Determinar la tabla según el modo del piloto
-	var table string
-	switch pilot.Mode {
-	case "race", "R":
-		table = "pilot_races"
-	case "qualy", "Q":
-		table = "pilot_qualies"
-	case "practice", "P":
-		table = "pilot_practices"
-	default:
-		return 0
-	}
-
-	// Obtener puntos de la tabla correspondiente
-	var result map[string]interface{}
-	if err := database.DB.Table(table).Where("pilot_id = ? AND gp_index = ?", pilotByLeague.PilotID, gpIndex).Take(&result).Error; err != nil {
-		log.Printf("[PILOT-POINTS] No se encontraron puntos para pilot_id=%d, gp_index=%d en tabla %s", pilotByLeague.PilotID, gpIndex, table)
+	// Puntos con las reglas de puntuación fijadas por la liga
+	points, ok := pilotSessionPointsForLeague(tx, pilotByLeague.LeagueID, pilot.Mode, pilot.ID, gpIndex)
+	if !ok {
+		log.Printf("[PILOT-POINTS] No se encontraron puntos para pilot_id=%d, gp_index=%d (modo %s)", pilotByLeague.PilotID, gpIndex, pilot.Mode)
 		return 0
 	}
 
-	points := 0
-	finishPosition := 0
-
-	// Obtener puntos base (delta + bonificaciones)
-	if pointsRaw := result["points"]; pointsRaw != nil {
-		if pointsVal, ok := pointsRaw.(float64); ok {
-			points = int(pointsVal)
-		} else if pointsVal, ok := pointsRaw.(int); ok {
-			points = pointsVal
-		} else if pointsVal, ok := pointsRaw.(int64); ok {
-			points = int(pointsVal)
-		}
-	}
-
-	// Obtener posición final
-	if finishPosRaw := result["finish_position"]; finishPosRaw != nil {
-		if finishPosVal, ok := finishPosRaw.(float64); ok {
-			finishPosition = int(finishPosVal)
-		} else if finishPosVal, ok := finishPosRaw.(int); ok {
-			finishPosition = finishPosVal
-		} else if finishPosVal, ok := finishPosRaw.(int64); ok {
-			finishPosition = int(finishPosVal)
-		}
-	}
-
-	// Los puntos por posición ya están incluidos en el campo Points desde los endpoints
-	// Solo mostrar información para debugging
-	positionPoints := getPositionPoints(pilot.Mode, finishPosition)
-
-	log.Printf("[PILOT-POINTS] Piloto %s (Mode: %s, Pos: %d): Total=%d (incluye posición=%d)",
-		pilot.DriverName, pilot.Mode, finishPosition, points, positionPoints)
+	log.Printf("[PILOT-POINTS] Piloto %s (Mode: %s): Total=%d", pilot.DriverName, pilot.Mode, points)
 
 	return points
 }
 
-// Función para obtener puntos por posición final
-func getPositionPoints(mode string, position int) int {
-	if position < 1 {
-		return 0
-	}
-
-	switch mode {
-	case "race", "R":
-		// 25, 18, 15, 12, 10, 8, 6, 4, 2, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0
-		if position <= 10 {
-			racePoints := []int{25, 18, 15, 12, 10, 8, 6, 4, 2, 1}
-			return racePoints[position-1]
-		}
-		return 0 // Posiciones 11+ no dan puntos
-	case "qualy", "Q":
-		// 10, 9, 8, 7, 6, 5, 4, 3, 2, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0
-		if position <= 10 {
-			qualyPoints := []int{10, 9, 8, 7, 6, 5, 4, 3, 2, 1}
-			return qualyPoints[position-1]
-		}
-		return 0 // Posiciones 11+ no dan puntos
-	case "practice", "P":
-		// 5, 5, 4, 4, 3, 3, 2, 2, 1, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0
-		if position <= 10 {
-			practicePoints := []int{5, 5, 4, 4, 3, 3, 2, 2, 1, 1}
-			return practicePoints[position-1]
-		}
-		return 0 // Posiciones 11+ no dan puntos
-	default:
-		return 0
-	}
+// Función para obtener puntos por posición final según el ruleset de la liga
+func getPositionPoints(leagueID uint, mode string, position int) int {
+	return leagueScoringRuleset(leagueID).PositionPoints(mode, position)
 }
 
 // Función auxiliar para obtener puntos de un constructor
-func getTeamConstructorPoints(teamConstructorByLeagueID uint, gpIndex uint64) int {
+func getTeamConstructorPoints(tx *gorm.DB, teamConstructorByLeagueID uint, gpIndex uint64) int {
 	var teamConstructorByLeague models.TeamConstructorByLeague
-	if err := database.DB.First(&teamConstructorByLeague, teamConstructorByLeagueID).Error; err != nil {
+	if err := tx.First(&teamConstructorByLeague, teamConstructorByLeagueID).Error; err != nil {
 		return 0
 	}
 
-	// Obtener puntos de la tabla team_races basándose en el team constructor
-	var result map[string]interface{}
-	if err := database.DB.Table("team_races").Where("teamconstructor_id = ? AND gp_index = ?", teamConstructorByLeague.TeamConstructorID, gpIndex).Take(&result).Error; err != nil {
+	// Obtener puntos de team_races con las reglas de la liga
+	points, ok := teamRacePointsForLeague(tx, teamConstructorByLeague.LeagueID, teamConstructorByLeague.TeamConstructorID, gpIndex)
+	if !ok {
 		log.Printf("[TEAM-CONSTRUCTOR-POINTS] No se encontraron datos en team_races para team constructor %d en GP %d", teamConstructorByLeague.TeamConstructorID, gpIndex)
 		return 0
 	}
 
-	points := 0
-	if pointsRaw := result["points"]; pointsRaw != nil {
-		if pointsVal, ok := pointsRaw.(float64); ok {
-			points = int(pointsVal)
-		} else if pointsVal, ok := pointsRaw.(int); ok {
-			points = pointsVal
-		} else if pointsVal, ok := pointsRaw.(int64); ok {
-			points = int(pointsVal)
-		}
-	}
-
 	log.Printf("[TEAM-CONSTRUCTOR-POINTS] Team Constructor ID %d - Puntos: %d", teamConstructorByLeague.TeamConstructorID, points)
 
 	return points
 }
 
 // Función auxiliar para obtener puntos de un chief engineer
-func getChiefEngineerPoints(chiefEngineerByLeagueID uint, gpIndex uint64) int {
+func getChiefEngineerPoints(tx *gorm.DB, chiefEngineerByLeagueID uint, gpIndex uint64) int {
 	var chiefEngineerByLeague models.ChiefEngineerByLeague
-	if err := database.DB.First(&chiefEngineerByLeague, chiefEngineerByLeagueID).Error; err != nil {
+	if err := tx.First(&chiefEngineerByLeague, chiefEngineerByLeagueID).Error; err != nil {
 		return 0
 	}
 
 	// Obtener el chief engineer para conocer su equipo
 	var chiefEngineer models.ChiefEngineer
-	if err := database.DB.First(&chiefEngineer, chiefEngineerByLeague.ChiefEngineerID).Error; err != nil {
+	if err := tx.First(&chiefEngineer, chiefEngineerByLeague.ChiefEngineerID).Error; err != nil {
 		return 0
 	}
 
 	// Buscar el team constructor correspondiente al equipo del chief engineer
 	var teamConstructor models.TeamConstructor
-	if err := database.DB.Where("name = ? AND gp_index = ?", chiefEngineer.Team, gpIndex).First(&teamConstructor).Error; err != nil {
+	if err := tx.Where("name = ? AND gp_index = ?", chiefEngineer.Team, gpIndex).First(&teamConstructor).Error; err != nil {
 		log.Printf("[CHIEF-ENGINEER-POINTS] No se encontró team constructor para equipo %s en GP %d", chiefEngineer.Team, gpIndex)
 		return 0
 	}
 
-	// Obtener puntos de la tabla team_races basándose en el team constructor
-	var result map[string]interface{}
-	if err := database.DB.Table("team_races").Where("teamconstructor_id = ? AND gp_index = ?", teamConstructor.ID, gpIndex).Take(&result).Error; err != nil {
+	// Obtener puntos de team_races con las reglas de la liga
+	points, ok := teamRacePointsForLeague(tx, chiefEngineerByLeague.LeagueID, teamConstructor.ID, gpIndex)
+	if !ok {
 		log.Printf("[CHIEF-ENGINEER-POINTS] No se encontraron datos en team_races para team constructor %d en GP %d", teamConstructor.ID, gpIndex)
 		return 0
 	}
 
-	points := 0
-	if pointsRaw := result["points"]; pointsRaw != nil {
-		if pointsVal, ok := pointsRaw.(float64); ok {
-			points = int(pointsVal)
-		} else if pointsVal, ok := pointsRaw.(int); ok {
-			points = pointsVal
-		} else if pointsVal, ok := pointsRaw.(int64); ok {
-			points = int(pointsVal)
-		}
-	}
-
 	log.Printf("[CHIEF-ENGINEER-POINTS] Chief Engineer %s (Team: %s) - Team Constructor ID: %d - Puntos: %d",
 		chiefEngineer.Name, chiefEngineer.Team, teamConstructor.ID, points)
 
@@ -10511,7 +10316,7 @@ func getTrackEngineerPoints(trackEngineerByLeagueID uint, gpIndex uint64) int {
 		return 0
 	}
 
-	// Sumar puntos de todas las sesiones (race, qualy, practice) para este GP
+	// Sumar puntos de todas las sesiones (también las de sprint) para este GP
 	var totalPoints int
 	database.DB.Model(&models.TrackEngineerPoints{}).
 		Where("track_engineer_id = ? AND gp_index = ?", trackEngineerByLeague.TrackEngineerID, gpIndex).
@@ -10522,163 +10327,80 @@ func getTrackEngineerPoints(trackEngineerByLeagueID uint, gpIndex uint64) int {
 }
 
 // Función auxiliar para obtener puntos de un track engineer verificando si el jugador tiene el piloto asociado
-func getTrackEngineerPointsWithLineup(trackEngineerByLeagueID uint, gpIndex uint64, lineup models.Lineup) int {
+func getTrackEngineerPointsWithLineup(tx *gorm.DB, trackEngineerByLeagueID uint, gpIndex uint64, lineup models.Lineup) int {
 	var trackEngineerByLeague models.TrackEngineerByLeague
-	if err := database.DB.First(&trackEngineerByLeague, trackEngineerByLeagueID).Error; err != nil {
+	if err := tx.First(&trackEngineerByLeague, trackEngineerByLeagueID).Error; err != nil {
 		return 0
 	}
 
 	// Obtener el track engineer para saber qué piloto está asociado
 	var trackEngineer models.TrackEngineer
-	if err := database.DB.First(&trackEngineer, trackEngineerByLeague.TrackEngineerID).Error; err != nil {
+	if err := tx.First(&trackEngineer, trackEngineerByLeague.TrackEngineerID).Error; err != nil {
 		return 0
 	}
 
-	// Buscar qué piloto tiene este track engineer asignado
-	var associatedPilots []models.Pilot
-	database.DB.Where("track_engineer_id = ?", trackEngineer.ID).Find(&associatedPilots)
-
-	if len(associatedPilots) == 0 {
-		log.Printf("[TRACK-ENG-POINTS] No hay pilotos asociados al track engineer %d", trackEngineer.ID)
+	// Sesiones en las que el jugador tiene alineado a un piloto del track engineer
+	sessions := trackEngineerLineupSessions(trackEngineer.ID, lineup)
+	if len(sessions) == 0 {
+		log.Printf("[TRACK-ENG-POINTS] Track Engineer %d: jugador no tiene ningún piloto asociado, 0 puntos", trackEngineer.ID)
 		return 0
 	}
 
-	// Obtener los pilotos que tiene el jugador en su lineup
-	var racePilots []uint
-	var qualifyingPilots []uint
-	var practicePilots []uint
-
-	if len(lineup.RacePilots) > 0 {
-		json.Unmarshal(lineup.RacePilots, &racePilots)
-	}
-	if len(lineup.QualifyingPilots) > 0 {
-		json.Unmarshal(lineup.QualifyingPilots, &qualifyingPilots)
-	}
-	if len(lineup.PracticePilots) > 0 {
-		json.Unmarshal(lineup.PracticePilots, &practicePilots)
-	}
-
-	// Obtener los PilotByLeague IDs para cada piloto asociado al track engineer
-	var associatedPilotByLeagueIDs []uint
-	for _, pilot := range associatedPilots {
-		var pilotByLeague models.PilotByLeague
-		if err := database.DB.Where("pilot_id = ? AND league_id = ?", pilot.ID, lineup.LeagueID).First(&pilotByLeague).Error; err == nil {
-			associatedPilotByLeagueIDs = append(associatedPilotByLeagueIDs, pilotByLeague.ID)
-		}
-	}
-
-	// Verificar si el jugador tiene alguno de los pilotos asociados en algún modo
+	// Sumar puntos solo de las sesiones donde el jugador tiene el piloto
 	totalPoints := 0
-	hasRacePilot := false
-	hasQualyPilot := false
-	hasPracticePilot := false
-
-	for _, pilotByLeagueID := range associatedPilotByLeagueIDs {
-		// Verificar si está en race
-		for _, racePilotID := range racePilots {
-			if racePilotID == pilotByLeagueID {
-				hasRacePilot = true
-				break
-			}
-		}
-		// Verificar si está en qualifying
-		for _, qualyPilotID := range qualifyingPilots {
-			if qualyPilotID == pilotByLeagueID {
-				hasQualyPilot = true
-				break
-			}
-		}
-		// Verificar si está en practice
-		for _, practicePilotID := range practicePilots {
-			if practicePilotID == pilotByLeagueID {
-				hasPracticePilot = true
-				break
-			}
+	for _, session := range trackEngineerSessions {
+		if !sessions[session] {
+			continue
 		}
-	}
-
-	// Sumar puntos solo de las sesiones donde el jugador tiene el piloto
-	if hasRacePilot {
-		var racePoints int
-		database.DB.Model(&models.TrackEngineerPoints{}).
-			Where("track_engineer_id = ? AND gp_index = ? AND session_type = ?", trackEngineer.ID, gpIndex, "race").
-			Select("COALESCE(SUM(total_points), 0)").
-			Scan(&racePoints)
-		totalPoints += racePoints
-		log.Printf("[TRACK-ENG-POINTS] Track Engineer %d tiene piloto en RACE: +%d puntos", trackEngineer.ID, racePoints)
-	}
-
-	if hasQualyPilot {
-		var qualyPoints int
-		database.DB.Model(&models.TrackEngineerPoints{}).
-			Where("track_engineer_id = ? AND gp_index = ? AND session_type = ?", trackEngineer.ID, gpIndex, "qualy").
-			Select("COALESCE(SUM(total_points), 0)").
-			Scan(&qualyPoints)
-		totalPoints += qualyPoints
-		log.Printf("[TRACK-ENG-POINTS] Track Engineer %d tiene piloto en QUALY: +%d puntos", trackEngineer.ID, qualyPoints)
-	}
-
-	if hasPracticePilot {
-		var practicePoints int
-		database.DB.Model(&models.TrackEngineerPoints{}).
-			Where("track_engineer_id = ? AND gp_index = ? AND session_type = ?", trackEngineer.ID, gpIndex, "practice").
+		var sessionPoints int
+		tx.Model(&models.TrackEngineerPoints{}).
+			Where("track_engineer_id = ? AND gp_index = ? AND session_type = ?", trackEngineer.ID, gpIndex, session).
 			Select("COALESCE(SUM(total_points), 0)").
-			Scan(&practicePoints)
-		totalPoints += practicePoints
-		log.Printf("[TRACK-ENG-POINTS] Track Engineer %d tiene piloto en PRACTICE: +%d puntos", trackEngineer.ID, practicePoints)
-	}
-
-	if !hasRacePilot && !hasQualyPilot && !hasPracticePilot {
-		log.Printf("[TRACK-ENG-POINTS] Track Engineer %d: jugador no tiene ningún piloto asociado, 0 puntos", trackEngineer.ID)
+			Scan(&sessionPoints)
+		totalPoints += sessionPoints
+		log.Printf("[TRACK-ENG-POINTS] Track Engineer %d tiene piloto en %s: +%d puntos", trackEngineer.ID, strings.ToUpper(session), sessionPoints)
 	}
 
 	return totalPoints
 }
 
 // Función para calcular automáticamente puntos de track engineers cuando se guarda un resultado de piloto
-func calculateTrackEngineerPointsForPilot(pilotID uint, gpIndex uint64, mode string) {
+func calculateTrackEngineerPointsForPilot(tx *gorm.DB, pilotID uint, gpIndex uint64, mode string) error {
 	log.Printf("[AUTO-TRACK-ENG] Iniciando cálculo para piloto %d, GP %d, mode %s", pilotID, gpIndex, mode)
 
 	// 1. Obtener el track engineer asignado a este piloto
 	// Primero buscar el piloto para obtener su track_engineer_id
 	var pilot models.Pilot
-	if err := database.DB.First(&pilot, pilotID).Error; err != nil {
+	if err := tx.First(&pilot, pilotID).Error; err != nil {
 		log.Printf("[AUTO-TRACK-ENG] Error obteniendo información del piloto %d: %v", pilotID, err)
-		return
+		return nil
 	}
 
 	// Verificar que el piloto tenga un track engineer asignado
 	if pilot.TrackEngineerID == 0 {
 		log.Printf("[AUTO-TRACK-ENG] No hay track engineer asignado al piloto %d", pilotID)
-		return
+		return nil
 	}
 
 	var trackEngineer models.TrackEngineer
-	if err := database.DB.First(&trackEngineer, pilot.TrackEngineerID).Error; err != nil {
+	if err := tx.First(&trackEngineer, pilot.TrackEngineerID).Error; err != nil {
 		log.Printf("[AUTO-TRACK-ENG] Track engineer %d no encontrado: %v", pilot.TrackEngineerID, err)
-		return
+		return nil
 	}
 
 	log.Printf("[AUTO-TRACK-ENG] Track Engineer encontrado: ID=%d, Name=%s", trackEngineer.ID, trackEngineer.Name)
 
 	// 2. Obtener los puntos del piloto
-	var table string
-	switch mode {
-	case "race":
-		table = "pilot_races"
-	case "qualy":
-		table = "pilot_qualies"
-	case "practice":
-		table = "pilot_practices"
-	default:
+	table, ok := sessionTables[mode]
+	if !ok {
 		log.Printf("[AUTO-TRACK-ENG] Modo inválido: %s", mode)
-		return
+		return nil
 	}
 
 	var pilotResult map[string]interface{}
-	if err := database.DB.Table(table).Where("pilot_id = ? AND gp_index = ?", pilotID, gpIndex).Take(&pilotResult).Error; err != nil {
+	if err := tx.Table(table).Where("pilot_id = ? AND gp_index = ?", pilotID, gpIndex).Take(&pilotResult).Error; err != nil {
 		log.Printf("[AUTO-TRACK-ENG] No se encontraron resultados del piloto %d en %s: %v", pilotID, table, err)
-		return
+		return nil
 	}
 
 	pilotPoints := 0
@@ -10694,14 +10416,15 @@ func calculateTrackEngineerPointsForPilot(pilotID uint, gpIndex uint64, mode str
 
 	// 3. Buscar compañero de equipo y calcular multiplicador
 	var teammate models.Pilot
-	modeCode := map[string]string{"race": "R", "qualy": "Q", "practice": "P"}[mode]
-	if err := database.DB.Where("team = ? AND mode = ? AND id != ?", pilot.Team, modeCode, pilotID).First(&teammate).Error; err != nil {
+	// En la sprint corren las cartas de carrera y en la sprint qualifying las de clasificación
+	modeCode := map[string]string{"race": "R", "qualy": "Q", "practice": "P", "sprint": "R", "sprint_qualy": "Q"}[mode]
+	if err := tx.Where("team = ? AND mode = ? AND id != ?", pilot.Team, modeCode, pilotID).First(&teammate).Error; err != nil {
 		log.Printf("[AUTO-TRACK-ENG] No se encontró compañero de equipo para piloto %d: %v", pilotID, err)
-		return
+		return nil
 	}
 
 	var teammateResult map[string]interface{}
-	database.DB.Table(table).Where("pilot_id = ? AND gp_index = ?", teammate.ID, gpIndex).Take(&teammateResult)
+	tx.Table(table).Where("pilot_id = ? AND gp_index = ?", teammate.ID, gpIndex).Take(&teammateResult)
 
 	// 4. Calcular multiplicador según las reglas correctas
 	multiplier := 0.2 // Default: detrás del compañero
@@ -10741,7 +10464,7 @@ func calculateTrackEngineerPointsForPilot(pilotID uint, gpIndex uint64, mode str
 		// Verificar si el compañero tiene track engineer
 		if teammate.TrackEngineerID != 0 {
 			var teammateTrackEngineer models.TrackEngineer
-			if err := database.DB.First(&teammateTrackEngineer, teammate.TrackEngineerID).Error; err == nil {
+			if err := tx.First(&teammateTrackEngineer, teammate.TrackEngineerID).Error; err == nil {
 				// Obtener puntos del compañero
 				teammatePoints := 0
 				if points, ok := teammateResult["points"].(float64); ok {
@@ -10775,7 +10498,7 @@ func calculateTrackEngineerPointsForPilot(pilotID uint, gpIndex uint64, mode str
 
 				// Guardar puntos del track engineer del compañero
 				var teammateRecord models.TrackEngineerPoints
-				err := database.DB.Where("track_engineer_id = ? AND gp_index = ? AND session_type = ?",
+				err := tx.Where("track_engineer_id = ? AND gp_index = ? AND session_type = ?",
 					teammateTrackEngineer.ID, gpIndex, mode).First(&teammateRecord).Error
 
 				if err != nil {
@@ -10792,8 +10515,9 @@ func calculateTrackEngineerPointsForPilot(pilotID uint, gpIndex uint64, mode str
 						TotalPoints:      teammateTrackEngineerPoints,
 					}
 
-					if err := database.DB.Create(&newTeammateRecord).Error; err != nil {
+					if err := tx.Create(&newTeammateRecord).Error; err != nil {
 						log.Printf("[AUTO-TRACK-ENG] Error creando registro del compañero: %v", err)
+						return err
 					} else {
 						log.Printf("[AUTO-TRACK-ENG] ✅ Creado registro para Track Engineer del compañero %d, GP %d: %d pts", teammateTrackEngineer.ID, gpIndex, teammateTrackEngineerPoints)
 					}
@@ -10806,19 +10530,23 @@ func calculateTrackEngineerPointsForPilot(pilotID uint, gpIndex uint64, mode str
 					teammateRecord.BasePoints = teammatePoints
 					teammateRecord.TotalPoints = teammateTrackEngineerPoints
 
-					if err := database.DB.Save(&teammateRecord).Error; err != nil {
+					if err := tx.Save(&teammateRecord).Error; err != nil {
 						log.Printf("[AUTO-TRACK-ENG] Error actualizando registro del compañero: %v", err)
+						return err
 					} else {
 						log.Printf("[AUTO-TRACK-ENG] ✅ Actualizado registro para Track Engineer del compañero %d, GP %d: %d pts", teammateTrackEngineer.ID, gpIndex, teammateTrackEngineerPoints)
 					}
 				}
+				if err := storeTrackEngineerLineItems(tx, teammateTrackEngineer.ID, gpIndex, mode); err != nil {
+					return err
+				}
 			}
 		}
 	}
 
 	// 6. Guardar los puntos en la tabla track_engineer_points
 	var existingRecord models.TrackEngineerPoints
-	err := database.DB.Where("track_engineer_id = ? AND gp_index = ? AND session_type = ?",
+	err := tx.Where("track_engineer_id = ? AND gp_index = ? AND session_type = ?",
 		trackEngineer.ID, gpIndex, mode).First(&existingRecord).Error
 
 	if err != nil {
@@ -10840,8 +10568,9 @@ func calculateTrackEngineerPointsForPilot(pilotID uint, gpIndex uint64, mode str
 			TotalPoints: trackEngineerPoints,
 		}
 
-		if err := database.DB.Create(&newRecord).Error; err != nil {
+		if err := tx.Create(&newRecord).Error; err != nil {
 			log.Printf("[AUTO-TRACK-ENG] Error creando registro: %v", err)
+			return err
 		} else {
 			log.Printf("[AUTO-TRACK-ENG] ✅ Creado registro para Track Engineer %d, GP %d: %d pts", trackEngineer.ID, gpIndex, trackEngineerPoints)
 		}
@@ -10856,12 +10585,16 @@ func calculateTrackEngineerPointsForPilot(pilotID uint, gpIndex uint64, mode str
 		existingRecord.BasePoints = pilotPoints
 		existingRecord.TotalPoints = trackEngineerPoints
 
-		if err := database.DB.Save(&existingRecord).Error; err != nil {
+		if err := tx.Save(&existingRecord).Error; err != nil {
 			log.Printf("[AUTO-TRACK-ENG] Error actualizando registro: %v", err)
+			return err
 		} else {
 			log.Printf("[AUTO-TRACK-ENG] ✅ Actualizado registro para Track Engineer %d, GP %d: %d pts", trackEngineer.ID, gpIndex, trackEngineerPoints)
 		}
 	}
+
+	// 7. Guardar el desglose de puntos del track engineer
+	return storeTrackEngineerLineItems(tx, trackEngineer.ID, gpIndex, mode)
 }
 
 // Función para calcular puntos de track engineers manualmente desde el formulario
@@ -11100,8 +10833,9 @@ func calculateSingleTrackEngineerPointsManually(trackEngineerID uint, pilotID ui
 	}
 }
 
-// Función para actualizar puntos totales de un jugador
-func updatePlayerTotalPoints(playerID uint64, leagueID uint64, gpIndex uint64, pointsToAdd int) {
+// Función para actualizar puntos totales de un jugador. Recalcula la alineación
+// del GP y suma todas sus alineaciones, por lo que repetirla no duplica puntos.
+func updatePlayerTotalPoints(playerID uint64, leagueID uint64, gpIndex uint64) {
 	// Obtener el jugador en la liga
 	var playerLeague models.PlayerByLeague
 	if err := database.DB.Where("player_id = ? AND league_id = ?", playerID, leagueID).First(&playerLeague).Error; err != nil {
@@ -11110,45 +10844,14 @@ func updatePlayerTotalPoints(playerID uint64, leagueID uint64, gpIndex uint64, p
 	}
 
 	// Calcular los puntos totales del jugador para este GP específico
-	totalPointsForGP := calculatePlayerTotalPoints(playerID, uint64(leagueID), gpIndex)
-
-	// Actualizar o crear registro en player_points_by_gp
-	var existingRecord struct {
-		ID uint `gorm:"primaryKey"`
-	}
-	err := database.DB.Table("player_points_by_gp").Where("player_id = ? AND league_id = ? AND gp_index = ?", playerID, leagueID, gpIndex).First(&existingRecord).Error
-
-	if err != nil {
-		// No existe, crear nuevo registro
-		err = database.DB.Exec("INSERT INTO player_points_by_gp (player_id, league_id, gp_index, points) VALUES (?, ?, ?, ?)",
-			playerID, leagueID, gpIndex, totalPointsForGP).Error
-		if err != nil {
-			log.Printf("Error creando registro en player_points_by_gp para player_id=%d, league_id=%d, gp_index=%d: %v", playerID, leagueID, gpIndex, err)
-		} else {
-			log.Printf("Creado registro en player_points_by_gp para player_id=%d, league_id=%d, gp_index=%d: %d pts", playerID, leagueID, gpIndex, totalPointsForGP)
-		}
-	} else {
-		// Existe, actualizar
-		err = database.DB.Exec("UPDATE player_points_by_gp SET points = ? WHERE player_id = ? AND league_id = ? AND gp_index = ?",
-			totalPointsForGP, playerID, leagueID, gpIndex).Error
-		if err != nil {
-			log.Printf("Error actualizando registro en player_points_by_gp para player_id=%d, league_id=%d, gp_index=%d: %v", playerID, leagueID, gpIndex, err)
-		} else {
-			log.Printf("Actualizado registro en player_points_by_gp para player_id=%d, league_id=%d, gp_index=%d: %d pts", playerID, leagueID, gpIndex, totalPointsForGP)
-		}
-	}
-
-	// Recalcular puntos totales sumando todos los GPs
-	var totalPoints int
-	err = database.DB.Raw("SELECT COALESCE(SUM(points), 0) FROM player_points_by_gp WHERE player_id = ? AND league_id = ?", playerID, leagueID).Scan(&totalPoints).Error
-	if err != nil {
-		log.Printf("Error calculando puntos totales para player_id=%d, league_id=%d: %v", playerID, leagueID, err)
-		return
-	}
-
-	// Actualizar TotalPoints en PlayerByLeague
-	playerLeague.TotalPoints = totalPoints
-	if err := database.DB.Save(&playerLeague).Error; err != nil {
+	totalPointsForGP := calculatePlayerTotalPoints(database.DB, playerID, leagueID, gpIndex)
+	database.DB.Model(&models.Lineup{}).Where("player_id = ? AND league_id = ? AND gp_index = ?", playerID, leagueID, gpIndex).
+		Update("lineup_points", totalPointsForGP)
+	syncPlayerPointsByGP(database.DB, playerID, leagueID, gpIndex, totalPointsForGP)
+
+	// Recalcular puntos totales sumando todas las alineaciones
+	totalPoints := playerSeasonPoints(database.DB, playerID, leagueID)
+	if err := database.DB.Model(&playerLeague).Update("total_points", totalPoints).Error; err != nil {
 		log.Printf("Error guardando puntos totales para player_id=%d, league_id=%d: %v", playerID, leagueID, err)
 	} else {
 		log.Printf("Puntos totales actualizados para player_id=%d, league_id=%d: %d pts", playerID, leagueID, totalPoints)
@@ -11156,7 +10859,11 @@ func updatePlayerTotalPoints(playerID uint64, leagueID uint64, gpIndex uint64, p
 }
 
 // Función para generar ofertas de la FIA para todos los elementos en venta
-func generateFIAOffersForLeague(leagueID uint) error {
+// generateFIAOffersForLeague genera las ofertas de la FIA para los elementos en
+// venta. Con rng las ofertas salen del sorteo del mercado y se devuelven para guardarlas.
+func generateFIAOffersForLeague(leagueID uint, rng *rand.Rand) ([]drawFIAOffer, error) {
+	offers := []drawFIAOffer{}
+	settings := loadLeagueSettings(database.DB, leagueID)
 	log.Printf("[FIA] Generando ofertas de la FIA para liga %d", leagueID)
 
 	// 1. Generar ofertas para pilotos en venta
@@ -11173,8 +10880,9 @@ func generateFIAOffersForLeague(leagueID uint) error {
 
 		// Usar el valor de venta en lugar del valor base del piloto
 		saleValue := float64(*pbl.Venta)
-		fiaOffer := generateFIAOffer(saleValue)
-		expires := time.Now().Add(24 * time.Hour)
+		fiaOffer := generateFIAOffer(rng, settings, saleValue)
+		expires := fiaOfferExpiry(settings)
+		offers = append(offers, drawFIAOffer{ItemType: "pilot", ItemID: pbl.ID, SaleValue: saleValue, Offer: fiaOffer, MinMultiplier: settings.FIAMinMultiplier, MaxMultiplier: settings.FIAMaxMultiplier})
 
 		log.Printf("[FIA] Generando oferta para piloto %s (ID: %d) - Valor venta: %.2f€, Oferta FIA: %.2f€", pilot.DriverName, pbl.ID, saleValue, fiaOffer)
 
@@ -11202,8 +10910,9 @@ func generateFIAOffersForLeague(leagueID uint) error {
 
 		// Usar el valor de venta en lugar del valor base del track engineer
 		saleValue := float64(*teb.Venta)
-		fiaOffer := generateFIAOffer(saleValue)
-		expires := time.Now().Add(24 * time.Hour)
+		fiaOffer := generateFIAOffer(rng, settings, saleValue)
+		expires := fiaOfferExpiry(settings)
+		offers = append(offers, drawFIAOffer{ItemType: "track_engineer", ItemID: teb.ID, SaleValue: saleValue, Offer: fiaOffer, MinMultiplier: settings.FIAMinMultiplier, MaxMultiplier: settings.FIAMaxMultiplier})
 
 		teb.LeagueOfferValue = &fiaOffer
 		teb.LeagueOfferExpiresAt = &expires
@@ -11227,8 +10936,9 @@ func generateFIAOffersForLeague(leagueID uint) error {
 
 		// Usar el valor de venta en lugar del valor base del chief engineer
 		saleValue := float64(*ceb.Venta)
-		fiaOffer := generateFIAOffer(saleValue)
-		expires := time.Now().Add(24 * time.Hour)
+		fiaOffer := generateFIAOffer(rng, settings, saleValue)
+		expires := fiaOfferExpiry(settings)
+		offers = append(offers, drawFIAOffer{ItemType: "chief_engineer", ItemID: ceb.ID, SaleValue: saleValue, Offer: fiaOffer, MinMultiplier: settings.FIAMinMultiplier, MaxMultiplier: settings.FIAMaxMultiplier})
 
 		ceb.LeagueOfferValue = &fiaOffer
 		ceb.LeagueOfferExpiresAt = &expires
@@ -11252,8 +10962,9 @@ func generateFIAOffersForLeague(leagueID uint) error {
 
 		// Usar el valor de venta en lugar del valor base del team constructor
 		saleValue := float64(*tcb.Venta)
-		fiaOffer := generateFIAOffer(saleValue)
-		expires := time.Now().Add(24 * time.Hour)
+		fiaOffer := generateFIAOffer(rng, settings, saleValue)
+		expires := fiaOfferExpiry(settings)
+		offers = append(offers, drawFIAOffer{ItemType: "team_constructor", ItemID: tcb.ID, SaleValue: saleValue, Offer: fiaOffer, MinMultiplier: settings.FIAMinMultiplier, MaxMultiplier: settings.FIAMaxMultiplier})
 
 		tcb.LeagueOfferValue = &fiaOffer
 		tcb.LeagueOfferExpiresAt = &expires
@@ -11264,12 +10975,15 @@ func generateFIAOffersForLeague(leagueID uint) error {
 	}
 
 	log.Printf("[FIA] Generación de ofertas FIA completada para liga %d", leagueID)
-	return nil
+	return offers, nil
 }
 
 // Función para generar ofertas de la FIA para elementos con propietario que no tienen ofertas
-func generateFIAOffersForOwnedItems(leagueID uint) error {
+// generateFIAOffersForOwnedItems saca las ofertas de rng y las devuelve para guardarlas en el sorteo
+func generateFIAOffersForOwnedItems(leagueID uint, rng *rand.Rand) ([]drawFIAOffer, error) {
+	offers := []drawFIAOffer{}
 	log.Printf("[FIA-OWNED] Generando ofertas de la FIA para elementos con propietario en liga %d", leagueID)
+	settings := loadLeagueSettings(database.DB, leagueID)
 
 	// 1. Generar ofertas para pilotos con propietario que no tienen ofertas de la FIA
 	var pilotsWithOwner []models.PilotByLeague
@@ -11283,7 +10997,8 @@ func generateFIAOffersForOwnedItems(leagueID uint) error {
 		}
 
 		// Generar oferta entre 90% y 110% del valor del piloto
-		fiaOfferValue := generateFIAOffer(pilot.Value)
+		fiaOfferValue := generateFIAOffer(rng, settings, pilot.Value)
+		offers = append(offers, drawFIAOffer{ItemType: "pilot", ItemID: pbl.ID, SaleValue: pilot.Value, Offer: fiaOfferValue, MinMultiplier: settings.FIAMinMultiplier, MaxMultiplier: settings.FIAMaxMultiplier})
 
 		// Crear la oferta de la FIA con ID especial
 		fiaBid := Bid{
@@ -11310,7 +11025,8 @@ func generateFIAOffersForOwnedItems(leagueID uint) error {
 		}
 
 		// Generar oferta entre 90% y 110% del valor del track engineer
-		fiaOfferValue := generateFIAOffer(te.Value)
+		fiaOfferValue := generateFIAOffer(rng, settings, te.Value)
+		offers = append(offers, drawFIAOffer{ItemType: "track_engineer", ItemID: teb.ID, SaleValue: te.Value, Offer: fiaOfferValue, MinMultiplier: settings.FIAMinMultiplier, MaxMultiplier: settings.FIAMaxMultiplier})
 
 		// Crear la oferta de la FIA con ID especial
 		fiaBid := Bid{
@@ -11337,7 +11053,8 @@ func generateFIAOffersForOwnedItems(leagueID uint) error {
 		}
 
 		// Generar oferta entre 90% y 110% del valor del chief engineer
-		fiaOfferValue := generateFIAOffer(ce.Value)
+		fiaOfferValue := generateFIAOffer(rng, settings, ce.Value)
+		offers = append(offers, drawFIAOffer{ItemType: "chief_engineer", ItemID: ceb.ID, SaleValue: ce.Value, Offer: fiaOfferValue, MinMultiplier: settings.FIAMinMultiplier, MaxMultiplier: settings.FIAMaxMultiplier})
 
 		// Crear la oferta de la FIA con ID especial
 		fiaBid := Bid{
@@ -11364,7 +11081,8 @@ func generateFIAOffersForOwnedItems(leagueID uint) error {
 		}
 
 		// Generar oferta entre 90% y 110% del valor del team constructor
-		fiaOfferValue := generateFIAOffer(tc.Value)
+		fiaOfferValue := generateFIAOffer(rng, settings, tc.Value)
+		offers = append(offers, drawFIAOffer{ItemType: "team_constructor", ItemID: tcb.ID, SaleValue: tc.Value, Offer: fiaOfferValue, MinMultiplier: settings.FIAMinMultiplier, MaxMultiplier: settings.FIAMaxMultiplier})
 
 		// Crear la oferta de la FIA (el PlayerID debe ser el del propietario actual)
 		fiaBid := Bid{
@@ -11380,7 +11098,7 @@ func generateFIAOffersForOwnedItems(leagueID uint) error {
 	}
 
 	log.Printf("[FIA-OWNED] Generación de ofertas FIA para elementos con propietario completada para liga %d", leagueID)
-	return nil
+	return offers, nil
 }
 
 // Función para generar un código único de liga, aleatorio, sin todos los caracteres iguales y que no exista en la base de datos
@@ -11621,9 +11339,9 @@ func initializeF1Calendar() {
 		{"Hungarian Grand Prix", "2025-08-03", "2025-08-02 04:30:00", "Hungaroring", "Hungary", "hungary.png", false},
 		{"Dutch Grand Prix", "2025-08-31", "2025-08-30 11:30:00", "Zandvoort", "Netherlands", "Netherlands_flag.webp", false},
 		{"Italian Grand Prix", "2025-09-07", "2025-09-06 12:30:00", "Monza", "Italy", "Italy_flag.webp", false},
-		{"Azerbaijan Grand Prix", "2025-09-21", "2025-09-20 10:30:00", "Baku", "Azerbaijan", "Azerbaijan_flag.webp", true},
+		{"Azerbaijan Grand Prix", "2025-09-21", "2025-09-20 10:30:00", "Baku", "Azerbaijan", "Azerbaijan_flag.webp", false},
 		{"Singapore Grand Prix", "2025-10-05", "2025-10-04 11:30:00", "Marina Bay", "Singapore", "Singapore_flag.png", false},
-		{"United States Grand Prix", "2025-10-19", "2025-10-17 19:30:00", "Austin", "United States", "EEUU_flag.png", false},
+		{"United States Grand Prix", "2025-10-19", "2025-10-17 19:30:00", "Austin", "United States", "EEUU_flag.png", true},
 		{"Mexican Grand Prix", "2025-10-26", "2025-10-25 19:30:00", "Mexico City", "Mexico", "Mexico_flag.webp", false},
 		{"Brazilian Grand Prix", "2025-11-09", "2025-11-07 15:30:00", "Interlagos", "Brazil", "Brazil_flag.png", true},
 		{"Las Vegas Grand Prix", "2025-11-22", "2025-11-22 01:30:00", "Las Vegas", "United States", "EEUU_flag.png", false},
@@ -11649,6 +11367,7 @@ func initializeF1Calendar() {
 			Circuit:   gp.Circuit,
 			Country:   gp.Country,
 			Flag:      gp.Flag,
+			HasSprint: gp.HasSprint,
 		}
 
 		if err := database.DB.Create(&grandPrix).Error; err != nil {
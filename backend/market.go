@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"sort"
+
+	"f1-fantasy-app/database"
+	"f1-fantasy-app/models"
+)
+
+// Tipos de elemento que pueden aparecer en el mercado, en orden de prioridad
+var marketItemTypes = []string{"pilot", "track_engineer", "chief_engineer", "team_constructor"}
+
+// Ponderaciones posibles para la selección del mercado
+const (
+	marketWeightingUniform = "uniform" // Todos los elementos libres con la misma probabilidad
+	marketWeightingValue   = "value"   // Más probabilidad cuanto mayor sea el valor
+	marketWeightingForm    = "form"    // Más probabilidad cuanto más puntos en los últimos GPs
+)
+
+// Número de GPs con resultados que cuentan como forma reciente
+const recentFormGPs = 3
+
+// Límite de huecos del mercado configurable por liga
+const maxMarketSlots = 40
+
+// defaultMarketSettings devuelve la configuración por defecto: 8 huecos con al
+// menos 2 pilotos y 1 elemento de cada otro tipo
+func defaultMarketSettings(leagueID uint) models.LeagueMarketSettings {
+	return models.LeagueMarketSettings{
+		LeagueID:            leagueID,
+		TotalSlots:          defaultMarketSlots,
+		MinPilots:           2,
+		MaxPilots:           4,
+		MinTrackEngineers:   1,
+		MaxTrackEngineers:   3,
+		MinChiefEngineers:   1,
+		MaxChiefEngineers:   3,
+		MinTeamConstructors: 1,
+		MaxTeamConstructors: 3,
+		Weighting:           marketWeightingUniform,
+	}
+}
+
+// loadMarketSettings carga la configuración del mercado de una liga o la de por defecto
+func loadMarketSettings(leagueID uint) models.LeagueMarketSettings {
+	var settings models.LeagueMarketSettings
+	if err := database.DB.Where("league_id = ?", leagueID).First(&settings).Error; err != nil {
+		return defaultMarketSettings(leagueID)
+	}
+	return settings
+}
+
+// marketTypeLimits devuelve el mínimo y el máximo de un tipo. Un máximo 0 equivale a sin límite.
+func marketTypeLimits(s models.LeagueMarketSettings, itemType string) (int, int) {
+	var min, max int
+	switch itemType {
+	case "pilot":
+		min, max = s.MinPilots, s.MaxPilots
+	case "track_engineer":
+		min, max = s.MinTrackEngineers, s.MaxTrackEngineers
+	case "chief_engineer":
+		min, max = s.MinChiefEngineers, s.MaxChiefEngineers
+	case "team_constructor":
+		min, max = s.MinTeamConstructors, s.MaxTeamConstructors
+	}
+	if max == 0 {
+		max = s.TotalSlots
+	}
+	return min, max
+}
+
+// validateMarketSettings comprueba que la configuración del mercado sea coherente
+func validateMarketSettings(s models.LeagueMarketSettings) error {
+	if s.TotalSlots < 1 || s.TotalSlots > maxMarketSlots {
+		return fmt.Errorf("total_slots debe estar entre 1 y %d", maxMarketSlots)
+	}
+	switch s.Weighting {
+	case marketWeightingUniform, marketWeightingValue, marketWeightingForm:
+	default:
+		return fmt.Errorf("weighting inválido: %s", s.Weighting)
+	}
+	sumMin := 0
+	for _, itemType := range marketItemTypes {
+		min, max := marketTypeLimits(s, itemType)
+		if min < 0 || max < 0 {
+			return fmt.Errorf("los límites de %s no pueden ser negativos", itemType)
+		}
+		if min > max {
+			return fmt.Errorf("el mínimo de %s (%d) supera su máximo (%d)", itemType, min, max)
+		}
+		sumMin += min
+	}
+	if sumMin > s.TotalSlots {
+		return fmt.Errorf("la suma de mínimos (%d) supera total_slots (%d)", sumMin, s.TotalSlots)
+	}
+	return nil
+}
+
+// marketItemWeight calcula el peso de un elemento según la ponderación de la liga
+func marketItemWeight(item models.MarketItem, weighting string) float64 {
+	switch weighting {
+	case marketWeightingValue:
+		if it, err := loadAuctionItem(database.DB, item.ItemType, item.ItemID); err == nil {
+			return it.Value
+		}
+	case marketWeightingForm:
+		return float64(recentFormPoints(item)) + 1
+	}
+	return 1
+}
+
+// recentFormPoints suma los puntos de un elemento del mercado en los últimos GPs con resultados
+func recentFormPoints(item models.MarketItem) int {
+	t, ok := valuationTables[item.ItemType]
+	if !ok {
+		return 0
+	}
+	var globalID uint
+	database.DB.Table(t.ByLeague).Where("id = ?", item.ItemID).Select(t.GlobalColumn).Scan(&globalID)
+	if globalID == 0 {
+		return 0
+	}
+	points := itemRecentPoints(item.ItemType, globalID, recentGPIndexes(recentFormGPs))
+	if points < 0 {
+		return 0
+	}
+	return points
+}
+
+// selectMarketItems elige los elementos del mercado respetando los mínimos y
+// máximos por tipo. Si no hay suficientes elementos para cumplirlos, primero
+// se ignoran los máximos y al final se devuelven los que haya. Todo el azar
+// sale de rng para que el sorteo se pueda reproducir con su semilla.
+func selectMarketItems(freeItems []models.MarketItem, s models.LeagueMarketSettings, weight func(models.MarketItem) float64, rng *rand.Rand) []models.MarketItem {
+	// Orden aleatorio ponderado (Efraimidis-Spirakis): clave ln(u)/w, mayor primero
+	pool := make([]models.MarketItem, len(freeItems))
+	copy(pool, freeItems)
+	keys := make(map[uint]float64, len(pool))
+	for _, item := range pool {
+		w := weight(item)
+		if w <= 0 || math.IsNaN(w) {
+			w = 1e-6
+		}
+		keys[item.ID] = math.Log(1-rng.Float64()) / w
+	}
+	sort.SliceStable(pool, func(i, j int) bool { return keys[pool[i].ID] > keys[pool[j].ID] })
+
+	selected := []models.MarketItem{}
+	used := make(map[uint]bool)
+	countByType := make(map[string]int)
+	take := func(item models.MarketItem) {
+		selected = append(selected, item)
+		used[item.ID] = true
+		countByType[item.ItemType]++
+	}
+
+	// 1. Cubrir los mínimos de cada tipo
+	for _, itemType := range marketItemTypes {
+		min, _ := marketTypeLimits(s, itemType)
+		for _, item := range pool {
+			if countByType[itemType] >= min || len(selected) >= s.TotalSlots {
+				break
+			}
+			if item.ItemType == itemType && !used[item.ID] {
+				take(item)
+			}
+		}
+		if countByType[itemType] < min {
+			log.Printf("[MARKET] Solo hay %d %s libres para un mínimo de %d", countByType[itemType], itemType, min)
+		}
+	}
+
+	// 2. Rellenar los huecos restantes respetando los máximos
+	for _, item := range pool {
+		if len(selected) >= s.TotalSlots {
+			break
+		}
+		if _, max := marketTypeLimits(s, item.ItemType); used[item.ID] || countByType[item.ItemType] >= max {
+			continue
+		}
+		take(item)
+	}
+
+	// 3. Si los máximos impiden llenar el mercado, ignorarlos
+	if len(selected) < s.TotalSlots {
+		for _, item := range pool {
+			if len(selected) >= s.TotalSlots {
+				break
+			}
+			if !used[item.ID] {
+				log.Printf("[MARKET] Superando el máximo de %s para llenar el mercado", item.ItemType)
+				take(item)
+			}
+		}
+	}
+	return selected
+}
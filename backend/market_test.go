@@ -0,0 +1,108 @@
+package main
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"f1-fantasy-app/models"
+)
+
+// testMarketItems crea n elementos libres de cada tipo indicado
+func testMarketItems(counts map[string]int) []models.MarketItem {
+	items := []models.MarketItem{}
+	id := uint(1)
+	for _, itemType := range marketItemTypes {
+		for i := 0; i < counts[itemType]; i++ {
+			items = append(items, models.MarketItem{ID: id, ItemType: itemType, ItemID: id, IsActive: true})
+			id++
+		}
+	}
+	return items
+}
+
+func countTypes(items []models.MarketItem) map[string]int {
+	counts := map[string]int{}
+	for _, item := range items {
+		counts[item.ItemType]++
+	}
+	return counts
+}
+
+func uniformWeight(models.MarketItem) float64 { return 1 }
+
+func TestSelectMarketItemsLimits(t *testing.T) {
+	s := defaultMarketSettings(1)
+	items := testMarketItems(map[string]int{"pilot": 20, "track_engineer": 10, "chief_engineer": 10, "team_constructor": 10})
+	for seed := int64(1); seed <= 50; seed++ {
+		selected := selectMarketItems(items, s, uniformWeight, rand.New(rand.NewSource(seed)))
+		if len(selected) != s.TotalSlots {
+			t.Fatalf("semilla %d: %d elementos, want %d", seed, len(selected), s.TotalSlots)
+		}
+		seen := map[uint]bool{}
+		for _, item := range selected {
+			if seen[item.ID] {
+				t.Fatalf("semilla %d: elemento %d repetido", seed, item.ID)
+			}
+			seen[item.ID] = true
+		}
+		for itemType, n := range countTypes(selected) {
+			min, max := marketTypeLimits(s, itemType)
+			if n < min || n > max {
+				t.Fatalf("semilla %d: %d %s fuera de [%d, %d]", seed, n, itemType, min, max)
+			}
+		}
+	}
+}
+
+func TestSelectMarketItemsDeterministic(t *testing.T) {
+	s := defaultMarketSettings(1)
+	items := testMarketItems(map[string]int{"pilot": 20, "track_engineer": 5, "chief_engineer": 5, "team_constructor": 5})
+	a := selectMarketItems(items, s, uniformWeight, rand.New(rand.NewSource(42)))
+	b := selectMarketItems(items, s, uniformWeight, rand.New(rand.NewSource(42)))
+	if !reflect.DeepEqual(a, b) {
+		t.Fatalf("misma semilla, distinto mercado:\n%+v\n%+v", a, b)
+	}
+}
+
+// Sin elementos suficientes de los otros tipos se superan los máximos para
+// llenar el mercado, y con menos elementos que huecos se devuelven todos
+func TestSelectMarketItemsShortage(t *testing.T) {
+	s := defaultMarketSettings(1)
+	items := testMarketItems(map[string]int{"pilot": 10, "track_engineer": 1})
+	selected := selectMarketItems(items, s, uniformWeight, rand.New(rand.NewSource(1)))
+	if len(selected) != s.TotalSlots {
+		t.Fatalf("%d elementos, want %d", len(selected), s.TotalSlots)
+	}
+	if counts := countTypes(selected); counts["track_engineer"] != 1 || counts["pilot"] != 7 {
+		t.Fatalf("reparto %v, want 7 pilotos y 1 track engineer", counts)
+	}
+
+	few := testMarketItems(map[string]int{"pilot": 3, "team_constructor": 2})
+	if got := selectMarketItems(few, s, uniformWeight, rand.New(rand.NewSource(1))); len(got) != len(few) {
+		t.Fatalf("%d elementos, want %d", len(got), len(few))
+	}
+}
+
+// Con ponderación, el elemento de más peso sale mucho más a menudo
+func TestSelectMarketItemsWeighting(t *testing.T) {
+	s := models.LeagueMarketSettings{TotalSlots: 1}
+	items := testMarketItems(map[string]int{"pilot": 10})
+	weight := func(item models.MarketItem) float64 {
+		if item.ID == 1 {
+			return 50
+		}
+		return 1
+	}
+	rng := rand.New(rand.NewSource(7))
+	hits := 0
+	for i := 0; i < 1000; i++ {
+		if selectMarketItems(items, s, weight, rng)[0].ID == 1 {
+			hits++
+		}
+	}
+	// Probabilidad esperada 50/59 ≈ 0,85
+	if hits < 750 {
+		t.Fatalf("el elemento de peso 50 salió %d de 1000 veces", hits)
+	}
+}
@@ -10,7 +10,7 @@ type Player struct {
 	Name         string    `json:"name" gorm:"not null"`
 	Email        string    `json:"email" gorm:"unique;not null"`
 	PasswordHash string    `json:"-" gorm:"not null"`
-	Money        float64   `json:"money" gorm:"default:50000000"`
+	Money        float64   `json:"money"` // Se fija al registrarse con el dinero inicial por defecto de las ligas
 	IsActive     bool      `json:"is_active" gorm:"default:true"`
 	IsAdmin      bool      `json:"is_admin" gorm:"default:false;column:is_admin"`
 	CreatedAt    time.Time `json:"created_at"`
@@ -64,6 +64,8 @@ type League struct {
 	PlayerID          uint       `json:"player_id"`
 	MarketPilots      []byte     `json:"market_pilots" gorm:"type:json"`
 	MarketNextRefresh *time.Time `json:"market_next_refresh"`
+	AuctionMode       string     `json:"auction_mode" gorm:"type:varchar(30);default:'open'"` // "open", "sealed_first_price", "sealed_second_price"
+	ScoringVersion    int        `json:"scoring_version" gorm:"not null;default:1"`           // Versión de reglas de puntuación fijada por la liga
 	CreatedAt         time.Time  `json:"created_at"`
 	UpdatedAt         time.Time  `json:"updated_at"`
 }
@@ -122,12 +124,79 @@ type GrandPrix struct {
 	Circuit   string    `json:"circuit"`
 	Country   string    `json:"country"`
 	Flag      string    `json:"flag"`
+	HasSprint bool      `json:"has_sprint" gorm:"column:has_sprint;not null;default:false"` // Fin de semana con sprint y sprint qualifying
+
+	// Ruta del GP en formula1.com (/en/results/<season>/races/<id>/<slug>),
+	// descubierta por el scraper en el índice de la temporada
+	ResultsSeason int    `json:"results_season" gorm:"column:results_season;not null;default:0"`
+	ResultsRaceID string `json:"results_race_id" gorm:"column:results_race_id;size:16"`
+	ResultsSlug   string `json:"results_slug" gorm:"column:results_slug;size:64"`
 }
 
 func (GrandPrix) TableName() string {
 	return "f1_grand_prixes"
 }
 
+// GrandPrixSession: horario de cada sesión de un GP. Cada grupo de la
+// alineación se bloquea al empezar su sesión.
+type GrandPrixSession struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	GPIndex   uint64    `json:"gp_index" gorm:"not null;uniqueIndex:idx_gp_session"`
+	Session   string    `json:"session" gorm:"size:32;not null;uniqueIndex:idx_gp_session"` // fp1, fp2, fp3, sprint_qualifying, sprint, qualifying, race
+	StartTime time.Time `json:"start_time" gorm:"not null"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (GrandPrixSession) TableName() string {
+	return "grand_prix_sessions"
+}
+
+// ScraperImport: resultados leídos por el scraper en modo dry-run, pendientes
+// de que un admin los apruebe o los rechace
+type ScraperImport struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	GPIndex    uint64     `json:"gp_index" gorm:"not null;index"`
+	GPKey      string     `json:"gp_key" gorm:"size:64;not null"`
+	Season     int        `json:"season" gorm:"not null;default:0"`
+	Status     string     `json:"status" gorm:"size:16;not null;default:pending;index"` // pending, approved, rejected
+	Data       []byte     `json:"-" gorm:"type:json"`                                   // scrapedGP serializado
+	CreatedBy  uint       `json:"created_by"`
+	ResolvedBy *uint      `json:"resolved_by"`
+	ResolvedAt *time.Time `json:"resolved_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+func (ScraperImport) TableName() string {
+	return "scraper_imports"
+}
+
+// ScraperJob: ejecución en segundo plano del scraper para un GP. La tabla es
+// además el historial de ejecuciones de cada GP.
+type ScraperJob struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	GPIndex     uint64     `json:"gp_index" gorm:"not null;index"`
+	GPKey       string     `json:"gp_key" gorm:"size:64;not null"`
+	Season      int        `json:"season" gorm:"not null;default:0"`
+	DryRun      bool       `json:"dry_run" gorm:"not null;default:false"`
+	Status      string     `json:"status" gorm:"size:16;not null;default:queued;index"` // queued, running, succeeded, failed
+	Sessions    []byte     `json:"-" gorm:"type:json"`                                  // Resultado por sesión
+	RowsScraped int        `json:"rows_scraped" gorm:"not null;default:0"`
+	RowsSaved   int        `json:"rows_saved" gorm:"not null;default:0"`
+	ImportID    *uint      `json:"import_id"` // Importación pendiente creada en dry-run
+	Error       string     `json:"error" gorm:"type:text"`
+	CreatedBy   uint       `json:"created_by"`
+	StartedAt   *time.Time `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+func (ScraperJob) TableName() string {
+	return "scraper_jobs"
+}
+
 // Modelos para puntuaciones desacopladas por sesión
 
 type PilotRace struct {
@@ -148,6 +217,7 @@ type PilotRace struct {
 	CausedRedFlag          bool
 	DNFDriverError         bool
 	DNFNoFault             bool
+	ScoringVersion         int `gorm:"not null;default:1"` // Versión de reglas con la que se calcularon los puntos
 }
 
 func (PilotRace) TableName() string {
@@ -164,12 +234,51 @@ type PilotQualy struct {
 	DeltaPosition    int
 	Points           int
 	CausedRedFlag    bool
+	ScoringVersion   int `gorm:"not null;default:1"` // Versión de reglas con la que se calcularon los puntos
 }
 
 func (PilotQualy) TableName() string {
 	return "pilot_qualies"
 }
 
+// Resultado de la carrera sprint. Lo puntúan las cartas de carrera (modo R).
+type PilotSprint struct {
+	ID               uint   `gorm:"primaryKey"`
+	PilotID          uint   `gorm:"not null"`
+	GPIndex          uint64 `gorm:"not null;column:gp_index"`
+	StartPosition    int
+	FinishPosition   int
+	ExpectedPosition float64
+	DeltaPosition    int
+	Points           int
+	CausedRedFlag    bool
+	DNFDriverError   bool
+	DNFNoFault       bool
+	ScoringVersion   int `gorm:"not null;default:1"` // Versión de reglas con la que se calcularon los puntos
+}
+
+func (PilotSprint) TableName() string {
+	return "pilot_sprints"
+}
+
+// Resultado de la sprint qualifying. Lo puntúan las cartas de clasificación (modo Q).
+type PilotSprintQualy struct {
+	ID               uint   `gorm:"primaryKey"`
+	PilotID          uint   `gorm:"not null"`
+	GPIndex          uint64 `gorm:"not null;column:gp_index"`
+	StartPosition    int
+	FinishPosition   int
+	ExpectedPosition float64
+	DeltaPosition    int
+	Points           int
+	CausedRedFlag    bool
+	ScoringVersion   int `gorm:"not null;default:1"` // Versión de reglas con la que se calcularon los puntos
+}
+
+func (PilotSprintQualy) TableName() string {
+	return "pilot_sprint_qualies"
+}
+
 type PilotPractice struct {
 	ID               uint   `gorm:"primaryKey"`
 	PilotID          uint   `gorm:"not null"`
@@ -180,6 +289,7 @@ type PilotPractice struct {
 	DeltaPosition    int
 	Points           int
 	CausedRedFlag    bool
+	ScoringVersion   int `gorm:"not null;default:1"` // Versión de reglas con la que se calcularon los puntos
 }
 
 func (PilotPractice) TableName() string {
@@ -332,9 +442,12 @@ type TeamRace struct {
 	FinishPosition    *int      `gorm:"column:finish_position"`
 	ExpectedPosition  *float64  `gorm:"column:expected_position"`
 	DeltaPosition     *int      `gorm:"column:delta_position"`
-	PitstopTime       *float64  `gorm:"column:pitstop_time"`
-	FinishCars        int       `gorm:"column:finish_cars;default:0"` // Número de coches que acabaron (0, 1 o 2)
+	PitstopTime       *float64  `gorm:"column:pitstop_time"`                           // Tiempo parado en boxes (lo introduce el admin)
+	PitLaneTime       *float64  `gorm:"column:pit_lane_time"`                          // Tiempo en pit lane de la parada más rápida (scraper)
+	FastestPitstop    bool      `gorm:"column:fastest_pitstop;not null;default:false"` // Parada más rápida del GP
+	FinishCars        int       `gorm:"column:finish_cars;default:0"`                  // Número de coches que acabaron (0, 1 o 2)
 	Points            int       `gorm:"default:0"`
+	ScoringVersion    int       `gorm:"not null;default:1"` // Versión de reglas con la que se calcularon los puntos
 	CreatedAt         time.Time `json:"created_at"`
 	UpdatedAt         time.Time `json:"updated_at"`
 }
@@ -369,10 +482,15 @@ type Lineup struct {
 	RacePilots        []byte    `json:"race_pilots" gorm:"type:json"`                          // Array de pilot_by_league_id
 	QualifyingPilots  []byte    `json:"qualifying_pilots" gorm:"type:json"`                    // Array de pilot_by_league_id
 	PracticePilots    []byte    `json:"practice_pilots" gorm:"type:json"`                      // Array de pilot_by_league_id
+	SprintPilots      []byte    `json:"sprint_pilots" gorm:"type:json"`                        // Array de pilot_by_league_id (solo GPs con sprint)
+	BenchPilots       []byte    `json:"bench_pilots" gorm:"type:json"`                         // Suplentes ordenados por sesión: {"race": [...], "qualy": [...], "practice": [...]}
 	TeamConstructorID *uint     `json:"team_constructor_id" gorm:"column:team_constructor_id"` // ID de teamconstructor_by_league
 	ChiefEngineerID   *uint     `json:"chief_engineer_id" gorm:"column:chief_engineer_id"`     // ID de chief_engineer_by_league
 	TrackEngineers    []byte    `json:"track_engineers" gorm:"type:json"`                      // Array de track_engineer_by_league_id
+	CaptainID         *uint     `json:"captain_id" gorm:"column:captain_id"`                   // pilot_by_league_id del capitán
+	ViceCaptainID     *uint     `json:"vice_captain_id" gorm:"column:vice_captain_id"`         // pilot_by_league_id del vicecapitán
 	LineupPoints      int       `json:"lineup_points" gorm:"default:0"`                        // Puntos totales de la alineación
+	AutoGenerated     bool      `json:"auto_generated" gorm:"not null;default:false"`          // Copiada de la alineación anterior al bloquearse el GP
 	CreatedAt         time.Time `json:"created_at"`
 	UpdatedAt         time.Time `json:"updated_at"`
 }
@@ -380,3 +498,204 @@ type Lineup struct {
 func (Lineup) TableName() string {
 	return "lineups"
 }
+
+// Modelo para el estado persistente de los trabajos programados por liga
+type SchedulerJobState struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	LeagueID  uint       `json:"league_id" gorm:"not null;uniqueIndex:idx_scheduler_league_job"`
+	Job       string     `json:"job" gorm:"type:varchar(50);not null;uniqueIndex:idx_scheduler_league_job"` // "settle_auctions", "market_refresh", "expire_offers"
+	LastRunAt *time.Time `json:"last_run_at"`
+	NextRunAt *time.Time `json:"next_run_at"`
+	LastError string     `json:"last_error" gorm:"type:text"`
+	RunCount  int        `json:"run_count" gorm:"default:0"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+func (SchedulerJobState) TableName() string {
+	return "scheduler_job_states"
+}
+
+// Modelo de asiento del libro mayor de dinero por liga. Cada movimiento genera
+// dos asientos (débito y crédito) con el mismo TransferID; PlayerID 0 es la
+// cuenta de la propia liga (banca/FIA).
+type LedgerEntry struct {
+	ID             uint64    `json:"id" gorm:"primaryKey"`
+	TransferID     string    `json:"transfer_id" gorm:"type:varchar(40);not null;index"`
+	LeagueID       uint64    `json:"league_id" gorm:"not null;index:idx_ledger_league_player"`
+	PlayerID       uint64    `json:"player_id" gorm:"not null;index:idx_ledger_league_player"`
+	CounterpartyID uint64    `json:"counterparty_id" gorm:"default:0"`
+	Direction      string    `json:"direction" gorm:"type:varchar(10);not null"` // "credit", "debit"
+	Amount         float64   `json:"amount" gorm:"type:decimal(15,2);not null"`
+	ItemType       string    `json:"item_type" gorm:"type:varchar(30)"`
+	ItemID         uint      `json:"item_id" gorm:"default:0"`
+	Reason         string    `json:"reason" gorm:"type:varchar(50);not null"`
+	BalanceAfter   float64   `json:"balance_after" gorm:"type:decimal(15,2)"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+func (LedgerEntry) TableName() string {
+	return "ledger_entries"
+}
+
+// Configuración del mercado de una liga: número de huecos, mínimo y máximo por
+// tipo de elemento y ponderación de la selección ("uniform", "value", "form")
+type LeagueMarketSettings struct {
+	ID                  uint      `json:"id" gorm:"primaryKey"`
+	LeagueID            uint      `json:"league_id" gorm:"not null;uniqueIndex"`
+	TotalSlots          int       `json:"total_slots" gorm:"not null;default:8"`
+	MinPilots           int       `json:"min_pilots" gorm:"default:0"`
+	MaxPilots           int       `json:"max_pilots" gorm:"default:0"`
+	MinTrackEngineers   int       `json:"min_track_engineers" gorm:"default:0"`
+	MaxTrackEngineers   int       `json:"max_track_engineers" gorm:"default:0"`
+	MinChiefEngineers   int       `json:"min_chief_engineers" gorm:"default:0"`
+	MaxChiefEngineers   int       `json:"max_chief_engineers" gorm:"default:0"`
+	MinTeamConstructors int       `json:"min_team_constructors" gorm:"default:0"`
+	MaxTeamConstructors int       `json:"max_team_constructors" gorm:"default:0"`
+	Weighting           string    `json:"weighting" gorm:"type:varchar(20);default:'uniform'"`
+	CreatedAt           time.Time `json:"created_at"`
+	UpdatedAt           time.Time `json:"updated_at"`
+}
+
+func (LeagueMarketSettings) TableName() string {
+	return "league_market_settings"
+}
+
+// Resultado de una subasta finalizada. Guarda todas las pujas y el modo de la
+// liga para poder comprobar el precio cobrado, también en modo sellado.
+type AuctionResult struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	AuctionID  uint      `json:"auction_id" gorm:"not null;uniqueIndex"`
+	LeagueID   uint      `json:"league_id" gorm:"not null;index"`
+	ItemType   string    `json:"item_type" gorm:"size:32;not null"`
+	ItemID     uint      `json:"item_id" gorm:"not null"`
+	Mode       string    `json:"mode" gorm:"size:32;not null"`
+	Bids       []byte    `json:"bids" gorm:"type:json"` // [{player_id, valor}] en el orden de llegada
+	Reserve    float64   `json:"reserve"`               // Valor de mercado usado como precio de reserva
+	WinnerID   uint      `json:"winner_id"`             // 0 si no se pudo adjudicar
+	WinningBid float64   `json:"winning_bid"`
+	Price      float64   `json:"price"`
+	SettledAt  time.Time `json:"settled_at"`
+	Failure    string    `json:"failure_reason" gorm:"column:failure_reason;size:255;not null;default:''"` // Motivo si se cerró sin adjudicar
+}
+
+func (AuctionResult) TableName() string {
+	return "auction_results"
+}
+
+// Sorteo verificable del mercado. El hash de la semilla se publica antes del
+// sorteo y la semilla se revela después, junto con los candidatos y el resultado.
+type MarketDraw struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	LeagueID    uint       `json:"league_id" gorm:"not null;index"`
+	Kind        string     `json:"kind" gorm:"size:16;not null;default:'market'"` // market: refresco del mercado; fia: ofertas FIA sueltas
+	SeedHash    string     `json:"seed_hash" gorm:"type:varchar(64);not null"`
+	Seed        string     `json:"-" gorm:"type:varchar(64);not null"`
+	Candidates  []byte     `json:"candidates" gorm:"type:json"` // [{market_item_id, item_type, item_id, weight}] en el orden del sorteo
+	Settings    []byte     `json:"settings" gorm:"type:json"`
+	Selected    []byte     `json:"selected" gorm:"type:json"`   // IDs de market_items elegidos
+	FIAOffers   []byte     `json:"fia_offers" gorm:"type:json"` // Ofertas FIA generadas con la misma semilla
+	CommittedAt time.Time  `json:"committed_at"`
+	RevealedAt  *time.Time `json:"revealed_at"`
+}
+
+func (MarketDraw) TableName() string {
+	return "market_draws"
+}
+
+// Parámetros económicos de una liga que antes eran constantes del código
+type LeagueSettings struct {
+	ID                   uint      `json:"id" gorm:"primaryKey"`
+	LeagueID             uint      `json:"league_id" gorm:"not null;uniqueIndex"`
+	StartingMoney        float64   `json:"starting_money" gorm:"not null;default:100000000"`
+	AuctionDurationHours int       `json:"auction_duration_hours" gorm:"not null;default:24"`
+	ClausulaDays         int       `json:"clausula_days" gorm:"not null;default:14"`
+	FIAMinMultiplier     float64   `json:"fia_min_multiplier" gorm:"not null;default:0.9"`
+	FIAMaxMultiplier     float64   `json:"fia_max_multiplier" gorm:"not null;default:1.1"`
+	CaptainMultiplier    float64   `json:"captain_multiplier" gorm:"not null;default:2"`
+	FIAOfferHours        int       `json:"fia_offer_hours" gorm:"not null;default:24"`                                                                                // Validez de las ofertas de la FIA
+	MarketRefreshHours   int       `json:"market_refresh_hours" gorm:"not null;default:24"`                                                                           // Tiempo entre refrescos del mercado
+	EnabledChips         string    `json:"enabled_chips" gorm:"type:varchar(255);not null;default:'triple_captain,no_negatives,double_chief_engineer,free_clausula'"` // Chips disponibles en la liga separados por comas
+	CreatedAt            time.Time `json:"created_at"`
+	UpdatedAt            time.Time `json:"updated_at"`
+}
+
+func (LeagueSettings) TableName() string {
+	return "league_settings"
+}
+
+// Parámetros del motor de valoración diaria (una sola fila global)
+type ValuationConfig struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	Damping        float64   `json:"damping" gorm:"not null;default:0.3"`          // Parte de la distancia al valor objetivo que se recorre cada día
+	DemandWeight   float64   `json:"demand_weight" gorm:"not null;default:0.1"`    // Peso de los fichajes/ventas netos
+	PointsWeight   float64   `json:"points_weight" gorm:"not null;default:0.15"`   // Peso de los puntos recientes frente a la media del tipo
+	RecentGPs      int       `json:"recent_gps" gorm:"not null;default:3"`         // GPs con resultados que cuentan como forma reciente
+	MaxDailyChange float64   `json:"max_daily_change" gorm:"not null;default:0.1"` // Variación máxima diaria (0.1 = 10%)
+	FloorRatio     float64   `json:"floor_ratio" gorm:"not null;default:0.5"`      // Valor mínimo respecto al valor base del elemento
+	CeilingRatio   float64   `json:"ceiling_ratio" gorm:"not null;default:2"`      // Valor máximo respecto al valor base del elemento
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+func (ValuationConfig) TableName() string {
+	return "valuation_configs"
+}
+
+// Valoración diaria de un elemento (piloto, ingeniero o constructor) con los
+// datos que la explican
+type ItemValuation struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	ItemType     string    `json:"item_type" gorm:"type:varchar(30);not null;uniqueIndex:idx_item_valuation_day"`
+	ItemID       uint      `json:"item_id" gorm:"not null;uniqueIndex:idx_item_valuation_day"` // ID global (pilots, track_engineers, chief_engineers, teamconstructor)
+	Day          string    `json:"day" gorm:"type:varchar(10);not null;uniqueIndex:idx_item_valuation_day"`
+	BaseValue    float64   `json:"base_value"`
+	OldValue     float64   `json:"old_value"`
+	TargetValue  float64   `json:"target_value"`
+	NewValue     float64   `json:"new_value"`
+	NetTransfers int       `json:"net_transfers"`
+	RecentPoints int       `json:"recent_points"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func (ItemValuation) TableName() string {
+	return "item_valuations"
+}
+
+// Modelo para cada evento de puntuación de un elemento en una sesión de un GP
+type PointsLineItem struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	GPIndex        uint64    `json:"gp_index" gorm:"not null;column:gp_index;index:idx_points_line_items_item"`
+	Session        string    `json:"session" gorm:"type:varchar(20);not null;index:idx_points_line_items_item"`   // "race", "qualy", "practice", "team"
+	ItemType       string    `json:"item_type" gorm:"type:varchar(30);not null;index:idx_points_line_items_item"` // "pilot", "team_constructor", "track_engineer"
+	ItemID         uint      `json:"item_id" gorm:"not null;index:idx_points_line_items_item"`                    // ID global del elemento
+	Rule           string    `json:"rule" gorm:"type:varchar(40);not null"`
+	Quantity       int       `json:"quantity"`
+	Points         int       `json:"points"`
+	Detail         string    `json:"detail" gorm:"type:varchar(255)"`
+	ScoringVersion int       `json:"scoring_version" gorm:"not null;default:1"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+func (PointsLineItem) TableName() string {
+	return "points_line_items"
+}
+
+// Uso de un chip de temporada por un manager. Cada chip se usa una sola vez por
+// temporada; los de alineación guardan el GP y el de cláusula el elemento fichado.
+type ChipUsage struct {
+	ID               uint      `json:"id" gorm:"primaryKey"`
+	LeagueID         uint64    `json:"league_id" gorm:"not null;index"`
+	PlayerID         uint64    `json:"player_id" gorm:"not null"`
+	PlayerByLeagueID uint64    `json:"player_by_league_id" gorm:"not null;uniqueIndex:idx_chip_usages_player_chip"`
+	Chip             string    `json:"chip" gorm:"type:varchar(30);not null;uniqueIndex:idx_chip_usages_player_chip"`
+	GPIndex          *uint64   `json:"gp_index,omitempty" gorm:"column:gp_index"`
+	ItemType         string    `json:"item_type,omitempty" gorm:"type:varchar(30)"`
+	ItemID           uint      `json:"item_id,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+func (ChipUsage) TableName() string {
+	return "chip_usages"
+}
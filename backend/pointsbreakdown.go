@@ -0,0 +1,510 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"f1-fantasy-app/database"
+	"f1-fantasy-app/models"
+
+	"gorm.io/gorm"
+)
+
+// pointsExplanation es un nodo del árbol que explica los puntos de una alineación
+type pointsExplanation struct {
+	Label     string                  `json:"label"`
+	ItemType  string                  `json:"item_type,omitempty"`
+	ItemID    uint                    `json:"item_id,omitempty"` // ID por liga del elemento
+	Session   string                  `json:"session,omitempty"`
+	Points    int                     `json:"points"`
+	LineItems []models.PointsLineItem `json:"line_items,omitempty"`
+	Children  []pointsExplanation     `json:"children,omitempty"`
+}
+
+// pilotSessionName traduce el modo de un piloto a su sesión
+func pilotSessionName(mode string) string {
+	switch mode {
+	case "race", "R":
+		return "race"
+	case "qualy", "Q":
+		return "qualy"
+	case "practice", "P":
+		return "practice"
+	}
+	return mode
+}
+
+// sprintSessionName devuelve la sesión que puntúa un piloto alineado en el
+// hueco de sprint: las cartas de carrera puntúan la sprint y las de
+// clasificación la sprint qualifying
+func sprintSessionName(mode string) string {
+	switch pilotSessionName(mode) {
+	case "race":
+		return "sprint"
+	case "qualy":
+		return "sprint_qualy"
+	}
+	return ""
+}
+
+// withAdjustment añade un ajuste manual si los puntos guardados no coinciden con
+// el desglose, para que las líneas siempre sumen lo que se puntuó
+func withAdjustment(items []models.PointsLineItem, stored int) []models.PointsLineItem {
+	if diff := stored - sumLineItems(items); diff != 0 {
+		items = lineItem(items, ruleManualAdjustment, 1, diff, "Ajuste manual de puntos")
+	}
+	return items
+}
+
+// pilotSessionBreakdown desglosa con rs el resultado de un piloto en una sesión
+// y devuelve también los puntos guardados y su versión de reglas
+func pilotSessionBreakdown(tx *gorm.DB, rs ScoringRuleset, session string, pilotID uint, gpIndex uint64) ([]models.PointsLineItem, int, int, bool) {
+	switch pilotSessionName(session) {
+	case "race":
+		var row models.PilotRace
+		if err := tx.Where("pilot_id = ? AND gp_index = ?", pilotID, gpIndex).First(&row).Error; err == nil {
+			return rs.BreakdownPilotRace(row), row.Points, row.ScoringVersion, true
+		}
+	case "qualy":
+		var row models.PilotQualy
+		if err := tx.Where("pilot_id = ? AND gp_index = ?", pilotID, gpIndex).First(&row).Error; err == nil {
+			return rs.BreakdownPilotQualy(row), row.Points, row.ScoringVersion, true
+		}
+	case "practice":
+		var row models.PilotPractice
+		if err := tx.Where("pilot_id = ? AND gp_index = ?", pilotID, gpIndex).First(&row).Error; err == nil {
+			return rs.BreakdownPilotPractice(row), row.Points, row.ScoringVersion, true
+		}
+	case "sprint":
+		var row models.PilotSprint
+		if err := tx.Where("pilot_id = ? AND gp_index = ?", pilotID, gpIndex).First(&row).Error; err == nil {
+			return rs.BreakdownPilotSprint(row), row.Points, row.ScoringVersion, true
+		}
+	case "sprint_qualy":
+		var row models.PilotSprintQualy
+		if err := tx.Where("pilot_id = ? AND gp_index = ?", pilotID, gpIndex).First(&row).Error; err == nil {
+			return rs.BreakdownPilotSprintQualy(row), row.Points, row.ScoringVersion, true
+		}
+	}
+	return nil, 0, 0, false
+}
+
+// replaceLineItems sustituye las líneas guardadas de un elemento en una sesión de un GP
+func replaceLineItems(tx *gorm.DB, gpIndex uint64, session, itemType string, itemID uint, version int, items []models.PointsLineItem) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("gp_index = ? AND session = ? AND item_type = ? AND item_id = ?", gpIndex, session, itemType, itemID).
+			Delete(&models.PointsLineItem{}).Error; err != nil {
+			return err
+		}
+		for i := range items {
+			items[i].ID = 0
+			items[i].GPIndex = gpIndex
+			items[i].Session = session
+			items[i].ItemType = itemType
+			items[i].ItemID = itemID
+			items[i].ScoringVersion = version
+		}
+		if len(items) == 0 {
+			return nil
+		}
+		return tx.Create(&items).Error
+	})
+}
+
+// storePilotLineItems guarda el desglose del resultado de un piloto en una sesión
+func storePilotLineItems(tx *gorm.DB, session string, pilotID uint, gpIndex uint64) error {
+	session = pilotSessionName(session)
+	var version int
+	if err := tx.Table(sessionTables[session]).Where("pilot_id = ? AND gp_index = ?", pilotID, gpIndex).
+		Select("scoring_version").Scan(&version).Error; err != nil || version == 0 {
+		return nil
+	}
+	items, stored, _, ok := pilotSessionBreakdown(tx, scoringRuleset(version), session, pilotID, gpIndex)
+	if !ok {
+		return nil
+	}
+	if err := replaceLineItems(tx, gpIndex, session, "pilot", pilotID, version, withAdjustment(items, stored)); err != nil {
+		log.Printf("[POINTS-BREAKDOWN] Error guardando desglose de piloto %d (%s, GP %d): %v", pilotID, session, gpIndex, err)
+		return err
+	}
+	return nil
+}
+
+// scorePilotSession puntúa con el ruleset activo el resultado guardado de un
+// piloto en una sesión, guarda los puntos y su desglose y devuelve el desglose
+func scorePilotSession(session string, pilotID uint, gpIndex uint64) ([]models.PointsLineItem, error) {
+	session = pilotSessionName(session)
+	rs := activeScoringRuleset()
+	items, _, _, ok := pilotSessionBreakdown(database.DB, rs, session, pilotID, gpIndex)
+	if !ok {
+		return nil, fmt.Errorf("no hay resultado de %s del piloto %d en el GP %d", session, pilotID, gpIndex)
+	}
+	if err := database.DB.Table(sessionTables[session]).Where("pilot_id = ? AND gp_index = ?", pilotID, gpIndex).
+		Updates(map[string]interface{}{"points": sumLineItems(items), "scoring_version": rs.Version}).Error; err != nil {
+		return nil, err
+	}
+	storePilotLineItems(database.DB, session, pilotID, gpIndex)
+	return items, nil
+}
+
+// lineItemsSummary agrupa un desglose en los puntos de delta, de posición y el
+// resto de bonificaciones y penalizaciones
+func lineItemsSummary(items []models.PointsLineItem) map[string]int {
+	summary := map[string]int{"delta_points": 0, "position_points": 0, "bonus_points": 0, "total_points": 0}
+	for _, item := range items {
+		switch item.Rule {
+		case ruleDelta:
+			summary["delta_points"] += item.Points
+		case rulePosition:
+			summary["position_points"] += item.Points
+		default:
+			summary["bonus_points"] += item.Points
+		}
+		summary["total_points"] += item.Points
+	}
+	return summary
+}
+
+// storeTeamLineItems guarda el desglose del resultado de un equipo en un GP
+func storeTeamLineItems(tx *gorm.DB, teamConstructorID uint, gpIndex uint64) error {
+	var row models.TeamRace
+	if err := tx.Where("teamconstructor_id = ? AND gp_index = ?", teamConstructorID, gpIndex).First(&row).Error; err != nil {
+		return nil
+	}
+	items := withAdjustment(scoringRuleset(row.ScoringVersion).BreakdownTeamRace(row), row.Points)
+	if err := replaceLineItems(tx, gpIndex, "team", "team_constructor", teamConstructorID, row.ScoringVersion, items); err != nil {
+		log.Printf("[POINTS-BREAKDOWN] Error guardando desglose de equipo %d (GP %d): %v", teamConstructorID, gpIndex, err)
+		return err
+	}
+	return nil
+}
+
+// trackEngineerLineItems explica los puntos de un track engineer en una sesión
+func trackEngineerLineItems(row models.TrackEngineerPoints) []models.PointsLineItem {
+	detail := fmt.Sprintf("%d pts del piloto × %.1f", row.BasePoints, row.Multiplier)
+	if row.BasePoints < 0 {
+		detail = fmt.Sprintf("%d pts negativos del piloto en valor absoluto × 0.2", row.BasePoints)
+	}
+	if row.PilotPosition != nil && row.TeammatePosition != nil {
+		detail += fmt.Sprintf(" (P%d frente a P%d del compañero)", *row.PilotPosition, *row.TeammatePosition)
+	}
+	return lineItem(nil, ruleTrackEngineer, row.BasePoints, row.TotalPoints, detail)
+}
+
+// storeTrackEngineerLineItems guarda el desglose de un track engineer en una sesión
+func storeTrackEngineerLineItems(tx *gorm.DB, trackEngineerID uint, gpIndex uint64, session string) error {
+	var row models.TrackEngineerPoints
+	if err := tx.Where("track_engineer_id = ? AND gp_index = ? AND session_type = ?", trackEngineerID, gpIndex, session).First(&row).Error; err != nil {
+		return nil
+	}
+	if err := replaceLineItems(tx, gpIndex, session, "track_engineer", trackEngineerID, activeScoringVersion(), trackEngineerLineItems(row)); err != nil {
+		log.Printf("[POINTS-BREAKDOWN] Error guardando desglose de track engineer %d (%s, GP %d): %v", trackEngineerID, session, gpIndex, err)
+		return err
+	}
+	return nil
+}
+
+// Tabla de resultados de cada sesión de pilotos
+var sessionTables = map[string]string{
+	"race":         models.PilotRace{}.TableName(),
+	"qualy":        models.PilotQualy{}.TableName(),
+	"practice":     models.PilotPractice{}.TableName(),
+	"sprint":       models.PilotSprint{}.TableName(),
+	"sprint_qualy": models.PilotSprintQualy{}.TableName(),
+}
+
+// Sesiones en las que puntúan los track engineers
+var trackEngineerSessions = []string{"race", "qualy", "practice", "sprint", "sprint_qualy"}
+
+// storeGPLineItems regenera el desglose de todos los resultados de un GP y
+// devuelve el primer error al guardarlo
+func storeGPLineItems(tx *gorm.DB, gpIndex uint64) error {
+	for session, table := range sessionTables {
+		var pilotIDs []uint
+		if err := tx.Table(table).Where("gp_index = ?", gpIndex).Pluck("pilot_id", &pilotIDs).Error; err != nil {
+			return err
+		}
+		for _, pilotID := range pilotIDs {
+			if err := storePilotLineItems(tx, session, pilotID, gpIndex); err != nil {
+				return err
+			}
+		}
+	}
+	var teamIDs []uint
+	if err := tx.Model(&models.TeamRace{}).Where("gp_index = ?", gpIndex).Pluck("teamconstructor_id", &teamIDs).Error; err != nil {
+		return err
+	}
+	for _, teamID := range teamIDs {
+		if err := storeTeamLineItems(tx, teamID, gpIndex); err != nil {
+			return err
+		}
+	}
+	var trackEngineerRows []models.TrackEngineerPoints
+	if err := tx.Where("gp_index = ?", gpIndex).Find(&trackEngineerRows).Error; err != nil {
+		return err
+	}
+	for _, row := range trackEngineerRows {
+		if err := storeTrackEngineerLineItems(tx, row.TrackEngineerID, gpIndex, row.SessionType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// storedLineItems devuelve las líneas guardadas de un elemento con una versión de reglas
+func storedLineItems(gpIndex uint64, session, itemType string, itemID uint, version int) []models.PointsLineItem {
+	var items []models.PointsLineItem
+	database.DB.Where("gp_index = ? AND session = ? AND item_type = ? AND item_id = ? AND scoring_version = ?",
+		gpIndex, session, itemType, itemID, version).Order("id asc").Find(&items)
+	return items
+}
+
+// pilotLineItemsForLeague devuelve el desglose de un piloto con las reglas de la
+// liga, igual que pilotSessionPointsForLeague calcula sus puntos
+func pilotLineItemsForLeague(leagueID uint, session string, pilotID uint, gpIndex uint64) []models.PointsLineItem {
+	rs := leagueScoringRuleset(leagueID)
+	session = pilotSessionName(session)
+	if items := storedLineItems(gpIndex, session, "pilot", pilotID, rs.Version); len(items) > 0 {
+		return items
+	}
+	items, stored, version, ok := pilotSessionBreakdown(database.DB, rs, session, pilotID, gpIndex)
+	if ok && version == rs.Version {
+		items = withAdjustment(items, stored)
+	}
+	return items
+}
+
+// teamLineItemsForLeague devuelve el desglose de un equipo con las reglas de la liga
+func teamLineItemsForLeague(leagueID uint, teamConstructorID uint, gpIndex uint64) []models.PointsLineItem {
+	rs := leagueScoringRuleset(leagueID)
+	if items := storedLineItems(gpIndex, "team", "team_constructor", teamConstructorID, rs.Version); len(items) > 0 {
+		return items
+	}
+	var row models.TeamRace
+	if err := database.DB.Where("teamconstructor_id = ? AND gp_index = ?", teamConstructorID, gpIndex).First(&row).Error; err != nil {
+		return nil
+	}
+	items := rs.BreakdownTeamRace(row)
+	if row.ScoringVersion == rs.Version {
+		items = withAdjustment(items, row.Points)
+	}
+	return items
+}
+
+// trackEngineerLineupSessions devuelve las sesiones en las que la alineación
+// tiene a algún piloto asociado al track engineer
+func trackEngineerLineupSessions(trackEngineerID uint, lineup models.Lineup) map[string]bool {
+	var associatedPilotIDs []uint
+	database.DB.Model(&models.Pilot{}).Where("track_engineer_id = ?", trackEngineerID).Pluck("id", &associatedPilotIDs)
+	if len(associatedPilotIDs) == 0 {
+		log.Printf("[TRACK-ENG-POINTS] No hay pilotos asociados al track engineer %d", trackEngineerID)
+		return map[string]bool{}
+	}
+	var associatedPilots []models.Pilot
+	database.DB.Where("id IN ?", associatedPilotIDs).Find(&associatedPilots)
+	modes := make(map[uint]string, len(associatedPilots))
+	for _, pilot := range associatedPilots {
+		modes[pilot.ID] = pilot.Mode
+	}
+	var associatedByLeague []models.PilotByLeague
+	database.DB.Where("pilot_id IN ? AND league_id = ?", associatedPilotIDs, lineup.LeagueID).Find(&associatedByLeague)
+	associated := make(map[uint]string, len(associatedByLeague))
+	for _, pbl := range associatedByLeague {
+		associated[pbl.ID] = modes[pbl.PilotID]
+	}
+
+	sessions := make(map[string]bool)
+	slots := map[string][]byte{"race": lineup.RacePilots, "qualy": lineup.QualifyingPilots, "practice": lineup.PracticePilots, "sprint": lineup.SprintPilots}
+	for slot, raw := range slots {
+		var ids []uint
+		if len(raw) > 0 {
+			json.Unmarshal(raw, &ids)
+		}
+		for _, id := range ids {
+			mode, ok := associated[id]
+			if !ok {
+				continue
+			}
+			// En el hueco de sprint la sesión depende del modo de la carta
+			session := slot
+			if slot == "sprint" {
+				session = sprintSessionName(mode)
+			}
+			if session != "" {
+				sessions[session] = true
+			}
+		}
+	}
+	return sessions
+}
+
+// explainPilots explica los puntos de los pilotos de un hueco de la alineación.
+// En el hueco de sprint cada piloto puntúa la sesión de sprint de su modo.
+func explainPilots(label string, raw []byte, lineup models.Lineup, sprint bool) pointsExplanation {
+	node := pointsExplanation{Label: label}
+	var ids []uint
+	if len(raw) > 0 {
+		json.Unmarshal(raw, &ids)
+	}
+	for _, pilotByLeagueID := range ids {
+		var pbl models.PilotByLeague
+		var pilot models.Pilot
+		if database.DB.First(&pbl, pilotByLeagueID).Error != nil || database.DB.First(&pilot, pbl.PilotID).Error != nil {
+			continue
+		}
+		session, points := pilotSessionName(pilot.Mode), 0
+		if sprint {
+			session, points = sprintSessionName(pilot.Mode), getPilotSprintPoints(database.DB, pilotByLeagueID, lineup.GPIndex)
+		} else {
+			points = getPilotPoints(database.DB, pilotByLeagueID, lineup.GPIndex)
+		}
+		child := pointsExplanation{
+			Label:     pilot.DriverName,
+			ItemType:  "pilot",
+			ItemID:    pilotByLeagueID,
+			Session:   session,
+			Points:    points,
+			LineItems: pilotLineItemsForLeague(pbl.LeagueID, session, pilot.ID, lineup.GPIndex),
+		}
+		node.Points += child.Points
+		node.Children = append(node.Children, child)
+	}
+	return node
+}
+
+// explainLineup construye el árbol que explica los puntos de una alineación: por
+// cada hueco, cada elemento con sus puntos y las reglas que los generan
+func explainLineup(lineup models.Lineup) pointsExplanation {
+	lineup, substitutions := applyBenchSubstitutions(lineup)
+	leagueID := uint(lineup.LeagueID)
+	gpIndex := lineup.GPIndex
+	root := pointsExplanation{Label: fmt.Sprintf("Alineación GP %d", gpIndex)}
+
+	groups := []pointsExplanation{
+		explainPilots("Pilotos de carrera", lineup.RacePilots, lineup, false),
+		explainPilots("Pilotos de clasificación", lineup.QualifyingPilots, lineup, false),
+		explainPilots("Pilotos de libres", lineup.PracticePilots, lineup, false),
+	}
+	if len(lineup.SprintPilots) > 0 {
+		groups = append(groups, explainPilots("Pilotos de sprint", lineup.SprintPilots, lineup, true))
+	}
+
+	if lineup.TeamConstructorID != nil {
+		var tcbl models.TeamConstructorByLeague
+		var tc models.TeamConstructor
+		if database.DB.First(&tcbl, *lineup.TeamConstructorID).Error == nil && database.DB.First(&tc, tcbl.TeamConstructorID).Error == nil {
+			groups = append(groups, pointsExplanation{
+				Label:     "Constructor: " + tc.Name,
+				ItemType:  "team_constructor",
+				ItemID:    *lineup.TeamConstructorID,
+				Session:   "team",
+				Points:    getTeamConstructorPoints(database.DB, *lineup.TeamConstructorID, gpIndex),
+				LineItems: teamLineItemsForLeague(leagueID, tcbl.TeamConstructorID, gpIndex),
+			})
+		}
+	}
+
+	if lineup.ChiefEngineerID != nil {
+		var cebl models.ChiefEngineerByLeague
+		var ce models.ChiefEngineer
+		if database.DB.First(&cebl, *lineup.ChiefEngineerID).Error == nil && database.DB.First(&ce, cebl.ChiefEngineerID).Error == nil {
+			node := pointsExplanation{
+				Label:    "Chief engineer: " + ce.Name,
+				ItemType: "chief_engineer",
+				ItemID:   *lineup.ChiefEngineerID,
+				Session:  "team",
+				Points:   getChiefEngineerPoints(database.DB, *lineup.ChiefEngineerID, gpIndex),
+			}
+			var tc models.TeamConstructor
+			if database.DB.Where("name = ? AND gp_index = ?", ce.Team, gpIndex).First(&tc).Error == nil {
+				node.LineItems = teamLineItemsForLeague(leagueID, tc.ID, gpIndex)
+			}
+			groups = append(groups, node)
+		}
+	}
+
+	trackEngineers := pointsExplanation{Label: "Track engineers"}
+	var trackEngineerIDs []uint
+	if len(lineup.TrackEngineers) > 0 {
+		json.Unmarshal(lineup.TrackEngineers, &trackEngineerIDs)
+	}
+	for _, tebl := range trackEngineerIDs {
+		var teByLeague models.TrackEngineerByLeague
+		var te models.TrackEngineer
+		if database.DB.First(&teByLeague, tebl).Error != nil || database.DB.First(&te, teByLeague.TrackEngineerID).Error != nil {
+			continue
+		}
+		child := pointsExplanation{
+			Label:    te.Name,
+			ItemType: "track_engineer",
+			ItemID:   tebl,
+			Points:   getTrackEngineerPointsWithLineup(database.DB, tebl, gpIndex, lineup),
+		}
+		// Solo cuentan las sesiones en las que el jugador alineó al piloto asociado
+		sessions := trackEngineerLineupSessions(te.ID, lineup)
+		for _, session := range trackEngineerSessions {
+			if !sessions[session] {
+				continue
+			}
+			items := storedLineItems(gpIndex, session, "track_engineer", te.ID, activeScoringVersion())
+			if len(items) == 0 {
+				var row models.TrackEngineerPoints
+				if database.DB.Where("track_engineer_id = ? AND gp_index = ? AND session_type = ?", te.ID, gpIndex, session).First(&row).Error == nil {
+					items = trackEngineerLineItems(row)
+				}
+			}
+			for i := range items {
+				items[i].Session = session
+			}
+			child.LineItems = append(child.LineItems, items...)
+		}
+		trackEngineers.Points += child.Points
+		trackEngineers.Children = append(trackEngineers.Children, child)
+	}
+	groups = append(groups, trackEngineers)
+
+	captainPoints, captainID, role, multiplier := captainBonus(database.DB, lineup)
+	if captainID != 0 {
+		label := "Capitán"
+		if role == captainRoleViceCaptain {
+			label = "Vicecapitán (el capitán no participó)"
+		}
+		groups = append(groups, pointsExplanation{
+			Label:    label,
+			ItemType: "pilot",
+			ItemID:   captainID,
+			Points:   captainPoints,
+			LineItems: lineItem(nil, ruleCaptainMultiplier, 1, captainPoints,
+				fmt.Sprintf("%d pts del piloto × %.2f", getPilotPoints(database.DB, captainID, gpIndex), multiplier)),
+		})
+	}
+
+	if bonus, chip, detail := chipBonus(database.DB, lineup, captainPoints); chip != "" {
+		info, _ := findChip(chip)
+		groups = append(groups, pointsExplanation{
+			Label:     "Chip: " + info.Name,
+			Points:    bonus,
+			LineItems: lineItem(nil, ruleChip+"_"+chip, 1, bonus, detail),
+		})
+	}
+
+	if len(substitutions) > 0 {
+		changes := pointsExplanation{Label: "Cambios del banquillo"}
+		for _, sub := range substitutions {
+			changes.Children = append(changes.Children, pointsExplanation{
+				Label:    fmt.Sprintf("Entra %s por %s", sub.InName, sub.OutName),
+				ItemType: "pilot",
+				ItemID:   sub.InID,
+				Session:  sub.Session,
+			})
+		}
+		groups = append(groups, changes)
+	}
+
+	for _, group := range groups {
+		root.Points += group.Points
+		root.Children = append(root.Children, group)
+	}
+	return root
+}
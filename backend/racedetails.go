@@ -0,0 +1,136 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Estructura para una parada extraída del resumen de pit stops
+type ScrapedPitStopData struct {
+	Stops        int     `json:"stops"`
+	DriverNumber string  `json:"driver_number"`
+	DriverName   string  `json:"driver_name"`
+	DriverCode   string  `json:"driver_code"`
+	Team         string  `json:"team"`
+	Lap          string  `json:"lap"`
+	TimeOfDay    string  `json:"time_of_day"`
+	Time         string  `json:"time"`
+	Duration     float64 `json:"duration"` // Segundos de la parada (columna Time)
+}
+
+// Estructura para una vuelta extraída de la tabla de vueltas rápidas
+type ScrapedFastestLapData struct {
+	Position     int    `json:"position"`
+	DriverNumber string `json:"driver_number"`
+	DriverName   string `json:"driver_name"`
+	DriverCode   string `json:"driver_code"`
+	Team         string `json:"team"`
+	Lap          string `json:"lap"`
+	TimeOfDay    string `json:"time_of_day"`
+	Time         string `json:"time"`
+	AvgSpeed     string `json:"avg_speed"`
+}
+
+// cellText devuelve el texto de la columna i de una fila
+func cellText(s *goquery.Selection, i int) string {
+	cells := s.Find("td")
+	if cells.Length() <= i {
+		return ""
+	}
+	return strings.TrimSpace(cells.Eq(i).Text())
+}
+
+// Extraer las paradas del resumen de pit stops.
+// Columnas: 0 Stops | 1 No | 2 Driver | 3 Car | 4 Lap | 5 Time of day | 6 Time | 7 Total
+func extractPitStopDataFromTable(doc *goquery.Document) ([]ScrapedPitStopData, error) {
+	var stops []ScrapedPitStopData
+
+	tableRows := doc.Find("table.f1-table-with-data tbody tr")
+	log.Printf("[SCRAPER] Pit stops: filas de tabla encontradas: %d", tableRows.Length())
+
+	tableRows.Each(func(i int, s *goquery.Selection) {
+		stop := extractPosition(s) // La primera columna es el número de parada
+		name, code := parseDriverCell(cellText(s, 2))
+		driverName := mapDriverName(normalizeDriverName(name))
+		duration, err := strconv.ParseFloat(cellText(s, 6), 64)
+		if stop <= 0 || driverName == "" || err != nil || duration <= 0 {
+			log.Printf("[SCRAPER] Pit stops: fila %d ignorada (%s)", i+1, strings.Join(strings.Fields(s.Text()), " "))
+			return
+		}
+		stops = append(stops, ScrapedPitStopData{
+			Stops:        stop,
+			DriverNumber: extractDriverNumber(s),
+			DriverName:   driverName,
+			DriverCode:   code,
+			Team:         extractTeam(s),
+			Lap:          cellText(s, 4),
+			TimeOfDay:    cellText(s, 5),
+			Time:         cellText(s, 6),
+			Duration:     duration,
+		})
+	})
+
+	log.Printf("[SCRAPER] Total de paradas extraídas: %d", len(stops))
+	return stops, nil
+}
+
+// Extraer la tabla de vueltas rápidas.
+// Columnas: 0 Pos | 1 No | 2 Driver | 3 Car | 4 Lap | 5 Time of day | 6 Time | 7 Avg Speed
+func extractFastestLapDataFromTable(doc *goquery.Document) ([]ScrapedFastestLapData, error) {
+	var laps []ScrapedFastestLapData
+
+	tableRows := doc.Find("table.f1-table-with-data tbody tr")
+	log.Printf("[SCRAPER] Vueltas rápidas: filas de tabla encontradas: %d", tableRows.Length())
+
+	tableRows.Each(func(i int, s *goquery.Selection) {
+		position := extractPosition(s)
+		name, code := parseDriverCell(cellText(s, 2))
+		driverName := mapDriverName(normalizeDriverName(name))
+		if position <= 0 || driverName == "" {
+			return
+		}
+		laps = append(laps, ScrapedFastestLapData{
+			Position:     position,
+			DriverNumber: extractDriverNumber(s),
+			DriverName:   driverName,
+			DriverCode:   code,
+			Team:         extractTeam(s),
+			Lap:          cellText(s, 4),
+			TimeOfDay:    cellText(s, 5),
+			Time:         cellText(s, 6),
+			AvgSpeed:     cellText(s, 7),
+		})
+	})
+
+	log.Printf("[SCRAPER] Total de vueltas rápidas extraídas: %d", len(laps))
+	return laps, nil
+}
+
+// mapTeamName traduce el nombre de equipo de formula1.com al de team_constructors
+func mapTeamName(team string) string {
+	teamMappings := map[string]string{
+		"Haas F1 Team": "Haas",
+		"Kick Sauber":  "Stake F1 Team Kick Sauber",
+		"Racing Bulls": "Visa Cash App RB",
+	}
+	if mapped, ok := teamMappings[team]; ok {
+		return mapped
+	}
+	return team
+}
+
+// fastestPitStopsByTeam devuelve la parada más rápida de cada equipo (con el
+// nombre de team_constructors)
+func fastestPitStopsByTeam(stops []ScrapedPitStopData) map[string]float64 {
+	fastest := make(map[string]float64)
+	for _, stop := range stops {
+		team := mapTeamName(stop.Team)
+		if best, ok := fastest[team]; !ok || stop.Duration < best {
+			fastest[team] = stop.Duration
+		}
+	}
+	return fastest
+}
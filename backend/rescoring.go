@@ -0,0 +1,270 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"f1-fantasy-app/database"
+	"f1-fantasy-app/models"
+
+	"gorm.io/gorm"
+)
+
+// rescoreMu evita que dos ejecuciones del rescoring se pisen entre sí
+var rescoreMu sync.Mutex
+
+// scoreChange es un cambio de puntos detectado al repuntuar un GP
+type scoreChange struct {
+	ID       uint   `json:"id"`
+	PlayerID uint   `json:"player_id,omitempty"`
+	LeagueID uint   `json:"league_id,omitempty"`
+	Session  string `json:"session,omitempty"`
+	Old      int    `json:"old"`
+	New      int    `json:"new"`
+}
+
+// rescoreResult es el diff de una ejecución del pipeline de rescoring
+type rescoreResult struct {
+	GPIndex        uint64        `json:"gp_index"`
+	ScoringVersion int           `json:"scoring_version"`
+	Sessions       []scoreChange `json:"sessions"`        // id = pilot_id
+	Teams          []scoreChange `json:"teams"`           // id = teamconstructor_id
+	TrackEngineers []scoreChange `json:"track_engineers"` // id = track_engineer_id
+	Lineups        []scoreChange `json:"lineups"`         // id = lineup_id
+	Players        []scoreChange `json:"players"`         // id = player_by_league_id
+	LineupsChecked int           `json:"lineups_checked"`
+	PlayersChecked int           `json:"players_checked"`
+}
+
+// Changed indica si la ejecución modificó algún valor
+func (r rescoreResult) Changed() bool {
+	return len(r.Sessions)+len(r.Teams)+len(r.TrackEngineers)+len(r.Lineups)+len(r.Players) > 0
+}
+
+// trackEngineerSessionPoints devuelve los puntos de track engineers de un GP por ingeniero y sesión
+func trackEngineerSessionPoints(tx *gorm.DB, gpIndex uint64) map[string]models.TrackEngineerPoints {
+	var rows []models.TrackEngineerPoints
+	tx.Where("gp_index = ?", gpIndex).Find(&rows)
+	points := make(map[string]models.TrackEngineerPoints, len(rows))
+	for _, row := range rows {
+		points[fmt.Sprintf("%d/%s", row.TrackEngineerID, row.SessionType)] = row
+	}
+	return points
+}
+
+// rescorePilotSessions recalcula los puntos de todas las sesiones de pilotos del
+// GP a partir de los datos en bruto con el ruleset activo
+func rescorePilotSessions(tx *gorm.DB, gpIndex uint64, rs ScoringRuleset, result *rescoreResult) error {
+	save := func(table, session string, pilotID uint, old, points int) error {
+		if old != points {
+			result.Sessions = append(result.Sessions, scoreChange{ID: pilotID, Session: session, Old: old, New: points})
+		}
+		return tx.Table(table).Where("pilot_id = ? AND gp_index = ?", pilotID, gpIndex).
+			Updates(map[string]interface{}{"points": points, "scoring_version": rs.Version}).Error
+	}
+
+	var races []models.PilotRace
+	if err := tx.Where("gp_index = ?", gpIndex).Find(&races).Error; err != nil {
+		return err
+	}
+	for _, row := range races {
+		if err := save(row.TableName(), "race", row.PilotID, row.Points, rs.ScorePilotRace(row)); err != nil {
+			return err
+		}
+	}
+
+	var qualies []models.PilotQualy
+	if err := tx.Where("gp_index = ?", gpIndex).Find(&qualies).Error; err != nil {
+		return err
+	}
+	for _, row := range qualies {
+		if err := save(row.TableName(), "qualy", row.PilotID, row.Points, rs.ScorePilotQualy(row)); err != nil {
+			return err
+		}
+	}
+
+	var practices []models.PilotPractice
+	if err := tx.Where("gp_index = ?", gpIndex).Find(&practices).Error; err != nil {
+		return err
+	}
+	for _, row := range practices {
+		if err := save(row.TableName(), "practice", row.PilotID, row.Points, rs.ScorePilotPractice(row)); err != nil {
+			return err
+		}
+	}
+
+	var sprints []models.PilotSprint
+	if err := tx.Where("gp_index = ?", gpIndex).Find(&sprints).Error; err != nil {
+		return err
+	}
+	for _, row := range sprints {
+		if err := save(row.TableName(), "sprint", row.PilotID, row.Points, rs.ScorePilotSprint(row)); err != nil {
+			return err
+		}
+	}
+
+	var sprintQualies []models.PilotSprintQualy
+	if err := tx.Where("gp_index = ?", gpIndex).Find(&sprintQualies).Error; err != nil {
+		return err
+	}
+	for _, row := range sprintQualies {
+		if err := save(row.TableName(), "sprint_qualy", row.PilotID, row.Points, rs.ScorePilotSprintQualy(row)); err != nil {
+			return err
+		}
+	}
+
+	var teams []models.TeamRace
+	if err := tx.Where("gp_index = ?", gpIndex).Find(&teams).Error; err != nil {
+		return err
+	}
+	for _, row := range teams {
+		points := rs.ScoreTeamRace(row)
+		if row.Points != points {
+			result.Teams = append(result.Teams, scoreChange{ID: row.TeamConstructorID, Old: row.Points, New: points})
+		}
+		if err := tx.Model(&models.TeamRace{}).Where("id = ?", row.ID).
+			Updates(map[string]interface{}{"points": points, "scoring_version": rs.Version}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rescoreTrackEngineers recalcula los puntos de los track engineers a partir de
+// los puntos ya repuntuados de sus pilotos, también en las sesiones de sprint
+func rescoreTrackEngineers(tx *gorm.DB, gpIndex uint64, result *rescoreResult) error {
+	before := trackEngineerSessionPoints(tx, gpIndex)
+	for _, session := range trackEngineerSessions {
+		var pilotIDs []uint
+		if err := tx.Table(sessionTables[session]).Where("gp_index = ?", gpIndex).Pluck("pilot_id", &pilotIDs).Error; err != nil {
+			return err
+		}
+		for _, pilotID := range pilotIDs {
+			if err := calculateTrackEngineerPointsForPilot(tx, pilotID, gpIndex, session); err != nil {
+				return err
+			}
+		}
+	}
+	for key, row := range trackEngineerSessionPoints(tx, gpIndex) {
+		if old := before[key]; old.TotalPoints != row.TotalPoints || old.ID == 0 {
+			result.TrackEngineers = append(result.TrackEngineers, scoreChange{ID: row.TrackEngineerID, Session: row.SessionType, Old: old.TotalPoints, New: row.TotalPoints})
+		}
+	}
+	return nil
+}
+
+// syncPlayerPointsByGP guarda los puntos de una alineación en player_points_by_gp si la tabla existe
+func syncPlayerPointsByGP(tx *gorm.DB, playerID, leagueID, gpIndex uint64, points int) error {
+	if !tx.Migrator().HasTable("player_points_by_gp") {
+		return nil
+	}
+	var count int64
+	tx.Table("player_points_by_gp").Where("player_id = ? AND league_id = ? AND gp_index = ?", playerID, leagueID, gpIndex).Count(&count)
+	var err error
+	if count > 0 {
+		err = tx.Exec("UPDATE player_points_by_gp SET points = ? WHERE player_id = ? AND league_id = ? AND gp_index = ?",
+			points, playerID, leagueID, gpIndex).Error
+	} else {
+		err = tx.Exec("INSERT INTO player_points_by_gp (player_id, league_id, gp_index, points) VALUES (?, ?, ?, ?)",
+			playerID, leagueID, gpIndex, points).Error
+	}
+	if err != nil {
+		log.Printf("[RESCORE] Error guardando player_points_by_gp para player_id=%d, league_id=%d, gp_index=%d: %v", playerID, leagueID, gpIndex, err)
+	}
+	return err
+}
+
+// playerSeasonPoints suma los puntos de todas las alineaciones de un jugador en una liga
+func playerSeasonPoints(tx *gorm.DB, playerID, leagueID uint64) int {
+	var total int
+	tx.Model(&models.Lineup{}).Where("player_id = ? AND league_id = ?", playerID, leagueID).
+		Select("COALESCE(SUM(lineup_points), 0)").Scan(&total)
+	return total
+}
+
+// rescoreGP recalcula desde los resultados en bruto las puntuaciones de todas las
+// sesiones del GP, los puntos de cada alineación y el total de cada jugador
+// afectado. No suma nada de forma incremental, así que repetirlo da el mismo
+// resultado; la segunda ejecución devuelve un diff vacío. Todo se escribe en una
+// transacción: si algo falla el GP se queda con las puntuaciones anteriores.
+func rescoreGP(gpIndex uint64) (rescoreResult, error) {
+	rescoreMu.Lock()
+	defer rescoreMu.Unlock()
+
+	rs := activeScoringRuleset()
+	result := rescoreResult{
+		GPIndex:        gpIndex,
+		ScoringVersion: rs.Version,
+		Sessions:       []scoreChange{},
+		Teams:          []scoreChange{},
+		TrackEngineers: []scoreChange{},
+		Lineups:        []scoreChange{},
+		Players:        []scoreChange{},
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// 1. Puntuaciones de sesión
+		if err := rescorePilotSessions(tx, gpIndex, rs, &result); err != nil {
+			return fmt.Errorf("error repuntuando sesiones: %v", err)
+		}
+		if err := rescoreTrackEngineers(tx, gpIndex, &result); err != nil {
+			return fmt.Errorf("error repuntuando track engineers: %v", err)
+		}
+		if err := storeGPLineItems(tx, gpIndex); err != nil {
+			return fmt.Errorf("error guardando el desglose de puntos: %v", err)
+		}
+
+		// 2. Puntos de cada alineación del GP
+		var lineups []models.Lineup
+		if err := tx.Where("gp_index = ?", gpIndex).Find(&lineups).Error; err != nil {
+			return fmt.Errorf("error obteniendo alineaciones: %v", err)
+		}
+		type playerKey struct{ PlayerID, LeagueID uint64 }
+		affected := make(map[playerKey]bool)
+		for _, lineup := range lineups {
+			points := calculatePlayerTotalPoints(tx, lineup.PlayerID, lineup.LeagueID, gpIndex)
+			if points != lineup.LineupPoints {
+				result.Lineups = append(result.Lineups, scoreChange{
+					ID: uint(lineup.ID), PlayerID: uint(lineup.PlayerID), LeagueID: uint(lineup.LeagueID),
+					Old: lineup.LineupPoints, New: points,
+				})
+				if err := tx.Model(&models.Lineup{}).Where("id = ?", lineup.ID).Update("lineup_points", points).Error; err != nil {
+					return fmt.Errorf("error guardando alineación %d: %v", lineup.ID, err)
+				}
+			}
+			if err := syncPlayerPointsByGP(tx, lineup.PlayerID, lineup.LeagueID, gpIndex, points); err != nil {
+				return fmt.Errorf("error guardando puntos por GP del jugador %d: %v", lineup.PlayerID, err)
+			}
+			affected[playerKey{lineup.PlayerID, lineup.LeagueID}] = true
+		}
+		result.LineupsChecked = len(lineups)
+
+		// 3. Total de temporada de cada jugador afectado
+		for key := range affected {
+			var pbl models.PlayerByLeague
+			if err := tx.Where("player_id = ? AND league_id = ?", key.PlayerID, key.LeagueID).First(&pbl).Error; err != nil {
+				continue
+			}
+			total := playerSeasonPoints(tx, key.PlayerID, key.LeagueID)
+			if total != pbl.TotalPoints {
+				result.Players = append(result.Players, scoreChange{
+					ID: uint(pbl.ID), PlayerID: uint(key.PlayerID), LeagueID: uint(key.LeagueID),
+					Old: pbl.TotalPoints, New: total,
+				})
+				if err := tx.Model(&models.PlayerByLeague{}).Where("id = ?", pbl.ID).Update("total_points", total).Error; err != nil {
+					return fmt.Errorf("error guardando total del jugador %d: %v", key.PlayerID, err)
+				}
+			}
+		}
+		result.PlayersChecked = len(affected)
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	log.Printf("[RESCORE] GP %d repuntuado con reglas v%d: %d sesiones, %d equipos, %d track engineers, %d alineaciones y %d jugadores cambiados",
+		gpIndex, rs.Version, len(result.Sessions), len(result.Teams), len(result.TrackEngineers), len(result.Lineups), len(result.Players))
+	return result, nil
+}
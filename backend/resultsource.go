@@ -0,0 +1,347 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"f1-fantasy-app/database"
+	"f1-fantasy-app/models"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// errSessionNotAvailable indica que la fuente no tiene resultados de la sesión
+var errSessionNotAvailable = errors.New("sesión no disponible")
+
+// Páginas de resultados que no son una sesión del horario
+const (
+	resultsPitStops    = "pit_stops"
+	resultsFastestLaps = "fastest_laps"
+)
+
+// ResultsSource es de donde el scraper lee las páginas de resultados de un GP.
+// Las sesiones usan los nombres del horario del GP (fp1, qualifying, race...)
+// más pit_stops y fastest_laps para los resúmenes de carrera.
+type ResultsSource interface {
+	// Fetch devuelve el documento de la sesión y su origen (URL o fichero).
+	// Devuelve errSessionNotAvailable si la sesión aún no tiene resultados.
+	Fetch(gpKey, session string) (*goquery.Document, string, error)
+}
+
+// newResultsSource devuelve la fuente configurada: los ficheros de
+// SCRAPER_RESULTS_DIR si está definida o formula1.com si no. season es la
+// temporada de formula1.com; 0 usa el año de inicio de cada GP.
+func newResultsSource(season int) ResultsSource {
+	if dir := os.Getenv("SCRAPER_RESULTS_DIR"); dir != "" {
+		log.Printf("[SCRAPER] Leyendo resultados de ficheros en %s", dir)
+		return fileResultsSource{Dir: dir}
+	}
+	return newHTTPResultsSource(season)
+}
+
+// gpResultsPath es la ruta de un GP en formula1.com:
+// /en/results/<Season>/races/<RaceID>/<Slug>
+type gpResultsPath struct {
+	Season int
+	RaceID string
+	Slug   string
+}
+
+func (p gpResultsPath) baseURL() string {
+	return fmt.Sprintf("https://www.formula1.com/en/results/%d/races/%s/%s", p.Season, p.RaceID, p.Slug)
+}
+
+// httpResultsSource descarga los resultados de formula1.com
+type httpResultsSource struct {
+	client *http.Client
+	season int
+
+	mu      sync.Mutex
+	paths   map[string]gpResultsPath // Ruta resuelta por gpKey
+	indexes map[int][]seasonRace     // Índice de carreras por temporada
+}
+
+func newHTTPResultsSource(season int) *httpResultsSource {
+	return &httpResultsSource{
+		client:  &http.Client{Timeout: 30 * time.Second},
+		season:  season,
+		paths:   make(map[string]gpResultsPath),
+		indexes: make(map[int][]seasonRace),
+	}
+}
+
+// get descarga y parsea una página; errSessionNotAvailable si no existe
+func (s *httpResultsSource) get(url string) (*goquery.Document, error) {
+	resp, err := s.client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		log.Printf("[SCRAPER] %s: Status %d (no válido)", url, resp.StatusCode)
+		return nil, errSessionNotAvailable
+	}
+	return goquery.NewDocumentFromReader(resp.Body)
+}
+
+// seasonRaces descarga una sola vez el índice de carreras de una temporada
+func (s *httpResultsSource) seasonRaces(season int) ([]seasonRace, error) {
+	if races, ok := s.indexes[season]; ok {
+		return races, nil
+	}
+	url := fmt.Sprintf("https://www.formula1.com/en/results/%d/races", season)
+	log.Printf("[SCRAPER] Descargando índice de carreras: %s", url)
+	doc, err := s.get(url)
+	if err != nil {
+		return nil, fmt.Errorf("error descargando índice de la temporada %d: %v", season, err)
+	}
+	races := parseSeasonRaceIndex(doc, season)
+	if len(races) == 0 {
+		return nil, fmt.Errorf("el índice de la temporada %d no tiene carreras", season)
+	}
+	s.indexes[season] = races
+	return races, nil
+}
+
+// gpPath resuelve la ruta de un GP. Se usa la guardada en el GP si es de la
+// temporada pedida; si no, se busca en el índice de la temporada y se guarda.
+func (s *httpResultsSource) gpPath(gpKey string) (gpResultsPath, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if path, ok := s.paths[gpKey]; ok {
+		return path, nil
+	}
+
+	gpIndex, err := getGPIndexFromKey(gpKey)
+	if err != nil {
+		return gpResultsPath{}, err
+	}
+	var gp models.GrandPrix
+	if err := database.DB.Where("gp_index = ?", gpIndex).First(&gp).Error; err != nil {
+		return gpResultsPath{}, fmt.Errorf("GP %d no encontrado: %v", gpIndex, err)
+	}
+
+	season := s.season
+	if season == 0 {
+		season = gp.StartDate.Year()
+	}
+	if gp.ResultsSeason == season && gp.ResultsRaceID != "" && gp.ResultsSlug != "" {
+		path := gpResultsPath{Season: season, RaceID: gp.ResultsRaceID, Slug: gp.ResultsSlug}
+		s.paths[gpKey] = path
+		return path, nil
+	}
+
+	races, err := s.seasonRaces(season)
+	if err != nil {
+		return gpResultsPath{}, err
+	}
+	race, ok := matchSeasonRace(races, gpSlugCandidates(gpKey, gp))
+	if !ok {
+		return gpResultsPath{}, fmt.Errorf("%s no aparece en el índice de la temporada %d", gp.Name, season)
+	}
+	path := gpResultsPath{Season: season, RaceID: race.ID, Slug: race.Slug}
+	if err := database.DB.Model(&models.GrandPrix{}).Where("gp_index = ?", gp.GPIndex).Updates(map[string]interface{}{
+		"results_season":  path.Season,
+		"results_race_id": path.RaceID,
+		"results_slug":    path.Slug,
+	}).Error; err != nil {
+		log.Printf("[SCRAPER] Error guardando la ruta de %s: %v", gp.Name, err)
+	}
+	log.Printf("[SCRAPER] Ruta de %s resuelta: %s", gp.Name, path.baseURL())
+	s.paths[gpKey] = path
+	return path, nil
+}
+
+// sessionURLs devuelve las URLs candidatas de una sesión, en orden
+func sessionURLs(path gpResultsPath, session string) []string {
+	base := path.baseURL()
+	switch session {
+	case sessionQualifying:
+		return []string{base + "/qualifying"}
+	case sessionRace:
+		return []string{base + "/race-result", base + "/race"}
+	case sessionSprintQualifying:
+		return []string{base + "/sprint-qualifying"}
+	case sessionSprint:
+		return []string{base + "/sprint-results"}
+	case sessionFP1:
+		return []string{base + "/practice/1"}
+	case sessionFP2:
+		return []string{base + "/practice/2"}
+	case sessionFP3:
+		return []string{base + "/practice/3"}
+	case resultsPitStops:
+		return []string{base + "/pit-stop-summary"}
+	case resultsFastestLaps:
+		return []string{base + "/fastest-laps"}
+	}
+	return nil
+}
+
+func (s *httpResultsSource) Fetch(gpKey, session string) (*goquery.Document, string, error) {
+	path, err := s.gpPath(gpKey)
+	if err != nil {
+		return nil, "", err
+	}
+	urls := sessionURLs(path, session)
+	if len(urls) == 0 {
+		return nil, "", fmt.Errorf("sesión de resultados desconocida: %s", session)
+	}
+	for _, url := range urls {
+		log.Printf("[SCRAPER] Intentando %s: %s", session, url)
+		doc, err := s.get(url)
+		if err != nil {
+			log.Printf("[SCRAPER] %s no válido: %v", session, err)
+			continue
+		}
+		log.Printf("[SCRAPER] %s: HTML parseado correctamente", session)
+		return doc, url, nil
+	}
+	return nil, "", errSessionNotAvailable
+}
+
+// fileResultsSource lee páginas de resultados guardadas en disco con la
+// estructura <Dir>/<gpKey>/<sesión>.html
+type fileResultsSource struct {
+	Dir string
+}
+
+func (s fileResultsSource) Fetch(gpKey, session string) (*goquery.Document, string, error) {
+	path := filepath.Join(s.Dir, gpKey, session+".html")
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, path, errSessionNotAvailable
+		}
+		return nil, path, err
+	}
+	defer f.Close()
+	doc, err := goquery.NewDocumentFromReader(f)
+	if err != nil {
+		return nil, path, fmt.Errorf("error parseando %s: %v", path, err)
+	}
+	return doc, path, nil
+}
+
+// seasonRace es una carrera del índice de resultados de una temporada
+type seasonRace struct {
+	ID   string
+	Slug string
+}
+
+// parseSeasonRaceIndex extrae las carreras de /en/results/<season>/races a
+// partir de sus enlaces, en el orden en que aparecen
+func parseSeasonRaceIndex(doc *goquery.Document, season int) []seasonRace {
+	pattern := regexp.MustCompile(fmt.Sprintf(`/results/%d/races/(\d+)/([a-z0-9-]+)`, season))
+	var races []seasonRace
+	seen := make(map[string]bool)
+	doc.Find("a[href]").Each(func(i int, s *goquery.Selection) {
+		href, _ := s.Attr("href")
+		m := pattern.FindStringSubmatch(href)
+		if len(m) != 3 || seen[m[1]] {
+			return
+		}
+		seen[m[1]] = true
+		races = append(races, seasonRace{ID: m[1], Slug: m[2]})
+	})
+	return races
+}
+
+// gpNameSlug es el slug del nombre de un GP sin "Grand Prix"
+func gpNameSlug(gp models.GrandPrix) string {
+	return slugify(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(gp.Name), "Grand Prix")))
+}
+
+// gpSlugCandidates devuelve los slugs con los que puede aparecer un GP en el
+// índice, del más al menos fiable: el de su clave, el de su nombre sin "Grand
+// Prix" y el de su país
+func gpSlugCandidates(gpKey string, gp models.GrandPrix) []string {
+	var candidates []string
+	for _, slug := range []string{getGPSlugFromKey(gpKey), gpNameSlug(gp), slugify(gp.Country)} {
+		if slug != "" && !containsString(candidates, slug) {
+			candidates = append(candidates, slug)
+		}
+	}
+	return candidates
+}
+
+// matchSeasonRace busca en el índice la primera carrera con alguno de los
+// slugs candidatos
+func matchSeasonRace(races []seasonRace, candidates []string) (seasonRace, bool) {
+	for _, slug := range candidates {
+		for _, race := range races {
+			if race.Slug == slug {
+				return race, true
+			}
+		}
+	}
+	return seasonRace{}, false
+}
+
+// Obtener el índice del GP desde la clave. La clave se resuelve contra
+// f1_grand_prixes (ver matchGPKey).
+func getGPIndexFromKey(gpKey string) (uint64, error) {
+	var gps []models.GrandPrix
+	if err := database.DB.Order("gp_index ASC").Find(&gps).Error; err != nil {
+		return 0, fmt.Errorf("error cargando los GPs: %v", err)
+	}
+	gp, ok := matchGPKey(gps, gpKey)
+	if !ok {
+		return 0, fmt.Errorf("clave de GP no válida: %s", gpKey)
+	}
+	log.Printf("[SCRAPER] Clave '%s' resuelta: %s (índice %d)", gpKey, gp.Name, gp.GPIndex)
+	return gp.GPIndex, nil
+}
+
+// gpKeySlugs devuelve las formas de slug de una clave de GP (ej.:
+// "japanese_grand_prix" -> "japanese" y "japan")
+func gpKeySlugs(gpKey string) []string {
+	key := strings.ToLower(strings.TrimSpace(gpKey))
+	key = strings.ReplaceAll(key, "-", "_")
+	key = strings.TrimSuffix(key, "_grand_prix")
+	var slugs []string
+	for _, slug := range []string{strings.ReplaceAll(key, "_", "-"), getGPSlugFromKey(key)} {
+		if slug != "" && !containsString(slugs, slug) {
+			slugs = append(slugs, slug)
+		}
+	}
+	return slugs
+}
+
+// matchGPKey busca el GP de una clave, del criterio más al menos fiable: el id
+// de carrera de formula1.com guardado en el GP, su slug de resultados, el slug
+// de su nombre sin "Grand Prix" y el de su país si ningún otro GP lo comparte
+func matchGPKey(gps []models.GrandPrix, gpKey string) (models.GrandPrix, bool) {
+	key := strings.TrimSpace(gpKey)
+	slugs := gpKeySlugs(gpKey)
+	byCountry := make(map[string][]models.GrandPrix)
+	for _, gp := range gps {
+		byCountry[slugify(gp.Country)] = append(byCountry[slugify(gp.Country)], gp)
+	}
+
+	matchers := []func(models.GrandPrix) bool{
+		func(gp models.GrandPrix) bool { return gp.ResultsRaceID != "" && gp.ResultsRaceID == key },
+		func(gp models.GrandPrix) bool { return gp.ResultsSlug != "" && containsString(slugs, gp.ResultsSlug) },
+		func(gp models.GrandPrix) bool { return containsString(slugs, gpNameSlug(gp)) },
+		func(gp models.GrandPrix) bool {
+			country := slugify(gp.Country)
+			return country != "" && len(byCountry[country]) == 1 && containsString(slugs, country)
+		},
+	}
+	for _, match := range matchers {
+		for _, gp := range gps {
+			if match(gp) {
+				return gp, true
+			}
+		}
+	}
+	return models.GrandPrix{}, false
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"f1-fantasy-app/database"
+	"f1-fantasy-app/models"
+)
+
+// Intervalo entre ejecuciones del planificador
+const schedulerInterval = time.Minute
+
+// Trabajos que el planificador ejecuta para cada liga
+const (
+	jobSettleAuctions = "settle_auctions"
+	jobMarketRefresh  = "market_refresh"
+	jobExpireOffers   = "expire_offers"
+	jobCarryOver      = "lineup_carry_over"
+	jobValuation      = "valuation" // Global, se guarda con league_id 0
+)
+
+// startScheduler arranca en segundo plano el planificador que cierra subastas,
+// refresca mercados y caduca ofertas sin necesidad de que un cliente lo pida.
+func startScheduler() {
+	log.Printf("[SCHEDULER] Iniciando planificador (intervalo %v)", schedulerInterval)
+	go func() {
+		runSchedulerTick()
+		ticker := time.NewTicker(schedulerInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			runSchedulerTick()
+		}
+	}()
+}
+
+// runSchedulerTick ejecuta una pasada de todos los trabajos para todas las ligas
+func runSchedulerTick() {
+	runGlobalJobs(time.Now())
+
+	var leagues []models.League
+	if err := database.DB.Find(&leagues).Error; err != nil {
+		log.Printf("[SCHEDULER] Error obteniendo ligas: %v", err)
+		return
+	}
+	for _, league := range leagues {
+		runLeagueJobs(league)
+	}
+}
+
+// runLeagueJobs ejecuta los trabajos de una liga. Un panic en una liga no
+// detiene el planificador para el resto.
+func runLeagueJobs(league models.League) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[SCHEDULER] PANIC RECUPERADO en liga %d: %v", league.ID, r)
+		}
+	}()
+
+	now := time.Now()
+
+	// 1. Cerrar subastas expiradas
+	settled, err := settleExpiredAuctions(league.ID, now)
+	if settled > 0 {
+		log.Printf("[SCHEDULER] Liga %d: %d subastas finalizadas", league.ID, settled)
+	}
+	recordJobRun(league.ID, jobSettleAuctions, now, nil, err)
+
+	// 2. Refrescar el mercado si ha pasado la fecha de refresco
+	if league.MarketNextRefresh == nil || !league.MarketNextRefresh.After(now) {
+		log.Printf("[SCHEDULER] Liga %d: refrescando mercado", league.ID)
+		err := refreshMarketForLeague(league.ID)
+		updateMarketNextRefresh(league.ID, err)
+	}
+
+	// 3. Caducar ventas y ofertas de la liga vencidas
+	expired, err := expireLeagueOffers(league.ID, now)
+	if expired > 0 {
+		log.Printf("[SCHEDULER] Liga %d: %d ventas/ofertas caducadas", league.ID, expired)
+	}
+	recordJobRun(league.ID, jobExpireOffers, now, nil, err)
+
+	// 4. Copiar la alineación anterior a quien no guardó la del GP bloqueado
+	runCarryOver(league.ID, now)
+}
+
+// runCarryOver ejecuta la copia de alineaciones una vez por GP: al bloquearse
+// la alineación de un GP y, después, en cuanto se bloquee el siguiente
+func runCarryOver(leagueID uint, now time.Time) {
+	var state models.SchedulerJobState
+	if err := database.DB.Where("league_id = ? AND job = ?", leagueID, jobCarryOver).First(&state).Error; err == nil && state.NextRunAt != nil && state.NextRunAt.After(now) {
+		return
+	}
+	locked, next := lockedGP(now)
+	if next == nil {
+		// Sin más GPs en el calendario, volver a mirar en un día
+		later := now.Add(24 * time.Hour)
+		next = &later
+	}
+	if locked == nil || !locked.lastStart().Add(carryOverWindow).After(now) {
+		recordJobRun(leagueID, jobCarryOver, now, next, nil)
+		return
+	}
+	created, err := carryOverLineups(leagueID, locked.GP)
+	if created > 0 {
+		log.Printf("[SCHEDULER] Liga %d: %d alineaciones copiadas al GP %d", leagueID, created, locked.GP.GPIndex)
+	}
+	recordJobRun(leagueID, jobCarryOver, now, next, err)
+}
+
+// runGlobalJobs ejecuta los trabajos que no dependen de una liga, como la
+// valoración diaria de pilotos, ingenieros y constructores
+func runGlobalJobs(now time.Time) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[SCHEDULER] PANIC RECUPERADO en trabajos globales: %v", r)
+		}
+	}()
+
+	var state models.SchedulerJobState
+	if err := database.DB.Where("league_id = ? AND job = ?", 0, jobValuation).First(&state).Error; err == nil && state.NextRunAt != nil && state.NextRunAt.After(now) {
+		return
+	}
+	log.Printf("[SCHEDULER] Ejecutando valoración diaria")
+	_, err := runValuation(now)
+	next := now.Add(24 * time.Hour)
+	recordJobRun(0, jobValuation, now, &next, err)
+}
+
+// settleExpiredAuctions finaliza las subastas de la liga cuyo end_time ya pasó.
+// Las que fallan por un error de base de datos se quedan para la siguiente
+// pasada; las que se cierran sin ganador desaparecen y su motivo se guarda una
+// sola vez como error del trabajo.
+func settleExpiredAuctions(leagueID uint, now time.Time) (int, error) {
+	var auctions []Auction
+	if err := database.DB.Where("league_id = ? AND end_time <= ?", leagueID, now).Find(&auctions).Error; err != nil {
+		return 0, err
+	}
+
+	settled := 0
+	var lastErr error
+	for _, auction := range auctions {
+		result, err := settleAuction(auction)
+		if err != nil {
+			log.Printf("[SCHEDULER] Error finalizando subasta %d: %v", auction.ID, err)
+			lastErr = err
+			continue
+		}
+		if result != nil && result.Failure != "" {
+			lastErr = fmt.Errorf("subasta %d cerrada sin adjudicar: %s", auction.ID, result.Failure)
+			continue
+		}
+		if result != nil {
+			settled++
+		}
+	}
+	return settled, lastErr
+}
+
+// expireLeagueOffers limpia las ventas (venta_expires_at) y las ofertas de la
+// liga (league_offer_expires_at) caducadas en las cuatro tablas por liga.
+func expireLeagueOffers(leagueID uint, now time.Time) (int64, error) {
+	tables := []string{
+		models.PilotByLeague{}.TableName(),
+		models.TrackEngineerByLeague{}.TableName(),
+		models.ChiefEngineerByLeague{}.TableName(),
+		models.TeamConstructorByLeague{}.TableName(),
+	}
+
+	var total int64
+	for _, table := range tables {
+		res := database.DB.Table(table).
+			Where("league_id = ? AND venta IS NOT NULL AND venta_expires_at <= ?", leagueID, now).
+			Updates(map[string]interface{}{
+				"venta":                   nil,
+				"venta_expires_at":        nil,
+				"league_offer_value":      nil,
+				"league_offer_expires_at": nil,
+			})
+		if res.Error != nil {
+			return total, fmt.Errorf("caducando ventas en %s: %v", table, res.Error)
+		}
+		total += res.RowsAffected
+
+		res = database.DB.Table(table).
+			Where("league_id = ? AND league_offer_value IS NOT NULL AND league_offer_expires_at <= ?", leagueID, now).
+			Updates(map[string]interface{}{
+				"league_offer_value":      nil,
+				"league_offer_expires_at": nil,
+			})
+		if res.Error != nil {
+			return total, fmt.Errorf("caducando ofertas de la liga en %s: %v", table, res.Error)
+		}
+		total += res.RowsAffected
+	}
+	return total, nil
+}
+
+// updateMarketNextRefresh reinicia el contador de refresco del mercado de una
+// liga y lo guarda en la base de datos junto con el resultado del refresco.
+func updateMarketNextRefresh(leagueID uint, refreshErr error) time.Time {
+	next := nextMarketRefresh(loadLeagueSettings(database.DB, leagueID))
+	if err := database.DB.Model(&models.League{}).Where("id = ?", leagueID).Update("market_next_refresh", next).Error; err != nil {
+		log.Printf("[SCHEDULER] Error guardando market_next_refresh para liga %d: %v", leagueID, err)
+	}
+	recordJobRun(leagueID, jobMarketRefresh, time.Now(), &next, refreshErr)
+	return next
+}
+
+// recordJobRun guarda el estado de la última ejecución de un trabajo
+func recordJobRun(leagueID uint, job string, ranAt time.Time, next *time.Time, jobErr error) {
+	var state models.SchedulerJobState
+	if err := database.DB.Where("league_id = ? AND job = ?", leagueID, job).First(&state).Error; err != nil {
+		state = models.SchedulerJobState{LeagueID: leagueID, Job: job}
+	}
+	state.LastRunAt = &ranAt
+	if next != nil {
+		state.NextRunAt = next
+	}
+	state.LastError = ""
+	if jobErr != nil {
+		state.LastError = jobErr.Error()
+	}
+	state.RunCount++
+	if err := database.DB.Save(&state).Error; err != nil {
+		log.Printf("[SCHEDULER] Error guardando estado del trabajo %s en liga %d: %v", job, leagueID, err)
+	}
+}
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"f1-fantasy-app/database"
+	"f1-fantasy-app/models"
+
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// Reglas de puntuación incluidas en el binario. Se pueden añadir versiones
+// nuevas en el directorio indicado por SCORING_RULESETS_DIR.
+//
+//go:embed rulesets/*.yaml
+var embeddedRulesets embed.FS
+
+// ScoringPositions son los puntos por posición final de cada sesión (índice 0 = P1)
+type ScoringPositions struct {
+	Race        []int `json:"race" yaml:"race"`
+	Qualy       []int `json:"qualy" yaml:"qualy"`
+	Practice    []int `json:"practice" yaml:"practice"`
+	Team        []int `json:"team" yaml:"team"`
+	Sprint      []int `json:"sprint" yaml:"sprint"`             // Opcional: sin tabla la sprint no puntúa por posición
+	SprintQualy []int `json:"sprint_qualy" yaml:"sprint_qualy"` // Opcional: sin tabla la sprint qualifying no puntúa por posición
+}
+
+// ScoringRaceBonuses son las bonificaciones y penalizaciones de carrera
+type ScoringRaceBonuses struct {
+	PositionsGainedAtStart int `json:"positions_gained_at_start" yaml:"positions_gained_at_start"`
+	CleanOvertake          int `json:"clean_overtake" yaml:"clean_overtake"`
+	NetPositionLost        int `json:"net_position_lost" yaml:"net_position_lost"`
+	FastestLap             int `json:"fastest_lap" yaml:"fastest_lap"`
+	FastestLapMaxPosition  int `json:"fastest_lap_max_position" yaml:"fastest_lap_max_position"`
+	CausedVSC              int `json:"caused_vsc" yaml:"caused_vsc"`
+	CausedSC               int `json:"caused_sc" yaml:"caused_sc"`
+	CausedRedFlag          int `json:"caused_red_flag" yaml:"caused_red_flag"`
+	DNFDriverError         int `json:"dnf_driver_error" yaml:"dnf_driver_error"`
+	DNFNoFault             int `json:"dnf_no_fault" yaml:"dnf_no_fault"`
+}
+
+// ScoringTeamBonuses son las bonificaciones de los equipos en carrera
+type ScoringTeamBonuses struct {
+	FastestPitstop int `json:"fastest_pitstop" yaml:"fastest_pitstop"` // Opcional: equipo con la parada más rápida del GP
+}
+
+// ScoringRuleset es una versión completa de las reglas de puntuación
+type ScoringRuleset struct {
+	Version             int                `json:"version" yaml:"version"`
+	Name                string             `json:"name" yaml:"name"`
+	Positions           ScoringPositions   `json:"positions" yaml:"positions"`
+	DeltaMultiplier     int                `json:"delta_multiplier" yaml:"delta_multiplier"`
+	TeamDeltaMultiplier int                `json:"team_delta_multiplier" yaml:"team_delta_multiplier"`
+	Race                ScoringRaceBonuses `json:"race" yaml:"race"`
+	Team                ScoringTeamBonuses `json:"team" yaml:"team"`
+}
+
+var (
+	scoringRulesets     map[int]ScoringRuleset
+	scoringRulesetsOnce sync.Once
+)
+
+// parseScoringRuleset interpreta un ruleset en JSON o YAML según la extensión
+func parseScoringRuleset(name string, data []byte) (ScoringRuleset, error) {
+	var rs ScoringRuleset
+	var err error
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json":
+		err = json.Unmarshal(data, &rs)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &rs)
+	default:
+		return rs, fmt.Errorf("extensión no soportada: %s", name)
+	}
+	if err != nil {
+		return rs, fmt.Errorf("error leyendo %s: %v", name, err)
+	}
+	if rs.Version < 1 {
+		return rs, fmt.Errorf("%s: version debe ser mayor que 0", name)
+	}
+	if len(rs.Positions.Race) == 0 || len(rs.Positions.Qualy) == 0 || len(rs.Positions.Practice) == 0 || len(rs.Positions.Team) == 0 {
+		return rs, fmt.Errorf("%s: faltan puntos por posición", name)
+	}
+	return rs, nil
+}
+
+// loadScoringRulesets carga los rulesets incluidos y los del directorio externo
+func loadScoringRulesets() map[int]ScoringRuleset {
+	scoringRulesetsOnce.Do(func() {
+		scoringRulesets = make(map[int]ScoringRuleset)
+		add := func(name string, data []byte) {
+			rs, err := parseScoringRuleset(name, data)
+			if err != nil {
+				log.Printf("[SCORING] %v", err)
+				return
+			}
+			if _, exists := scoringRulesets[rs.Version]; exists {
+				log.Printf("[SCORING] Versión %d repetida en %s, se sustituye", rs.Version, name)
+			}
+			scoringRulesets[rs.Version] = rs
+		}
+
+		entries, _ := embeddedRulesets.ReadDir("rulesets")
+		for _, entry := range entries {
+			data, err := embeddedRulesets.ReadFile("rulesets/" + entry.Name())
+			if err == nil {
+				add(entry.Name(), data)
+			}
+		}
+		if dir := os.Getenv("SCORING_RULESETS_DIR"); dir != "" {
+			files, _ := os.ReadDir(dir)
+			for _, f := range files {
+				if data, err := os.ReadFile(filepath.Join(dir, f.Name())); err == nil {
+					add(f.Name(), data)
+				}
+			}
+		}
+		log.Printf("[SCORING] %d versiones de reglas cargadas (activa: %d)", len(scoringRulesets), latestVersion(scoringRulesets))
+	})
+	return scoringRulesets
+}
+
+// latestVersion devuelve la versión más alta de un conjunto de rulesets
+func latestVersion(rulesets map[int]ScoringRuleset) int {
+	latest := 0
+	for v := range rulesets {
+		if v > latest {
+			latest = v
+		}
+	}
+	return latest
+}
+
+// scoringVersions devuelve las versiones disponibles ordenadas
+func scoringVersions() []int {
+	versions := []int{}
+	for v := range loadScoringRulesets() {
+		versions = append(versions, v)
+	}
+	sort.Ints(versions)
+	return versions
+}
+
+// activeScoringVersion es la versión con la que se puntúan los resultados nuevos
+func activeScoringVersion() int {
+	return latestVersion(loadScoringRulesets())
+}
+
+// scoringRuleset devuelve una versión concreta o la activa si no existe
+func scoringRuleset(version int) ScoringRuleset {
+	rulesets := loadScoringRulesets()
+	if rs, ok := rulesets[version]; ok {
+		return rs
+	}
+	return rulesets[latestVersion(rulesets)]
+}
+
+// activeScoringRuleset devuelve las reglas con las que se puntúan los resultados nuevos
+func activeScoringRuleset() ScoringRuleset {
+	return scoringRuleset(activeScoringVersion())
+}
+
+// leagueScoringRuleset devuelve las reglas fijadas por una liga
+func leagueScoringRuleset(leagueID uint) ScoringRuleset {
+	var league models.League
+	if err := database.DB.Select("id", "scoring_version").First(&league, leagueID).Error; err != nil {
+		return activeScoringRuleset()
+	}
+	return scoringRuleset(league.ScoringVersion)
+}
+
+// pointsAt devuelve los puntos de una tabla por posición (1 = primera)
+func pointsAt(table []int, position int) int {
+	if position < 1 || position > len(table) {
+		return 0
+	}
+	return table[position-1]
+}
+
+// PositionPoints devuelve los puntos por posición final según el modo del piloto
+func (rs ScoringRuleset) PositionPoints(mode string, position int) int {
+	switch mode {
+	case "race", "R":
+		return pointsAt(rs.Positions.Race, position)
+	case "qualy", "Q":
+		return pointsAt(rs.Positions.Qualy, position)
+	case "practice", "P":
+		return pointsAt(rs.Positions.Practice, position)
+	case "sprint":
+		return pointsAt(rs.Positions.Sprint, position)
+	case "sprint_qualy":
+		return pointsAt(rs.Positions.SprintQualy, position)
+	}
+	return 0
+}
+
+// TeamPositionPoints devuelve los puntos por posición final de un equipo
+func (rs ScoringRuleset) TeamPositionPoints(position int) int {
+	return pointsAt(rs.Positions.Team, position)
+}
+
+// Reglas que aparecen en el desglose de puntos
+const (
+	ruleDelta                  = "delta"
+	rulePosition               = "position"
+	rulePositionsGainedAtStart = "positions_gained_at_start"
+	ruleCleanOvertakes         = "clean_overtakes"
+	ruleNetPositionsLost       = "net_positions_lost"
+	ruleFastestLap             = "fastest_lap"
+	ruleFastestPitstop         = "fastest_pitstop"
+	ruleCausedVSC              = "caused_vsc"
+	ruleCausedSC               = "caused_sc"
+	ruleCausedRedFlag          = "caused_red_flag"
+	ruleDNFDriverError         = "dnf_driver_error"
+	ruleDNFNoFault             = "dnf_no_fault"
+	ruleTrackEngineer          = "track_engineer_multiplier"
+	ruleCaptainMultiplier      = "captain_multiplier"
+	ruleChip                   = "chip"
+	ruleManualAdjustment       = "manual_adjustment"
+)
+
+// lineItem crea una línea del desglose; las que no suman puntos se omiten
+func lineItem(items []models.PointsLineItem, rule string, quantity, points int, detail string) []models.PointsLineItem {
+	if points == 0 {
+		return items
+	}
+	return append(items, models.PointsLineItem{Rule: rule, Quantity: quantity, Points: points, Detail: detail})
+}
+
+// sumLineItems suma los puntos de un desglose
+func sumLineItems(items []models.PointsLineItem) int {
+	total := 0
+	for _, item := range items {
+		total += item.Points
+	}
+	return total
+}
+
+// positionLineItems devuelve las líneas comunes a todas las sesiones: delta y posición final
+func (rs ScoringRuleset) positionLineItems(mode string, delta, finishPosition, deltaMultiplier int) []models.PointsLineItem {
+	items := lineItem(nil, ruleDelta, delta, delta*deltaMultiplier, fmt.Sprintf("%+d posiciones respecto a la esperada", delta))
+	points := rs.PositionPoints(mode, finishPosition)
+	if mode == "team" {
+		points = rs.TeamPositionPoints(finishPosition)
+	}
+	return lineItem(items, rulePosition, finishPosition, points, fmt.Sprintf("P%d", finishPosition))
+}
+
+// BreakdownPilotRace desglosa los puntos de carrera de un piloto
+func (rs ScoringRuleset) BreakdownPilotRace(race models.PilotRace) []models.PointsLineItem {
+	b := rs.Race
+	items := rs.positionLineItems("R", race.DeltaPosition, race.FinishPosition, rs.DeltaMultiplier)
+	items = lineItem(items, rulePositionsGainedAtStart, race.PositionsGainedAtStart, race.PositionsGainedAtStart*b.PositionsGainedAtStart,
+		fmt.Sprintf("%d × %+d", race.PositionsGainedAtStart, b.PositionsGainedAtStart))
+	items = lineItem(items, ruleCleanOvertakes, race.CleanOvertakes, race.CleanOvertakes*b.CleanOvertake,
+		fmt.Sprintf("%d × %+d", race.CleanOvertakes, b.CleanOvertake))
+	items = lineItem(items, ruleNetPositionsLost, race.NetPositionsLost, race.NetPositionsLost*b.NetPositionLost,
+		fmt.Sprintf("%d × %+d", race.NetPositionsLost, b.NetPositionLost))
+	if race.FastestLap && race.FinishPosition <= b.FastestLapMaxPosition {
+		items = lineItem(items, ruleFastestLap, 1, b.FastestLap, fmt.Sprintf("Vuelta rápida terminando en el top %d", b.FastestLapMaxPosition))
+	}
+	flags := []struct {
+		set    bool
+		rule   string
+		points int
+		detail string
+	}{
+		{race.CausedVSC, ruleCausedVSC, b.CausedVSC, "Provocó un VSC"},
+		{race.CausedSC, ruleCausedSC, b.CausedSC, "Provocó un Safety Car"},
+		{race.CausedRedFlag, ruleCausedRedFlag, b.CausedRedFlag, "Provocó una bandera roja"},
+		{race.DNFDriverError, ruleDNFDriverError, b.DNFDriverError, "Abandono por error del piloto"},
+		{race.DNFNoFault, ruleDNFNoFault, b.DNFNoFault, "Abandono sin culpa del piloto"},
+	}
+	for _, f := range flags {
+		if f.set {
+			items = lineItem(items, f.rule, 1, f.points, f.detail)
+		}
+	}
+	return items
+}
+
+// redFlagLineItem añade la penalización por bandera roja, que cuenta en cualquier sesión
+func (rs ScoringRuleset) redFlagLineItem(items []models.PointsLineItem, causedRedFlag bool) []models.PointsLineItem {
+	if !causedRedFlag {
+		return items
+	}
+	return lineItem(items, ruleCausedRedFlag, 1, rs.Race.CausedRedFlag, "Provocó una bandera roja")
+}
+
+// BreakdownPilotQualy desglosa los puntos de clasificación de un piloto: delta,
+// posición y bandera roja
+func (rs ScoringRuleset) BreakdownPilotQualy(qualy models.PilotQualy) []models.PointsLineItem {
+	items := rs.positionLineItems("Q", qualy.DeltaPosition, qualy.FinishPosition, rs.DeltaMultiplier)
+	return rs.redFlagLineItem(items, qualy.CausedRedFlag)
+}
+
+// BreakdownPilotPractice desglosa los puntos de libres de un piloto: delta,
+// posición y bandera roja
+func (rs ScoringRuleset) BreakdownPilotPractice(practice models.PilotPractice) []models.PointsLineItem {
+	items := rs.positionLineItems("P", practice.DeltaPosition, practice.FinishPosition, rs.DeltaMultiplier)
+	return rs.redFlagLineItem(items, practice.CausedRedFlag)
+}
+
+// BreakdownPilotSprint desglosa los puntos de sprint de un piloto: delta,
+// posición y las mismas penalizaciones de carrera por bandera roja y abandono
+func (rs ScoringRuleset) BreakdownPilotSprint(sprint models.PilotSprint) []models.PointsLineItem {
+	b := rs.Race
+	items := rs.positionLineItems("sprint", sprint.DeltaPosition, sprint.FinishPosition, rs.DeltaMultiplier)
+	items = rs.redFlagLineItem(items, sprint.CausedRedFlag)
+	if sprint.DNFDriverError {
+		items = lineItem(items, ruleDNFDriverError, 1, b.DNFDriverError, "Abandono por error del piloto")
+	}
+	if sprint.DNFNoFault {
+		items = lineItem(items, ruleDNFNoFault, 1, b.DNFNoFault, "Abandono sin culpa del piloto")
+	}
+	return items
+}
+
+// BreakdownPilotSprintQualy desglosa los puntos de sprint qualifying de un piloto
+func (rs ScoringRuleset) BreakdownPilotSprintQualy(qualy models.PilotSprintQualy) []models.PointsLineItem {
+	items := rs.positionLineItems("sprint_qualy", qualy.DeltaPosition, qualy.FinishPosition, rs.DeltaMultiplier)
+	return rs.redFlagLineItem(items, qualy.CausedRedFlag)
+}
+
+// BreakdownTeamRace desglosa los puntos de un equipo en carrera
+func (rs ScoringRuleset) BreakdownTeamRace(team models.TeamRace) []models.PointsLineItem {
+	delta, finishPosition := 0, 0
+	if team.DeltaPosition != nil {
+		delta = *team.DeltaPosition
+	}
+	if team.FinishPosition != nil {
+		finishPosition = *team.FinishPosition
+	}
+	items := rs.positionLineItems("team", delta, finishPosition, rs.TeamDeltaMultiplier)
+	if team.FastestPitstop {
+		detail := "Parada más rápida del GP"
+		if team.PitstopTime != nil {
+			detail = fmt.Sprintf("Parada más rápida del GP (%.3fs parado)", *team.PitstopTime)
+		} else if team.PitLaneTime != nil {
+			detail = fmt.Sprintf("Parada más rápida del GP (%.3fs en pit lane)", *team.PitLaneTime)
+		}
+		items = lineItem(items, ruleFastestPitstop, 1, rs.Team.FastestPitstop, detail)
+	}
+	return items
+}
+
+// ScorePilotRace calcula los puntos de carrera: delta + posición + bonificaciones
+func (rs ScoringRuleset) ScorePilotRace(race models.PilotRace) int {
+	return sumLineItems(rs.BreakdownPilotRace(race))
+}
+
+// ScorePilotQualy calcula los puntos de clasificación: delta + posición + bandera roja
+func (rs ScoringRuleset) ScorePilotQualy(qualy models.PilotQualy) int {
+	return sumLineItems(rs.BreakdownPilotQualy(qualy))
+}
+
+// ScorePilotPractice calcula los puntos de libres: delta + posición + bandera roja
+func (rs ScoringRuleset) ScorePilotPractice(practice models.PilotPractice) int {
+	return sumLineItems(rs.BreakdownPilotPractice(practice))
+}
+
+// ScorePilotSprint calcula los puntos de sprint: delta + posición + penalizaciones
+func (rs ScoringRuleset) ScorePilotSprint(sprint models.PilotSprint) int {
+	return sumLineItems(rs.BreakdownPilotSprint(sprint))
+}
+
+// ScorePilotSprintQualy calcula los puntos de sprint qualifying: delta + posición + bandera roja
+func (rs ScoringRuleset) ScorePilotSprintQualy(qualy models.PilotSprintQualy) int {
+	return sumLineItems(rs.BreakdownPilotSprintQualy(qualy))
+}
+
+// ScoreTeamRace calcula los puntos de un equipo: delta + posición + parada más rápida
+func (rs ScoringRuleset) ScoreTeamRace(team models.TeamRace) int {
+	return sumLineItems(rs.BreakdownTeamRace(team))
+}
+
+// pilotSessionPointsForLeague devuelve los puntos de un piloto en una sesión
+// de un GP con las reglas de la liga. Si el resultado se puntuó con la misma
+// versión se usan los puntos guardados; si no, se recalculan a partir de los
+// datos de la sesión.
+func pilotSessionPointsForLeague(tx *gorm.DB, leagueID uint, session string, pilotID uint, gpIndex uint64) (int, bool) {
+	rs := leagueScoringRuleset(leagueID)
+	items, stored, version, ok := pilotSessionBreakdown(tx, rs, session, pilotID, gpIndex)
+	if !ok {
+		return 0, false
+	}
+	if version == rs.Version {
+		return stored, true
+	}
+	return sumLineItems(items), true
+}
+
+// teamRacePointsForLeague devuelve los puntos de un equipo en un GP con las reglas de la liga
+func teamRacePointsForLeague(tx *gorm.DB, leagueID uint, teamConstructorID uint, gpIndex uint64) (int, bool) {
+	var row models.TeamRace
+	if err := tx.Where("teamconstructor_id = ? AND gp_index = ?", teamConstructorID, gpIndex).First(&row).Error; err != nil {
+		return 0, false
+	}
+	rs := leagueScoringRuleset(leagueID)
+	if row.ScoringVersion == rs.Version {
+		return row.Points, true
+	}
+	return rs.ScoreTeamRace(row), true
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"f1-fantasy-app/models"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Las páginas de testdata/results son copias recortadas de formula1.com con
+// la misma estructura de tabla que usa el scraper
+var fixtureSource = fileResultsSource{Dir: "testdata/results"}
+
+func TestExtractDriverDataFromTable(t *testing.T) {
+	tests := []struct {
+		gp, session string
+		want        []ScrapedDriverData
+	}{
+		{"australia", sessionQualifying, []ScrapedDriverData{
+			{Position: 1, DriverNumber: "4", DriverName: "Lando Norris", DriverCode: "NOR", Team: "McLaren", Q1Time: "1:15.912", Q2Time: "1:15.415", Q3Time: "1:15.096", Laps: "20"},
+			{Position: 2, DriverNumber: "81", DriverName: "Oscar Piastri", DriverCode: "PIA", Team: "McLaren", Q1Time: "1:16.062", Q2Time: "1:15.468", Q3Time: "1:15.180", Laps: "18"},
+			{Position: 3, DriverNumber: "1", DriverName: "Max Verstappen", DriverCode: "VER", Team: "Red Bull Racing", Q1Time: "1:16.018", Q2Time: "1:15.565", Q3Time: "1:15.481", Laps: "17"},
+			{Position: 4, DriverNumber: "63", DriverName: "George Russell", DriverCode: "RUS", Team: "Mercedes", Q1Time: "1:15.971", Q2Time: "1:15.798", Q3Time: "1:15.546", Laps: "21"},
+			{Position: 16, DriverNumber: "12", DriverName: "Kimi Antonelli", DriverCode: "ANT", Team: "Mercedes", Q1Time: "1:16.525", Laps: "6"},
+			{Position: 19, DriverNumber: "7", DriverName: "Franco Colapinto", DriverCode: "DOO", Team: "Alpine", Q1Time: "1:16.863", Laps: "7"},
+		}},
+		{"china", sessionSprintQualifying, []ScrapedDriverData{
+			{Position: 1, DriverNumber: "44", DriverName: "Lewis Hamilton", DriverCode: "HAM", Team: "Ferrari", Q1Time: "1:31.212", Q2Time: "1:30.948", Q3Time: "1:30.849", Laps: "18"},
+			{Position: 2, DriverNumber: "1", DriverName: "Max Verstappen", DriverCode: "VER", Team: "Red Bull Racing", Q1Time: "1:31.526", Q2Time: "1:31.244", Q3Time: "1:30.867", Laps: "18"},
+			{Position: 3, DriverNumber: "81", DriverName: "Oscar Piastri", DriverCode: "PIA", Team: "McLaren", Q1Time: "1:31.526", Q2Time: "1:31.103", Q3Time: "1:30.929", Laps: "18"},
+		}},
+		{"china", sessionQualifying, []ScrapedDriverData{
+			{Position: 1, DriverNumber: "81", DriverName: "Oscar Piastri", DriverCode: "PIA", Team: "McLaren", Q1Time: "1:31.591", Q2Time: "1:31.200", Q3Time: "1:30.641", Laps: "18"},
+			{Position: 2, DriverNumber: "63", DriverName: "George Russell", DriverCode: "RUS", Team: "Mercedes", Q1Time: "1:31.295", Q2Time: "1:31.307", Q3Time: "1:30.723", Laps: "21"},
+			{Position: 3, DriverNumber: "4", DriverName: "Lando Norris", DriverCode: "NOR", Team: "McLaren", Q1Time: "1:30.983", Q2Time: "1:30.787", Q3Time: "1:30.793", Laps: "18"},
+			{Position: 4, DriverNumber: "1", DriverName: "Max Verstappen", DriverCode: "VER", Team: "Red Bull Racing", Q1Time: "1:31.424", Q2Time: "1:31.168", Q3Time: "1:30.817", Laps: "21"},
+		}},
+		{"bahrain", sessionQualifying, []ScrapedDriverData{
+			{Position: 1, DriverNumber: "81", DriverName: "Oscar Piastri", DriverCode: "PIA", Team: "McLaren", Q1Time: "1:30.778", Q2Time: "1:30.261", Q3Time: "1:29.841", Laps: "18"},
+			{Position: 2, DriverNumber: "63", DriverName: "George Russell", DriverCode: "RUS", Team: "Mercedes", Q1Time: "1:30.899", Q2Time: "1:30.327", Q3Time: "1:30.009", Laps: "21"},
+			{Position: 3, DriverNumber: "16", DriverName: "Charles Leclerc", DriverCode: "LEC", Team: "Ferrari", Q1Time: "1:30.849", Q2Time: "1:30.306", Q3Time: "1:30.175", Laps: "18"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.gp+"/"+tt.session, func(t *testing.T) {
+			doc, _, err := fixtureSource.Fetch(tt.gp, tt.session)
+			if err != nil {
+				t.Fatalf("Fetch: %v", err)
+			}
+			got, err := extractDriverDataFromTable(doc)
+			if err != nil {
+				t.Fatalf("extractDriverDataFromTable: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d pilotos, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("fila %d:\n got  %+v\n want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestExtractRaceDataFromTable(t *testing.T) {
+	tests := []struct {
+		gp, session string
+		want        []ScrapedRaceData
+	}{
+		// Las filas NC (no clasificados) no tienen posición y se descartan
+		{"australia", sessionRace, []ScrapedRaceData{
+			{Position: 1, DriverNumber: "4", DriverName: "Lando Norris", DriverCode: "NOR", Team: "McLaren", Time: "1:42:06.304", Points: "25", Laps: "57"},
+			{Position: 2, DriverNumber: "1", DriverName: "Max Verstappen", DriverCode: "VER", Team: "Red Bull Racing", Time: "+0.895s", Points: "18", Laps: "57"},
+			{Position: 3, DriverNumber: "63", DriverName: "George Russell", DriverCode: "RUS", Team: "Mercedes", Time: "+8.481s", Points: "15", Laps: "57"},
+			{Position: 4, DriverNumber: "12", DriverName: "Kimi Antonelli", DriverCode: "ANT", Team: "Mercedes", Time: "+10.135s", Points: "12", Laps: "57"},
+			{Position: 5, DriverNumber: "23", DriverName: "Alexander Albon", DriverCode: "ALB", Team: "Williams", Time: "+12.773s", Points: "10", Laps: "57"},
+		}},
+		{"china", sessionSprint, []ScrapedRaceData{
+			{Position: 1, DriverNumber: "44", DriverName: "Lewis Hamilton", DriverCode: "HAM", Team: "Ferrari", Time: "30:39.965", Points: "8", Laps: "19"},
+			{Position: 2, DriverNumber: "81", DriverName: "Oscar Piastri", DriverCode: "PIA", Team: "McLaren", Time: "+6.889s", Points: "7", Laps: "19"},
+			{Position: 3, DriverNumber: "1", DriverName: "Max Verstappen", DriverCode: "VER", Team: "Red Bull Racing", Time: "+9.804s", Points: "6", Laps: "19"},
+		}},
+		{"china", sessionRace, []ScrapedRaceData{
+			{Position: 1, DriverNumber: "81", DriverName: "Oscar Piastri", DriverCode: "PIA", Team: "McLaren", Time: "1:30:55.026", Points: "25", Laps: "56"},
+			{Position: 2, DriverNumber: "4", DriverName: "Lando Norris", DriverCode: "NOR", Team: "McLaren", Time: "+9.748s", Points: "18", Laps: "56"},
+			{Position: 3, DriverNumber: "63", DriverName: "George Russell", DriverCode: "RUS", Team: "Mercedes", Time: "+11.097s", Points: "15", Laps: "56"},
+			{Position: 4, DriverNumber: "1", DriverName: "Max Verstappen", DriverCode: "VER", Team: "Red Bull Racing", Time: "+16.656s", Points: "12", Laps: "56"},
+		}},
+		{"bahrain", sessionRace, []ScrapedRaceData{
+			{Position: 1, DriverNumber: "81", DriverName: "Oscar Piastri", DriverCode: "PIA", Team: "McLaren", Time: "1:35:39.435", Points: "25", Laps: "57"},
+			{Position: 2, DriverNumber: "63", DriverName: "George Russell", DriverCode: "RUS", Team: "Mercedes", Time: "+15.499s", Points: "18", Laps: "57"},
+			{Position: 3, DriverNumber: "4", DriverName: "Lando Norris", DriverCode: "NOR", Team: "McLaren", Time: "+16.273s", Points: "15", Laps: "57"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.gp+"/"+tt.session, func(t *testing.T) {
+			doc, _, err := fixtureSource.Fetch(tt.gp, tt.session)
+			if err != nil {
+				t.Fatalf("Fetch: %v", err)
+			}
+			got, err := extractRaceDataFromTable(doc)
+			if err != nil {
+				t.Fatalf("extractRaceDataFromTable: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d pilotos, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("fila %d:\n got  %+v\n want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestExtractPracticeDataFromTable(t *testing.T) {
+	tests := []struct {
+		gp, session string
+		want        []ScrapedPracticeData
+	}{
+		{"australia", sessionFP3, []ScrapedPracticeData{
+			{Position: 1, DriverNumber: "16", DriverName: "Charles Leclerc", DriverCode: "LEC", Team: "Ferrari", Time: "1:15.921", Laps: "14"},
+			{Position: 2, DriverNumber: "4", DriverName: "Lando Norris", DriverCode: "NOR", Team: "McLaren", Time: "+0.012s", Laps: "19"},
+			{Position: 3, DriverNumber: "81", DriverName: "Oscar Piastri", DriverCode: "PIA", Team: "McLaren", Time: "+0.104s", Laps: "18"},
+			{Position: 4, DriverNumber: "7", DriverName: "Franco Colapinto", DriverCode: "DOO", Team: "Alpine", Time: "+0.512s", Laps: "20"},
+		}},
+		{"china", sessionFP1, []ScrapedPracticeData{
+			{Position: 1, DriverNumber: "4", DriverName: "Lando Norris", DriverCode: "NOR", Team: "McLaren", Time: "1:31.504", Laps: "24"},
+			{Position: 2, DriverNumber: "44", DriverName: "Lewis Hamilton", DriverCode: "HAM", Team: "Ferrari", Time: "+0.114s", Laps: "26"},
+			{Position: 3, DriverNumber: "16", DriverName: "Charles Leclerc", DriverCode: "LEC", Team: "Ferrari", Time: "+0.175s", Laps: "25"},
+		}},
+		{"bahrain", sessionFP2, []ScrapedPracticeData{
+			{Position: 1, DriverNumber: "63", DriverName: "George Russell", DriverCode: "RUS", Team: "Mercedes", Time: "1:30.505", Laps: "27"},
+			{Position: 2, DriverNumber: "10", DriverName: "Pierre Gasly", DriverCode: "GAS", Team: "Alpine", Time: "+0.026s", Laps: "28"},
+			{Position: 3, DriverNumber: "16", DriverName: "Charles Leclerc", DriverCode: "LEC", Team: "Ferrari", Time: "+0.120s", Laps: "27"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.gp+"/"+tt.session, func(t *testing.T) {
+			doc, _, err := fixtureSource.Fetch(tt.gp, tt.session)
+			if err != nil {
+				t.Fatalf("Fetch: %v", err)
+			}
+			got, err := extractPracticeDataFromTable(doc)
+			if err != nil {
+				t.Fatalf("extractPracticeDataFromTable: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d pilotos, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("fila %d:\n got  %+v\n want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFileResultsSourceMissingSession(t *testing.T) {
+	// Bahrain no es fin de semana con sprint
+	if _, _, err := fixtureSource.Fetch("bahrain", sessionSprint); !errors.Is(err, errSessionNotAvailable) {
+		t.Fatalf("got err %v, want errSessionNotAvailable", err)
+	}
+}
+
+func TestExtractPitStopDataFromTable(t *testing.T) {
+	tests := []struct {
+		gp   string
+		want []ScrapedPitStopData
+		// Parada más rápida por equipo con los nombres de team_constructors
+		fastest map[string]float64
+	}{
+		{"australia", []ScrapedPitStopData{
+			{Stops: 1, DriverNumber: "4", DriverName: "Lando Norris", DriverCode: "NOR", Team: "McLaren", Lap: "34", TimeOfDay: "16:02:11", Time: "17.452", Duration: 17.452},
+			{Stops: 1, DriverNumber: "1", DriverName: "Max Verstappen", DriverCode: "VER", Team: "Red Bull Racing", Lap: "34", TimeOfDay: "16:02:15", Time: "17.120", Duration: 17.12},
+			{Stops: 1, DriverNumber: "63", DriverName: "George Russell", DriverCode: "RUS", Team: "Mercedes", Lap: "35", TimeOfDay: "16:03:40", Time: "18.001", Duration: 18.001},
+			{Stops: 1, DriverNumber: "23", DriverName: "Alexander Albon", DriverCode: "ALB", Team: "Williams", Lap: "35", TimeOfDay: "16:03:52", Time: "17.910", Duration: 17.91},
+			{Stops: 1, DriverNumber: "27", DriverName: "Nico Hulkenberg", DriverCode: "HUL", Team: "Kick Sauber", Lap: "36", TimeOfDay: "16:05:02", Time: "18.340", Duration: 18.34},
+			{Stops: 2, DriverNumber: "4", DriverName: "Lando Norris", DriverCode: "NOR", Team: "McLaren", Lap: "44", TimeOfDay: "16:19:30", Time: "16.987", Duration: 16.987},
+			{Stops: 1, DriverNumber: "87", DriverName: "Oliver Bearman", DriverCode: "BEA", Team: "Haas F1 Team", Lap: "44", TimeOfDay: "16:19:41", Time: "19.225", Duration: 19.225},
+		}, map[string]float64{
+			"McLaren": 16.987, "Red Bull Racing": 17.12, "Mercedes": 18.001, "Williams": 17.91,
+			"Stake F1 Team Kick Sauber": 18.34, "Haas": 19.225,
+		}},
+		{"china", []ScrapedPitStopData{
+			{Stops: 1, DriverNumber: "81", DriverName: "Oscar Piastri", DriverCode: "PIA", Team: "McLaren", Lap: "13", TimeOfDay: "15:24:20", Time: "21.950", Duration: 21.95},
+			{Stops: 1, DriverNumber: "6", DriverName: "Isack Hadjar", DriverCode: "HAD", Team: "Racing Bulls", Lap: "14", TimeOfDay: "15:25:48", Time: "21.604", Duration: 21.604},
+			{Stops: 1, DriverNumber: "44", DriverName: "Lewis Hamilton", DriverCode: "HAM", Team: "Ferrari", Lap: "14", TimeOfDay: "15:25:52", Time: "22.480", Duration: 22.48},
+		}, map[string]float64{"McLaren": 21.95, "Visa Cash App RB": 21.604, "Ferrari": 22.48}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.gp, func(t *testing.T) {
+			doc, _, err := fixtureSource.Fetch(tt.gp, resultsPitStops)
+			if err != nil {
+				t.Fatalf("Fetch: %v", err)
+			}
+			got, err := extractPitStopDataFromTable(doc)
+			if err != nil {
+				t.Fatalf("extractPitStopDataFromTable: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d paradas, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("fila %d:\n got  %+v\n want %+v", i, got[i], tt.want[i])
+				}
+			}
+			fastest := fastestPitStopsByTeam(got)
+			if len(fastest) != len(tt.fastest) {
+				t.Fatalf("got %d equipos, want %d: %v", len(fastest), len(tt.fastest), fastest)
+			}
+			for team, want := range tt.fastest {
+				if fastest[team] != want {
+					t.Errorf("%s: got %.3f, want %.3f", team, fastest[team], want)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractFastestLapDataFromTable(t *testing.T) {
+	tests := []struct {
+		gp   string
+		want []ScrapedFastestLapData
+	}{
+		{"australia", []ScrapedFastestLapData{
+			{Position: 1, DriverNumber: "4", DriverName: "Lando Norris", DriverCode: "NOR", Team: "McLaren", Lap: "43", TimeOfDay: "16:18:02", Time: "1:22.167", AvgSpeed: "232.278"},
+			{Position: 2, DriverNumber: "81", DriverName: "Oscar Piastri", DriverCode: "PIA", Team: "McLaren", Lap: "43", TimeOfDay: "16:18:04", Time: "1:22.429", AvgSpeed: "231.540"},
+			{Position: 3, DriverNumber: "1", DriverName: "Max Verstappen", DriverCode: "VER", Team: "Red Bull Racing", Lap: "43", TimeOfDay: "16:18:01", Time: "1:23.081", AvgSpeed: "229.723"},
+		}},
+		{"china", []ScrapedFastestLapData{
+			{Position: 1, DriverNumber: "4", DriverName: "Lando Norris", DriverCode: "NOR", Team: "McLaren", Lap: "53", TimeOfDay: "16:28:40", Time: "1:35.454", AvgSpeed: "205.568"},
+			{Position: 2, DriverNumber: "81", DriverName: "Oscar Piastri", DriverCode: "PIA", Team: "McLaren", Lap: "55", TimeOfDay: "16:31:52", Time: "1:35.520", AvgSpeed: "205.426"},
+			{Position: 3, DriverNumber: "16", DriverName: "Charles Leclerc", DriverCode: "LEC", Team: "Ferrari", Lap: "54", TimeOfDay: "16:30:12", Time: "1:35.740", AvgSpeed: "204.954"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.gp, func(t *testing.T) {
+			doc, _, err := fixtureSource.Fetch(tt.gp, resultsFastestLaps)
+			if err != nil {
+				t.Fatalf("Fetch: %v", err)
+			}
+			got, err := extractFastestLapDataFromTable(doc)
+			if err != nil {
+				t.Fatalf("extractFastestLapDataFromTable: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d vueltas, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("fila %d:\n got  %+v\n want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSeasonRaceIndex(t *testing.T) {
+	f, err := os.Open("testdata/results/races_2025.html")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer f.Close()
+	doc, err := goquery.NewDocumentFromReader(f)
+	if err != nil {
+		t.Fatalf("NewDocumentFromReader: %v", err)
+	}
+
+	races := parseSeasonRaceIndex(doc, 2025)
+	if len(races) != 10 {
+		t.Fatalf("got %d carreras, want 10: %+v", len(races), races)
+	}
+	if races[0] != (seasonRace{ID: "1254", Slug: "australia"}) {
+		t.Errorf("primera carrera: got %+v", races[0])
+	}
+	if got := parseSeasonRaceIndex(doc, 2024); len(got) != 1 || got[0].ID != "1229" {
+		t.Errorf("temporada 2024: got %+v", got)
+	}
+
+	tests := []struct {
+		gpKey  string
+		gp     models.GrandPrix
+		wantID string
+	}{
+		{"australian", models.GrandPrix{Name: "Australian Grand Prix", Country: "Australia"}, "1254"},
+		{"saudi_arabian_grand_prix", models.GrandPrix{Name: "Saudi Arabian Grand Prix", Country: "Saudi Arabia"}, "1258"},
+		{"emilia_romagna", models.GrandPrix{Name: "Emilia Romagna Grand Prix", Country: "Italy"}, "1260"},
+		{"italian", models.GrandPrix{Name: "Italian Grand Prix", Country: "Italy"}, "1268"},
+		{"miami", models.GrandPrix{Name: "Miami Grand Prix", Country: "United States"}, "1259"},
+		{"las_vegas", models.GrandPrix{Name: "Las Vegas Grand Prix", Country: "United States"}, "1274"},
+		// Clave desconocida: se resuelve por el nombre del GP
+		{"usa_2025", models.GrandPrix{Name: "United States Grand Prix", Country: "United States"}, "1271"},
+		{"monaco", models.GrandPrix{Name: "Monaco Grand Prix", Country: "Monaco"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.gpKey, func(t *testing.T) {
+			race, ok := matchSeasonRace(races, gpSlugCandidates(tt.gpKey, tt.gp))
+			if ok != (tt.wantID != "") || race.ID != tt.wantID {
+				t.Errorf("got %+v (%v), want ID %q", race, ok, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestDiffRows(t *testing.T) {
+	pit := 21.4
+	old := models.PilotRace{ID: 7, PilotID: 1, GPIndex: 3, FinishPosition: 5, ExpectedPosition: 8, DeltaPosition: 3, Points: 20}
+	races := map[uint]*plannedRow[models.PilotRace]{
+		// Solo cambia la posición final: la esperada de los admins se conserva
+		1: {Old: &old, New: models.PilotRace{ID: 7, PilotID: 1, GPIndex: 3, FinishPosition: 4, ExpectedPosition: 8, DeltaPosition: 4, Points: 24, FastestLap: true}},
+		2: {New: models.PilotRace{PilotID: 2, GPIndex: 3, FinishPosition: 1, Points: 25}},
+		3: {Old: &models.PilotRace{PilotID: 3, FinishPosition: 2}, New: models.PilotRace{PilotID: 3, FinishPosition: 2}},
+	}
+	names := map[uint]string{1: "Lando Norris", 2: "Oscar Piastri", 3: "Max Verstappen"}
+	rows := diffRows("race", races, func(id uint) string { return names[id] }, raceFields)
+
+	if len(rows) != 3 {
+		t.Fatalf("got %d filas, want 3", len(rows))
+	}
+	// Ordenadas por nombre
+	if rows[0].Name != "Lando Norris" || rows[1].Name != "Max Verstappen" || rows[2].Name != "Oscar Piastri" {
+		t.Fatalf("orden inesperado: %+v", rows)
+	}
+	want := []scraperFieldChange{
+		{Field: "finish_position", Old: 5, New: 4},
+		{Field: "delta_position", Old: 3, New: 4},
+		{Field: "points", Old: 20, New: 24},
+		{Field: "fastest_lap", Old: false, New: true},
+	}
+	if rows[0].Status != "changed" || !reflect.DeepEqual(rows[0].Changes, want) {
+		t.Errorf("Norris:\n got  %s %+v\n want changed %+v", rows[0].Status, rows[0].Changes, want)
+	}
+	if rows[1].Status != "unchanged" || len(rows[1].Changes) != 0 {
+		t.Errorf("Verstappen: got %s %+v", rows[1].Status, rows[1].Changes)
+	}
+	if rows[2].Status != "new" || len(rows[2].Changes) != 5 || rows[2].Changes[0].Old != nil {
+		t.Errorf("Piastri: got %s %+v", rows[2].Status, rows[2].Changes)
+	}
+
+	teams := map[uint]*plannedRow[models.TeamRace]{
+		4: {Old: &models.TeamRace{TeamConstructorID: 4}, New: models.TeamRace{TeamConstructorID: 4, PitLaneTime: &pit, FastestPitstop: true}},
+	}
+	teamRows := diffRows("team", teams, func(uint) string { return "McLaren" }, teamFields)
+	wantTeam := []scraperFieldChange{
+		{Field: "pit_lane_time", Old: nil, New: 21.4},
+		{Field: "fastest_pitstop", Old: false, New: true},
+	}
+	if len(teamRows) != 1 || !reflect.DeepEqual(teamRows[0].Changes, wantTeam) {
+		t.Errorf("equipo: got %+v, want %+v", teamRows, wantTeam)
+	}
+}
+
+func TestRecordSession(t *testing.T) {
+	var data scrapedGP
+	data.recordSession("qualifying", "a.html", 20, nil)
+	data.recordSession("sprint_results", "b.html", 0, errSessionNotAvailable)
+	data.recordSession("race_results", "c.html", 0, nil)
+	data.recordSession("pit_stops", "d.html", 0, errors.New("status 500"))
+
+	want := []scrapedSession{
+		{Session: "qualifying", Status: "ok", Rows: 20, Source: "a.html"},
+		{Session: "sprint_results", Status: "not_available", Source: "b.html"},
+		{Session: "race_results", Status: "empty", Source: "c.html"},
+		{Session: "pit_stops", Status: "error", Source: "d.html", Error: "status 500"},
+	}
+	if !reflect.DeepEqual(data.Sessions, want) {
+		t.Errorf("got %+v\nwant %+v", data.Sessions, want)
+	}
+	if got := data.scrapedRows(); got != 20 {
+		t.Errorf("scrapedRows = %d, want 20", got)
+	}
+}
+
+func TestMatchGPKey(t *testing.T) {
+	gps := []models.GrandPrix{
+		{GPIndex: 1, Name: "Australian Grand Prix", Country: "Australia", ResultsRaceID: "1254", ResultsSlug: "australia"},
+		{GPIndex: 3, Name: "Japanese Grand Prix", Country: "Japan"},
+		{GPIndex: 6, Name: "Miami Grand Prix", Country: "United States"},
+		{GPIndex: 7, Name: "Emilia Romagna Grand Prix", Country: "Italy"},
+		{GPIndex: 12, Name: "British Grand Prix", Country: "United Kingdom", ResultsSlug: "great-britain"},
+		{GPIndex: 16, Name: "Italian Grand Prix", Country: "Italy"},
+		{GPIndex: 19, Name: "United States Grand Prix", Country: "United States"},
+	}
+	tests := []struct {
+		gpKey string
+		want  uint64
+	}{
+		{"1254", 1},                  // Id de carrera guardado
+		{"australian_grand_prix", 1}, // Nombre
+		{"australia", 1},             // Slug de resultados
+		{"japan", 3},                 // País único
+		{"japanese", 3},              // Nombre
+		{"great_britain", 12},        // Slug de resultados
+		{"british", 12},              // Nombre
+		{"emilia-romagna", 7},        // Nombre con guiones
+		{"united_states_grand_prix", 19},
+		{"italy", 0}, // País compartido por dos GPs
+		{"monaco", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.gpKey, func(t *testing.T) {
+			gp, ok := matchGPKey(gps, tt.gpKey)
+			if ok != (tt.want != 0) || gp.GPIndex != tt.want {
+				t.Errorf("got %d (%v), want %d", gp.GPIndex, ok, tt.want)
+			}
+		})
+	}
+}
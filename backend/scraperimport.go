@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"time"
+
+	"f1-fantasy-app/database"
+	"f1-fantasy-app/models"
+
+	"gorm.io/gorm"
+)
+
+// Estados de una importación del scraper
+const (
+	scraperImportPending  = "pending"
+	scraperImportApproved = "approved"
+	scraperImportRejected = "rejected"
+)
+
+var (
+	errImportNotFound   = errors.New("importación no encontrada")
+	errImportNotPending = errors.New("la importación ya no está pendiente") // Ya se aprobó o se rechazó
+)
+
+// scraperFieldChange es un campo que cambia al aplicar la importación
+type scraperFieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+// scraperDiffRow es el cambio de un piloto en una sesión (o de un equipo)
+type scraperDiffRow struct {
+	Session string               `json:"session"` // qualy, race, practice, sprint, sprint_qualy o team
+	ID      uint                 `json:"id"`      // pilot_id o teamconstructor_id
+	Name    string               `json:"name"`
+	Status  string               `json:"status"` // new, changed o unchanged
+	Changes []scraperFieldChange `json:"changes,omitempty"`
+}
+
+// scraperDiff compara una importación con lo que hay en la base de datos
+type scraperDiff struct {
+	Rows    []scraperDiffRow `json:"rows"`
+	Changed int              `json:"changed"`
+	Skipped []string         `json:"skipped"` // Pilotos y equipos que no están en la base de datos
+}
+
+// diffField es un campo comparable de un registro
+type diffField struct {
+	name  string
+	value interface{}
+}
+
+func pilotResultFields(finish int, expected float64, delta, points int) []diffField {
+	return []diffField{
+		{"finish_position", finish},
+		{"expected_position", expected},
+		{"delta_position", delta},
+		{"points", points},
+	}
+}
+
+func qualyFields(r models.PilotQualy) []diffField {
+	return pilotResultFields(r.FinishPosition, r.ExpectedPosition, r.DeltaPosition, r.Points)
+}
+
+func raceFields(r models.PilotRace) []diffField {
+	return append(pilotResultFields(r.FinishPosition, r.ExpectedPosition, r.DeltaPosition, r.Points),
+		diffField{"fastest_lap", r.FastestLap})
+}
+
+func practiceFields(r models.PilotPractice) []diffField {
+	return pilotResultFields(r.FinishPosition, r.ExpectedPosition, r.DeltaPosition, r.Points)
+}
+
+func sprintFields(r models.PilotSprint) []diffField {
+	return pilotResultFields(r.FinishPosition, r.ExpectedPosition, r.DeltaPosition, r.Points)
+}
+
+func sprintQualyFields(r models.PilotSprintQualy) []diffField {
+	return pilotResultFields(r.FinishPosition, r.ExpectedPosition, r.DeltaPosition, r.Points)
+}
+
+func teamFields(r models.TeamRace) []diffField {
+	var pitLane interface{}
+	if r.PitLaneTime != nil {
+		pitLane = *r.PitLaneTime
+	}
+	return []diffField{
+		{"pit_lane_time", pitLane},
+		{"fastest_pitstop", r.FastestPitstop},
+		{"points", r.Points},
+	}
+}
+
+// diffRows compara los registros planificados de una sesión
+func diffRows[T any](session string, rows map[uint]*plannedRow[T], name func(uint) string, fields func(T) []diffField) []scraperDiffRow {
+	var out []scraperDiffRow
+	for _, id := range sortedIDs(rows) {
+		row := rows[id]
+		d := scraperDiffRow{Session: session, ID: id, Name: name(id), Status: "unchanged"}
+		next := fields(row.New)
+		if row.Old == nil {
+			d.Status = "new"
+			for _, f := range next {
+				d.Changes = append(d.Changes, scraperFieldChange{Field: f.name, New: f.value})
+			}
+		} else {
+			for i, f := range fields(*row.Old) {
+				if !reflect.DeepEqual(f.value, next[i].value) {
+					d.Changes = append(d.Changes, scraperFieldChange{Field: f.name, Old: f.value, New: next[i].value})
+				}
+			}
+			if len(d.Changes) > 0 {
+				d.Status = "changed"
+			}
+		}
+		out = append(out, d)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// pilotName devuelve el nombre de un piloto ya buscado o lo carga
+func (p *scraperPlan) pilotName(id uint) string {
+	if name, ok := p.pilotNames[id]; ok {
+		return name
+	}
+	var pilot models.Pilot
+	if p.db.First(&pilot, id).Error == nil {
+		p.pilotNames[id] = pilot.DriverName
+	}
+	return p.pilotNames[id]
+}
+
+// teamName devuelve el nombre de un equipo ya buscado o lo carga
+func (p *scraperPlan) teamName(id uint) string {
+	if name, ok := p.teamNames[id]; ok {
+		return name
+	}
+	var team models.TeamConstructor
+	if p.db.First(&team, id).Error == nil {
+		p.teamNames[id] = team.Name
+	}
+	return p.teamNames[id]
+}
+
+// diff devuelve los cambios del plan piloto a piloto
+func (p *scraperPlan) diff() scraperDiff {
+	var rows []scraperDiffRow
+	rows = append(rows, diffRows("practice", p.Practices, p.pilotName, practiceFields)...)
+	rows = append(rows, diffRows("sprint_qualy", p.SprintQualies, p.pilotName, sprintQualyFields)...)
+	rows = append(rows, diffRows("sprint", p.Sprints, p.pilotName, sprintFields)...)
+	rows = append(rows, diffRows("qualy", p.Qualies, p.pilotName, qualyFields)...)
+	rows = append(rows, diffRows("race", p.Races, p.pilotName, raceFields)...)
+	rows = append(rows, diffRows("team", p.Teams, p.teamName, teamFields)...)
+
+	out := scraperDiff{Rows: rows, Skipped: p.Skipped}
+	if out.Rows == nil {
+		out.Rows = []scraperDiffRow{}
+	}
+	if out.Skipped == nil {
+		out.Skipped = []string{}
+	}
+	for _, r := range rows {
+		if r.Status != "unchanged" {
+			out.Changed++
+		}
+	}
+	return out
+}
+
+// saveScraperImport guarda los resultados leídos de un GP como importación
+// pendiente sin tocar los resultados y devuelve su diff
+func saveScraperImport(data *scrapedGP, userID uint) (*models.ScraperImport, scraperDiff, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, scraperDiff{}, err
+	}
+	imp := &models.ScraperImport{
+		GPIndex:   data.GPIndex,
+		GPKey:     data.GPKey,
+		Season:    data.Season,
+		Status:    scraperImportPending,
+		Data:      raw,
+		CreatedBy: userID,
+	}
+	if err := database.DB.Create(imp).Error; err != nil {
+		return nil, scraperDiff{}, fmt.Errorf("error guardando importación: %v", err)
+	}
+	diff := buildScraperPlan(database.DB, data).diff()
+	log.Printf("[SCRAPER] Importación %d pendiente para GP %d: %d cambios", imp.ID, imp.GPIndex, diff.Changed)
+	return imp, diff, nil
+}
+
+// loadScraperImport carga una importación y sus resultados leídos
+func loadScraperImport(db *gorm.DB, id uint) (models.ScraperImport, *scrapedGP, error) {
+	var imp models.ScraperImport
+	if err := db.First(&imp, id).Error; err != nil {
+		return imp, nil, err
+	}
+	var data scrapedGP
+	if err := json.Unmarshal(imp.Data, &data); err != nil {
+		return imp, nil, fmt.Errorf("importación %d corrupta: %v", id, err)
+	}
+	return imp, &data, nil
+}
+
+// scraperImportDiff compara una importación con el estado actual
+func scraperImportDiff(id uint) (models.ScraperImport, scraperDiff, error) {
+	imp, data, err := loadScraperImport(database.DB, id)
+	if err != nil {
+		return imp, scraperDiff{}, err
+	}
+	return imp, buildScraperPlan(database.DB, data).diff(), nil
+}
+
+// resolveScraperImport pasa una importación pendiente a su estado final. Solo
+// una petición puede resolverla aunque lleguen dos a la vez.
+func resolveScraperImport(tx *gorm.DB, id uint, status string, userID uint) error {
+	now := time.Now()
+	res := tx.Model(&models.ScraperImport{}).
+		Where("id = ? AND status = ?", id, scraperImportPending).
+		Updates(map[string]interface{}{"status": status, "resolved_by": userID, "resolved_at": now})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		var count int64
+		tx.Model(&models.ScraperImport{}).Where("id = ?", id).Count(&count)
+		if count == 0 {
+			return errImportNotFound
+		}
+		return errImportNotPending
+	}
+	return nil
+}
+
+// approveScraperImport aplica una importación pendiente en una única
+// transacción y devuelve cuántos registros ha guardado
+func approveScraperImport(id, userID uint) (int, error) {
+	var saved int
+	var gpIndex uint64
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := resolveScraperImport(tx, id, scraperImportApproved, userID); err != nil {
+			return err
+		}
+		_, data, err := loadScraperImport(tx, id)
+		if err != nil {
+			return err
+		}
+		gpIndex = data.GPIndex
+		saved, err = buildScraperPlan(tx, data).save()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	storeGPLineItems(database.DB, gpIndex)
+	log.Printf("[SCRAPER] Importación %d aprobada: %d registros guardados", id, saved)
+	return saved, nil
+}
+
+// rejectScraperImport descarta una importación pendiente
+func rejectScraperImport(id, userID uint) error {
+	if err := resolveScraperImport(database.DB, id, scraperImportRejected, userID); err != nil {
+		return err
+	}
+	log.Printf("[SCRAPER] Importación %d rechazada", id)
+	return nil
+}
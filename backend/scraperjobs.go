@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"f1-fantasy-app/database"
+	"f1-fantasy-app/models"
+)
+
+// Estados de un trabajo del scraper
+const (
+	scraperJobQueued    = "queued"
+	scraperJobRunning   = "running"
+	scraperJobSucceeded = "succeeded"
+	scraperJobFailed    = "failed"
+)
+
+// Trabajos en cola como máximo; el worker los ejecuta de uno en uno para no
+// lanzar varias descargas de formula1.com a la vez
+const scraperJobQueueSize = 32
+
+var (
+	scraperJobQueue  = make(chan uint, scraperJobQueueSize)
+	errScraperBusy   = errors.New("la cola del scraper está llena, inténtalo más tarde")
+	errNoResultsRead = errors.New("no hay resultados disponibles para el GP")
+)
+
+// scraperJobView es un trabajo tal y como lo devuelven los endpoints
+type scraperJobView struct {
+	models.ScraperJob
+	Sessions []scrapedSession `json:"sessions"`
+}
+
+func newScraperJobView(job models.ScraperJob) scraperJobView {
+	view := scraperJobView{ScraperJob: job, Sessions: []scrapedSession{}}
+	if len(job.Sessions) > 0 {
+		json.Unmarshal(job.Sessions, &view.Sessions)
+	}
+	return view
+}
+
+// startScraperWorker arranca el worker que ejecuta los trabajos del scraper.
+// Los trabajos que quedaron a medias por un reinicio se dan por fallidos.
+func startScraperWorker() {
+	now := time.Now()
+	res := database.DB.Model(&models.ScraperJob{}).
+		Where("status IN ?", []string{scraperJobQueued, scraperJobRunning}).
+		Updates(map[string]interface{}{"status": scraperJobFailed, "error": "Interrumpido por un reinicio del servidor", "finished_at": now})
+	if res.Error == nil && res.RowsAffected > 0 {
+		log.Printf("[SCRAPER-JOBS] %d trabajos interrumpidos marcados como fallidos", res.RowsAffected)
+	}
+
+	log.Printf("[SCRAPER-JOBS] Iniciando worker del scraper")
+	go func() {
+		for id := range scraperJobQueue {
+			runScraperJob(id)
+		}
+	}()
+}
+
+// submitScraperJob crea un trabajo del scraper y lo deja en cola
+func submitScraperJob(gpKey string, season int, dryRun bool, userID uint) (*models.ScraperJob, error) {
+	gpIndex, err := getGPIndexFromKey(gpKey)
+	if err != nil {
+		return nil, err
+	}
+	job := &models.ScraperJob{
+		GPIndex:   gpIndex,
+		GPKey:     gpKey,
+		Season:    season,
+		DryRun:    dryRun,
+		Status:    scraperJobQueued,
+		CreatedBy: userID,
+	}
+	if err := database.DB.Create(job).Error; err != nil {
+		return nil, fmt.Errorf("error creando trabajo: %v", err)
+	}
+
+	select {
+	case scraperJobQueue <- job.ID:
+		log.Printf("[SCRAPER-JOBS] Trabajo %d en cola (GP %s, dry-run %v)", job.ID, gpKey, dryRun)
+		return job, nil
+	default:
+		finishScraperJob(job, nil, errScraperBusy)
+		return nil, errScraperBusy
+	}
+}
+
+// finishScraperJob guarda el resultado final de un trabajo
+func finishScraperJob(job *models.ScraperJob, data *scrapedGP, err error) {
+	now := time.Now()
+	job.FinishedAt = &now
+	job.Status = scraperJobSucceeded
+	if data != nil {
+		job.Sessions, _ = json.Marshal(data.Sessions)
+		job.RowsScraped = data.scrapedRows()
+	}
+	if err != nil {
+		job.Status, job.Error = scraperJobFailed, err.Error()
+	}
+	if e := database.DB.Save(job).Error; e != nil {
+		log.Printf("[SCRAPER-JOBS] Error guardando el trabajo %d: %v", job.ID, e)
+	}
+	log.Printf("[SCRAPER-JOBS] Trabajo %d terminado: %s (%d filas leídas, %d guardadas)", job.ID, job.Status, job.RowsScraped, job.RowsSaved)
+}
+
+// runScraperJob ejecuta un trabajo. En dry-run deja una importación pendiente;
+// si no, aplica los resultados directamente.
+func runScraperJob(id uint) {
+	var job models.ScraperJob
+	if err := database.DB.First(&job, id).Error; err != nil {
+		log.Printf("[SCRAPER-JOBS] Trabajo %d no encontrado: %v", id, err)
+		return
+	}
+	var data *scrapedGP
+	var err error
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[SCRAPER-JOBS] PANIC RECUPERADO en trabajo %d: %v", id, r)
+			err = fmt.Errorf("panic en el scraper: %v", r)
+		}
+		finishScraperJob(&job, data, err)
+	}()
+
+	now := time.Now()
+	job.Status, job.StartedAt = scraperJobRunning, &now
+	database.DB.Save(&job)
+
+	if !job.DryRun {
+		data, job.RowsSaved, err = RunScraper(job.GPKey, job.Season)
+		if err == nil && data.scrapedRows() == 0 {
+			err = errNoResultsRead
+		}
+		return
+	}
+
+	data, err = scrapeGP(job.GPKey, job.Season)
+	if err != nil {
+		return
+	}
+	if data.scrapedRows() == 0 {
+		err = errNoResultsRead
+		return
+	}
+	var imp *models.ScraperImport
+	if imp, _, err = saveScraperImport(data, job.CreatedBy); err == nil {
+		job.ImportID = &imp.ID
+	}
+}
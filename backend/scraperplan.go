@@ -0,0 +1,408 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+
+	"f1-fantasy-app/database"
+	"f1-fantasy-app/models"
+
+	"gorm.io/gorm"
+)
+
+// scrapedGP es todo lo que el scraper ha leído de un GP, antes de escribir nada
+type scrapedGP struct {
+	GPKey            string                  `json:"gp_key"`
+	GPIndex          uint64                  `json:"gp_index"`
+	Season           int                     `json:"season"`
+	Qualifying       []ScrapedDriverData     `json:"qualifying,omitempty"`
+	Race             []ScrapedRaceData       `json:"race,omitempty"`
+	SprintQualifying []ScrapedDriverData     `json:"sprint_qualifying,omitempty"`
+	Sprint           []ScrapedRaceData       `json:"sprint,omitempty"`
+	Practice         []ScrapedPracticeData   `json:"practice,omitempty"`
+	PracticeSession  string                  `json:"practice_session,omitempty"`
+	PitStops         []ScrapedPitStopData    `json:"pit_stops,omitempty"`
+	FastestLaps      []ScrapedFastestLapData `json:"fastest_laps,omitempty"`
+	Sessions         []scrapedSession        `json:"sessions"`
+}
+
+// scrapedSession es el resultado de leer una página de resultados
+type scrapedSession struct {
+	Session string `json:"session"`
+	Status  string `json:"status"` // ok, empty, not_available o error
+	Rows    int    `json:"rows"`
+	Source  string `json:"source,omitempty"` // URL o fichero
+	Error   string `json:"error,omitempty"`
+}
+
+// recordSession apunta el resultado de leer una sesión
+func (d *scrapedGP) recordSession(session, source string, rows int, err error) {
+	s := scrapedSession{Session: session, Status: "ok", Rows: rows, Source: source}
+	switch {
+	case errors.Is(err, errSessionNotAvailable):
+		s.Status = "not_available"
+	case err != nil:
+		s.Status, s.Error = "error", err.Error()
+	case rows == 0:
+		s.Status = "empty"
+	}
+	d.Sessions = append(d.Sessions, s)
+}
+
+// scrapedRows cuenta las filas leídas de todas las sesiones
+func (d *scrapedGP) scrapedRows() int {
+	n := 0
+	for _, s := range d.Sessions {
+		n += s.Rows
+	}
+	return n
+}
+
+// plannedRow es un registro antes y después de aplicar los resultados
+type plannedRow[T any] struct {
+	Old *T // nil si el registro aún no existe
+	New T
+}
+
+// plannedRowFor devuelve el registro planificado de un piloto o equipo,
+// cargándolo de la base de datos la primera vez
+func plannedRowFor[T any](db *gorm.DB, rows map[uint]*plannedRow[T], id uint, where string, gpIndex uint64, empty T) *T {
+	if row, ok := rows[id]; ok {
+		return &row.New
+	}
+	row := &plannedRow[T]{New: empty}
+	var old T
+	if db.Where(where, id, gpIndex).First(&old).Error == nil {
+		row.Old, row.New = &old, old
+	}
+	rows[id] = row
+	return &row.New
+}
+
+// changed indica si aplicar el registro cambia algo en la base de datos
+func (r *plannedRow[T]) changed() bool {
+	return r.Old == nil || !reflect.DeepEqual(*r.Old, r.New)
+}
+
+// sortedIDs devuelve las claves de un mapa de registros en orden
+func sortedIDs[T any](rows map[uint]*plannedRow[T]) []uint {
+	ids := make([]uint, 0, len(rows))
+	for id := range rows {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// saveRows guarda los registros que cambian
+func saveRows[T any](db *gorm.DB, rows map[uint]*plannedRow[T]) (int, error) {
+	saved := 0
+	for _, id := range sortedIDs(rows) {
+		row := rows[id]
+		if !row.changed() {
+			continue
+		}
+		if err := db.Save(&row.New).Error; err != nil {
+			return saved, err
+		}
+		saved++
+	}
+	return saved, nil
+}
+
+// scraperPlan calcula cómo quedan los resultados de un GP tras aplicar lo que
+// ha leído el scraper. Solo se tocan la posición final y las marcas de vuelta
+// y parada más rápidas; la posición esperada y el resto de datos que hayan
+// metido los admins se conservan, y el delta y los puntos se recalculan con
+// el ruleset activo.
+type scraperPlan struct {
+	db      *gorm.DB
+	gpIndex uint64
+	rs      ScoringRuleset
+
+	Qualies       map[uint]*plannedRow[models.PilotQualy]
+	Races         map[uint]*plannedRow[models.PilotRace]
+	Practices     map[uint]*plannedRow[models.PilotPractice]
+	Sprints       map[uint]*plannedRow[models.PilotSprint]
+	SprintQualies map[uint]*plannedRow[models.PilotSprintQualy]
+	Teams         map[uint]*plannedRow[models.TeamRace] // Por teamconstructor_id
+
+	pilotIDs   map[string]uint // "modo/nombre" → pilot_id (0 si no existe)
+	pilotNames map[uint]string
+	teamNames  map[uint]string
+	Skipped    []string // Pilotos y equipos que no están en la base de datos
+}
+
+const pilotRowWhere = "pilot_id = ? AND gp_index = ?"
+
+func (p *scraperPlan) qualy(pilotID uint) *models.PilotQualy {
+	return plannedRowFor(p.db, p.Qualies, pilotID, pilotRowWhere, p.gpIndex, models.PilotQualy{PilotID: pilotID, GPIndex: p.gpIndex})
+}
+
+func (p *scraperPlan) race(pilotID uint) *models.PilotRace {
+	return plannedRowFor(p.db, p.Races, pilotID, pilotRowWhere, p.gpIndex, models.PilotRace{PilotID: pilotID, GPIndex: p.gpIndex})
+}
+
+func (p *scraperPlan) practice(pilotID uint) *models.PilotPractice {
+	return plannedRowFor(p.db, p.Practices, pilotID, pilotRowWhere, p.gpIndex, models.PilotPractice{PilotID: pilotID, GPIndex: p.gpIndex})
+}
+
+func (p *scraperPlan) sprint(pilotID uint) *models.PilotSprint {
+	return plannedRowFor(p.db, p.Sprints, pilotID, pilotRowWhere, p.gpIndex, models.PilotSprint{PilotID: pilotID, GPIndex: p.gpIndex})
+}
+
+func (p *scraperPlan) sprintQualy(pilotID uint) *models.PilotSprintQualy {
+	return plannedRowFor(p.db, p.SprintQualies, pilotID, pilotRowWhere, p.gpIndex, models.PilotSprintQualy{PilotID: pilotID, GPIndex: p.gpIndex})
+}
+
+func (p *scraperPlan) team(teamConstructorID uint) *models.TeamRace {
+	return plannedRowFor(p.db, p.Teams, teamConstructorID, "teamconstructor_id = ? AND gp_index = ?", p.gpIndex, models.TeamRace{TeamConstructorID: teamConstructorID, GPIndex: p.gpIndex})
+}
+
+// pilotID busca la carta de un piloto por nombre y modo (R, Q o P)
+func (p *scraperPlan) pilotID(mode, name string) (uint, bool) {
+	key := mode + "/" + name
+	if id, ok := p.pilotIDs[key]; ok {
+		return id, id != 0
+	}
+	var pilot models.Pilot
+	if err := p.db.Where("driver_name = ? AND mode = ?", name, mode).First(&pilot).Error; err != nil {
+		log.Printf("[SCRAPER] INFO: Piloto '%s' (%s) no está en la base de datos; se omite.", name, mode)
+		p.Skipped = append(p.Skipped, fmt.Sprintf("%s (%s)", name, mode))
+		p.pilotIDs[key] = 0
+		return 0, false
+	}
+	p.pilotIDs[key] = pilot.ID
+	p.pilotNames[pilot.ID] = name
+	return pilot.ID, true
+}
+
+// teamID busca el equipo de este GP por nombre (o cualquiera con ese nombre)
+func (p *scraperPlan) teamID(name string) (uint, bool) {
+	var team models.TeamConstructor
+	if err := p.db.Where("name = ? AND gp_index = ?", name, p.gpIndex).First(&team).Error; err != nil {
+		if err := p.db.Where("name = ?", name).First(&team).Error; err != nil {
+			log.Printf("[SCRAPER] INFO: Equipo '%s' no está en la base de datos; se omite.", name)
+			p.Skipped = append(p.Skipped, name)
+			return 0, false
+		}
+	}
+	p.teamNames[team.ID] = name
+	return team.ID, true
+}
+
+// buildScraperPlan calcula el plan leyendo el estado actual con db
+func buildScraperPlan(db *gorm.DB, data *scrapedGP) *scraperPlan {
+	p := &scraperPlan{
+		db:            db,
+		gpIndex:       data.GPIndex,
+		rs:            activeScoringRuleset(),
+		Qualies:       map[uint]*plannedRow[models.PilotQualy]{},
+		Races:         map[uint]*plannedRow[models.PilotRace]{},
+		Practices:     map[uint]*plannedRow[models.PilotPractice]{},
+		Sprints:       map[uint]*plannedRow[models.PilotSprint]{},
+		SprintQualies: map[uint]*plannedRow[models.PilotSprintQualy]{},
+		Teams:         map[uint]*plannedRow[models.TeamRace]{},
+		pilotIDs:      map[string]uint{},
+		pilotNames:    map[uint]string{},
+		teamNames:     map[uint]string{},
+	}
+
+	for _, d := range data.Qualifying {
+		if id, ok := p.pilotID("Q", d.DriverName); ok {
+			p.qualy(id).FinishPosition = d.Position
+		}
+	}
+	for _, d := range data.Race {
+		if id, ok := p.pilotID("R", d.DriverName); ok {
+			p.race(id).FinishPosition = d.Position
+		}
+	}
+	for _, d := range data.Practice {
+		if id, ok := p.pilotID("P", d.DriverName); ok {
+			p.practice(id).FinishPosition = d.Position
+		}
+	}
+	// La sprint puntúa en las cartas R y la sprint qualifying en las Q
+	for _, d := range data.Sprint {
+		if id, ok := p.pilotID("R", d.DriverName); ok {
+			p.sprint(id).FinishPosition = d.Position
+		}
+	}
+	for _, d := range data.SprintQualifying {
+		if id, ok := p.pilotID("Q", d.DriverName); ok {
+			p.sprintQualy(id).FinishPosition = d.Position
+		}
+	}
+	if len(data.PitStops) > 0 {
+		p.applyPitStops(data.PitStops)
+	}
+	if len(data.FastestLaps) > 0 {
+		p.applyFastestLaps(data.FastestLaps)
+	}
+
+	p.score()
+	return p
+}
+
+// applyPitStops guarda el tiempo en pit lane de la parada más rápida de cada
+// equipo y marca la más rápida del GP. formula1.com solo publica el tiempo en
+// pit lane, así que el tiempo parado (pitstop_time) queda como lo dejó el admin.
+func (p *scraperPlan) applyPitStops(stops []ScrapedPitStopData) {
+	byTeam := fastestPitStopsByTeam(stops)
+	var fastestTeam string
+	for team, duration := range byTeam {
+		if fastestTeam == "" || duration < byTeam[fastestTeam] || (duration == byTeam[fastestTeam] && team < fastestTeam) {
+			fastestTeam = team
+		}
+	}
+	log.Printf("[SCRAPER] Parada más rápida del GP: %s (%.3fs)", fastestTeam, byTeam[fastestTeam])
+
+	var fastestID uint
+	for team, duration := range byTeam {
+		id, ok := p.teamID(team)
+		if !ok {
+			continue
+		}
+		d := duration
+		row := p.team(id)
+		row.PitLaneTime = &d
+		row.FastestPitstop = team == fastestTeam
+		if row.FastestPitstop {
+			fastestID = id
+		}
+	}
+
+	// Quitar la marca a los equipos que la tenían de una lectura anterior
+	var marked []uint
+	p.db.Model(&models.TeamRace{}).Where("gp_index = ? AND fastest_pitstop = ?", p.gpIndex, true).Pluck("teamconstructor_id", &marked)
+	for _, id := range marked {
+		if id != fastestID {
+			p.team(id).FastestPitstop = false
+		}
+	}
+}
+
+// applyFastestLaps marca la vuelta rápida en el resultado de carrera del
+// primero de la tabla y se la quita al resto
+func (p *scraperPlan) applyFastestLaps(laps []ScrapedFastestLapData) {
+	var fastest *ScrapedFastestLapData
+	for i := range laps {
+		if laps[i].Position == 1 {
+			fastest = &laps[i]
+			break
+		}
+	}
+	if fastest == nil {
+		return
+	}
+	log.Printf("[SCRAPER] Vuelta rápida del GP: %s (%s)", fastest.DriverName, fastest.Time)
+
+	id, ok := p.pilotID("R", fastest.DriverName)
+	if ok {
+		var count int64
+		p.db.Model(&models.PilotRace{}).Where(pilotRowWhere, id, p.gpIndex).Count(&count)
+		if _, planned := p.Races[id]; count > 0 || planned {
+			p.race(id).FastestLap = true
+		} else {
+			log.Printf("[SCRAPER] INFO: '%s' no tiene resultado de carrera en el GP %d; vuelta rápida sin asignar", fastest.DriverName, p.gpIndex)
+		}
+	}
+
+	var marked []uint
+	p.db.Model(&models.PilotRace{}).Where("gp_index = ? AND fastest_lap = ?", p.gpIndex, true).Pluck("pilot_id", &marked)
+	for _, pilotID := range marked {
+		if pilotID != id {
+			p.race(pilotID).FastestLap = false
+		}
+	}
+}
+
+// score recalcula delta y puntos de los registros tocados con el ruleset activo
+func (p *scraperPlan) score() {
+	for _, row := range p.Qualies {
+		r := &row.New
+		r.DeltaPosition = sprintDelta(r.ExpectedPosition, r.FinishPosition)
+		r.Points, r.ScoringVersion = p.rs.ScorePilotQualy(*r), p.rs.Version
+	}
+	for _, row := range p.Races {
+		r := &row.New
+		r.DeltaPosition = sprintDelta(r.ExpectedPosition, r.FinishPosition)
+		r.Points, r.ScoringVersion = p.rs.ScorePilotRace(*r), p.rs.Version
+	}
+	for _, row := range p.Practices {
+		r := &row.New
+		r.DeltaPosition = sprintDelta(r.ExpectedPosition, r.FinishPosition)
+		r.Points, r.ScoringVersion = p.rs.ScorePilotPractice(*r), p.rs.Version
+	}
+	for _, row := range p.Sprints {
+		r := &row.New
+		r.DeltaPosition = sprintDelta(r.ExpectedPosition, r.FinishPosition)
+		r.Points, r.ScoringVersion = p.rs.ScorePilotSprint(*r), p.rs.Version
+	}
+	for _, row := range p.SprintQualies {
+		r := &row.New
+		r.DeltaPosition = sprintDelta(r.ExpectedPosition, r.FinishPosition)
+		r.Points, r.ScoringVersion = p.rs.ScorePilotSprintQualy(*r), p.rs.Version
+	}
+	for _, row := range p.Teams {
+		r := &row.New
+		r.Points, r.ScoringVersion = p.rs.ScoreTeamRace(*r), p.rs.Version
+	}
+}
+
+// save escribe los registros que cambian y devuelve cuántos ha guardado
+func (p *scraperPlan) save() (int, error) {
+	total := 0
+	for _, save := range []func() (int, error){
+		func() (int, error) { return saveRows(p.db, p.Qualies) },
+		func() (int, error) { return saveRows(p.db, p.Races) },
+		func() (int, error) { return saveRows(p.db, p.Practices) },
+		func() (int, error) { return saveRows(p.db, p.Sprints) },
+		func() (int, error) { return saveRows(p.db, p.SprintQualies) },
+		func() (int, error) { return saveRows(p.db, p.Teams) },
+	} {
+		n, err := save()
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// countChanged cuenta los registros de un mapa que cambian
+func countChanged[T any](rows map[uint]*plannedRow[T]) int {
+	n := 0
+	for _, row := range rows {
+		if row.changed() {
+			n++
+		}
+	}
+	return n
+}
+
+// changedCount cuenta los registros que cambian
+func (p *scraperPlan) changedCount() int {
+	return countChanged(p.Qualies) + countChanged(p.Races) + countChanged(p.Practices) +
+		countChanged(p.Sprints) + countChanged(p.SprintQualies) + countChanged(p.Teams)
+}
+
+// applyScrapedGP aplica los resultados leídos en una transacción y regenera
+// el desglose de puntos del GP
+func applyScrapedGP(data *scrapedGP) (*scraperPlan, error) {
+	var plan *scraperPlan
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		plan = buildScraperPlan(tx, data)
+		_, err := plan.save()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	storeGPLineItems(database.DB, data.GPIndex)
+	return plan, nil
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"f1-fantasy-app/database"
+	"f1-fantasy-app/models"
+
+	"gorm.io/gorm"
+)
+
+// Sesiones de un fin de semana de GP, en orden cronológico habitual
+const (
+	sessionFP1              = "fp1"
+	sessionFP2              = "fp2"
+	sessionFP3              = "fp3"
+	sessionSprintQualifying = "sprint_qualifying"
+	sessionSprint           = "sprint"
+	sessionQualifying       = "qualifying"
+	sessionRace             = "race"
+)
+
+var gpSessionNames = []string{sessionFP1, sessionFP2, sessionFP3, sessionSprintQualifying, sessionSprint, sessionQualifying, sessionRace}
+
+// Sesión cuyo inicio bloquea cada grupo de la alineación. Los grupos sin
+// sesión (track engineers y chip) valen para todo el fin de semana y se
+// bloquean con la primera sesión. El hueco de sprint se bloquea con la sprint
+// qualifying porque las cartas de clasificación puntúan en ella. Capitán y
+// vicecapitán se bloquean con la sesión del grupo en el que están alineados
+// (ver slotSession); aquí figura la carrera, la última en la que se eligen.
+var lineupSlotSessions = map[string]string{
+	"practice_pilots":       sessionFP1,
+	"bench_pilots.practice": sessionFP1,
+	"qualifying_pilots":     sessionQualifying,
+	"bench_pilots.qualy":    sessionQualifying,
+	"race_pilots":           sessionRace,
+	"bench_pilots.race":     sessionRace,
+	"team_constructor_id":   sessionRace,
+	"chief_engineer_id":     sessionRace,
+	"sprint_pilots":         sessionSprintQualifying,
+	"track_engineers":       "",
+	"captain_id":            sessionRace,
+	"vice_captain_id":       sessionRace,
+	"chip":                  "",
+}
+
+// gpSchedule es el horario de sesiones de un GP. Si una sesión no tiene hora
+// guardada se usa GrandPrix.StartDate, que era el bloqueo único anterior.
+type gpSchedule struct {
+	GP     models.GrandPrix
+	Starts map[string]time.Time
+}
+
+// loadGPSchedule carga las sesiones guardadas de un GP
+func loadGPSchedule(gp models.GrandPrix) gpSchedule {
+	var sessions []models.GrandPrixSession
+	database.DB.Where("gp_index = ?", gp.GPIndex).Find(&sessions)
+	schedule := gpSchedule{GP: gp, Starts: make(map[string]time.Time, len(sessions))}
+	for _, s := range sessions {
+		schedule.Starts[s.Session] = s.StartTime
+	}
+	return schedule
+}
+
+// sessionStart devuelve el inicio de una sesión; "" es la primera del GP
+func (s gpSchedule) sessionStart(session string) time.Time {
+	if session == "" {
+		return s.firstStart()
+	}
+	if session == sessionSprintQualifying {
+		if _, ok := s.Starts[session]; !ok {
+			session = sessionSprint
+		}
+	}
+	if start, ok := s.Starts[session]; ok {
+		return start
+	}
+	return s.GP.StartDate
+}
+
+// firstStart es el inicio de la primera sesión del GP
+func (s gpSchedule) firstStart() time.Time {
+	if len(s.Starts) == 0 {
+		return s.GP.StartDate
+	}
+	var first time.Time
+	for _, start := range s.Starts {
+		if first.IsZero() || start.Before(first) {
+			first = start
+		}
+	}
+	return first
+}
+
+// lastStart es el inicio de la última sesión del GP; a partir de ahí ya no se
+// puede tocar nada de la alineación
+func (s gpSchedule) lastStart() time.Time {
+	last := s.GP.StartDate
+	if len(s.Starts) > 0 {
+		last = time.Time{}
+		for _, start := range s.Starts {
+			if start.After(last) {
+				last = start
+			}
+		}
+	}
+	return last
+}
+
+// started indica si la sesión ya ha empezado
+func (s gpSchedule) started(session string, now time.Time) bool {
+	return !s.sessionStart(session).After(now)
+}
+
+// captainSlotSession devuelve la sesión en la que puntúa el capitán o
+// vicecapitán id: la clasificación si está alineado en ella y, si no, la
+// carrera
+func captainSlotSession(lineup models.Lineup, id *uint) string {
+	if id == nil {
+		return sessionRace
+	}
+	var qualifying []uint
+	if len(lineup.QualifyingPilots) > 0 {
+		json.Unmarshal(lineup.QualifyingPilots, &qualifying)
+	}
+	for _, pilotID := range qualifying {
+		if pilotID == *id {
+			return sessionQualifying
+		}
+	}
+	return sessionRace
+}
+
+// slotSession devuelve la sesión cuyo inicio bloquea un grupo de la alineación
+func slotSession(slot string, lineup models.Lineup) string {
+	switch slot {
+	case "captain_id":
+		return captainSlotSession(lineup, lineup.CaptainID)
+	case "vice_captain_id":
+		return captainSlotSession(lineup, lineup.ViceCaptainID)
+	}
+	return lineupSlotSessions[slot]
+}
+
+// slotLockStart devuelve cuándo se bloqueó un grupo: el primer inicio ya
+// pasado de su sesión en cualquiera de las alineaciones
+func (s gpSchedule) slotLockStart(slot string, now time.Time, lineups ...models.Lineup) (time.Time, bool) {
+	if len(lineups) == 0 {
+		lineups = []models.Lineup{{}}
+	}
+	var first time.Time
+	for _, lineup := range lineups {
+		start := s.sessionStart(slotSession(slot, lineup))
+		if !start.After(now) && (first.IsZero() || start.Before(first)) {
+			first = start
+		}
+	}
+	return first, !first.IsZero()
+}
+
+// lockedSlots devuelve los grupos ya bloqueados en alguna de las alineaciones
+func (s gpSchedule) lockedSlots(now time.Time, lineups ...models.Lineup) []string {
+	var locked []string
+	for slot := range lineupSlotSessions {
+		if _, ok := s.slotLockStart(slot, now, lineups...); ok {
+			locked = append(locked, slot)
+		}
+	}
+	sort.Strings(locked)
+	return locked
+}
+
+// saveGPSessions sustituye el horario de sesiones de un GP
+func saveGPSessions(gpIndex uint64, sessions []models.GrandPrixSession) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("gp_index = ?", gpIndex).Delete(&models.GrandPrixSession{}).Error; err != nil {
+			return err
+		}
+		if len(sessions) == 0 {
+			return nil
+		}
+		return tx.Create(&sessions).Error
+	})
+}
+
+// gpSessionStatus es una sesión del horario tal y como la ven los endpoints
+type gpSessionStatus struct {
+	Session   string    `json:"session"`
+	StartTime time.Time `json:"start_time"`
+	IsStarted bool      `json:"is_started"`
+}
+
+// sessionStatuses devuelve las sesiones con hora guardada en orden de inicio
+func (s gpSchedule) sessionStatuses(now time.Time) []gpSessionStatus {
+	out := []gpSessionStatus{}
+	for _, name := range gpSessionNames {
+		if start, ok := s.Starts[name]; ok {
+			out = append(out, gpSessionStatus{Session: name, StartTime: start, IsStarted: !start.After(now)})
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].StartTime.Before(out[j].StartTime) })
+	return out
+}
+
+// lineupTargetGP devuelve el GP cuya alineación se edita ahora: el primero
+// que todavía tiene alguna sesión sin empezar
+func lineupTargetGP(now time.Time) (gpSchedule, bool) {
+	var gps []models.GrandPrix
+	database.DB.Order("start_date ASC").Find(&gps)
+	for _, gp := range gps {
+		schedule := loadGPSchedule(gp)
+		if schedule.lastStart().After(now) {
+			return schedule, true
+		}
+	}
+	return gpSchedule{}, false
+}
+
+// lineupSlotValue devuelve el contenido de un grupo de la alineación de forma
+// comparable
+func lineupSlotValue(lineup models.Lineup, slot string) string {
+	ids := func(raw []byte) string {
+		var list []uint
+		if len(raw) > 0 {
+			json.Unmarshal(raw, &list)
+		}
+		if len(list) == 0 {
+			return "[]"
+		}
+		out, _ := json.Marshal(list)
+		return string(out)
+	}
+	ptr := func(id *uint) string {
+		if id == nil {
+			return ""
+		}
+		return fmt.Sprint(*id)
+	}
+	switch slot {
+	case "race_pilots":
+		return ids(lineup.RacePilots)
+	case "qualifying_pilots":
+		return ids(lineup.QualifyingPilots)
+	case "practice_pilots":
+		return ids(lineup.PracticePilots)
+	case "sprint_pilots":
+		return ids(lineup.SprintPilots)
+	case "track_engineers":
+		return ids(lineup.TrackEngineers)
+	case "team_constructor_id":
+		return ptr(lineup.TeamConstructorID)
+	case "chief_engineer_id":
+		return ptr(lineup.ChiefEngineerID)
+	case "captain_id":
+		return ptr(lineup.CaptainID)
+	case "vice_captain_id":
+		return ptr(lineup.ViceCaptainID)
+	case "bench_pilots.race", "bench_pilots.qualy", "bench_pilots.practice":
+		bench := lineupBench(lineup)[slot[len("bench_pilots."):]]
+		if len(bench) == 0 {
+			return "[]"
+		}
+		out, _ := json.Marshal(bench)
+		return string(out)
+	}
+	return ""
+}
+
+// lockedSlotChanges devuelve un error por cada grupo bloqueado que la nueva
+// alineación cambia respecto a la guardada. chip es el chip pedido (nil si no
+// se toca). El capitán no se puede cambiar si ya empezó la sesión en la que
+// puntúa el guardado o la del nuevo.
+func lockedSlotChanges(schedule gpSchedule, now time.Time, saved models.Lineup, next models.Lineup, chip *string) []lineupSlotError {
+	var errs []lineupSlotError
+	for _, slot := range schedule.lockedSlots(now, saved, next) {
+		start, _ := schedule.slotLockStart(slot, now, saved, next)
+		changed := false
+		if slot == "chip" {
+			changed = chip != nil && *chip != lineupChip(saved)
+		} else {
+			changed = lineupSlotValue(saved, slot) != lineupSlotValue(next, slot)
+		}
+		if changed {
+			errs = append(errs, lineupSlotError{
+				Slot:  slot,
+				Error: fmt.Sprintf("%s está bloqueado desde %s", slot, start.Format("2006-01-02 15:04")),
+			})
+		}
+	}
+	return errs
+}
+
+// frozenSlots devuelve los grupos bloqueados que la nueva alineación deja
+// igual que la guardada
+func frozenSlots(schedule gpSchedule, now time.Time, saved models.Lineup, next models.Lineup) map[string]bool {
+	frozen := make(map[string]bool)
+	for _, slot := range schedule.lockedSlots(now, saved, next) {
+		if slot != "chip" && lineupSlotValue(saved, slot) == lineupSlotValue(next, slot) {
+			frozen[slot] = true
+		}
+	}
+	return frozen
+}
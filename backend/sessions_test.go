@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"f1-fantasy-app/models"
+)
+
+// Tras la clasificación, los grupos bloqueados que se reenvían igual quedan
+// fuera de la validación y sus errores (p. ej. una carta ya vendida) se ignoran
+func TestFrozenSlots(t *testing.T) {
+	base := time.Date(2025, 4, 11, 11, 30, 0, 0, time.UTC)
+	schedule := gpSchedule{Starts: map[string]time.Time{
+		sessionFP1:        base,
+		sessionQualifying: base.Add(28 * time.Hour),
+		sessionRace:       base.Add(52 * time.Hour),
+	}}
+	now := base.Add(30 * time.Hour)
+
+	saved := models.Lineup{
+		RacePilots:       []byte("[1,2]"),
+		QualifyingPilots: []byte("[5,6]"),
+		PracticePilots:   []byte("[9]"),
+		TrackEngineers:   []byte("[3]"),
+	}
+	next := saved
+	next.RacePilots = []byte("[1,4]")
+	next.PracticePilots = []byte("[8]")
+
+	frozen := frozenSlots(schedule, now, saved, next)
+	for _, slot := range []string{"qualifying_pilots", "track_engineers"} {
+		if !frozen[slot] {
+			t.Errorf("%s debería estar congelado", slot)
+		}
+	}
+	for _, slot := range []string{"race_pilots", "practice_pilots", "chip"} {
+		if frozen[slot] {
+			t.Errorf("%s no debería estar congelado", slot)
+		}
+	}
+
+	errs := withoutSlots([]lineupSlotError{
+		{Slot: "qualifying_pilots", ID: 6, Error: "El piloto 6 no es tuyo"},
+		{Slot: "track_engineers", ID: 3, Error: "No tienes ningún piloto del track engineer 3"},
+		{Slot: "race_pilots", ID: 4, Error: "El piloto 4 no es tuyo"},
+	}, frozen)
+	if len(errs) != 1 || errs[0].Slot != "race_pilots" {
+		t.Fatalf("errores = %+v, want solo race_pilots", errs)
+	}
+}
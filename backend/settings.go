@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"f1-fantasy-app/database"
+	"f1-fantasy-app/models"
+
+	"gorm.io/gorm"
+)
+
+// Valores por defecto de la configuración de una liga
+const (
+	defaultStartingMoney        = 100000000 // 100M
+	defaultAuctionDurationHours = 24
+	defaultClausulaDays         = 14
+	defaultFIAOfferHours        = 24
+	defaultMarketRefreshHours   = 24
+	defaultFIAMinMultiplier     = 0.9
+	defaultFIAMaxMultiplier     = 1.1
+	defaultMarketSlots          = 8
+	defaultCaptainMultiplier    = 2
+)
+
+// defaultEnabledChips son los chips de temporada de una liga nueva
+var defaultEnabledChips = strings.Join([]string{chipTripleCaptain, chipNoNegatives, chipDoubleChiefEngineer, chipFreeClausula}, ",")
+
+// defaultLeagueSettings devuelve la configuración por defecto de una liga
+func defaultLeagueSettings(leagueID uint) models.LeagueSettings {
+	return models.LeagueSettings{
+		LeagueID:             leagueID,
+		StartingMoney:        defaultStartingMoney,
+		AuctionDurationHours: defaultAuctionDurationHours,
+		ClausulaDays:         defaultClausulaDays,
+		FIAOfferHours:        defaultFIAOfferHours,
+		MarketRefreshHours:   defaultMarketRefreshHours,
+		FIAMinMultiplier:     defaultFIAMinMultiplier,
+		FIAMaxMultiplier:     defaultFIAMaxMultiplier,
+		CaptainMultiplier:    defaultCaptainMultiplier,
+		EnabledChips:         defaultEnabledChips,
+	}
+}
+
+// loadLeagueSettings carga la configuración de una liga o la de por defecto
+func loadLeagueSettings(tx *gorm.DB, leagueID uint) models.LeagueSettings {
+	var settings models.LeagueSettings
+	if err := tx.Where("league_id = ?", leagueID).First(&settings).Error; err != nil {
+		return defaultLeagueSettings(leagueID)
+	}
+	return settings
+}
+
+// validateLeagueSettings comprueba que la configuración de una liga sea coherente
+func validateLeagueSettings(s models.LeagueSettings) error {
+	if s.StartingMoney < 0 || s.StartingMoney > 1000000000 {
+		return fmt.Errorf("starting_money debe estar entre 0 y 1000M")
+	}
+	if s.AuctionDurationHours < 1 || s.AuctionDurationHours > 7*24 {
+		return fmt.Errorf("auction_duration_hours debe estar entre 1 y 168")
+	}
+	if s.ClausulaDays < 0 || s.ClausulaDays > 60 {
+		return fmt.Errorf("clausula_days debe estar entre 0 y 60")
+	}
+	if s.FIAOfferHours < 1 || s.FIAOfferHours > 7*24 {
+		return fmt.Errorf("fia_offer_hours debe estar entre 1 y 168")
+	}
+	if s.MarketRefreshHours < 1 || s.MarketRefreshHours > 7*24 {
+		return fmt.Errorf("market_refresh_hours debe estar entre 1 y 168")
+	}
+	if s.FIAMinMultiplier <= 0 || s.FIAMaxMultiplier > 3 {
+		return fmt.Errorf("los multiplicadores FIA deben estar entre 0 y 3")
+	}
+	if s.FIAMinMultiplier > s.FIAMaxMultiplier {
+		return fmt.Errorf("fia_min_multiplier (%.2f) supera fia_max_multiplier (%.2f)", s.FIAMinMultiplier, s.FIAMaxMultiplier)
+	}
+	if s.CaptainMultiplier < 1 || s.CaptainMultiplier > 3 {
+		return fmt.Errorf("captain_multiplier debe estar entre 1 y 3")
+	}
+	if err := validateEnabledChips(s.EnabledChips); err != nil {
+		return fmt.Errorf("enabled_chips: %v", err)
+	}
+	return nil
+}
+
+// saveLeagueSettings guarda la configuración de la liga y, si se indica, la del
+// mercado en la misma transacción
+func saveLeagueSettings(settings *models.LeagueSettings, market *models.LeagueMarketSettings) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(settings).Error; err != nil {
+			return err
+		}
+		if market != nil {
+			return tx.Save(market).Error
+		}
+		return nil
+	})
+}
+
+// auctionEndTime devuelve el cierre de una subasta que empieza ahora
+func auctionEndTime(s models.LeagueSettings) time.Time {
+	return time.Now().Add(time.Duration(s.AuctionDurationHours) * time.Hour)
+}
+
+// clausulaExpiry devuelve hasta cuándo protege la cláusula un fichaje
+func clausulaExpiry(s models.LeagueSettings, from time.Time) time.Time {
+	return from.Add(time.Duration(s.ClausulaDays) * 24 * time.Hour)
+}
+
+// fiaOfferExpiry devuelve hasta cuándo es válida una oferta de la FIA generada ahora
+func fiaOfferExpiry(s models.LeagueSettings) time.Time {
+	return time.Now().Add(time.Duration(s.FIAOfferHours) * time.Hour)
+}
+
+// nextMarketRefresh devuelve cuándo toca el siguiente refresco del mercado
+func nextMarketRefresh(s models.LeagueSettings) time.Time {
+	return time.Now().Add(time.Duration(s.MarketRefreshHours) * time.Hour)
+}
+
+// fiaMultiplier devuelve un multiplicador aleatorio dentro del rango FIA de la liga
+func fiaMultiplier(rng *rand.Rand, s models.LeagueSettings) float64 {
+	r := rand.Float64
+	if rng != nil {
+		r = rng.Float64
+	}
+	return s.FIAMinMultiplier + r()*(s.FIAMaxMultiplier-s.FIAMinMultiplier)
+}
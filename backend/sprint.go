@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"f1-fantasy-app/database"
+	"f1-fantasy-app/models"
+
+	"gorm.io/gorm"
+)
+
+// Huecos de sprint de una alineación en un GP con sprint
+const sprintLineupSlots = 1
+
+// gpHasSprint indica si un GP es fin de semana con sprint
+func gpHasSprint(gpIndex uint64) bool {
+	var gp models.GrandPrix
+	if err := database.DB.Select("gp_index", "has_sprint").Where("gp_index = ?", gpIndex).First(&gp).Error; err != nil {
+		return false
+	}
+	return gp.HasSprint
+}
+
+// getPilotSprintPoints devuelve los puntos de un piloto alineado en el hueco de
+// sprint: la sprint si es carta de carrera o la sprint qualifying si es de clasificación
+func getPilotSprintPoints(tx *gorm.DB, pilotByLeagueID uint, gpIndex uint64) int {
+	var pilotByLeague models.PilotByLeague
+	var pilot models.Pilot
+	if tx.First(&pilotByLeague, pilotByLeagueID).Error != nil || tx.First(&pilot, pilotByLeague.PilotID).Error != nil {
+		return 0
+	}
+	session := sprintSessionName(pilot.Mode)
+	if session == "" {
+		return 0
+	}
+	points, ok := pilotSessionPointsForLeague(tx, pilotByLeague.LeagueID, session, pilot.ID, gpIndex)
+	if !ok {
+		log.Printf("[SPRINT-POINTS] No se encontraron puntos de %s para pilot_id=%d, gp_index=%d", session, pilot.ID, gpIndex)
+		return 0
+	}
+	return points
+}
+
+// validateSprintPilots comprueba el hueco de sprint de una alineación
+func validateSprintPilots(gp models.GrandPrix, sprintPilots []uint) error {
+	if len(sprintPilots) == 0 {
+		return nil
+	}
+	if !gp.HasSprint {
+		return fmt.Errorf("El GP %s no tiene sprint", gp.Name)
+	}
+	if len(sprintPilots) > sprintLineupSlots {
+		return fmt.Errorf("Solo se puede alinear %d piloto en la sprint", sprintLineupSlots)
+	}
+	return nil
+}
+
+// sprintResultInput son los datos de un piloto en una sesión de sprint. Los
+// campos a nil conservan el valor guardado.
+type sprintResultInput struct {
+	StartPosition    *int     `json:"start_position"`
+	FinishPosition   *int     `json:"finish_position"`
+	ExpectedPosition *float64 `json:"expected_position"`
+	CausedRedFlag    *bool    `json:"caused_red_flag"`
+	DNFDriverError   *bool    `json:"dnf_driver_error"` // Solo sprint
+	DNFNoFault       *bool    `json:"dnf_no_fault"`     // Solo sprint
+}
+
+// sprintDelta es la diferencia entre la posición esperada y la final; sin
+// posición esperada no hay delta
+func sprintDelta(expected float64, finish int) int {
+	if expected <= 0 || finish <= 0 {
+		return 0
+	}
+	return int(expected) - finish
+}
+
+// saveSprintResult guarda el resultado de un piloto en la sprint o en la sprint
+// qualifying, lo puntúa con el ruleset activo y devuelve los puntos
+func saveSprintResult(session string, pilotID uint, gpIndex uint64, in sprintResultInput) (int, error) {
+	rs := activeScoringRuleset()
+	setInt := func(dst *int, v *int) {
+		if v != nil {
+			*dst = *v
+		}
+	}
+	setBool := func(dst *bool, v *bool) {
+		if v != nil {
+			*dst = *v
+		}
+	}
+
+	var points int
+	var err error
+	switch session {
+	case "sprint":
+		var row models.PilotSprint
+		if database.DB.Where("pilot_id = ? AND gp_index = ?", pilotID, gpIndex).First(&row).Error != nil {
+			row = models.PilotSprint{PilotID: pilotID, GPIndex: gpIndex}
+		}
+		setInt(&row.StartPosition, in.StartPosition)
+		setInt(&row.FinishPosition, in.FinishPosition)
+		if in.ExpectedPosition != nil {
+			row.ExpectedPosition = *in.ExpectedPosition
+		}
+		setBool(&row.CausedRedFlag, in.CausedRedFlag)
+		setBool(&row.DNFDriverError, in.DNFDriverError)
+		setBool(&row.DNFNoFault, in.DNFNoFault)
+		row.DeltaPosition = sprintDelta(row.ExpectedPosition, row.FinishPosition)
+		row.Points = rs.ScorePilotSprint(row)
+		row.ScoringVersion = rs.Version
+		points, err = row.Points, database.DB.Save(&row).Error
+	case "sprint_qualy":
+		var row models.PilotSprintQualy
+		if database.DB.Where("pilot_id = ? AND gp_index = ?", pilotID, gpIndex).First(&row).Error != nil {
+			row = models.PilotSprintQualy{PilotID: pilotID, GPIndex: gpIndex}
+		}
+		setInt(&row.StartPosition, in.StartPosition)
+		setInt(&row.FinishPosition, in.FinishPosition)
+		if in.ExpectedPosition != nil {
+			row.ExpectedPosition = *in.ExpectedPosition
+		}
+		setBool(&row.CausedRedFlag, in.CausedRedFlag)
+		row.DeltaPosition = sprintDelta(row.ExpectedPosition, row.FinishPosition)
+		row.Points = rs.ScorePilotSprintQualy(row)
+		row.ScoringVersion = rs.Version
+		points, err = row.Points, database.DB.Save(&row).Error
+	default:
+		return 0, fmt.Errorf("sesión de sprint inválida: %s", session)
+	}
+	if err != nil {
+		return 0, err
+	}
+	storePilotLineItems(database.DB, session, pilotID, gpIndex)
+	calculateTrackEngineerPointsForPilot(database.DB, pilotID, gpIndex, session)
+	return points, nil
+}
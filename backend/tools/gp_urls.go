@@ -1,6 +1,9 @@
 package main
 
-// GPURLs contiene las URLs de todos los GPs de la temporada 2025
+// GPURLs contiene las URLs de todos los GPs de la temporada 2025. Los fines de
+// semana con sprint incluyen además sprint_qualifying y sprint. Solo sirve de
+// referencia para esta herramienta: el scraper del backend descubre las URLs
+// de cada temporada en el índice de resultados de formula1.com.
 var GPURLs = map[string]map[string]string{
 	"australian": {
 		"name":         "Australian Grand Prix",
@@ -47,26 +50,30 @@ var GPURLs = map[string]map[string]string{
 		"gp_index":     "4",
 	},
 	"belgian": {
-		"name":         "Belgian Grand Prix",
-		"race":         "https://www.formula1.com/en/results/2025/races/1265/belgium/race-result",
-		"qualifying":   "https://www.formula1.com/en/results/2025/races/1265/belgium/qualifying",
-		"practice1":    "https://www.formula1.com/en/results/2025/races/1265/belgium/practice/1",
-		"practice2":    "https://www.formula1.com/en/results/2025/races/1265/belgium/practice/2",
-		"practice3":    "https://www.formula1.com/en/results/2025/races/1265/belgium/practice/3",
-		"pit_stops":    "https://www.formula1.com/en/results/2025/races/1265/belgium/pit-stop-summary",
-		"fastest_laps": "https://www.formula1.com/en/results/2025/races/1265/belgium/fastest-laps",
-		"gp_index":     "13",
+		"name":              "Belgian Grand Prix",
+		"race":              "https://www.formula1.com/en/results/2025/races/1265/belgium/race-result",
+		"qualifying":        "https://www.formula1.com/en/results/2025/races/1265/belgium/qualifying",
+		"sprint_qualifying": "https://www.formula1.com/en/results/2025/races/1265/belgium/sprint-qualifying",
+		"sprint":            "https://www.formula1.com/en/results/2025/races/1265/belgium/sprint-results",
+		"practice1":         "https://www.formula1.com/en/results/2025/races/1265/belgium/practice/1",
+		"practice2":         "https://www.formula1.com/en/results/2025/races/1265/belgium/practice/2",
+		"practice3":         "https://www.formula1.com/en/results/2025/races/1265/belgium/practice/3",
+		"pit_stops":         "https://www.formula1.com/en/results/2025/races/1265/belgium/pit-stop-summary",
+		"fastest_laps":      "https://www.formula1.com/en/results/2025/races/1265/belgium/fastest-laps",
+		"gp_index":          "13",
 	},
 	"brazilian": {
-		"name":         "Brazilian Grand Prix",
-		"race":         "https://www.formula1.com/en/results/2025/races/1275/brazil/race-result",
-		"qualifying":   "https://www.formula1.com/en/results/2025/races/1275/brazil/qualifying",
-		"practice1":    "https://www.formula1.com/en/results/2025/races/1275/brazil/practice/1",
-		"practice2":    "https://www.formula1.com/en/results/2025/races/1275/brazil/practice/2",
-		"practice3":    "https://www.formula1.com/en/results/2025/races/1275/brazil/practice/3",
-		"pit_stops":    "https://www.formula1.com/en/results/2025/races/1275/brazil/pit-stop-summary",
-		"fastest_laps": "https://www.formula1.com/en/results/2025/races/1275/brazil/fastest-laps",
-		"gp_index":     "21",
+		"name":              "Brazilian Grand Prix",
+		"race":              "https://www.formula1.com/en/results/2025/races/1275/brazil/race-result",
+		"qualifying":        "https://www.formula1.com/en/results/2025/races/1275/brazil/qualifying",
+		"sprint_qualifying": "https://www.formula1.com/en/results/2025/races/1275/brazil/sprint-qualifying",
+		"sprint":            "https://www.formula1.com/en/results/2025/races/1275/brazil/sprint-results",
+		"practice1":         "https://www.formula1.com/en/results/2025/races/1275/brazil/practice/1",
+		"practice2":         "https://www.formula1.com/en/results/2025/races/1275/brazil/practice/2",
+		"practice3":         "https://www.formula1.com/en/results/2025/races/1275/brazil/practice/3",
+		"pit_stops":         "https://www.formula1.com/en/results/2025/races/1275/brazil/pit-stop-summary",
+		"fastest_laps":      "https://www.formula1.com/en/results/2025/races/1275/brazil/fastest-laps",
+		"gp_index":          "21",
 	},
 	"british": {
 		"name":         "British Grand Prix",
@@ -91,15 +98,17 @@ var GPURLs = map[string]map[string]string{
 		"gp_index":     "10",
 	},
 	"chinese": {
-		"name":         "Chinese Grand Prix",
-		"race":         "https://www.formula1.com/en/results/2025/races/1255/china/race-result",
-		"qualifying":   "https://www.formula1.com/en/results/2025/races/1255/china/qualifying",
-		"practice1":    "https://www.formula1.com/en/results/2025/races/1255/china/practice-1",
-		"practice2":    "https://www.formula1.com/en/results/2025/races/1255/china/practice-2",
-		"practice3":    "https://www.formula1.com/en/results/2025/races/1255/china/practice-3",
-		"pit_stops":    "https://www.formula1.com/en/results/2025/races/1255/china/pit-stop-summary",
-		"fastest_laps": "https://www.formula1.com/en/results/2025/races/1255/china/fastest-laps",
-		"gp_index":     "2",
+		"name":              "Chinese Grand Prix",
+		"race":              "https://www.formula1.com/en/results/2025/races/1255/china/race-result",
+		"qualifying":        "https://www.formula1.com/en/results/2025/races/1255/china/qualifying",
+		"sprint_qualifying": "https://www.formula1.com/en/results/2025/races/1255/china/sprint-qualifying",
+		"sprint":            "https://www.formula1.com/en/results/2025/races/1255/china/sprint-results",
+		"practice1":         "https://www.formula1.com/en/results/2025/races/1255/china/practice-1",
+		"practice2":         "https://www.formula1.com/en/results/2025/races/1255/china/practice-2",
+		"practice3":         "https://www.formula1.com/en/results/2025/races/1255/china/practice-3",
+		"pit_stops":         "https://www.formula1.com/en/results/2025/races/1255/china/pit-stop-summary",
+		"fastest_laps":      "https://www.formula1.com/en/results/2025/races/1255/china/fastest-laps",
+		"gp_index":          "2",
 	},
 	"dutch": {
 		"name":         "Dutch Grand Prix",
@@ -179,15 +188,17 @@ var GPURLs = map[string]map[string]string{
 		"gp_index":     "20",
 	},
 	"miami": {
-		"name":         "Miami Grand Prix",
-		"race":         "https://www.formula1.com/en/results/2025/races/1261/miami/race-result",
-		"qualifying":   "https://www.formula1.com/en/results/2025/races/1261/miami/qualifying",
-		"practice1":    "https://www.formula1.com/en/results/2025/races/1261/miami/practice/1",
-		"practice2":    "https://www.formula1.com/en/results/2025/races/1261/miami/practice/2",
-		"practice3":    "https://www.formula1.com/en/results/2025/races/1261/miami/practice/3",
-		"pit_stops":    "https://www.formula1.com/en/results/2025/races/1261/miami/pit-stop-summary",
-		"fastest_laps": "https://www.formula1.com/en/results/2025/races/1261/miami/fastest-laps",
-		"gp_index":     "6",
+		"name":              "Miami Grand Prix",
+		"race":              "https://www.formula1.com/en/results/2025/races/1261/miami/race-result",
+		"qualifying":        "https://www.formula1.com/en/results/2025/races/1261/miami/qualifying",
+		"sprint_qualifying": "https://www.formula1.com/en/results/2025/races/1261/miami/sprint-qualifying",
+		"sprint":            "https://www.formula1.com/en/results/2025/races/1261/miami/sprint-results",
+		"practice1":         "https://www.formula1.com/en/results/2025/races/1261/miami/practice/1",
+		"practice2":         "https://www.formula1.com/en/results/2025/races/1261/miami/practice/2",
+		"practice3":         "https://www.formula1.com/en/results/2025/races/1261/miami/practice/3",
+		"pit_stops":         "https://www.formula1.com/en/results/2025/races/1261/miami/pit-stop-summary",
+		"fastest_laps":      "https://www.formula1.com/en/results/2025/races/1261/miami/fastest-laps",
+		"gp_index":          "6",
 	},
 	"monaco": {
 		"name":         "Monaco Grand Prix",
@@ -201,15 +212,17 @@ var GPURLs = map[string]map[string]string{
 		"gp_index":     "8",
 	},
 	"qatar": {
-		"name":         "Qatar Grand Prix",
-		"race":         "https://www.formula1.com/en/results/2025/races/1272/qatar/race-result",
-		"qualifying":   "https://www.formula1.com/en/results/2025/races/1272/qatar/qualifying",
-		"practice1":    "https://www.formula1.com/en/results/2025/races/1272/qatar/practice/1",
-		"practice2":    "https://www.formula1.com/en/results/2025/races/1272/qatar/practice/2",
-		"practice3":    "https://www.formula1.com/en/results/2025/races/1272/qatar/practice/3",
-		"pit_stops":    "https://www.formula1.com/en/results/2025/races/1272/qatar/pit-stop-summary",
-		"fastest_laps": "https://www.formula1.com/en/results/2025/races/1272/qatar/fastest-laps",
-		"gp_index":     "23",
+		"name":              "Qatar Grand Prix",
+		"race":              "https://www.formula1.com/en/results/2025/races/1272/qatar/race-result",
+		"qualifying":        "https://www.formula1.com/en/results/2025/races/1272/qatar/qualifying",
+		"sprint_qualifying": "https://www.formula1.com/en/results/2025/races/1272/qatar/sprint-qualifying",
+		"sprint":            "https://www.formula1.com/en/results/2025/races/1272/qatar/sprint-results",
+		"practice1":         "https://www.formula1.com/en/results/2025/races/1272/qatar/practice/1",
+		"practice2":         "https://www.formula1.com/en/results/2025/races/1272/qatar/practice/2",
+		"practice3":         "https://www.formula1.com/en/results/2025/races/1272/qatar/practice/3",
+		"pit_stops":         "https://www.formula1.com/en/results/2025/races/1272/qatar/pit-stop-summary",
+		"fastest_laps":      "https://www.formula1.com/en/results/2025/races/1272/qatar/fastest-laps",
+		"gp_index":          "23",
 	},
 	"saudi_arabian": {
 		"name":         "Saudi Arabian Grand Prix",
@@ -245,15 +258,17 @@ var GPURLs = map[string]map[string]string{
 		"gp_index":     "9",
 	},
 	"united_states": {
-		"name":         "United States Grand Prix",
-		"race":         "https://www.formula1.com/en/results/2025/races/1273/united-states/race-result",
-		"qualifying":   "https://www.formula1.com/en/results/2025/races/1273/united-states/qualifying",
-		"practice1":    "https://www.formula1.com/en/results/2025/races/1273/united-states/practice/1",
-		"practice2":    "https://www.formula1.com/en/results/2025/races/1273/united-states/practice/2",
-		"practice3":    "https://www.formula1.com/en/results/2025/races/1273/united-states/practice/3",
-		"pit_stops":    "https://www.formula1.com/en/results/2025/races/1273/united-states/pit-stop-summary",
-		"fastest_laps": "https://www.formula1.com/en/results/2025/races/1273/united-states/fastest-laps",
-		"gp_index":     "19",
+		"name":              "United States Grand Prix",
+		"race":              "https://www.formula1.com/en/results/2025/races/1273/united-states/race-result",
+		"qualifying":        "https://www.formula1.com/en/results/2025/races/1273/united-states/qualifying",
+		"sprint_qualifying": "https://www.formula1.com/en/results/2025/races/1273/united-states/sprint-qualifying",
+		"sprint":            "https://www.formula1.com/en/results/2025/races/1273/united-states/sprint-results",
+		"practice1":         "https://www.formula1.com/en/results/2025/races/1273/united-states/practice/1",
+		"practice2":         "https://www.formula1.com/en/results/2025/races/1273/united-states/practice/2",
+		"practice3":         "https://www.formula1.com/en/results/2025/races/1273/united-states/practice/3",
+		"pit_stops":         "https://www.formula1.com/en/results/2025/races/1273/united-states/pit-stop-summary",
+		"fastest_laps":      "https://www.formula1.com/en/results/2025/races/1273/united-states/fastest-laps",
+		"gp_index":          "19",
 	},
 	"abu_dhabi": {
 		"name":         "Abu Dhabi Grand Prix",
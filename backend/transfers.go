@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"f1-fantasy-app/database"
+	"f1-fantasy-app/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errOwnerChanged   = errors.New("el elemento ha cambiado de propietario")
+	errNotEnoughMoney = errors.New("no tienes suficiente dinero")
+	errNoLeagueOffer  = errors.New("no hay oferta activa de la liga")
+)
+
+// lockPlayerLeague carga el PlayerByLeague de un manager bloqueando la fila
+// hasta el final de la transacción
+func lockPlayerLeague(tx *gorm.DB, playerID, leagueID uint) (models.PlayerByLeague, error) {
+	var pl models.PlayerByLeague
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("player_id = ? AND league_id = ?", playerID, leagueID).
+		First(&pl).Error
+	return pl, err
+}
+
+// transferItemOwner cambia el propietario de un elemento *_by_league solo si
+// sigue siendo from, junto con los campos de fields. Si otra petición lo ha
+// cambiado antes devuelve errOwnerChanged.
+func transferItemOwner(tx *gorm.DB, table string, itemID, from, to uint, fields map[string]interface{}) error {
+	updates := map[string]interface{}{"owner_id": to}
+	for k, v := range fields {
+		updates[k] = v
+	}
+	res := tx.Table(table).Where("id = ? AND owner_id = ?", itemID, from).Updates(updates)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errOwnerChanged
+	}
+	return nil
+}
+
+// payClausula transfiere un elemento a buyerID y paga la cláusula al
+// propietario anterior (o a la liga si ya no está en ella) en una única
+// transacción. Con el chip de cláusula gratis paga la liga. El comprador solo
+// puede gastar el dinero que no tiene comprometido en pujas y ofertas.
+func payClausula(table, itemType string, itemID, leagueID, oldOwnerID, buyerID uint, value float64, useChip bool, reason string) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := transferItemOwner(tx, table, itemID, oldOwnerID, buyerID, nil); err != nil {
+			return err
+		}
+		var payer *models.PlayerByLeague
+		if !useChip {
+			buyer, err := lockPlayerLeague(tx, buyerID, leagueID)
+			if err != nil {
+				return err
+			}
+			if value > playerBudget(tx, buyer, commitmentOffer, itemType, itemID).Available {
+				return errNotEnoughMoney
+			}
+			payer = &buyer
+		}
+		var seller *models.PlayerByLeague
+		if oldOwner, err := lockPlayerLeague(tx, oldOwnerID, leagueID); err == nil {
+			seller = &oldOwner
+		}
+		return moveMoney(tx, uint64(leagueID), payer, seller, value, itemType, itemID, reason)
+	})
+}
+
+// acceptPlayerOffer transfiere un elemento de sellerID a bidderID por una
+// oferta directa en una única transacción. Se limpian las ofertas, la venta y
+// la cláusula del elemento. El comprador paga con el dinero que no tiene
+// comprometido en otras pujas y ofertas.
+func acceptPlayerOffer(itemType string, itemID, leagueID, sellerID, bidderID uint, value float64) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		item, err := loadAuctionItem(tx, itemType, itemID)
+		if err != nil {
+			return err
+		}
+		bidder, err := lockPlayerLeague(tx, bidderID, leagueID)
+		if err != nil {
+			return fmt.Errorf("comprador %d no encontrado en liga %d", bidderID, leagueID)
+		}
+		seller, err := lockPlayerLeague(tx, sellerID, leagueID)
+		if err != nil {
+			return fmt.Errorf("vendedor %d no encontrado en liga %d", sellerID, leagueID)
+		}
+		if value > playerBudget(tx, bidder, commitmentOffer, itemType, itemID).Available {
+			return errNotEnoughMoney
+		}
+		if err := transferItemOwner(tx, item.Table, itemID, sellerID, bidderID, map[string]interface{}{
+			"bids":                    []byte("[]"),
+			"venta":                   nil,
+			"venta_expires_at":        nil,
+			"league_offer_value":      nil,
+			"league_offer_expires_at": nil,
+			"clausula_value":          nil,
+			"clausulatime":            nil,
+		}); err != nil {
+			return err
+		}
+		return moveMoney(tx, uint64(leagueID), &bidder, &seller, value, itemType, itemID, ledgerReasonPlayerOffer)
+	})
+}
+
+// acceptLeagueOffer vende un elemento a la liga por su oferta activa en una
+// única transacción: cobra la oferta, libera el elemento, lo quita de Owned*
+// y resta su valor del valor de equipo. Devuelve el importe cobrado.
+func acceptLeagueOffer(itemType string, itemID, userID uint) (float64, error) {
+	var amount float64
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		item, err := loadAuctionItem(tx, itemType, itemID)
+		if err != nil {
+			return err
+		}
+
+		// Releer la oferta con la fila bloqueada para no cobrarla dos veces
+		var offer struct {
+			OwnerID          uint
+			LeagueOfferValue *float64
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Table(item.Table).
+			Select("owner_id", "league_offer_value").Where("id = ?", itemID).Take(&offer).Error; err != nil {
+			return err
+		}
+		if offer.OwnerID != userID {
+			return errOwnerChanged
+		}
+		if offer.LeagueOfferValue == nil {
+			return errNoLeagueOffer
+		}
+		amount = *offer.LeagueOfferValue
+
+		playerLeague, err := lockPlayerLeague(tx, userID, item.LeagueID)
+		if err != nil {
+			return fmt.Errorf("jugador %d no encontrado en liga %d", userID, item.LeagueID)
+		}
+		if err := moveMoney(tx, playerLeague.LeagueID, nil, &playerLeague, amount, itemType, itemID, ledgerReasonLeagueOffer); err != nil {
+			return err
+		}
+		owned := ownedItemsField(&playerLeague, itemType)
+		*owned = removeOwnedItem(*owned, item.GlobalID)
+		playerLeague.TeamValue -= item.Value
+		if err := tx.Save(&playerLeague).Error; err != nil {
+			return err
+		}
+
+		if err := transferItemOwner(tx, item.Table, itemID, userID, 0, map[string]interface{}{
+			"venta":                   nil,
+			"venta_expires_at":        nil,
+			"league_offer_value":      nil,
+			"league_offer_expires_at": nil,
+		}); err != nil {
+			return err
+		}
+
+		// Guardar histórico de venta directa
+		if itemType == "pilot" {
+			return tx.Exec(`INSERT INTO pilot_value_history (pilot_id, pilot_by_league_id, league_id, player_id, valor_pagado, fecha, tipo, counterparty_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, item.GlobalID, item.ID, item.LeagueID, userID, amount, time.Now(), "venta", 0).Error
+		}
+		return nil
+	})
+	return amount, err
+}
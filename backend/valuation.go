@@ -0,0 +1,292 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"f1-fantasy-app/database"
+	"f1-fantasy-app/models"
+
+	"gorm.io/gorm"
+)
+
+// valuationTable describe dónde vive cada tipo de elemento: la tabla global con
+// el valor de mercado y la tabla por liga con la columna que apunta a ella
+type valuationTable struct {
+	Global       string
+	ByLeague     string
+	GlobalColumn string
+}
+
+var valuationTables = map[string]valuationTable{
+	"pilot":            {"pilots", models.PilotByLeague{}.TableName(), "pilot_id"},
+	"track_engineer":   {"track_engineers", models.TrackEngineerByLeague{}.TableName(), "track_engineer_id"},
+	"chief_engineer":   {"chief_engineers", models.ChiefEngineerByLeague{}.TableName(), "chief_engineer_id"},
+	"team_constructor": {models.TeamConstructor{}.TableName(), models.TeamConstructorByLeague{}.TableName(), "teamconstructor_id"},
+}
+
+// Motivos del libro mayor que cuentan como fichaje o como venta para la demanda
+var (
+	valuationBuyReasons  = []string{ledgerReasonAuction, ledgerReasonClausula, ledgerReasonPlayerOffer}
+	valuationSellReasons = []string{ledgerReasonLeagueOffer}
+)
+
+// valuationKey identifica un elemento global
+type valuationKey struct {
+	ItemType string
+	ItemID   uint
+}
+
+// defaultValuationConfig devuelve la configuración por defecto del motor de valoración
+func defaultValuationConfig() models.ValuationConfig {
+	return models.ValuationConfig{
+		Damping:        0.3,
+		DemandWeight:   0.1,
+		PointsWeight:   0.15,
+		RecentGPs:      3,
+		MaxDailyChange: 0.1,
+		FloorRatio:     0.5,
+		CeilingRatio:   2,
+	}
+}
+
+// loadValuationConfig carga la configuración del motor o la de por defecto
+func loadValuationConfig() models.ValuationConfig {
+	var cfg models.ValuationConfig
+	if err := database.DB.Order("id asc").First(&cfg).Error; err != nil {
+		return defaultValuationConfig()
+	}
+	return cfg
+}
+
+// validateValuationConfig comprueba que la configuración del motor sea coherente
+func validateValuationConfig(cfg models.ValuationConfig) error {
+	if cfg.Damping <= 0 || cfg.Damping > 1 {
+		return fmt.Errorf("damping debe estar entre 0 y 1")
+	}
+	if cfg.DemandWeight < 0 || cfg.PointsWeight < 0 {
+		return fmt.Errorf("los pesos no pueden ser negativos")
+	}
+	if cfg.RecentGPs < 1 || cfg.RecentGPs > 24 {
+		return fmt.Errorf("recent_gps debe estar entre 1 y 24")
+	}
+	if cfg.MaxDailyChange <= 0 || cfg.MaxDailyChange > 1 {
+		return fmt.Errorf("max_daily_change debe estar entre 0 y 1")
+	}
+	if cfg.FloorRatio <= 0 || cfg.FloorRatio > 1 || cfg.CeilingRatio < 1 {
+		return fmt.Errorf("floor_ratio debe estar entre 0 y 1 y ceiling_ratio ser al menos 1")
+	}
+	return nil
+}
+
+// recentGPIndexes devuelve los últimos n GPs con resultados de carrera
+func recentGPIndexes(n int) []uint64 {
+	var gpIndexes []uint64
+	database.DB.Model(&models.PilotRace{}).Distinct("gp_index").Order("gp_index desc").Limit(n).Pluck("gp_index", &gpIndexes)
+	return gpIndexes
+}
+
+// itemRecentPoints suma los puntos de un elemento global en los GPs indicados.
+// Los track engineers puntúan con sus pilotos y los chief engineers con su equipo.
+func itemRecentPoints(itemType string, globalID uint, gpIndexes []uint64) int {
+	if len(gpIndexes) == 0 {
+		return 0
+	}
+	sessionTables := []string{models.PilotRace{}.TableName(), models.PilotQualy{}.TableName(), models.PilotPractice{}.TableName()}
+	sumPilots := func(pilotIDs []uint) int {
+		total := 0
+		if len(pilotIDs) == 0 {
+			return 0
+		}
+		for _, table := range sessionTables {
+			var sum int
+			database.DB.Table(table).Where("pilot_id IN ? AND gp_index IN ?", pilotIDs, gpIndexes).Select("COALESCE(SUM(points), 0)").Scan(&sum)
+			total += sum
+		}
+		return total
+	}
+	sumTeam := func(team string) int {
+		var sum int
+		database.DB.Table(models.TeamRace{}.TableName()+" tr").
+			Joins("JOIN "+models.TeamConstructor{}.TableName()+" tc ON tc.id = tr.teamconstructor_id").
+			Where("tc.name = ? AND tr.gp_index IN ?", team, gpIndexes).
+			Select("COALESCE(SUM(tr.points), 0)").Scan(&sum)
+		return sum
+	}
+
+	switch itemType {
+	case "pilot":
+		return sumPilots([]uint{globalID})
+	case "track_engineer":
+		var pilotIDs []uint
+		database.DB.Model(&models.Pilot{}).Where("track_engineer_id = ?", globalID).Pluck("id", &pilotIDs)
+		return sumPilots(pilotIDs)
+	case "chief_engineer":
+		var ce models.ChiefEngineer
+		if err := database.DB.First(&ce, globalID).Error; err != nil {
+			return 0
+		}
+		return sumTeam(ce.Team)
+	case "team_constructor":
+		var tc models.TeamConstructor
+		if err := database.DB.First(&tc, globalID).Error; err != nil {
+			return 0
+		}
+		return sumTeam(tc.Name)
+	}
+	return 0
+}
+
+// transferDemand cuenta los fichajes menos las ventas de cada elemento global
+// desde since, a partir del libro mayor de todas las ligas
+func transferDemand(since time.Time) map[valuationKey]int {
+	demand := make(map[valuationKey]int)
+	count := func(reasons []string, direction string, sign int) {
+		var rows []struct {
+			ItemType string
+			ItemID   uint
+		}
+		database.DB.Model(&models.LedgerEntry{}).Select("item_type", "item_id").
+			Where("created_at > ? AND player_id != ? AND direction = ? AND reason IN ?", since, ledgerLeagueAccount, direction, reasons).
+			Find(&rows)
+		for _, row := range rows {
+			t, ok := valuationTables[row.ItemType]
+			if !ok {
+				continue
+			}
+			var globalID uint
+			database.DB.Table(t.ByLeague).Where("id = ?", row.ItemID).Select(t.GlobalColumn).Scan(&globalID)
+			if globalID != 0 {
+				demand[valuationKey{row.ItemType, globalID}] += sign
+			}
+		}
+	}
+	count(valuationBuyReasons, "debit", 1)
+	count(valuationSellReasons, "credit", -1)
+	return demand
+}
+
+// itemBaseValue devuelve el valor del elemento en su primera valoración, que
+// sirve de referencia para el suelo y el techo
+func itemBaseValue(itemType string, itemID uint, current float64) float64 {
+	var first models.ItemValuation
+	if err := database.DB.Where("item_type = ? AND item_id = ?", itemType, itemID).Order("day asc").First(&first).Error; err != nil {
+		return current
+	}
+	return first.BaseValue
+}
+
+// nextItemValue calcula el nuevo valor de un elemento. El objetivo combina la
+// demanda neta por liga y los puntos recientes frente a la media de su tipo; el
+// valor se acerca al objetivo según damping, con variación diaria máxima y
+// entre suelo y techo.
+func nextItemValue(cfg models.ValuationConfig, current, base float64, netPerLeague, pointsRatio float64) (float64, float64) {
+	demandFactor := 1 + cfg.DemandWeight*math.Max(-1, math.Min(1, netPerLeague))
+	pointsFactor := 1 + cfg.PointsWeight*math.Max(-1, math.Min(1, pointsRatio-1))
+	target := current * demandFactor * pointsFactor
+
+	next := current + cfg.Damping*(target-current)
+	maxStep := current * cfg.MaxDailyChange
+	next = math.Max(current-maxStep, math.Min(current+maxStep, next))
+	next = math.Max(base*cfg.FloorRatio, math.Min(base*cfg.CeilingRatio, next))
+	return target, math.Round(next*100) / 100
+}
+
+// runValuation revaloriza los cuatro tipos de elemento y guarda una valoración
+// por elemento y día. Si ya existe la del día se recalcula desde el mismo valor
+// de partida, por lo que repetirla no acumula cambios.
+func runValuation(now time.Time) (int, error) {
+	cfg := loadValuationConfig()
+	day := now.Format("2006-01-02")
+	gpIndexes := recentGPIndexes(cfg.RecentGPs)
+	demand := transferDemand(now.Add(-24 * time.Hour))
+
+	var leagueCount int64
+	database.DB.Model(&models.League{}).Count(&leagueCount)
+	if leagueCount == 0 {
+		leagueCount = 1
+	}
+
+	updated := 0
+	for _, itemType := range marketItemTypes {
+		t := valuationTables[itemType]
+		var items []struct {
+			ID    uint
+			Value float64
+		}
+		if err := database.DB.Table(t.Global).Select("id", "value").Find(&items).Error; err != nil {
+			return updated, fmt.Errorf("cargando %s: %v", t.Global, err)
+		}
+		if len(items) == 0 {
+			continue
+		}
+
+		points := make([]int, len(items))
+		totalPoints := 0
+		for i, item := range items {
+			points[i] = itemRecentPoints(itemType, item.ID, gpIndexes)
+			totalPoints += points[i]
+		}
+		avgPoints := float64(totalPoints) / float64(len(items))
+
+		for i, item := range items {
+			// Si ya se valoró hoy, se repite desde el valor anterior a esa valoración
+			var existing models.ItemValuation
+			if err := database.DB.Where("item_type = ? AND item_id = ? AND day = ?", itemType, item.ID, day).First(&existing).Error; err == nil {
+				item.Value = existing.OldValue
+			}
+			if item.Value <= 0 {
+				continue
+			}
+			pointsRatio := 1.0
+			if avgPoints > 0 {
+				pointsRatio = float64(points[i]) / avgPoints
+			}
+			net := demand[valuationKey{itemType, item.ID}]
+			base := itemBaseValue(itemType, item.ID, item.Value)
+			target, newValue := nextItemValue(cfg, item.Value, base, float64(net)/float64(leagueCount), pointsRatio)
+
+			valuation := models.ItemValuation{
+				ItemType:     itemType,
+				ItemID:       item.ID,
+				Day:          day,
+				BaseValue:    base,
+				OldValue:     item.Value,
+				TargetValue:  target,
+				NewValue:     newValue,
+				NetTransfers: net,
+				RecentPoints: points[i],
+			}
+			valuation.ID, valuation.CreatedAt = existing.ID, existing.CreatedAt
+			err := database.DB.Transaction(func(tx *gorm.DB) error {
+				return applyItemValuation(tx, t, itemType, &valuation)
+			})
+			if err != nil {
+				log.Printf("[VALUATION] Error valorando %s %d: %v", itemType, item.ID, err)
+				continue
+			}
+			updated++
+		}
+	}
+	log.Printf("[VALUATION] %d elementos revalorizados para el día %s", updated, day)
+	return updated, nil
+}
+
+// applyItemValuation guarda el nuevo valor y la valoración del día, que es
+// también el punto de la serie de valores. Las cláusulas de cada liga no se tocan.
+func applyItemValuation(tx *gorm.DB, t valuationTable, itemType string, valuation *models.ItemValuation) error {
+	if err := tx.Save(valuation).Error; err != nil {
+		return err
+	}
+	if err := tx.Table(t.Global).Where("id = ?", valuation.ItemID).Update("value", valuation.NewValue).Error; err != nil {
+		return err
+	}
+	if itemType == "pilot" {
+		if err := tx.Table(t.Global).Where("id = ?", valuation.ItemID).Update("ventas7fichajes", valuation.NetTransfers).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
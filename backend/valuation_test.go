@@ -0,0 +1,45 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNextItemValue(t *testing.T) {
+	cfg := defaultValuationConfig()
+	steep := cfg
+	steep.Damping = 1
+	steep.DemandWeight = 0.5
+
+	tests := []struct {
+		name                 string
+		current, base        float64
+		net, ratio           float64
+		wantTarget, wantNext float64
+		steep                bool
+	}{
+		{"sin demanda ni forma", 100, 100, 0, 1, 100, 100, false},
+		{"demanda positiva", 100, 100, 1, 1, 110, 103, false},
+		{"demanda acotada a 1", 100, 100, 5, 1, 110, 103, false},
+		{"demanda negativa", 100, 100, -1, 1, 90, 97, false},
+		{"buena forma", 100, 100, 0, 2, 115, 104.5, false},
+		{"variación diaria máxima", 100, 100, 1, 1, 150, 110, true},
+		{"suelo", 51, 100, -1, 0, 51 * 0.9 * 0.85, 50, false},
+		{"techo", 199, 100, 1, 3, 199 * 1.1 * 1.15, 200, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := cfg
+			if tt.steep {
+				c = steep
+			}
+			target, next := nextItemValue(c, tt.current, tt.base, tt.net, tt.ratio)
+			if math.Abs(target-tt.wantTarget) > 1e-9 {
+				t.Errorf("objetivo = %v, want %v", target, tt.wantTarget)
+			}
+			if next != tt.wantNext {
+				t.Errorf("valor = %v, want %v", next, tt.wantNext)
+			}
+		})
+	}
+}
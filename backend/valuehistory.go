@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"f1-fantasy-app/database"
+	"f1-fantasy-app/models"
+)
+
+// Formato de los días de la serie de valores
+const valueHistoryDayLayout = "2006-01-02"
+
+// Rango por defecto de la serie si no se indica from
+const defaultValueHistoryDays = 90
+
+// valuePoint es el valor de un elemento al cierre de un día. La serie sale de
+// las valoraciones diarias (item_valuations).
+type valuePoint struct {
+	Day   string  `json:"day"`
+	Value float64 `json:"value"`
+}
+
+// parseValueHistoryRange interpreta los parámetros from/to (YYYY-MM-DD)
+func parseValueHistoryRange(from, to string) (string, string, error) {
+	now := time.Now()
+	if to == "" {
+		to = now.Format(valueHistoryDayLayout)
+	} else if _, err := time.Parse(valueHistoryDayLayout, to); err != nil {
+		return "", "", fmt.Errorf("to debe tener formato YYYY-MM-DD")
+	}
+	if from == "" {
+		from = now.AddDate(0, 0, -defaultValueHistoryDays).Format(valueHistoryDayLayout)
+	} else if _, err := time.Parse(valueHistoryDayLayout, from); err != nil {
+		return "", "", fmt.Errorf("from debe tener formato YYYY-MM-DD")
+	}
+	if from > to {
+		return "", "", fmt.Errorf("from no puede ser posterior a to")
+	}
+	return from, to, nil
+}
+
+// itemValueHistory devuelve los puntos diarios de un elemento entre from y to (incluidos)
+func itemValueHistory(itemType string, itemID uint, from, to string) ([]valuePoint, error) {
+	points := []valuePoint{}
+	err := database.DB.Model(&models.ItemValuation{}).Select("day", "new_value AS value").
+		Where("item_type = ? AND item_id = ? AND day BETWEEN ? AND ?", itemType, itemID, from, to).
+		Order("day asc").Scan(&points).Error
+	return points, err
+}
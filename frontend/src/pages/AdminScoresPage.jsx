@@ -9,6 +9,10 @@ import { Input } from '../components/ui/input';
 // Icons
 import { Settings, ArrowLeft, Save, X, Trophy, Flag, Timer, RotateCcw, Download } from 'lucide-react';
 
+// Sondeo del trabajo del scraper: cada 2 segundos, como mucho 5 minutos
+const SCRAPER_POLL_INTERVAL_MS = 2000;
+const SCRAPER_POLL_MAX_ATTEMPTS = 150;
+
 export default function AdminScoresPage() {
   const [step, setStep] = useState(0); // 0: elegir GP, 1: elegir tipo, 2: elegir modo, 3: posiciones esperadas
   const [sessionType, setSessionType] = useState('');
@@ -27,8 +31,6 @@ export default function AdminScoresPage() {
   const [calculatedPoints, setCalculatedPoints] = useState(0);
   const [expectedPositionForCalc, setExpectedPositionForCalc] = useState(0);
   const [isUpdatingLineupPoints, setIsUpdatingLineupPoints] = useState(false);
-  const [isResettingLineupPoints, setIsResettingLineupPoints] = useState(false);
-  const [isClearingLineupPoints, setIsClearingLineupPoints] = useState(false);
   const [selectedGPForPoints, setSelectedGPForPoints] = useState('');
   
   // Estados para posiciones de equipos
@@ -578,9 +580,7 @@ export default function AdminScoresPage() {
 
     setIsUpdatingLineupPoints(true);
     try {
-      // Obtener el league_id del localStorage o de algún contexto
-      const leagueId = localStorage.getItem('currentLeagueId') || '1'; // Default a 1 si no hay
-      
+      // El backend repuntúa el GP completo; se puede repetir sin duplicar puntos
       const response = await fetch('/api/admin/update-lineup-points', {
         method: 'POST',
         headers: {
@@ -588,133 +588,6 @@ export default function AdminScoresPage() {
           'Authorization': `Bearer ${localStorage.getItem('token')}`
         },
         body: JSON.stringify({
-          league_id: parseInt(leagueId),
-          gp_index: parseInt(selectedGPForPoints)
-        })
-      });
-
-      const data = await response.json();
-      
-      if (response.ok) {
-        let severity = 'success';
-        let message = `✅ ${data.message}`;
-        
-        // Si hay alineaciones que ya tenían puntos calculados, mostrar como warning
-        if (data.already_calculated_count && data.already_calculated_count > 0) {
-          severity = 'warning';
-          message = `⚠️ ${data.message}`;
-        }
-        
-        setSnackbar({ 
-          open: true, 
-          message: message, 
-          severity: severity 
-        });
-      } else {
-        // Manejar específicamente el error de puntos ya calculados
-        if (data.error && data.error.includes('ya tienen puntos calculados')) {
-          setSnackbar({ 
-            open: true, 
-            message: `⚠️ ${data.error}`, 
-            severity: 'warning' 
-          });
-        } else {
-          setSnackbar({ 
-            open: true, 
-            message: `❌ Error: ${data.error}`, 
-            severity: 'error' 
-          });
-        }
-      }
-    } catch (error) {
-      console.error('Error updating lineup points:', error);
-      setSnackbar({ 
-        open: true, 
-        message: '❌ Error de conexión', 
-        severity: 'error' 
-      });
-    } finally {
-      setIsUpdatingLineupPoints(false);
-    }
-  };
-
-  const handleResetLineupPoints = async () => {
-    if (!selectedGPForPoints) {
-      setSnackbar({ open: true, message: 'Por favor selecciona un Grand Prix para resetear puntos', severity: 'error' });
-      return;
-    }
-
-    // Confirmar antes de resetear
-    if (!window.confirm(`¿Estás seguro de que quieres resetear todos los puntos de alineaciones para el GP ${selectedGPForPoints}? Esta acción no se puede deshacer.`)) {
-      return;
-    }
-
-    setIsResettingLineupPoints(true);
-    try {
-      const leagueId = localStorage.getItem('currentLeagueId') || '1';
-      
-      const response = await fetch('/api/admin/reset-lineup-points', {
-        method: 'POST',
-        headers: {
-          'Content-Type': 'application/json',
-          'Authorization': `Bearer ${localStorage.getItem('token')}`
-        },
-        body: JSON.stringify({
-          league_id: parseInt(leagueId),
-          gp_index: parseInt(selectedGPForPoints)
-        })
-      });
-
-      const data = await response.json();
-      
-      if (response.ok) {
-        setSnackbar({ 
-          open: true, 
-          message: `✅ ${data.message}`, 
-          severity: 'success' 
-        });
-      } else {
-        setSnackbar({ 
-          open: true, 
-          message: `❌ Error: ${data.error}`, 
-          severity: 'error' 
-        });
-      }
-    } catch (error) {
-      console.error('Error resetting lineup points:', error);
-      setSnackbar({ 
-        open: true, 
-        message: '❌ Error de conexión', 
-        severity: 'error' 
-      });
-    } finally {
-      setIsResettingLineupPoints(false);
-    }
-  };
-
-  const handleClearLineupPoints = async () => {
-    if (!selectedGPForPoints) {
-      setSnackbar({ open: true, message: 'Por favor selecciona un Grand Prix para limpiar puntos', severity: 'error' });
-      return;
-    }
-
-    // Confirmar antes de limpiar
-    if (!window.confirm(`¿Estás seguro de que quieres LIMPIAR TODOS los puntos de alineaciones para el GP ${selectedGPForPoints}? Esta acción es irreversible y eliminará todos los puntos calculados.`)) {
-      return;
-    }
-
-    setIsClearingLineupPoints(true);
-    try {
-      const leagueId = localStorage.getItem('currentLeagueId') || '1';
-      
-      const response = await fetch('/api/admin/reset-lineup-points', {
-        method: 'POST',
-        headers: {
-          'Content-Type': 'application/json',
-          'Authorization': `Bearer ${localStorage.getItem('token')}`
-        },
-        body: JSON.stringify({
-          league_id: parseInt(leagueId),
           gp_index: parseInt(selectedGPForPoints)
         })
       });
@@ -735,14 +608,14 @@ export default function AdminScoresPage() {
         });
       }
     } catch (error) {
-      console.error('Error clearing lineup points:', error);
+      console.error('Error updating lineup points:', error);
       setSnackbar({ 
         open: true, 
         message: '❌ Error de conexión', 
         severity: 'error' 
       });
     } finally {
-      setIsClearingLineupPoints(false);
+      setIsUpdatingLineupPoints(false);
     }
   };
 
@@ -1141,16 +1014,48 @@ export default function AdminScoresPage() {
           'Authorization': `Bearer ${localStorage.getItem('token')}`
         },
         body: JSON.stringify({
-          gp_key: selectedGPForScraper
+          gp_key: selectedGPForScraper,
+          // Confirmado en el modal: aplicar los resultados en vez de dejar una importación pendiente
+          dry_run: false
         })
       });
 
       const data = await response.json();
       
       if (response.ok) {
+        // El scraper corre en segundo plano: esperar a que termine el trabajo (máx. 5 minutos)
+        let job = data.job;
+        let attempts = 0;
+        while (job && (job.status === 'queued' || job.status === 'running')) {
+          if (attempts >= SCRAPER_POLL_MAX_ATTEMPTS) {
+            setScraperSnackbar({ 
+              open: true, 
+              message: `⏳ El scraper sigue en curso (trabajo #${data.job_id}); consulta el historial más tarde`, 
+              severity: 'error' 
+            });
+            setTimeout(() => setScraperSnackbar({ open: false, message: '', severity: 'error' }), 5000);
+            return;
+          }
+          attempts++;
+          await new Promise(resolve => setTimeout(resolve, SCRAPER_POLL_INTERVAL_MS));
+          const jobResponse = await fetch(`/api/admin/scraper-jobs/${data.job_id}`, {
+            headers: { 'Authorization': `Bearer ${localStorage.getItem('token')}` }
+          });
+          if (!jobResponse.ok) break;
+          job = (await jobResponse.json()).job;
+        }
+        if (job && job.status === 'failed') {
+          setScraperSnackbar({ 
+            open: true, 
+            message: `❌ Error: ${job.error}`, 
+            severity: 'error' 
+          });
+          setTimeout(() => setScraperSnackbar({ open: false, message: '', severity: 'error' }), 5000);
+          return;
+        }
         setScraperSnackbar({ 
           open: true, 
-          message: `✅ ${data.message} - GP: ${data.gp_key}`, 
+          message: `✅ Scraper completado - GP: ${data.gp_key} (${job ? job.rows_saved : 0} registros guardados)`, 
           severity: 'success' 
         });
         setTimeout(() => setScraperSnackbar({ open: false, message: '', severity: 'success' }), 5000);
@@ -1345,24 +1250,6 @@ export default function AdminScoresPage() {
                         <Save className="h-6 w-6" />
                         {isUpdatingLineupPoints ? 'Actualizando...' : 'Actualizar Puntos Jugadores'}
                       </Button>
-                      <Button
-                        onClick={handleResetLineupPoints}
-                        disabled={isResettingLineupPoints}
-                        variant="ghost"
-                        className="w-full flex items-center justify-center gap-3 py-3 text-small text-state-warning hover:bg-state-warning/10 border border-state-warning/20"
-                      >
-                        <X className="h-5 w-5" />
-                        {isResettingLineupPoints ? 'Reseteando...' : 'Resetear Puntos'}
-                      </Button>
-                      <Button
-                        onClick={handleClearLineupPoints}
-                        disabled={isClearingLineupPoints}
-                        variant="ghost"
-                        className="w-full flex items-center justify-center gap-3 py-3 text-small text-state-error hover:bg-state-error/10 border border-state-error/20"
-                      >
-                        <X className="h-5 w-5" />
-                        {isClearingLineupPoints ? 'Limpiando...' : 'Limpiar Puntos'}
-                      </Button>
                     </div>
                   )}
                 </div>
@@ -134,12 +134,14 @@ export default function AuctionPilotBidPage() {
       // Si no existe subasta, crearla y añadir la puja
       let res = await fetch('/api/auctions/bid', {
         method: 'POST',
-        headers: { 'Content-Type': 'application/json' },
+        headers: {
+          'Content-Type': 'application/json',
+          'Authorization': `Bearer ${localStorage.getItem('token')}`
+        },
         body: JSON.stringify({
           item_type: 'pilot',
           item_id: Number(id),
           league_id: Number(selectedLeague.id),
-          player_id: Number(player_id),
           valor: Number(amount)
         })
       });
@@ -149,12 +149,14 @@ export default function AuctionTeamBidPage() {
     try {
       let res = await fetch('/api/auctions/bid', {
         method: 'POST',
-        headers: { 'Content-Type': 'application/json' },
+        headers: {
+          'Content-Type': 'application/json',
+          'Authorization': `Bearer ${localStorage.getItem('token')}`
+        },
         body: JSON.stringify({
           item_type: 'team_constructor',
           item_id: Number(id),
           league_id: Number(selectedLeague.id),
-          player_id: Number(player_id),
           valor: Number(amount)
         })
       });
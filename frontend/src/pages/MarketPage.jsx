@@ -539,11 +539,13 @@ export default function MarketPage() {
       
       const res = await fetch('/api/auctions/bid', {
         method: 'POST',
-        headers: { 'Content-Type': 'application/json' },
+        headers: {
+          'Content-Type': 'application/json',
+          'Authorization': `Bearer ${localStorage.getItem('token')}`
+        },
         body: JSON.stringify({
           item_type: itemType,
           item_id: selectedPilot.id,
-          player_id: user.id,
           league_id: selectedLeague.id,
           valor: Number(puja)
         })
@@ -1001,7 +1003,6 @@ export default function MarketPage() {
         body: JSON.stringify({
           item_type: itemType,
           item_id: selectedBidPilot.id,
-          player_id: user.id,
           league_id: selectedLeague.id,
           valor: Number(editBidValue)
         })
@@ -1478,7 +1479,7 @@ export default function MarketPage() {
   // Fetch market refresh timer
   const fetchNextRefresh = async () => {
     try {
-      const response = await fetch('/api/market/next-refresh');
+      const response = await fetch(`/api/market/next-refresh?league_id=${selectedLeague.id}`);
       const data = await response.json();
       setNextRefresh(data.next_refresh * 1000); // convert to ms
     } catch (err) {